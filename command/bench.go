@@ -0,0 +1,98 @@
+package command
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/codegangsta/cli"
+	. "github.com/timakin/gopli/constants"
+	database "github.com/timakin/gopli/database"
+	. "github.com/timakin/gopli/lib"
+)
+
+// CmdBench supports `bench` command in CLI
+func CmdBench(c *cli.Context) {
+	// Enable multi core setting
+	SetupMultiCore()
+
+	// Load tomlConfig
+	tmlconf := LoadTomlConf(c.String("config"))
+	applyEnvHostDefaults(c)
+	defer database.CloseConnections()
+
+	from := c.String("from")
+	dbConf, sshConf := tmlconf.Database[from], tmlconf.SSH[from]
+	if c.String("compression") != "" {
+		dbConf.Compression = c.String("compression")
+	}
+
+	tables := c.StringSlice("table")
+	if len(tables) == 0 {
+		tables = PickSampleTables(fetchTableStats(tmlconf, from), c.Int("sample"))
+	}
+	if len(tables) == 0 {
+		panic(T("No tables to benchmark"))
+	}
+	log.Print("[Bench] benchmarking with " + strings.Join(tables, ", "))
+
+	var results []BenchResult
+	for _, concurrency := range parseConcurrencies(c.String("concurrency")) {
+		log.Printf("[Bench] fetching with %d sessions...", concurrency)
+		result := benchFetch(tmlconf.Workspace, dbConf, sshConf, tables, concurrency)
+		log.Printf("[Bench] fetched %s in %s", HumanBytes(result.Bytes), result.Duration)
+		results = append(results, result)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "CONCURRENCY\tDURATION\tSIZE\tTHROUGHPUT")
+	for _, result := range results {
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s/s\n", result.Concurrency, result.Duration, HumanBytes(result.Bytes), HumanBytes(int64(result.Throughput())))
+	}
+	w.Flush()
+
+	best := RecommendConcurrency(results)
+	fmt.Printf("\nRecommended: concurrency = %d in [database.%s]\n", best.Concurrency, from)
+}
+
+func benchFetch(wsConf WorkspaceConf, dbConf Database, sshConf SSH, tables []string, concurrency int) BenchResult {
+	ws, err := NewWorkspace(TMP_DIR_PREFIX, wsConf)
+	if err != nil {
+		panic(fmt.Errorf("%s%w", T("Failed to create working directory: "), err))
+	}
+	defer ws.Remove()
+
+	dbConf.Concurrency = concurrency
+	fetcher, err := database.CreateFetcher(dbConf, sshConf, ws, database.FetchOptions{Tables: tables})
+	if err != nil {
+		panic(fmt.Errorf("%s%w", T("Failed to create fetcher instance: "), err))
+	}
+
+	start := time.Now()
+	if err := fetcher.Fetch(); err != nil {
+		panic(fmt.Errorf("%s%w", T("Failed to fetch: "), err))
+	}
+	duration := time.Since(start)
+
+	size, err := ws.DumpSize()
+	if err != nil {
+		panic(fmt.Errorf("%s%w", T("Failed to measure dumps: "), err))
+	}
+	return BenchResult{Concurrency: concurrency, Duration: duration, Bytes: size}
+}
+
+func parseConcurrencies(list string) []int {
+	var concurrencies []int
+	for _, value := range strings.Split(list, ",") {
+		concurrency, err := strconv.Atoi(strings.TrimSpace(value))
+		if err != nil || concurrency <= 0 {
+			panic(T("Invalid concurrency: ") + value)
+		}
+		concurrencies = append(concurrencies, concurrency)
+	}
+	return concurrencies
+}
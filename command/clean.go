@@ -0,0 +1,28 @@
+package command
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/codegangsta/cli"
+	. "github.com/timakin/gopli/lib"
+)
+
+// CmdClean supports `clean` command in CLI
+func CmdClean(c *cli.Context) {
+	log.Print("[Clean] looking for stale temporary directories...")
+	dirs, err := FindStaleTmpDirs(TmpDirPattern(), c.Duration("older-than"))
+	if err != nil {
+		panic(fmt.Errorf("%s%w", T("Failed to find temporary directories: "), err))
+	}
+
+	for _, dir := range dirs {
+		if c.Bool("dry-run") {
+			log.Print("\t[Clean] would remove " + dir)
+			continue
+		}
+		log.Print("\t[Clean] removing " + dir)
+		DeleteTmpDir(dir)
+	}
+	log.Printf("[Clean] found %d stale temporary directories", len(dirs))
+}
@@ -0,0 +1,18 @@
+package command
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/codegangsta/cli"
+	. "github.com/timakin/gopli/lib"
+)
+
+// CmdConfigSchema supports `config-schema` command in CLI
+func CmdConfigSchema(c *cli.Context) {
+	schemaBytes, err := json.MarshalIndent(ConfigSchema(), "", "  ")
+	if err != nil {
+		panic(err)
+	}
+	fmt.Println(string(schemaBytes))
+}
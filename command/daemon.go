@@ -0,0 +1,274 @@
+package command
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/codegangsta/cli"
+	. "github.com/timakin/gopli/constants"
+	database "github.com/timakin/gopli/database"
+	. "github.com/timakin/gopli/lib"
+)
+
+// CmdDaemon supports `daemon` command in CLI
+func CmdDaemon(c *cli.Context) {
+	health := &Health{}
+	drift := &schemaDriftGuard{}
+
+	switch c.String("on-schema-drift") {
+	case SCHEMA_DRIFT_IGNORE, SCHEMA_DRIFT_PAUSE:
+	default:
+		panic(T("Unknown schema drift policy: ") + c.String("on-schema-drift"))
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", health.ServeHealthz)
+	mux.HandleFunc("/readyz", health.ServeReadyz)
+	mux.HandleFunc("/resume", resumeHandler(c.String("resume-token"), health, drift))
+	go func() {
+		log.Print("[Daemon] serving health checks on " + c.String("listen"))
+		if err := http.ListenAndServe(c.String("listen"), mux); err != nil {
+			log.Fatalf("[Daemon] health check server stopped: %v", err)
+		}
+	}()
+
+	// SIGTERM lets the current run finish, a second signal exits immediately.
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, syscall.SIGTERM, syscall.SIGINT)
+
+	done := make(chan error, 1)
+	deferrals := &peakDeferrals{}
+	timer := time.NewTimer(0)
+	for {
+		select {
+		case <-timer.C:
+			if !checkSchemaDrift(c, health, drift) {
+				timer.Reset(c.Duration("interval"))
+				continue
+			}
+			if !checkSourceLoad(c) {
+				if deferrals.Postpone(c.Int("max-deferrals")) {
+					log.Print("[Daemon] retrying in " + c.Duration("peak-retry").String())
+					timer.Reset(c.Duration("peak-retry"))
+					continue
+				}
+				log.Printf("[Daemon] postponed %d times in a row, starting the run anyway", c.Int("max-deferrals"))
+			}
+			deferrals.Reset()
+			health.RunStarted()
+			go func() {
+				done <- runScheduledSync(c)
+			}()
+		case err := <-done:
+			health.RunFinished(err)
+			if err != nil {
+				log.Print("[Daemon] run failed: " + err.Error())
+			}
+			log.Print("[Daemon] next run in " + c.Duration("interval").String())
+			timer.Reset(c.Duration("interval"))
+		case sig := <-signals:
+			log.Print("[Daemon] received " + sig.String())
+			if !health.Running() {
+				return
+			}
+			log.Print("[Daemon] waiting for the current run to finish...")
+			select {
+			case err := <-done:
+				health.RunFinished(err)
+			case <-signals:
+				log.Print("[Daemon] exiting without waiting")
+				RestoreTerminal()
+				database.RestoreDestinations()
+				os.Exit(1)
+			}
+			return
+		}
+	}
+}
+
+// resumeHandler serves /resume, which resumes paused scheduled runs. With a
+// token, only requests carrying it as a bearer token are accepted.
+func resumeHandler(token string, health *Health, drift *schemaDriftGuard) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		if token != "" && subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), []byte("Bearer "+token)) != 1 {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		// The schema seen by the next run becomes the new baseline.
+		drift.Reset()
+		health.Resume()
+		log.Print("[Daemon] resumed")
+		w.Write([]byte("resumed\n"))
+	}
+}
+
+// recoveredError returns the error a command panicked with, keeping its
+// causes for errors.Is and errors.As.
+func recoveredError(recovered interface{}) error {
+	if err, ok := recovered.(error); ok {
+		return err
+	}
+	return fmt.Errorf("%v", recovered)
+}
+
+// runScheduledSync runs a single sync, turning a panic into an error too so
+// the daemon keeps its schedule.
+func runScheduledSync(c *cli.Context) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = recoveredError(r)
+		}
+	}()
+	return syncFromConfig(c)
+}
+
+// schemaDriftGuard remembers the source schema fingerprint the scheduled runs
+// were started with.
+type schemaDriftGuard struct {
+	mu          sync.Mutex
+	fingerprint string
+}
+
+// Changed records fingerprint as the baseline if there is none yet, and
+// reports whether it differs from the baseline otherwise.
+func (guard *schemaDriftGuard) Changed(fingerprint string) bool {
+	guard.mu.Lock()
+	defer guard.mu.Unlock()
+	if guard.fingerprint == "" {
+		guard.fingerprint = fingerprint
+		return false
+	}
+	return guard.fingerprint != fingerprint
+}
+
+// Reset forgets the baseline.
+func (guard *schemaDriftGuard) Reset() {
+	guard.mu.Lock()
+	defer guard.mu.Unlock()
+	guard.fingerprint = ""
+}
+
+// checkSchemaDrift applies the --on-schema-drift policy and reports whether
+// the scheduled run may start.
+func checkSchemaDrift(c *cli.Context, health *Health, drift *schemaDriftGuard) bool {
+	if health.Paused() {
+		log.Print("[Daemon] paused, skipping the scheduled run (POST /resume to continue)")
+		return false
+	}
+	if c.String("on-schema-drift") != SCHEMA_DRIFT_PAUSE {
+		return true
+	}
+
+	fingerprint, err := sourceSchemaFingerprint(c)
+	if err != nil {
+		// The run itself reports connection problems.
+		log.Print("[Daemon] failed to inspect the source schema: " + err.Error())
+		return true
+	}
+	if !drift.Changed(fingerprint) {
+		return true
+	}
+
+	reason := "the schema of " + c.String("from") + " changed"
+	log.Print("[Daemon] " + reason + ", pausing scheduled runs (POST /resume to continue)")
+	health.Pause(reason)
+	if c.String("notify-url") != "" {
+		err := Notify(c.String("notify-url"), Notification{
+			Event:   "schema_drift",
+			From:    c.String("from"),
+			To:      c.String("to"),
+			Message: reason + ", scheduled runs are paused",
+			At:      time.Now(),
+		})
+		if err != nil {
+			log.Print("[Daemon] failed to send notification: " + err.Error())
+		}
+	}
+	return false
+}
+
+// checkSourceLoad applies --defer-on-peak and reports whether the scheduled
+// run may start.
+func checkSourceLoad(c *cli.Context) bool {
+	if !c.Bool("defer-on-peak") || c.Duration("sample-load") <= 0 {
+		return true
+	}
+	reason, err := sourceLoadPeak(c)
+	if err != nil {
+		// The run itself reports connection problems.
+		log.Print("[Daemon] failed to sample the source load: " + err.Error())
+		return true
+	}
+	if reason == "" {
+		return true
+	}
+	log.Print("[Daemon] the source appears to be at peak load (" + reason + "), postponing the scheduled run")
+	return false
+}
+
+// peakDeferrals counts the consecutive runs postponed by --defer-on-peak, so a
+// source that stays at peak load cannot hold off the sync forever.
+type peakDeferrals struct {
+	count int
+}
+
+// Postpone reports whether the run may be postponed once more, given at most
+// max consecutive deferrals. A max of 0 or less means no limit.
+func (d *peakDeferrals) Postpone(max int) bool {
+	if max > 0 && d.count >= max {
+		return false
+	}
+	d.count++
+	return true
+}
+
+// Reset starts counting again once a run starts.
+func (d *peakDeferrals) Reset() {
+	d.count = 0
+}
+
+func sourceLoadPeak(c *cli.Context) (reason string, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = recoveredError(r)
+		}
+	}()
+	tmlconf := LoadTomlConf(c.String("config"))
+	applyEnvHostDefaults(c)
+	defer database.CloseConnections()
+
+	dbConf := tmlconf.Database[c.String("from")]
+	fetcher, err := database.CreateFetcher(dbConf, tmlconf.SSH[c.String("from")], nil, database.FetchOptions{})
+	if err != nil {
+		return "", err
+	}
+	return sourcePeakReason(fetcher, dbConf, c.Duration("sample-load")), nil
+}
+
+func sourceSchemaFingerprint(c *cli.Context) (fingerprint string, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = recoveredError(r)
+		}
+	}()
+	tmlconf := LoadTomlConf(c.String("config"))
+	applyEnvHostDefaults(c)
+	defer database.CloseConnections()
+
+	fetcher, err := database.CreateFetcher(tmlconf.Database[c.String("from")], tmlconf.SSH[c.String("from")], nil, database.FetchOptions{})
+	if err != nil {
+		return "", err
+	}
+	return fetcher.SchemaFingerprint()
+}
@@ -0,0 +1,82 @@
+package command
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	. "github.com/timakin/gopli/lib"
+)
+
+func TestResumeHandler(t *testing.T) {
+	for _, c := range []struct {
+		token         string
+		method        string
+		authorization string
+		status        int
+	}{
+		{"", http.MethodGet, "", http.StatusMethodNotAllowed},
+		{"", http.MethodPost, "", http.StatusOK},
+		{"s3cret", http.MethodPost, "", http.StatusUnauthorized},
+		{"s3cret", http.MethodPost, "Bearer wrong", http.StatusUnauthorized},
+		{"s3cret", http.MethodPost, "Bearer s3cret", http.StatusOK},
+	} {
+		health := &Health{}
+		health.Pause("the schema changed")
+		drift := &schemaDriftGuard{}
+		drift.Changed("baseline")
+
+		req := httptest.NewRequest(c.method, "/resume", nil)
+		if c.authorization != "" {
+			req.Header.Set("Authorization", c.authorization)
+		}
+		rec := httptest.NewRecorder()
+		resumeHandler(c.token, health, drift)(rec, req)
+		if rec.Code != c.status {
+			t.Errorf("%s with token %q and %q: expected %d, got %d", c.method, c.token, c.authorization, c.status, rec.Code)
+		}
+		resumed := c.status == http.StatusOK
+		if health.Paused() == resumed {
+			t.Errorf("%s with token %q and %q: expected paused %v", c.method, c.token, c.authorization, !resumed)
+		}
+		// A resumed daemon takes the next schema as its baseline.
+		if drift.Changed("new") == resumed {
+			t.Errorf("%s with token %q and %q: expected the baseline reset %v", c.method, c.token, c.authorization, resumed)
+		}
+	}
+}
+
+func TestRecoveredError(t *testing.T) {
+	err := recoveredError(fmt.Errorf("%s%w", T("Failed to fetch: "), ErrNoTables))
+	if !errors.Is(err, ErrNoTables) {
+		t.Errorf("expected the cause to be kept, got %v", err)
+	}
+	if err := recoveredError("Unknown online schema change tool"); err.Error() != "Unknown online schema change tool" {
+		t.Errorf("unexpected error %v", err)
+	}
+}
+
+func TestPeakDeferrals(t *testing.T) {
+	deferrals := &peakDeferrals{}
+	for i := 0; i < 3; i++ {
+		if !deferrals.Postpone(3) {
+			t.Fatalf("deferral %d was refused", i+1)
+		}
+	}
+	if deferrals.Postpone(3) {
+		t.Error("a fourth deferral was allowed with a limit of 3")
+	}
+	deferrals.Reset()
+	if !deferrals.Postpone(3) {
+		t.Error("deferrals were still refused after a run started")
+	}
+
+	unlimited := &peakDeferrals{}
+	for i := 0; i < 100; i++ {
+		if !unlimited.Postpone(0) {
+			t.Fatalf("deferral %d was refused without a limit", i+1)
+		}
+	}
+}
@@ -0,0 +1,42 @@
+package command
+
+import (
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/codegangsta/cli"
+	database "github.com/timakin/gopli/database"
+	. "github.com/timakin/gopli/lib"
+)
+
+// CmdDoctor supports `doctor` command in CLI
+func CmdDoctor(c *cli.Context) {
+	// Load tomlConfig
+	tmlconf := LoadTomlConf(c.String("config"))
+	applyEnvHostDefaults(c)
+	defer database.CloseConnections()
+	if err := applyPreviewNames(c, tmlconf); err != nil {
+		panic(err)
+	}
+
+	host := c.String("to")
+	log.Print("[Doctor] checking " + host + " for settings left behind by loads...")
+	inserter, err := database.CreateInserter(tmlconf.Database[host], tmlconf.SSH[host], nil)
+	if err != nil {
+		panic(fmt.Errorf("%s%w", T("Failed to create inserter instance: "), err))
+	}
+	problems, err := inserter.Doctor()
+	if err != nil {
+		panic(fmt.Errorf("%s%s: %w", T("Failed to inspect tables on "), host, err))
+	}
+	if len(problems) == 0 {
+		fmt.Println("No problems found on " + host + ".")
+		return
+	}
+	fmt.Fprintln(os.Stderr, "Problems found on "+host+":")
+	for _, problem := range problems {
+		fmt.Fprintln(os.Stderr, "  "+problem)
+	}
+	os.Exit(1)
+}
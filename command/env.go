@@ -0,0 +1,20 @@
+package command
+
+import (
+	"github.com/codegangsta/cli"
+	. "github.com/timakin/gopli/constants"
+)
+
+// applyEnvHostDefaults points --from and --to at the hosts built from the
+// environment when no configuration file is given.
+func applyEnvHostDefaults(c *cli.Context) {
+	if c.String("config") != "" {
+		return
+	}
+	if c.String("from") == "" {
+		c.Set("from", ENV_SOURCE_NAME)
+	}
+	if c.String("to") == "" {
+		c.Set("to", ENV_DESTINATION_NAME)
+	}
+}
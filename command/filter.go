@@ -0,0 +1,20 @@
+package command
+
+import (
+	"github.com/codegangsta/cli"
+	. "github.com/timakin/gopli/constants"
+	. "github.com/timakin/gopli/lib"
+)
+
+// tableFilter returns the [filter] section with the table patterns of the
+// source. --only replaces its include_tables and --skip adds to its
+// exclude_tables.
+func tableFilter(c *cli.Context, tmlconf TomlConfig, from string) Filter {
+	filter := tmlconf.Filter
+	filter.Include = tmlconf.Database[from].IncludeTables
+	if len(c.StringSlice("only")) > 0 {
+		filter.Include = c.StringSlice("only")
+	}
+	filter.Exclude = append(append([]string(nil), tmlconf.Database[from].ExcludeTables...), c.StringSlice("skip")...)
+	return filter
+}
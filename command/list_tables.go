@@ -0,0 +1,20 @@
+package command
+
+import (
+	"os"
+
+	"github.com/codegangsta/cli"
+	database "github.com/timakin/gopli/database"
+	. "github.com/timakin/gopli/lib"
+)
+
+// CmdListTables supports `list-tables` command in CLI
+func CmdListTables(c *cli.Context) {
+	// Load tomlConfig
+	tmlconf := LoadTomlConf(c.String("config"))
+	applyEnvHostDefaults(c)
+	defer database.CloseConnections()
+
+	stats := fetchTableStats(tmlconf, c.String("from"))
+	PrintTableStats(os.Stdout, stats, tableFilter(c, tmlconf, c.String("from")), c.Bool("all"))
+}
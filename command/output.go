@@ -0,0 +1,33 @@
+package command
+
+import (
+	"os"
+
+	"github.com/codegangsta/cli"
+	. "github.com/timakin/gopli/lib"
+)
+
+// Setup prepares the output and the transport of every command.
+func Setup(c *cli.Context) error {
+	if err := SetupOutput(c); err != nil {
+		return err
+	}
+	return SetupTransport(c)
+}
+
+// SetupOutput drops colors and full screen output with the --no-color global
+// flag, when NO_COLOR is set, and when stdout is not a terminal. Errors are
+// shown in the language of --lang or the locale, and the log at the level of
+// --log-level.
+func SetupOutput(c *cli.Context) error {
+	UsePlainOutput(c.GlobalBool("no-color") || os.Getenv("NO_COLOR") != "" || !IsTerminal(os.Stdout))
+	lang := c.GlobalString("lang")
+	if lang == "" {
+		lang = DetectLanguage()
+	}
+	SetLanguage(lang)
+	if level := c.GlobalString("log-level"); level != "" {
+		return SetLogLevel(level)
+	}
+	return nil
+}
@@ -0,0 +1,129 @@
+package command
+
+import (
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/codegangsta/cli"
+	database "github.com/timakin/gopli/database"
+	. "github.com/timakin/gopli/lib"
+)
+
+// CmdPlan supports `plan` command in CLI
+func CmdPlan(c *cli.Context) {
+	// Load tomlConfig
+	tmlconf := LoadTomlConf(c.String("config"))
+	applyEnvHostDefaults(c)
+	defer database.CloseConnections()
+	if err := applyPreviewNames(c, tmlconf); err != nil {
+		panic(err)
+	}
+
+	from, to := c.String("from"), c.String("to")
+	sourceStats := fetchTableStats(tmlconf, from)
+	destinationStats := fetchTableStats(tmlconf, to)
+
+	plan := BuildPlan(from, to, sourceStats, destinationStats, tableFilter(c, tmlconf, from))
+	plan.Print(os.Stdout)
+
+	if c.String("out") != "" {
+		if err := plan.Write(c.String("out")); err != nil {
+			panic(fmt.Errorf("%s%w", T("Failed to write plan: "), err))
+		}
+		log.Print("[Plan] saved plan to " + c.String("out"))
+	}
+}
+
+// CmdApply supports `apply` command in CLI
+func CmdApply(c *cli.Context) {
+	// Enable multi core setting
+	SetupMultiCore()
+
+	// Load tomlConfig
+	tmlconf := LoadTomlConf(c.String("config"))
+
+	if c.String("plan") == "" {
+		panic(T("Plan file is required"))
+	}
+	plan, err := ReadPlan(c.String("plan"))
+	if err != nil {
+		panic(fmt.Errorf("%s%w", T("Failed to read plan: "), err))
+	}
+	c.Set("from", plan.From)
+	c.Set("to", plan.To)
+
+	tables := plan.TablesToLoad()
+	if len(tables) == 0 {
+		log.Print("[Apply] the plan has no tables to replace")
+		return
+	}
+	log.Printf("[Apply] applying the plan for %d tables from %s to %s", len(tables), plan.From, plan.To)
+	if err := runSync(c, tmlconf, tables); err != nil {
+		panic(err)
+	}
+}
+
+// printDryRun prints the plan of a sync into every destination. The hosts
+// are only connected to for the statistics of their tables.
+func printDryRun(c *cli.Context, tmlconf TomlConfig, tables []string) error {
+	from := c.String("from")
+	destinations := SplitHosts(c.String("to"))
+	if err := tmlconf.RequireHosts(append([]string{from}, destinations...)...); err != nil {
+		return fmt.Errorf("%s%w", T("Invalid configuration: "), err)
+	}
+
+	sourceStats, err := readTableStats(tmlconf, from)
+	if err != nil {
+		return err
+	}
+	if len(tables) > 0 {
+		sourceStats = statsOf(sourceStats, tables)
+	}
+	filter := tableFilter(c, tmlconf, from)
+	for _, to := range destinations {
+		destinationStats, err := readTableStats(tmlconf, to)
+		if err != nil {
+			return err
+		}
+		BuildPlan(from, to, sourceStats, destinationStats, filter).Print(os.Stdout)
+	}
+	log.Print("[Plan] dry run, nothing was deleted or loaded")
+	return nil
+}
+
+// statsOf returns the statistics of the given tables.
+func statsOf(stats []TableStat, tables []string) []TableStat {
+	var selected []TableStat
+	for _, stat := range stats {
+		for _, table := range tables {
+			if SameTable(stat.Name, table) {
+				selected = append(selected, stat)
+				break
+			}
+		}
+	}
+	return selected
+}
+
+func fetchTableStats(tmlconf TomlConfig, host string) []TableStat {
+	stats, err := readTableStats(tmlconf, host)
+	if err != nil {
+		panic(err)
+	}
+	return stats
+}
+
+// readTableStats returns the statistics of the tables on host.
+func readTableStats(tmlconf TomlConfig, host string) ([]TableStat, error) {
+	log.Print("[Plan] inspecting tables on " + host + "...")
+	fetcher, err := database.CreateFetcher(tmlconf.Database[host], tmlconf.SSH[host], nil, database.FetchOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("%s%w", T("Failed to create fetcher instance: "), err)
+	}
+	stats, err := fetcher.TableStats()
+	if err != nil {
+		return nil, fmt.Errorf("%s%s: %w", T("Failed to inspect tables on "), host, err)
+	}
+	return stats, nil
+}
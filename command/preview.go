@@ -0,0 +1,98 @@
+package command
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/codegangsta/cli"
+	database "github.com/timakin/gopli/database"
+	. "github.com/timakin/gopli/lib"
+)
+
+// applyPreviewNames fills the database name templates of preview
+// destinations in with the --var values.
+func applyPreviewNames(c *cli.Context, tmlconf TomlConfig) error {
+	vars, err := ParseVars(c.StringSlice("var"))
+	if err != nil {
+		return fmt.Errorf("%s%w", T("Invalid --var: "), err)
+	}
+	for host, dbConf := range tmlconf.Database {
+		if !dbConf.Preview {
+			continue
+		}
+		if dbConf.Name, err = RenderDatabaseName(dbConf.Name, vars); err != nil {
+			return fmt.Errorf("%s%s: %w", T("Failed to name the preview database of "), host, err)
+		}
+		tmlconf.Database[host] = dbConf
+	}
+	return nil
+}
+
+// createPreview creates the database of a preview destination with the
+// tables of the source, so the dumps can be loaded into it.
+func createPreview(tmlconf TomlConfig, from string, to string) error {
+	inserter, err := database.CreateInserter(tmlconf.Database[to], tmlconf.SSH[to], nil)
+	if err != nil {
+		return fmt.Errorf("%s%w", T("Failed to create inserter instance: "), err)
+	}
+	log.Print("[Preview] creating " + tmlconf.Database[to].Name + " on " + to + "...")
+	if err := inserter.CreateDatabase(); err != nil {
+		return fmt.Errorf("%s%w", T("Failed to create the preview database: "), err)
+	}
+
+	source, err := database.CreateFetcher(tmlconf.Database[from], tmlconf.SSH[from], nil, database.FetchOptions{})
+	if err != nil {
+		return fmt.Errorf("%s%w", T("Failed to create fetcher instance: "), err)
+	}
+	destination, err := database.CreateFetcher(tmlconf.Database[to], tmlconf.SSH[to], nil, database.FetchOptions{})
+	if err != nil {
+		return fmt.Errorf("%s%w", T("Failed to create fetcher instance: "), err)
+	}
+	sourceSchema, err := source.Schema()
+	if err != nil {
+		return fmt.Errorf("%s%s: %w", T("Failed to inspect the schema of "), from, err)
+	}
+	destinationSchema, err := destination.Schema()
+	if err != nil {
+		return fmt.Errorf("%s%s: %w", T("Failed to inspect the schema of "), to, err)
+	}
+	// Tables existing already are left as they are, so a preview is
+	// refreshed by syncing into it again.
+	diff := DiffSchemas(sourceSchema, destinationSchema)
+	diff.ChangedTables = nil
+	diff.ExtraTables = nil
+	statements, err := source.SchemaDDL(diff)
+	if err != nil {
+		return fmt.Errorf("%s%w", T("Failed to generate DDL: "), err)
+	}
+	if err := inserter.ExecDDL(statements, database.DDLOptions{NoForeignKeyChecks: true}); err != nil {
+		return fmt.Errorf("%s%w", T("Failed to apply DDL: "), err)
+	}
+	log.Printf("[Preview] created %d tables in %s", len(diff.MissingTables), tmlconf.Database[to].Name)
+	return nil
+}
+
+// CmdDestroy supports `destroy` command in CLI
+func CmdDestroy(c *cli.Context) {
+	// Load tomlConfig
+	tmlconf := LoadTomlConf(c.String("config"))
+	defer database.CloseConnections()
+
+	host := c.String("to")
+	if !tmlconf.Database[host].Preview {
+		panic(T("Only preview destinations can be destroyed: ") + host)
+	}
+	if err := applyPreviewNames(c, tmlconf); err != nil {
+		panic(err)
+	}
+
+	inserter, err := database.CreateInserter(tmlconf.Database[host], tmlconf.SSH[host], nil)
+	if err != nil {
+		panic(fmt.Errorf("%s%w", T("Failed to create inserter instance: "), err))
+	}
+	log.Print("[Destroy] dropping " + tmlconf.Database[host].Name + " on " + host + "...")
+	if err := inserter.DropDatabase(); err != nil {
+		panic(fmt.Errorf("%s%w", T("Failed to drop the preview database: "), err))
+	}
+	log.Print("[Destroy] dropped " + tmlconf.Database[host].Name)
+}
@@ -0,0 +1,40 @@
+package command
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/codegangsta/cli"
+	database "github.com/timakin/gopli/database"
+	. "github.com/timakin/gopli/lib"
+)
+
+// CmdRestore supports `restore` command in CLI
+func CmdRestore(c *cli.Context) {
+	// Enable multi core setting
+	SetupMultiCore()
+
+	// Load tomlConfig
+	tmlconf := LoadTomlConf(c.String("config"))
+	applyEnvHostDefaults(c)
+	defer database.CloseConnections()
+	defer trapInterrupt()()
+
+	if c.String("snapshot") == "" {
+		panic(T("Snapshot name is required"))
+	}
+	snapshot, err := FindSnapshot(tmlconf.Snapshot, c.String("snapshot"))
+	if err != nil {
+		panic(fmt.Errorf("%s%w", T("Failed to find snapshot: "), err))
+	}
+	log.Print("[Restore] restoring " + snapshot.Name + " (" + snapshot.Source + "/" + snapshot.Database + ") into " + c.String("to"))
+
+	ws, closeSnapshot, err := OpenSnapshot(snapshot, tmlconf.Workspace)
+	if err != nil {
+		panic(fmt.Errorf("%s%w", T("Failed to open snapshot: "), err))
+	}
+	defer closeSnapshot()
+	if err := loadDumps(tmlconf.Database[c.String("to")], tmlconf.SSH[c.String("to")], ws, false); err != nil {
+		panic(err)
+	}
+}
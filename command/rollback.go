@@ -0,0 +1,43 @@
+package command
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/codegangsta/cli"
+	database "github.com/timakin/gopli/database"
+	. "github.com/timakin/gopli/lib"
+)
+
+// CmdRollback supports `rollback` command in CLI
+func CmdRollback(c *cli.Context) {
+	// Enable multi core setting
+	SetupMultiCore()
+
+	// Load tomlConfig
+	tmlconf := LoadTomlConf(c.String("config"))
+	applyEnvHostDefaults(c)
+	defer database.CloseConnections()
+	defer trapInterrupt()()
+
+	var backup SnapshotMeta
+	var err error
+	if c.String("snapshot") != "" {
+		backup, err = FindSnapshot(tmlconf.Snapshot, c.String("snapshot"))
+	} else {
+		backup, err = LatestBackup(tmlconf.Snapshot, c.String("to"))
+	}
+	if err != nil {
+		panic(fmt.Errorf("%s%w", T("Failed to find backup: "), err))
+	}
+	log.Print("[Rollback] restoring " + backup.Name + " into " + c.String("to"))
+
+	ws, closeSnapshot, err := OpenSnapshot(backup, tmlconf.Workspace)
+	if err != nil {
+		panic(fmt.Errorf("%s%w", T("Failed to open snapshot: "), err))
+	}
+	defer closeSnapshot()
+	if err := loadDumps(tmlconf.Database[c.String("to")], tmlconf.SSH[c.String("to")], ws, false); err != nil {
+		panic(err)
+	}
+}
@@ -0,0 +1,236 @@
+package command
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/codegangsta/cli"
+	. "github.com/timakin/gopli/constants"
+	database "github.com/timakin/gopli/database"
+	. "github.com/timakin/gopli/lib"
+)
+
+// CmdSchema supports `schema` command in CLI
+func CmdSchema(c *cli.Context) {
+	// Load tomlConfig
+	tmlconf := LoadTomlConf(c.String("config"))
+	applyEnvHostDefaults(c)
+	defer database.CloseConnections()
+	if err := applyPreviewNames(c, tmlconf); err != nil {
+		panic(err)
+	}
+
+	switch c.String("online-ddl") {
+	case "", ONLINE_DDL_GH_OST, ONLINE_DDL_PT_OSC:
+	default:
+		panic(T("Unknown online schema change tool: ") + c.String("online-ddl"))
+	}
+
+	from, to := c.String("from"), c.String("to")
+	source, err := database.CreateFetcher(tmlconf.Database[from], tmlconf.SSH[from], nil, database.FetchOptions{})
+	if err != nil {
+		panic(fmt.Errorf("%s%w", T("Failed to create fetcher instance: "), err))
+	}
+	destination, err := database.CreateFetcher(tmlconf.Database[to], tmlconf.SSH[to], nil, database.FetchOptions{})
+	if err != nil {
+		panic(fmt.Errorf("%s%w", T("Failed to create fetcher instance: "), err))
+	}
+
+	log.Print("[Schema] comparing the schema of " + from + " with " + to + "...")
+	sourceSchema, err := source.Schema()
+	if err != nil {
+		panic(fmt.Errorf("%s%s: %w", T("Failed to inspect the schema of "), from, err))
+	}
+	destinationSchema, err := destination.Schema()
+	if err != nil {
+		panic(fmt.Errorf("%s%s: %w", T("Failed to inspect the schema of "), to, err))
+	}
+	diff := DiffSchemas(sourceSchema, destinationSchema)
+	for _, table := range diff.ExcludeDataOnly(tmlconf.Filter) {
+		log.Print("[Schema] leaving " + table + " alone, it is marked data only")
+	}
+	if !c.Bool("drop-columns") {
+		diff.KeepExtraColumns()
+	}
+	if diff.Empty() {
+		log.Print("[Schema] the schemas match")
+		return
+	}
+
+	statements, err := source.SchemaDDL(diff)
+	if err != nil {
+		panic(fmt.Errorf("%s%w", T("Failed to generate DDL: "), err))
+	}
+	fmt.Println(JoinDDL(statements))
+
+	if c.String("ddl-dir") != "" {
+		path, err := WriteDDLFile(c.String("ddl-dir"), from+"_to_"+to, statements)
+		if err != nil {
+			panic(fmt.Errorf("%s%w", T("Failed to write DDL: "), err))
+		}
+		log.Print("[Schema] saved DDL to " + path)
+	}
+
+	if c.Bool("check") {
+		panic(fmt.Errorf("%s%w", T("The schemas differ: "), diff.Err()))
+	}
+
+	if c.Bool("apply") {
+		inserter, err := database.CreateInserter(tmlconf.Database[to], tmlconf.SSH[to], nil)
+		if err != nil {
+			panic(fmt.Errorf("%s%w", T("Failed to create inserter instance: "), err))
+		}
+		opts := database.DDLOptions{OnlineTool: c.String("online-ddl")}
+		if opts.OnlineTool != "" {
+			opts.OnlineTables = largeTables(destination, c.Int64("online-ddl-min-rows"))
+		}
+		log.Print("[Schema] applying DDL to " + to + "...")
+		if err := inserter.ExecDDL(statements, opts); err != nil {
+			panic(fmt.Errorf("%s%w", T("Failed to apply DDL: "), err))
+		}
+		log.Print("[Schema] applied DDL to " + to)
+	}
+}
+
+// largeTables returns the tables of fetcher with at least minRows rows.
+func largeTables(fetcher database.DBFetcher, minRows int64) []string {
+	stats, err := fetcher.TableStats()
+	if err != nil {
+		panic(fmt.Errorf("%s%w", T("Failed to inspect tables: "), err))
+	}
+	var tables []string
+	for _, stat := range stats {
+		if stat.Rows >= minRows {
+			tables = append(tables, stat.Name)
+		}
+	}
+	return tables
+}
+
+// syncSchema brings the schema of the synced tables on the destination in
+// line with the source before the load: missing tables are created, and
+// tables whose columns or constraints differ are dropped and created again,
+// since their data is replaced anyway. Tables of the destination only are
+// left alone.
+func syncSchema(tmlconf TomlConfig, ws *Workspace, from string, to string) error {
+	tables, err := ws.ReadTableList()
+	if err != nil {
+		return err
+	}
+	source, err := database.CreateFetcher(tmlconf.Database[from], tmlconf.SSH[from], nil, database.FetchOptions{})
+	if err != nil {
+		return fmt.Errorf("%s%w", T("Failed to create fetcher instance: "), err)
+	}
+	destination, err := database.CreateFetcher(tmlconf.Database[to], tmlconf.SSH[to], nil, database.FetchOptions{})
+	if err != nil {
+		return fmt.Errorf("%s%w", T("Failed to create fetcher instance: "), err)
+	}
+
+	log.Print("[Schema] comparing the schema of " + from + " with " + to + "...")
+	sourceSchema, err := source.Schema()
+	if err != nil {
+		return fmt.Errorf("%s%s: %w", T("Failed to inspect the schema of "), from, err)
+	}
+	destinationSchema, err := destination.Schema()
+	if err != nil {
+		return fmt.Errorf("%s%s: %w", T("Failed to inspect the schema of "), to, err)
+	}
+	diff := DiffSchemas(sourceSchema, destinationSchema)
+	diff.MissingTables = syncedTables(diff.MissingTables, tables)
+	diff.ChangedTables = syncedTables(diff.ChangedTables, tables)
+	diff.ExtraTables = nil
+	diff.ExcludeDataOnly(tmlconf.Filter)
+	if diff.Empty() {
+		log.Print("[Schema] the schemas of the synced tables match")
+		return nil
+	}
+
+	// Changed tables are recreated from scratch instead of altered.
+	recreated := diff.ChangedTables
+	diff.MissingTables = append(diff.MissingTables, recreated...)
+	diff.ChangedTables = nil
+	statements, err := source.SchemaDDL(diff)
+	if err != nil {
+		return fmt.Errorf("%s%w", T("Failed to generate DDL: "), err)
+	}
+	inserter, err := database.CreateInserter(tmlconf.Database[to], tmlconf.SSH[to], nil)
+	if err != nil {
+		return fmt.Errorf("%s%w", T("Failed to create inserter instance: "), err)
+	}
+	statements = append(database.DropTableDDL(recreated), statements...)
+	if err := inserter.ExecDDL(statements, database.DDLOptions{NoForeignKeyChecks: true}); err != nil {
+		return fmt.Errorf("%s%w", T("Failed to apply DDL: "), err)
+	}
+	log.Printf("[Schema] created %d and recreated %d tables on %s", len(diff.MissingTables)-len(recreated), len(recreated), to)
+	return nil
+}
+
+// syncedTables returns the tables of diffTables that are synced.
+func syncedTables(diffTables []string, tables []string) []string {
+	var synced []string
+	for _, table := range diffTables {
+		for _, syncedTable := range tables {
+			if SameTable(table, syncedTable) {
+				synced = append(synced, table)
+				break
+			}
+		}
+	}
+	return synced
+}
+
+// syncViewsAndTriggers replaces the views of the destination and the
+// triggers of the loaded tables with the ones of the source. It runs after
+// the load, so the triggers don't fire for the loaded rows.
+func syncViewsAndTriggers(tmlconf TomlConfig, ws *Workspace, from string, to string) error {
+	tables, err := ws.ReadTableList()
+	if err != nil {
+		return err
+	}
+	source, err := database.CreateFetcher(tmlconf.Database[from], tmlconf.SSH[from], nil, database.FetchOptions{})
+	if err != nil {
+		return fmt.Errorf("%s%w", T("Failed to create fetcher instance: "), err)
+	}
+	inserter, err := database.CreateInserter(tmlconf.Database[to], tmlconf.SSH[to], nil)
+	if err != nil {
+		return fmt.Errorf("%s%w", T("Failed to create inserter instance: "), err)
+	}
+
+	views, err := source.ViewDDL()
+	if err != nil {
+		return fmt.Errorf("%s%w", T("Failed to generate DDL: "), err)
+	}
+	if err := createViews(inserter, views); err != nil {
+		return fmt.Errorf("%s%w", T("Failed to apply DDL: "), err)
+	}
+	triggers, err := source.TriggerDDL(tables)
+	if err != nil {
+		return fmt.Errorf("%s%w", T("Failed to generate DDL: "), err)
+	}
+	if err := inserter.ExecDDL(triggers, database.DDLOptions{}); err != nil {
+		return fmt.Errorf("%s%w", T("Failed to apply DDL: "), err)
+	}
+	log.Printf("[Schema] synced %d views and %d triggers to %s", len(views), len(triggers)/2, to)
+	return nil
+}
+
+// createViews runs the view statements until all of them succeeded. Views
+// may select from other views, so views failing are tried again as long as
+// others succeed.
+func createViews(inserter database.DBInserter, views []DDLStatement) error {
+	for len(views) > 0 {
+		var failed []DDLStatement
+		var lastErr error
+		for _, view := range views {
+			if err := inserter.ExecDDL([]DDLStatement{view}, database.DDLOptions{}); err != nil {
+				failed = append(failed, view)
+				lastErr = err
+			}
+		}
+		if len(failed) == len(views) {
+			return lastErr
+		}
+		views = failed
+	}
+	return nil
+}
@@ -0,0 +1,43 @@
+package command
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/BurntSushi/toml"
+	"github.com/codegangsta/cli"
+	. "github.com/timakin/gopli/constants"
+	. "github.com/timakin/gopli/lib"
+)
+
+// CmdShowConfig supports `show-config` command in CLI
+func CmdShowConfig(c *cli.Context) {
+	// Load tomlConfig
+	tmlconf := LoadTomlConf(c.String("config"))
+	applyEnvHostDefaults(c)
+
+	switch {
+	case c.String("config") == "":
+		fmt.Println("# loaded from GOPLI_SRC_* and GOPLI_DST_* environment variables")
+	case !c.IsSet("config") && os.Getenv("GOPLI_CONFIG") != "":
+		fmt.Println("# loaded from " + c.String("config") + " (GOPLI_CONFIG)")
+	default:
+		fmt.Println("# loaded from " + c.String("config"))
+	}
+	if c.String("from") != "" || c.String("to") != "" {
+		fmt.Printf("# from: %s, to: %s\n", c.String("from"), c.String("to"))
+	}
+	fmt.Println()
+
+	if err := toml.NewEncoder(os.Stdout).Encode(tmlconf.Redacted()); err != nil {
+		panic(fmt.Errorf("%s%w", T("Failed to print configuration: "), err))
+	}
+
+	if errs := tmlconf.Validate(append([]string{c.String("from")}, SplitHosts(c.String("to"))...)...); len(errs) > 0 {
+		fmt.Fprintln(os.Stderr, "\nInvalid configuration:")
+		for _, err := range errs {
+			fmt.Fprintln(os.Stderr, "  "+err.Error())
+		}
+		os.Exit(EXIT_CONFIG)
+	}
+}
@@ -0,0 +1,51 @@
+package command
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"text/tabwriter"
+
+	"github.com/codegangsta/cli"
+	. "github.com/timakin/gopli/lib"
+)
+
+// CmdSnapshots supports `snapshots` command in CLI
+func CmdSnapshots(c *cli.Context) {
+	tmlconf := LoadTomlConf(c.String("config"))
+
+	snapshots, err := ListSnapshots(tmlconf.Snapshot)
+	if err != nil {
+		panic(fmt.Errorf("%s%w", T("Failed to list snapshots: "), err))
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tKIND\tSOURCE\tDATABASE\tTABLES\tCREATED")
+	for _, snapshot := range snapshots {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%d\t%s\n", snapshot.Name, snapshot.Kind, snapshot.Source, snapshot.Database, len(snapshot.Tables), snapshot.CreatedAt.Format("2006-01-02 15:04:05"))
+	}
+	w.Flush()
+}
+
+// CmdSnapshotsPrune supports `snapshots prune` command in CLI
+func CmdSnapshotsPrune(c *cli.Context) {
+	tmlconf := LoadTomlConf(c.String("config"))
+
+	keepLast := tmlconf.Snapshot.KeepLast
+	if c.IsSet("keep-last") {
+		keepLast = c.Int("keep-last")
+	}
+	keepDays := tmlconf.Snapshot.KeepDays
+	if c.IsSet("keep-days") {
+		keepDays = c.Int("keep-days")
+	}
+
+	pruned, err := PruneSnapshots(tmlconf.Snapshot, keepLast, keepDays)
+	if err != nil {
+		panic(fmt.Errorf("%s%w", T("Failed to prune snapshots: "), err))
+	}
+	for _, snapshot := range pruned {
+		log.Print("[Snapshot] pruned " + snapshot.Name)
+	}
+	log.Printf("[Snapshot] pruned %d snapshot(s)", len(pruned))
+}
@@ -1,6 +1,17 @@
 package command
 
 import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
 	"github.com/codegangsta/cli"
 	. "github.com/timakin/gopli/constants"
 	database "github.com/timakin/gopli/database"
@@ -9,41 +20,658 @@ import (
 
 // CmdSync supports `sync` command in CLI
 func CmdSync(c *cli.Context) {
+	// The daemon handles signals itself, letting the current run finish.
+	defer trapInterrupt()()
+	if err := syncFromConfig(c); err != nil {
+		// main exits with the code telling the cause of err.
+		panic(err)
+	}
+}
+
+// syncFromConfig loads the configuration and runs a sync with it.
+func syncFromConfig(c *cli.Context) error {
 	// Enable multi core setting
 	SetupMultiCore()
 
-	// Load tomlConfig
-	tmlconf := LoadTomlConf(c.String("config"))
+	// Load TomlConfig
+	tmlconf, err := ReadTomlConf(c.String("config"))
+	if err != nil {
+		return err
+	}
+	applyEnvHostDefaults(c)
+
+	return runSync(c, tmlconf, nil)
+}
+
+// trapInterrupt undoes the pending changes to destinations before exiting on
+// SIGINT or SIGTERM, and returns the function removing the trap.
+func trapInterrupt() func() {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	done := make(chan struct{})
+	go func() {
+		select {
+		case sig := <-signals:
+			RestoreTerminal()
+			log.Print("[Cancel] received " + sig.String() + ", restoring the destination...")
+			database.RestoreDestinations()
+			os.Exit(EXIT_INTERRUPTED)
+		case <-done:
+		}
+	}()
+	return func() {
+		signal.Stop(signals)
+		close(done)
+	}
+}
+
+// runSync fetches the source and loads it into the destination. A non-empty
+// tables restricts the sync to those tables.
+func runSync(c *cli.Context, tmlconf TomlConfig, tables []string) (err error) {
+	defer database.CloseConnections()
+	if err := applyPreviewNames(c, tmlconf); err != nil {
+		return err
+	}
+
+	if dryRun(c, tmlconf) {
+		return printDryRun(c, tmlconf, tables)
+	}
+
+	if c.Int("ssh-connections") > 0 {
+		for name, sshConf := range tmlconf.SSH {
+			sshConf.Connections = c.Int("ssh-connections")
+			tmlconf.SSH[name] = sshConf
+		}
+	}
+
+	if c.Bool("tui") {
+		defer startTUI()()
+	}
+	if c.String("otlp-endpoint") != "" {
+		defer startTrace(c)(&err)
+	}
+
+	report := NewReport(c.String("from"), c.String("to"))
+	report.Fetch = &FetchStats{}
+	if c.String("report") != "" {
+		defer writeReport(report, c.String("report"))
+	}
+	if c.String("report-url") != "" {
+		defer uploadReport(report, c.String("report-url"))
+	}
+	defer func() {
+		if err != nil {
+			report.SetError(err)
+		}
+	}()
+
+	continueOnError := c.Bool("continue-on-error")
+	if continueOnError {
+		defer logFailures(report)
+	}
+
+	destinations := SplitHosts(c.String("to"))
+	if len(destinations) > 1 && (c.Bool("skip-unchanged") || c.Bool("changed-only")) {
+		return errors.New(T("Multiple destinations can't skip unchanged tables"))
+	}
+	if err := tmlconf.RequireHosts(append([]string{c.String("from")}, destinations...)...); err != nil {
+		return fmt.Errorf("%s%w", T("Invalid configuration: "), err)
+	}
+
+	switch c.String("on-table-error") {
+	case TABLE_ERROR_ABORT, TABLE_ERROR_SKIP:
+	default:
+		return errors.New(T("Unknown table error policy: ") + c.String("on-table-error"))
+	}
+
+	// Create the working directory of this run
+	ws, err := NewWorkspace(TMP_DIR_PREFIX, tmlconf.Workspace)
+	if err != nil {
+		return fmt.Errorf("%s%w", T("Failed to create working directory: "), err)
+	}
+	defer ws.Remove()
+	report.WorkDir = ws.Path
+	log.Print("[Setting] working directory is " + ws.Path)
+
+	var cache *DumpCache
+	if c.Bool("cache") {
+		if cache, err = OpenDumpCache(tmlconf.Cache); err != nil {
+			return fmt.Errorf("%s%w", T("Failed to open the dump cache: "), err)
+		}
+	}
+
+	var knownChecksums func(tables []string) (map[string]string, error)
+	if c.Bool("skip-unchanged") {
+		knownChecksums = func(tables []string) (map[string]string, error) {
+			inserter, err := database.CreateInserter(tmlconf.Database[c.String("to")], tmlconf.SSH[c.String("to")], ws)
+			if err != nil {
+				return nil, err
+			}
+			return inserter.TableChecksums(tables)
+		}
+	}
+	var history *History
+	if c.Bool("changed-only") {
+		if knownChecksums != nil {
+			return errors.New(T("--changed-only and --skip-unchanged can't be combined"))
+		}
+		if history, err = ReadHistory(tmlconf.History, c.String("from"), c.String("to")); err != nil {
+			return fmt.Errorf("%s%w", T("Failed to read the sync history: "), err)
+		}
+		knownChecksums = func(tables []string) (map[string]string, error) {
+			return history.Checksums, nil
+		}
+	}
 
 	// Create DB Fetcher
-	fetcher, err := database.CreateFetcher(tmlconf.Database[c.String("from")], tmlconf.SSH[c.String("from")])
+	fetcher, err := connectSource(tmlconf, c.String("from"), ws, database.FetchOptions{
+		Tables:           tables,
+		Retries:          c.Int("retries"),
+		SkipFailedTables: c.String("on-table-error") == TABLE_ERROR_SKIP || continueOnError,
+		Compression:      c.String("compression"),
+		DumpTool:         c.String("dump-tool"),
+		RecentPartitions: c.Int("recent-partitions"),
+		OrderByPK:        c.Bool("order-by-pk"),
+		Filter:           tableFilter(c, tmlconf, c.String("from")),
+		Columns:          tmlconf.Columns,
+		Stats:            report.Fetch,
+		Cache:            cache,
+		KnownChecksums:   knownChecksums,
+	}, report)
 	if err != nil {
-		panic("Failed to create fetcher instance: " + err.Error())
+		return err
 	}
 
-	defer DeleteTmpDir(TMP_DIR_PATH)
+	// The daemon already postponed the run while the source was busy.
+	if c.Duration("sample-load") > 0 && !c.Bool("defer-on-peak") {
+		if reason := sourcePeakReason(fetcher, tmlconf.Database[c.String("from")], c.Duration("sample-load")); reason != "" {
+			log.Print("[Setting] the source appears to be at peak load: " + reason)
+		}
+	}
 
 	// Fetch
+	var failures []error
+	span := database.StartSpan("fetch", map[string]string{"gopli.from": c.String("from")})
+	fetcher.TraceUnder(span)
 	err = fetcher.Fetch()
+	span.End(err)
+	if tableErrors, ok := err.(*TableErrors); ok {
+		report.AddTableErrors(tableErrors)
+		if !tableErrors.Skipped {
+			return fmt.Errorf("%s%w", T("Failed to fetch: "), err)
+		}
+		log.Print("[Fetch] skipped failed tables: " + err.Error())
+		if continueOnError {
+			failures = append(failures, tableErrors)
+		}
+	} else if errors.Is(err, ErrNoTables) {
+		if code := c.Int("no-tables-exit-code"); code != 0 {
+			return &ExitError{Code: code, Err: err}
+		}
+		log.Print("[Fetch] " + err.Error() + ", nothing to do")
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("%s%w", T("Failed to fetch: "), err)
+	}
+
+	// Keep the fetched dumps as a snapshot
+	if c.Bool("keep-dumps") {
+		if err := saveSnapshot(c, ws, tmlconf.Snapshot, tmlconf.Database[c.String("from")]); err != nil {
+			return err
+		}
+	}
+
+	if len(destinations) > 1 {
+		if err := loadDestinations(c, tmlconf, ws, destinations, report); err != nil {
+			return err
+		}
+	} else {
+		seeds, err := loadDestination(c, tmlconf, ws, c.String("to"))
+		report.Seeds = seeds
+		tableFailures := tableFailures(err)
+		if tableFailures == nil && err != nil {
+			return err
+		}
+		for _, tableErrors := range tableFailures {
+			report.AddTableErrors(tableErrors)
+			failures = append(failures, tableErrors)
+		}
+	}
+
+	if history != nil {
+		recordHistory(history, report, tmlconf.History)
+	}
+	if len(failures) > 0 {
+		return fmt.Errorf("%s%w", T("Finished with failed tables: "), errors.Join(failures...))
+	}
+	return nil
+}
+
+// dryRun reports whether the sync only prints what it would do, by --dry-run
+// or else by dry_run of the defaults section.
+func dryRun(c *cli.Context, tmlconf TomlConfig) bool {
+	if c.IsSet("dry-run") {
+		return c.Bool("dry-run")
+	}
+	return tmlconf.Defaults.DryRun
+}
+
+// loadDestination backs up the destination when asked to, brings its schema
+// in line with --with-schema, loads the fetched dumps in ws into it and
+// applies its seed files, which are returned. With
+// --continue-on-error, tables failing to load don't stop the rest: the
+// returned error then only consists of *TableErrors.
+func loadDestination(c *cli.Context, tmlconf TomlConfig, ws *Workspace, to string) ([]string, error) {
+	// A preview database has to exist before it can be backed up
+	if tmlconf.Database[to].Preview {
+		if err := createPreview(tmlconf, c.String("from"), to); err != nil {
+			return nil, err
+		}
+	}
+
+	// Back up the destination before deleting its data
+	if c.String("backup") != "" {
+		if err := backupDestination(c, ws, tmlconf.Snapshot, tmlconf.Workspace, to, tmlconf.Database[to], tmlconf.SSH[to]); err != nil {
+			return nil, err
+		}
+	}
+
+	// Load the fetched dumps into the destination
+	if c.Bool("with-schema") {
+		if err := syncSchema(tmlconf, ws, c.String("from"), to); err != nil {
+			return nil, err
+		}
+	}
+	loadErr := loadDumps(tmlconf.Database[to], tmlconf.SSH[to], ws, c.Bool("continue-on-error"))
+	if loadErr != nil && tableFailures(loadErr) == nil {
+		return nil, loadErr
+	}
+	if c.Bool("with-views-and-triggers") {
+		if err := syncViewsAndTriggers(tmlconf, ws, c.String("from"), to); err != nil {
+			return nil, err
+		}
+	}
+
+	if seedDir := tmlconf.Database[to].SeedDir; seedDir != "" {
+		seeds, err := applySeeds(tmlconf.Database[to], tmlconf.SSH[to], seedDir)
+		if err != nil {
+			return seeds, err
+		}
+		return seeds, loadErr
+	}
+	return nil, loadErr
+}
+
+// loadDestinations loads the fetched dumps into every destination at once.
+// A failing destination doesn't stop the others; the failures are recorded
+// in the report and returned once all of them have finished.
+func loadDestinations(c *cli.Context, tmlconf TomlConfig, ws *Workspace, destinations []string, report *Report) error {
+	log.Print("[Load] loading into " + strings.Join(destinations, ", ") + " concurrently")
+	results := make([]DestinationResult, len(destinations))
+	errs := make([]error, len(destinations))
+	var wg sync.WaitGroup
+	for i, to := range destinations {
+		wg.Add(1)
+		go func(i int, to string) {
+			defer wg.Done()
+			results[i].Host = to
+			results[i].Seeds, errs[i] = loadDestination(c, tmlconf, ws, to)
+			if errs[i] != nil {
+				results[i].Error = errs[i].Error()
+			}
+		}(i, to)
+	}
+	wg.Wait()
+	report.Destinations = results
+
+	for _, result := range results {
+		if result.Error != "" {
+			log.Print("[Load] " + result.Host + " failed: " + result.Error)
+		} else {
+			log.Print("[Load] " + result.Host + " completed")
+		}
+	}
+	if failed := report.FailedDestinations(); len(failed) > 0 {
+		// The causes are kept for the exit code.
+		return fmt.Errorf("%s%s: %w", T("Failed to load into "), strings.Join(failed, ", "), errors.Join(errs...))
+	}
+	return nil
+}
+
+// tableFailures returns the failed tables err consists of, or nil when
+// anything else failed.
+func tableFailures(err error) []*TableErrors {
+	if tableErrors, ok := err.(*TableErrors); ok {
+		return []*TableErrors{tableErrors}
+	}
+	joined, ok := err.(interface{ Unwrap() []error })
+	if !ok {
+		return nil
+	}
+	var failures []*TableErrors
+	for _, err := range joined.Unwrap() {
+		tableErrors, ok := err.(*TableErrors)
+		if !ok {
+			return nil
+		}
+		failures = append(failures, tableErrors)
+	}
+	return failures
+}
+
+// logFailures sums up what failed in a run going on after failures.
+func logFailures(report *Report) {
+	failures := report.Failures()
+	if len(failures) == 0 {
+		log.Print("[Summary] nothing failed")
+		return
+	}
+	log.Printf("[Summary] %d failures:", len(failures))
+	for _, failure := range failures {
+		log.Print("[Summary]   " + failure)
+	}
+}
+
+// startTrace records the spans of the run, and returns the function
+// exporting them to the --otlp-endpoint collector along with the error the
+// run returned.
+func startTrace(c *cli.Context) func(err *error) {
+	tracer := StartTrace(c.String("otlp-endpoint"), "sync", map[string]string{
+		"gopli.from": c.String("from"),
+		"gopli.to":   c.String("to"),
+	})
+	database.TraceSpans(tracer)
+	return func(err *error) {
+		database.TraceSpans(nil)
+		if exportErr := tracer.Flush(*err); exportErr != nil {
+			log.Print("[Trace] failed to export spans: " + exportErr.Error())
+		}
+	}
+}
+
+// tracePhase starts the span of a phase, and returns the function ending it
+// with the error the phase returned.
+func tracePhase(phase string, attributes map[string]string) func(err *error) {
+	_, end := startPhaseSpan(phase, attributes)
+	return end
+}
+
+// startPhaseSpan is tracePhase for phases whose tables are traced, returning
+// the span of the phase as well.
+func startPhaseSpan(phase string, attributes map[string]string) (*Span, func(err *error)) {
+	span := database.StartSpan(phase, attributes)
+	return span, func(err *error) {
+		span.End(*err)
+	}
+}
+
+// startTUI shows the progress full screen when stdout is a terminal, and
+// returns the function restoring the screen and the log output.
+func startTUI() func() {
+	if PlainOutput() {
+		log.Print("[Setting] plain output, logging instead of showing the progress")
+		return func() {}
+	}
+	progress := NewProgress()
+	database.TrackProgress(progress)
+	output := log.Writer()
+	log.SetOutput(progress)
+	tui := StartTUI(progress, os.Stdout)
+	return func() {
+		tui.Stop()
+		log.SetOutput(output)
+		database.TrackProgress(nil)
+	}
+}
+
+// recordHistory saves the source checksums of the synced tables for the next
+// --changed-only run. Failed tables are forgotten, so they are synced again.
+func recordHistory(history *History, report *Report, historyConf HistoryConf) {
+	for _, checksum := range report.Fetch.Checksums {
+		history.Checksums[checksum.Table] = checksum.Source
+	}
+	for table := range report.FailedTables {
+		delete(history.Checksums, table)
+	}
+	if err := history.Write(historyConf); err != nil {
+		log.Print("[History] failed to record the sync history: " + err.Error())
+	}
+}
+
+// sourcePeakReason samples the load of the source for duration and returns
+// why it is considered at peak load, or an empty string.
+func sourcePeakReason(fetcher database.DBFetcher, dbConf Database, duration time.Duration) string {
+	if dbConf.PeakQPS <= 0 && dbConf.PeakThreads <= 0 {
+		log.Print("[Setting] neither peak_qps nor peak_threads is set, not sampling the source load")
+		return ""
+	}
+	log.Print("[Setting] sampling the source load for " + duration.String())
+	sample, err := fetcher.SampleLoad(duration)
 	if err != nil {
-		panic("Failed to fetch: " + err.Error())
+		log.Print("[Setting] failed to sample the source load: " + err.Error())
+		return ""
 	}
+	log.Printf("[Setting] the source ran %.0f queries/s with up to %d threads connected", sample.QPS, sample.Threads)
+	return sample.PeakReason(dbConf.PeakQPS, dbConf.PeakThreads)
+}
+
+// connectSource creates the fetcher of the source host. When the host can't
+// be reached, the host named by its failover setting is used instead, and so
+// on down the chain.
+func connectSource(tmlconf TomlConfig, from string, ws *Workspace, opts database.FetchOptions, report *Report) (database.DBFetcher, error) {
+	visited := make(map[string]bool)
+	for host := from; ; {
+		visited[host] = true
+		// Creating the fetcher connects to the SSH host, pinging to the database.
+		fetcher, err := database.CreateFetcher(tmlconf.Database[host], tmlconf.SSH[host], ws, opts)
+		if err == nil {
+			if err = fetcher.Ping(); err == nil {
+				return fetcher, nil
+			}
+		}
+		failover := tmlconf.Database[host].Failover
+		if failover == "" || visited[failover] {
+			return nil, fmt.Errorf("%s%s: %w: %w", T("Failed to connect to "), host, ErrConnectionFailed, err)
+		}
+		log.Print("[Failover] " + host + " is unreachable, fetching from " + failover + " instead: " + err.Error())
+		report.Failovers = append(report.Failovers, Failover{From: host, To: failover, Reason: err.Error()})
+		host = failover
+	}
+}
+
+// loadDumps deletes the destination tables and loads the dump files in ws.
+// With continueOnError, the tables failing to delete are left alone and the
+// other tables are loaded, and the failures of both phases are returned as
+// they are.
+func loadDumps(dbConf Database, sshConf SSH, ws *Workspace, continueOnError bool) (err error) {
+	span, endSpan := startPhaseSpan("load", map[string]string{"db.name": dbConf.Name, "net.peer.name": dbConf.Host})
+	defer endSpan(&err)
 
 	// Create DB Inserter
-	inserter, err := database.CreateInserter(tmlconf.Database[c.String("to")], tmlconf.SSH[c.String("to")])
+	inserter, err := database.CreateInserter(dbConf, sshConf, ws)
+	if err != nil {
+		return fmt.Errorf("%s%w", T("Failed to create inserter instance: "), err)
+	}
+	inserter.TraceUnder(span)
+
+	endMaintenance, err := inserter.StartMaintenance()
+	if err != nil {
+		return fmt.Errorf("%s%w", T("Failed to set the maintenance flag: "), err)
+	}
+	defer endMaintenance()
+
+	if dbConf.DrainURL != "" || dbConf.DrainCommand != "" {
+		if err := RunDrainHook(dbConf); err != nil {
+			return fmt.Errorf("%s%w", T("Failed to drain the destination: "), err)
+		}
+		if err := inserter.WaitForDrain(); err != nil {
+			return fmt.Errorf("%s%w", T("Failed to drain the destination: "), err)
+		}
+	}
+
+	return cleanAndInsert(inserter, continueOnError)
+}
+
+// cleanAndInsert deletes the destination tables and loads them. Tables
+// deleted before others failed are loaded either way, so none is left empty;
+// only with continueOnError does the sync count as partly done.
+func cleanAndInsert(inserter database.DBInserter, continueOnError bool) error {
+	cleanErr := inserter.Clean()
+	if _, ok := cleanErr.(*TableErrors); ok {
+		log.Print("[Delete] loading the deleted tables: " + cleanErr.Error())
+	} else if cleanErr != nil {
+		return fmt.Errorf("%s%w", T("Failed to clean: "), cleanErr)
+	}
+
+	err := inserter.Insert()
+	if _, ok := err.(*TableErrors); ok && continueOnError {
+		return errors.Join(cleanErr, err)
+	} else if err != nil {
+		err = fmt.Errorf("%s%w", T("Failed to insert: "), err)
+	}
+	if cleanErr != nil && !continueOnError {
+		return errors.Join(fmt.Errorf("%s%w", T("Failed to clean: "), cleanErr), err)
+	}
+	if err != nil {
+		return err
+	}
+	return cleanErr
+}
+
+// applySeeds applies the seed files in dir to the destination, and returns
+// the names of the applied files.
+func applySeeds(dbConf Database, sshConf SSH, dir string) (applied []string, err error) {
+	defer tracePhase("seed", map[string]string{"db.name": dbConf.Name, "net.peer.name": dbConf.Host})(&err)
+
+	files, err := SeedFiles(dir)
 	if err != nil {
-		panic("Failed to create inserter instance: " + err.Error())
+		return nil, fmt.Errorf("%s%w", T("Failed to read seed files: "), err)
+	}
+	inserter, err := database.CreateInserter(dbConf, sshConf, nil)
+	if err != nil {
+		return nil, fmt.Errorf("%s%w", T("Failed to create inserter instance: "), err)
+	}
+	for _, file := range files {
+		log.Print("[Seed] applying " + filepath.Base(file))
+		if err := inserter.ApplySeed(file); err != nil {
+			return applied, fmt.Errorf("%s%s: %w", T("Failed to apply seed "), filepath.Base(file), err)
+		}
+		applied = append(applied, filepath.Base(file))
+	}
+	log.Printf("[Seed] applied %d seed files", len(files))
+	return applied, nil
+}
+
+func writeReport(report *Report, path string) {
+	if err := report.Write(path); err != nil {
+		log.Print("[Report] failed to write report: " + err.Error())
+		return
+	}
+	log.Print("[Report] wrote report to " + path)
+}
+
+// uploadReport sends the report to url. A failed upload is logged, and
+// doesn't fail the run.
+func uploadReport(report *Report, url string) {
+	if err := report.Upload(url); err != nil {
+		log.Print("[Report] failed to upload report: " + err.Error())
+		return
 	}
+	log.Print("[Report] uploaded report to " + RedactURL(url))
+}
+
+func saveSnapshot(c *cli.Context, ws *Workspace, snapshotConf Snapshot, dbConf Database) (err error) {
+	defer tracePhase("snapshot", nil)(&err)
 
-	// Clean up
-	err = inserter.Clean()
+	name := c.String("snapshot")
+	if name == "" {
+		name = DefaultSnapshotName(c.String("from"))
+	}
+	tables, err := ws.ReadTableList()
 	if err != nil {
-		panic("Failed to clean: " + err.Error())
+		return fmt.Errorf("%s%w", T("Failed to read the list of tables: "), err)
 	}
 
-	// INSERT
-	err = inserter.Insert()
+	log.Print("[Snapshot] saving fetched dumps as " + name + "...")
+	path, err := SaveSnapshot(ws.Path, snapshotConf, SnapshotMeta{
+		Name:     name,
+		Kind:     SNAPSHOT_KIND_DUMP,
+		Source:   c.String("from"),
+		Database: dbConf.Name,
+		Tables:   tables,
+	})
 	if err != nil {
-		panic("Failed to insert: " + err.Error())
+		return fmt.Errorf("%s%w", T("Failed to save snapshot: "), err)
+	}
+	log.Print("[Snapshot] saved snapshot to " + path)
+
+	return pruneSnapshots(snapshotConf)
+}
+
+func backupDestination(c *cli.Context, ws *Workspace, snapshotConf Snapshot, wsConf WorkspaceConf, to string, dbConf Database, sshConf SSH) (err error) {
+	span, endSpan := startPhaseSpan("backup", map[string]string{"db.name": dbConf.Name, "net.peer.name": dbConf.Host})
+	defer endSpan(&err)
+
+	var tables []string
+	switch c.String("backup") {
+	case BACKUP_ALL:
+	case BACKUP_TARGETED:
+		targeted, err := ws.ReadTableList()
+		if err != nil {
+			return fmt.Errorf("%s%w", T("Failed to read the list of tables: "), err)
+		}
+		tables = targeted
+	default:
+		return errors.New(T("Unknown backup mode: ") + c.String("backup"))
+	}
+
+	backupWs, err := NewWorkspace(BACKUP_DIR_PREFIX, wsConf)
+	if err != nil {
+		return fmt.Errorf("%s%w", T("Failed to create backup directory: "), err)
+	}
+	defer backupWs.Remove()
+
+	log.Print("[Backup] backing up " + to + " before deleting tables...")
+	fetcher, err := database.CreateFetcher(dbConf, sshConf, backupWs, database.FetchOptions{Tables: tables, Retries: c.Int("retries")})
+	if err != nil {
+		return fmt.Errorf("%s%w", T("Failed to create fetcher instance for backup: "), err)
+	}
+	fetcher.TraceUnder(span)
+
+	err = fetcher.Fetch()
+	if errors.Is(err, ErrNoTables) {
+		log.Print("[Backup] " + err.Error() + ", nothing to back up")
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("%s%w", T("Failed to back up: "), err)
+	}
+
+	backupTables, err := backupWs.ReadTableList()
+	if err != nil {
+		return fmt.Errorf("%s%w", T("Failed to read the list of tables: "), err)
+	}
+	path, err := SaveSnapshot(backupWs.Path, snapshotConf, SnapshotMeta{
+		Name:     "backup-" + DefaultSnapshotName(to),
+		Kind:     SNAPSHOT_KIND_BACKUP,
+		Source:   to,
+		Database: dbConf.Name,
+		Tables:   backupTables,
+	})
+	if err != nil {
+		return fmt.Errorf("%s%w", T("Failed to save backup: "), err)
+	}
+	log.Print("[Backup] saved backup to " + path)
+
+	return pruneSnapshots(snapshotConf)
+}
+
+func pruneSnapshots(snapshotConf Snapshot) error {
+	pruned, err := PruneSnapshots(snapshotConf, snapshotConf.KeepLast, snapshotConf.KeepDays)
+	if err != nil {
+		return fmt.Errorf("%s%w", T("Failed to prune snapshots: "), err)
+	}
+	for _, snapshot := range pruned {
+		log.Print("[Snapshot] pruned " + snapshot.Name)
 	}
+	return nil
 }
@@ -1,7 +1,71 @@
 package command
 
-import "testing"
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/timakin/gopli/database"
+	. "github.com/timakin/gopli/lib"
+)
 
 func TestCmdSync(t *testing.T) {
 	// Write your code here
 }
+
+func TestTableFailures(t *testing.T) {
+	deleteErrors := NewTableErrors("delete")
+	deleteErrors.Add("users", errors.New("exit status 1"))
+	loadErrors := NewTableErrors("load")
+	loadErrors.Add("orders", errors.New("exit status 1"))
+
+	if failures := tableFailures(deleteErrors); len(failures) != 1 || failures[0] != deleteErrors {
+		t.Errorf("expected the table errors, got %v", failures)
+	}
+	if failures := tableFailures(errors.Join(deleteErrors, loadErrors)); len(failures) != 2 {
+		t.Errorf("expected the joined table errors, got %v", failures)
+	}
+	if failures := tableFailures(fmt.Errorf("Failed to insert: %w", loadErrors)); failures != nil {
+		t.Errorf("expected nil for an aborting failure, got %v", failures)
+	}
+	if failures := tableFailures(errors.Join(loadErrors, errors.New("Failed to apply seed"))); failures != nil {
+		t.Errorf("expected nil when anything else failed, got %v", failures)
+	}
+	if failures := tableFailures(nil); failures != nil {
+		t.Errorf("expected nil without an error, got %v", failures)
+	}
+}
+
+// cleanFailingInserter fails to delete some tables and records whether the
+// others were loaded.
+type cleanFailingInserter struct {
+	database.DBInserter
+	inserted bool
+}
+
+func (inserter *cleanFailingInserter) Clean() error {
+	failures := NewTableErrors("delete")
+	failures.Add("orders", errors.New("exit status 1"))
+	return failures
+}
+
+func (inserter *cleanFailingInserter) Insert() error {
+	inserter.inserted = true
+	return nil
+}
+
+func TestCleanAndInsertLoadsDeletedTables(t *testing.T) {
+	for _, continueOnError := range []bool{false, true} {
+		inserter := &cleanFailingInserter{}
+		err := cleanAndInsert(inserter, continueOnError)
+		if !inserter.inserted {
+			t.Errorf("continueOnError=%v: expected the deleted tables to be loaded", continueOnError)
+		}
+		if err == nil {
+			t.Fatalf("continueOnError=%v: expected the delete failure", continueOnError)
+		}
+		if failures := tableFailures(err); (failures != nil) != continueOnError {
+			t.Errorf("continueOnError=%v: unexpected table failures %v of %v", continueOnError, failures, err)
+		}
+	}
+}
@@ -0,0 +1,37 @@
+package command
+
+import (
+	"log"
+
+	"github.com/codegangsta/cli"
+	database "github.com/timakin/gopli/database"
+	. "github.com/timakin/gopli/lib"
+)
+
+// SetupTransport switches every command gopli runs to recording or replay
+// mode when the hidden --record or --replay global flags are given, and
+// injects faults when the hidden --chaos-* flags are given. Host keys go
+// unverified with --insecure-ignore-host-key.
+func SetupTransport(c *cli.Context) error {
+	if c.GlobalBool("insecure-ignore-host-key") {
+		log.Print("[Setting] not verifying SSH host keys")
+		IgnoreHostKeys(true)
+	}
+	if dir := c.GlobalString("record"); dir != "" {
+		log.Print("[Setting] recording commands to " + dir)
+		if err := database.RecordTo(dir); err != nil {
+			return err
+		}
+	}
+	if dir := c.GlobalString("replay"); dir != "" {
+		log.Print("[Setting] replaying commands from " + dir)
+		if err := database.ReplayFrom(dir); err != nil {
+			return err
+		}
+	}
+	if c.GlobalInt64("chaos-drop-after") > 0 || c.GlobalFloat64("chaos-fail-loads") > 0 {
+		log.Printf("[Setting] injecting faults: dropping sessions after %d bytes, failing %.0f%% of loads", c.GlobalInt64("chaos-drop-after"), c.GlobalFloat64("chaos-fail-loads")*100)
+		database.InjectFaults(c.GlobalInt64("chaos-drop-after"), c.GlobalFloat64("chaos-fail-loads"))
+	}
+	return nil
+}
@@ -0,0 +1,152 @@
+package command
+
+import (
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/codegangsta/cli"
+	. "github.com/timakin/gopli/constants"
+	database "github.com/timakin/gopli/database"
+	. "github.com/timakin/gopli/lib"
+)
+
+// CmdVerify supports `verify` command in CLI
+func CmdVerify(c *cli.Context) {
+	// Load tomlConfig
+	tmlconf := LoadTomlConf(c.String("config"))
+	applyEnvHostDefaults(c)
+	defer database.CloseConnections()
+	if err := applyPreviewNames(c, tmlconf); err != nil {
+		panic(err)
+	}
+
+	report, err := verifyHosts(c, tmlconf)
+	if err != nil {
+		panic(err)
+	}
+	if c.Bool("json") {
+		if err := report.WriteJSON(os.Stdout); err != nil {
+			panic(err)
+		}
+	} else {
+		report.Print(os.Stdout)
+	}
+	if err := report.Err(); err != nil {
+		panic(fmt.Errorf("%s%w", T("The data differs: "), err))
+	}
+}
+
+// verifyHosts compares the tables a sync copies between the source and the
+// destination. Tables existing on one host only aren't counted.
+func verifyHosts(c *cli.Context, tmlconf TomlConfig) (*VerifyReport, error) {
+	from, to := c.String("from"), c.String("to")
+	if err := tmlconf.RequireHosts(from, to); err != nil {
+		return nil, fmt.Errorf("%s%w", T("Invalid configuration: "), err)
+	}
+	filter := tableFilter(c, tmlconf, from)
+
+	source, err := database.CreateFetcher(tmlconf.Database[from], tmlconf.SSH[from], nil, database.FetchOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("%s%w", T("Failed to create fetcher instance: "), err)
+	}
+	destination, err := database.CreateFetcher(tmlconf.Database[to], tmlconf.SSH[to], nil, database.FetchOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("%s%w", T("Failed to create fetcher instance: "), err)
+	}
+
+	sourceTables, err := verifiedTables(source, from, filter)
+	if err != nil {
+		return nil, err
+	}
+	destinationTables, err := verifiedTables(destination, to, filter)
+	if err != nil {
+		return nil, err
+	}
+	checksummed := func(table string) bool {
+		return c.Bool("checksum") && wholeTable(tmlconf, from, to, table)
+	}
+	sourceCounts, err := countTables(source, from, sourceTables, destinationTables, checksummed)
+	if err != nil {
+		return nil, err
+	}
+	destinationCounts, err := countTables(destination, to, destinationTables, sourceTables, checksummed)
+	if err != nil {
+		return nil, err
+	}
+	return BuildVerifyReport(from, to, sourceCounts, destinationCounts), nil
+}
+
+// verifiedTables returns the tables of host whose data a sync with filter
+// copies.
+func verifiedTables(fetcher database.DBFetcher, host string, filter Filter) ([]string, error) {
+	stats, err := fetcher.TableStats()
+	if err != nil {
+		return nil, fmt.Errorf("%s%s: %w", T("Failed to list the tables of "), host, err)
+	}
+	var tables []string
+	for _, stat := range stats {
+		if stat.SkipReason(filter) == "" && TableClass(filter, stat.Name) != TABLE_CLASS_SCHEMA_ONLY {
+			tables = append(tables, stat.Name)
+		}
+	}
+	return tables, nil
+}
+
+// wholeTable reports whether a sync from one host to the other copies every
+// row and column of table as it is. Only then can their checksums match.
+func wholeTable(tmlconf TomlConfig, from string, to string, table string) bool {
+	if tmlconf.Database[from].Offset > 0 {
+		return false
+	}
+	for name, settings := range tmlconf.Database[from].Tables {
+		if SameTable(name, table) && (settings.Where != "" || settings.Limit > 0) {
+			return false
+		}
+	}
+	for name, settings := range tmlconf.Database[to].Tables {
+		if SameTable(name, table) && len(settings.Set) > 0 {
+			return false
+		}
+	}
+	for name, selection := range tmlconf.Columns {
+		if SameTable(name, table) && len(selection.Include) > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// countTables counts the rows of the tables of host that also exist on the
+// other host, and checksums the ones checksummed accepts.
+func countTables(fetcher database.DBFetcher, host string, tables []string, otherTables []string, checksummed func(table string) bool) (TableCounts, error) {
+	var common []string
+	for _, table := range tables {
+		for _, other := range otherTables {
+			if SameTable(table, other) {
+				common = append(common, table)
+				break
+			}
+		}
+	}
+
+	log.Printf("[Verify] counting the rows of %d tables on %s...", len(common), host)
+	counts := TableCounts{Tables: tables}
+	var err error
+	if counts.Rows, err = fetcher.RowCounts(common); err != nil {
+		return counts, fmt.Errorf("%s%s: %w", T("Failed to count rows on "), host, err)
+	}
+	var checksums []string
+	for _, table := range common {
+		if checksummed(table) {
+			checksums = append(checksums, table)
+		}
+	}
+	if len(checksums) > 0 {
+		log.Print("[Verify] checksumming tables on " + host + "...")
+		if counts.Checksums, err = fetcher.TableChecksums(checksums); err != nil {
+			return counts, fmt.Errorf("%s%s: %w", T("Failed to checksum tables on "), host, err)
+		}
+	}
+	return counts, nil
+}
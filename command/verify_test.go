@@ -0,0 +1,27 @@
+package command
+
+import (
+	"testing"
+
+	. "github.com/timakin/gopli/constants"
+	. "github.com/timakin/gopli/lib"
+)
+
+func TestWholeTable(t *testing.T) {
+	tmlconf := TomlConfig{
+		Database: map[string]Database{
+			"production": {Tables: map[string]TableSettings{"events": {Where: "created_at > NOW() - INTERVAL 30 DAY"}, "logs": {Limit: 1000}}},
+			"staging":    {Tables: map[string]TableSettings{"users": {Set: map[string]string{"email": "NULL"}}}},
+		},
+		Columns: map[string]ColumnSelection{"documents": {Include: []string{"id", "title"}}},
+	}
+	for table, want := range map[string]bool{"orders": true, "events": false, "logs": false, "users": false, "documents": false} {
+		if got := wholeTable(tmlconf, "production", "staging", table); got != want {
+			t.Errorf("wholeTable(%s) = %v, want %v", table, got, want)
+		}
+	}
+	tmlconf.Database["production"] = Database{Offset: 100}
+	if wholeTable(tmlconf, "production", "staging", "orders") {
+		t.Error("expected tables capped by offset to be partial")
+	}
+}
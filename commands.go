@@ -3,23 +3,335 @@ package main
 import (
 	"fmt"
 	"os"
+	"time"
 
 	"github.com/codegangsta/cli"
 	"github.com/timakin/gopli/command"
+	. "github.com/timakin/gopli/constants"
+	"github.com/timakin/gopli/lib"
 )
 
-var GlobalFlags = []cli.Flag{}
+var GlobalFlags = []cli.Flag{
+	cli.BoolFlag{
+		Name:  "no-color, plain",
+		Usage: "Print no colors or other ANSI escapes (default when stdout is not a terminal or NO_COLOR is set)",
+	},
+	cli.StringFlag{
+		Name:  "lang",
+		Usage: "Show errors in `LANG` (en or ja, default: from LC_ALL, LC_MESSAGES or LANG)",
+	},
+	cli.StringFlag{
+		Name:  "log-level",
+		Usage: "Log at `LEVEL` (info, or error to only show errors; default: log_level in [defaults] or info)",
+	},
+	cli.BoolFlag{
+		Name:  "insecure-ignore-host-key",
+		Usage: "Connect over SSH without verifying host keys against known_hosts",
+	},
+	cli.StringFlag{
+		Name:   "record",
+		Usage:  "Record every command and its output as fixtures in `DIR`",
+		Hidden: true,
+	},
+	cli.StringFlag{
+		Name:   "replay",
+		Usage:  "Answer every command from the fixtures in `DIR` instead of contacting hosts",
+		Hidden: true,
+	},
+	cli.Int64Flag{
+		Name:   "chaos-drop-after",
+		Usage:  "Drop every remote session after `BYTES` of output",
+		Hidden: true,
+	},
+	cli.Float64Flag{
+		Name:   "chaos-fail-loads",
+		Usage:  "Fail the given `RATIO` (0.0-1.0) of loads",
+		Hidden: true,
+	},
+}
+
+var configFlag = cli.StringFlag{
+	Name:   "config, c",
+	Usage:  "Load configuration from `FILE` (default: read GOPLI_SRC_* and GOPLI_DST_* environment variables)",
+	EnvVar: "GOPLI_CONFIG",
+}
+
+var syncFlags = []cli.Flag{
+	configFlag,
+	cli.StringFlag{
+		Name:  "from, f",
+		Usage: "Target `HOST` for fetching data source",
+	},
+	cli.StringFlag{
+		Name:  "to, t",
+		Usage: "Target `HOST` to apply copied data from other host, or comma separated hosts to load into concurrently",
+	},
+	cli.BoolFlag{
+		Name:  "keep-dumps",
+		Usage: "Keep the fetched dumps as a snapshot",
+	},
+	cli.StringFlag{
+		Name:  "snapshot",
+		Usage: "Snapshot `NAME` used with --keep-dumps (default: <from>-<timestamp>)",
+	},
+	cli.StringFlag{
+		Name:  "backup",
+		Usage: "Back up the destination before deleting its data (`MODE`: all or targeted)",
+	},
+	cli.StringFlag{
+		Name:  "report",
+		Usage: "Write a JSON summary of the run to `FILE`",
+	},
+	cli.StringFlag{
+		Name:  "report-url",
+		Usage: "Upload the JSON summary of the run to an s3:// `URL`, or POST it to an http(s) URL",
+	},
+	cli.IntFlag{
+		Name:  "retries",
+		Usage: "Retry a failing table `N` more times",
+	},
+	cli.StringFlag{
+		Name:  "on-table-error",
+		Value: "abort",
+		Usage: "What to do with tables that still fail after retrying (`POLICY`: abort or skip)",
+	},
+	cli.BoolFlag{
+		Name:  "continue-on-error",
+		Usage: "Sync the remaining tables when tables fail to fetch, delete or load, and exit with a summary of the failures",
+	},
+	cli.BoolFlag{
+		Name:  "dry-run",
+		Usage: "Print what the sync would delete and load without changing the destination (--dry-run=false overrides dry_run in [defaults])",
+	},
+	cli.IntFlag{
+		Name:  "no-tables-exit-code",
+		Usage: "Exit with `CODE` instead of 0 when the source has no table to sync",
+	},
+	cli.IntFlag{
+		Name:  "ssh-connections",
+		Usage: "Open `N` SSH connections per host and spread sessions over them",
+	},
+	cli.StringFlag{
+		Name:  "compression",
+		Usage: "Compress dumps on the source host with `CODEC` (gzip, zstd, lz4 or none)",
+	},
+	cli.StringFlag{
+		Name:  "dump-tool",
+		Usage: "Dump with `TOOL` (mysql, or mysqlsh for MySQL Shell's parallel dump and load when installed)",
+	},
+	cli.IntFlag{
+		Name:  "recent-partitions",
+		Usage: "Only sync the last `N` partitions of partitioned tables",
+	},
+	cli.BoolFlag{
+		Name:  "order-by-pk",
+		Usage: "Dump rows in primary key order, so InnoDB destinations load them without page splits",
+	},
+	cli.BoolFlag{
+		Name:  "cache",
+		Usage: "Reuse cached dumps of unchanged tables and skip loading tables the destination already holds",
+	},
+	cli.BoolFlag{
+		Name:  "skip-unchanged",
+		Usage: "Skip tables whose CHECKSUM TABLE matches on both hosts before fetching them",
+	},
+	cli.BoolFlag{
+		Name:  "tui",
+		Usage: "Show the progress of every table full screen instead of logging, when stdout is a terminal",
+	},
+	cli.BoolFlag{
+		Name:  "changed-only",
+		Usage: "Only sync tables whose CHECKSUM TABLE on the source changed since the last --changed-only sync",
+	},
+	cli.BoolFlag{
+		Name:  "with-schema",
+		Usage: "Create missing tables and recreate tables whose schema differs from the source before loading",
+	},
+	cli.BoolFlag{
+		Name:  "with-views-and-triggers",
+		Usage: "Replace the views and the triggers of the synced tables with the ones of the source after loading",
+	},
+	varFlag,
+	onlyFlag,
+	skipFlag,
+	cli.StringFlag{
+		Name:   "otlp-endpoint",
+		Usage:  "Export OpenTelemetry spans of every phase and table to the OTLP/HTTP collector at `URL`, e.g. http://localhost:4318",
+		EnvVar: "OTEL_EXPORTER_OTLP_ENDPOINT",
+	},
+	cli.DurationFlag{
+		Name:  "sample-load",
+		Usage: "Sample the source load for `DURATION` first and warn when it exceeds peak_qps or peak_threads",
+	},
+}
+
+var onlyFlag = cli.StringSliceFlag{
+	Name:  "only",
+	Usage: "Only sync tables matching `PATTERN`, a glob or /regexp/ (repeatable, replaces include_tables)",
+}
+
+var skipFlag = cli.StringSliceFlag{
+	Name:  "skip",
+	Usage: "Don't sync tables matching `PATTERN`, a glob or /regexp/ (repeatable, adds to exclude_tables)",
+}
+
+var varFlag = cli.StringSliceFlag{
+	Name:  "var",
+	Usage: "Set `NAME=VALUE` for the database names of preview destinations, e.g. --var PR=123",
+}
 
 var Commands = []cli.Command{
 	{
 		Name:   "sync",
 		Usage:  "",
 		Action: command.CmdSync,
-		Flags:  []cli.Flag{
+		Flags:  syncFlags,
+	},
+	{
+		Name:   "daemon",
+		Usage:  "Run sync repeatedly with health check endpoints",
+		Action: command.CmdDaemon,
+		Flags: append([]cli.Flag{
+			cli.DurationFlag{
+				Name:  "interval",
+				Value: 24 * time.Hour,
+				Usage: "Run a sync every `DURATION`",
+			},
+			cli.StringFlag{
+				Name:  "listen",
+				Value: DEFAULT_DAEMON_LISTEN,
+				Usage: "`ADDRESS` serving /healthz, /readyz and /resume",
+			},
+			cli.StringFlag{
+				Name:   "resume-token",
+				Usage:  "Require `TOKEN` as a bearer token to POST /resume",
+				EnvVar: "GOPLI_RESUME_TOKEN",
+			},
+			cli.StringFlag{
+				Name:  "on-schema-drift",
+				Value: "ignore",
+				Usage: "What to do when the source schema changed since the first run (`POLICY`: ignore or pause)",
+			},
+			cli.StringFlag{
+				Name:  "notify-url",
+				Usage: "POST a JSON notification to `URL` when scheduled runs are paused",
+			},
+			cli.BoolFlag{
+				Name:  "defer-on-peak",
+				Usage: "Postpone a scheduled run when --sample-load finds the source at peak load",
+			},
+			cli.DurationFlag{
+				Name:  "peak-retry",
+				Value: DEFAULT_PEAK_RETRY_WAIT,
+				Usage: "Retry a run postponed by --defer-on-peak after `DURATION`",
+			},
+			cli.IntFlag{
+				Name:  "max-deferrals",
+				Value: DEFAULT_MAX_PEAK_DEFERRALS,
+				Usage: "Start a scheduled run anyway after postponing it `COUNT` times in a row (0 for no limit)",
+			},
+		}, syncFlags...),
+	},
+	{
+		Name:   "plan",
+		Usage:  "Show what a sync would do to every table",
+		Action: command.CmdPlan,
+		Flags: []cli.Flag{
+			configFlag,
+			cli.StringFlag{
+				Name:  "from, f",
+				Usage: "Target `HOST` for fetching data source",
+			},
+			cli.StringFlag{
+				Name:  "to, t",
+				Usage: "Target `HOST` to apply copied data from other host",
+			},
+			cli.StringFlag{
+				Name:  "out, o",
+				Usage: "Save the plan to `FILE` for apply",
+			},
+			onlyFlag,
+			skipFlag,
+			varFlag,
+		},
+	},
+	{
+		Name:   "apply",
+		Usage:  "Execute a plan saved by plan --out",
+		Action: command.CmdApply,
+		Flags: append([]cli.Flag{
+			cli.StringFlag{
+				Name:  "plan, p",
+				Usage: "Plan `FILE` to execute",
+			},
+		}, syncFlags...),
+	},
+	{
+		Name:   "schema",
+		Usage:  "Show the DDL bringing the destination schema in line with the source",
+		Action: command.CmdSchema,
+		Flags: []cli.Flag{
+			configFlag,
+			cli.StringFlag{
+				Name:  "from, f",
+				Usage: "Target `HOST` for fetching data source",
+			},
+			cli.StringFlag{
+				Name:  "to, t",
+				Usage: "Target `HOST` to apply copied data from other host",
+			},
 			cli.StringFlag{
-				Name:  "config, c",
-				Usage: "Load configuration from `FILE`",
+				Name:  "ddl-dir",
+				Usage: "Save the DDL as a timestamped migration file in `DIR`",
+			},
+			cli.BoolFlag{
+				Name:  "apply",
+				Usage: "Run the DDL on the destination",
 			},
+			cli.BoolFlag{
+				Name:  "drop-columns",
+				Usage: "Drop columns that exist only on the destination instead of keeping them",
+			},
+			cli.BoolFlag{
+				Name:  "check",
+				Usage: "Exit with status 5 instead of applying when the schemas differ",
+			},
+			cli.StringFlag{
+				Name:  "online-ddl",
+				Usage: "Alter large tables with `TOOL` (gh-ost or pt-osc) on the destination host instead of ALTER TABLE",
+			},
+			cli.Int64Flag{
+				Name:  "online-ddl-min-rows",
+				Value: 100000,
+				Usage: "Use --online-ddl for tables with at least `N` rows",
+			},
+			varFlag,
+		},
+	},
+	{
+		Name:   "list-tables",
+		Usage:  "List the source tables a sync would include, with their estimated size",
+		Action: command.CmdListTables,
+		Flags: []cli.Flag{
+			configFlag,
+			cli.StringFlag{
+				Name:  "from, f",
+				Usage: "Target `HOST` for fetching data source",
+			},
+			cli.BoolFlag{
+				Name:  "all, a",
+				Usage: "Also list the tables that are never synced",
+			},
+			onlyFlag,
+			skipFlag,
+		},
+	},
+	{
+		Name:   "verify",
+		Usage:  "Compare the row counts and checksums of the tables of two hosts",
+		Action: command.CmdVerify,
+		Flags: []cli.Flag{
+			configFlag,
 			cli.StringFlag{
 				Name:  "from, f",
 				Usage: "Target `HOST` for fetching data source",
@@ -28,11 +340,173 @@ var Commands = []cli.Command{
 				Name:  "to, t",
 				Usage: "Target `HOST` to apply copied data from other host",
 			},
+			cli.BoolFlag{
+				Name:  "checksum",
+				Usage: "Also compare the checksums of the tables",
+			},
+			cli.BoolFlag{
+				Name:  "json",
+				Usage: "Print the report as JSON",
+			},
+			onlyFlag,
+			skipFlag,
+			varFlag,
+		},
+	},
+	{
+		Name:   "show-config",
+		Usage:  "Print the configuration in use with secrets redacted",
+		Action: command.CmdShowConfig,
+		Flags: []cli.Flag{
+			configFlag,
+			cli.StringFlag{
+				Name:  "from, f",
+				Usage: "Also validate the source `HOST`",
+			},
+			cli.StringFlag{
+				Name:  "to, t",
+				Usage: "Also validate the destination `HOST`",
+			},
+		},
+	},
+	{
+		Name:   "config-schema",
+		Usage:  "Print a JSON Schema of the configuration file for editors and tooling",
+		Action: command.CmdConfigSchema,
+	},
+	{
+		Name:   "doctor",
+		Usage:  "Check a destination for settings left behind by interrupted loads",
+		Action: command.CmdDoctor,
+		Flags: []cli.Flag{
+			configFlag,
+			cli.StringFlag{
+				Name:  "to, t",
+				Usage: "Destination `HOST` to check",
+			},
+			varFlag,
+		},
+	},
+	{
+		Name:   "destroy",
+		Usage:  "Drop the database of a preview destination",
+		Action: command.CmdDestroy,
+		Flags: []cli.Flag{
+			configFlag,
+			cli.StringFlag{
+				Name:  "to, t",
+				Usage: "Preview destination `HOST` to drop",
+			},
+			varFlag,
+		},
+	},
+	{
+		Name:   "bench",
+		Usage:  "Measure fetch throughput at several concurrency settings",
+		Action: command.CmdBench,
+		Flags: []cli.Flag{
+			configFlag,
+			cli.StringFlag{
+				Name:  "from, f",
+				Usage: "Target `HOST` for fetching data source",
+			},
+			cli.StringSliceFlag{
+				Name:  "table",
+				Usage: "Benchmark with `TABLE` (repeatable, default: mid-size tables of the source)",
+			},
+			cli.IntFlag{
+				Name:  "sample",
+				Value: 3,
+				Usage: "Number of mid-size tables to pick when --table is not given",
+			},
+			cli.StringFlag{
+				Name:  "concurrency",
+				Value: "1,2,4,8",
+				Usage: "Comma separated `LIST` of session counts to try",
+			},
+			cli.StringFlag{
+				Name:  "compression",
+				Usage: "Compress dumps on the source host with `CODEC` (gzip, zstd, lz4 or none)",
+			},
+		},
+	},
+	{
+		Name:   "restore",
+		Usage:  "Load a retained snapshot into a destination",
+		Action: command.CmdRestore,
+		Flags: []cli.Flag{
+			configFlag,
+			cli.StringFlag{
+				Name:  "snapshot, s",
+				Usage: "Snapshot `NAME` to restore",
+			},
+			cli.StringFlag{
+				Name:  "to, t",
+				Usage: "Target `HOST` to apply the snapshot",
+			},
+		},
+	},
+	{
+		Name:   "clean",
+		Usage:  "Remove temporary directories left behind by crashed runs",
+		Action: command.CmdClean,
+		Flags: []cli.Flag{
+			cli.DurationFlag{
+				Name:  "older-than",
+				Value: 24 * time.Hour,
+				Usage: "Only remove directories untouched for longer than `DURATION`",
+			},
+			cli.BoolFlag{
+				Name:  "dry-run",
+				Usage: "List the directories without removing them",
+			},
+		},
+	},
+	{
+		Name:   "rollback",
+		Usage:  "Restore the latest destination backup taken by sync --backup",
+		Action: command.CmdRollback,
+		Flags: []cli.Flag{
+			configFlag,
+			cli.StringFlag{
+				Name:  "to, t",
+				Usage: "Target `HOST` to roll back",
+			},
+			cli.StringFlag{
+				Name:  "snapshot, s",
+				Usage: "Backup `NAME` to restore (default: the latest backup of the target)",
+			},
+		},
+	},
+	{
+		Name:   "snapshots",
+		Usage:  "List retained snapshots",
+		Action: command.CmdSnapshots,
+		Flags: []cli.Flag{
+			configFlag,
+		},
+		Subcommands: []cli.Command{
+			{
+				Name:   "prune",
+				Usage:  "Remove snapshots outside of the retention policy",
+				Action: command.CmdSnapshotsPrune,
+				Flags: []cli.Flag{
+					configFlag,
+					cli.IntFlag{
+						Name:  "keep-last",
+						Usage: "Keep the newest `N` snapshots",
+					},
+					cli.IntFlag{
+						Name:  "keep-days",
+						Usage: "Keep snapshots created within the last `DAYS` days",
+					},
+				},
+			},
 		},
 	},
 }
 
 func CommandNotFound(c *cli.Context, command string) {
-	fmt.Fprintf(os.Stderr, "%s: '%s' is not a %s command. See '%s --help'.", c.App.Name, command, c.App.Name, c.App.Name)
-	os.Exit(2)
+	fmt.Fprintf(os.Stderr, lib.T("%s: '%s' is not a %s command. See '%s --help'."), c.App.Name, command, c.App.Name, c.App.Name)
+	os.Exit(EXIT_USAGE)
 }
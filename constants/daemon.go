@@ -0,0 +1,21 @@
+package constants
+
+const (
+	SCHEMA_DRIFT_IGNORE = "ignore"
+	SCHEMA_DRIFT_PAUSE  = "pause"
+
+	DEFAULT_DAEMON_LISTEN = "127.0.0.1:8080"
+
+	NOTIFY_TIMEOUT_SECONDS = 10
+	NOTIFY_EVENT_DRAIN     = "drain"
+
+	REPORT_SCHEME_S3              = "s3://"
+	REPORT_UPLOAD_TIMEOUT_SECONDS = 30
+
+	OTLP_TRACES_PATH            = "/v1/traces"
+	OTLP_SERVICE_NAME           = "gopli"
+	OTLP_EXPORT_TIMEOUT_SECONDS = 10
+	OTLP_SPAN_KIND_INTERNAL     = 1
+	OTLP_STATUS_OK              = 1
+	OTLP_STATUS_ERROR           = 2
+)
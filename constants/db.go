@@ -1,14 +1,158 @@
 package constants
 
+import "time"
+
 const (
-	SELECT_TABLES_CMD_FORMAT = "mysql -u%s -p%s -B -N -e 'SELECT * FROM %s.%s'"
-	SHOW_TABLES_CMD_FORMAT   = "mysql %s -u%s -p%s -B -N -e 'show tables'"
+	LIST_TABLES_QUERY_FORMAT   = "SELECT table_schema, table_name, IF(table_type = 'SEQUENCE', table_type, IFNULL(engine, table_type)) FROM information_schema.tables WHERE %s ORDER BY table_schema, table_name LIMIT %d OFFSET %d;"
+	TABLE_STATS_QUERY_FORMAT   = "SELECT table_name, IFNULL(table_rows, 0), IFNULL(data_length, 0), IF(table_type = 'SEQUENCE', table_type, IFNULL(engine, table_type)) FROM information_schema.tables WHERE table_schema = '%s' ORDER BY table_name;"
+	SCHEMA_EXISTS_QUERY_FORMAT = "SELECT COUNT(*) FROM information_schema.schemata WHERE schema_name = '%s';"
+	SERVER_VERSION_QUERY       = "SELECT VERSION();"
+	PING_QUERY                 = "SELECT 1;"
+	TABLE_LIST_PAGE_SIZE       = 1000
+	MAX_LINE_SIZE              = 16 * 1024 * 1024
+
+	SELECT_TABLE_QUERY_FORMAT = "SELECT %s FROM %s"
+	DELETE_TABLE_QUERY_FORMAT = "DELETE FROM %s"
+	BATCH_DELETE_QUERY_FORMAT = "DELETE FROM %s%s LIMIT %d; SELECT ROW_COUNT();"
+	DELETE_PARTITION_FORMAT   = "DELETE FROM %s PARTITION (%s)"
+	LOCK_TABLE_QUERY_FORMAT   = "LOCK TABLES %s WRITE;\n"
+	UNLOCK_TABLES_QUERY       = ";\nUNLOCK TABLES;"
+	LOAD_INFILE_QUERY_FORMAT  = "LOAD DATA LOCAL INFILE '%s' INTO TABLE %s"
+	STDIN_INFILE              = "/dev/stdin"
+
+	SSH_AUTH_KEY       = "key"
+	SSH_AUTH_GSSAPI    = "gssapi"
+	SSH_DEFAULT_PORT   = "22"
+	SSH_AGENT_SOCK_ENV = "SSH_AUTH_SOCK"
+	KNOWN_HOSTS_FILE   = "~/.ssh/known_hosts"
+	TRANSPORT_SSH      = "ssh"
+	TRANSPORT_TELEPORT = "teleport"
+	TRANSPORT_SSM      = "ssm"
+	// SSM_PROXY_COMMAND tunnels the OpenSSH client to the port of an
+	// instance through SSM Session Manager.
+	SSM_PROXY_COMMAND = "aws ssm start-session --target %h --document-name AWS-StartSSHSession --parameters portNumber=%p"
+
+	PROXY_PROXYSQL = "proxysql"
+	PROXY_VITESS   = "vitess"
+
+	INSERT_QUERY_FORMAT = "INSERT INTO %s VALUES "
+	INSERT_BATCH_ROWS   = 1000
+	INSERT_BATCH_SIZE   = 1024 * 1024
+
+	RDS_PORT                  = "3306"
+	IAM_TOKEN_REFRESH_MINUTES = 10
+
+	NATIVE_LOCAL_HOST           = "127.0.0.1"
+	NATIVE_DEFAULT_PORT         = "3306"
+	NATIVE_COLLATION            = "utf8mb4_general_ci"
+	NATIVE_NETWORK_FORMAT       = "gopli-tunnel-%d"
+	NATIVE_READER_FORMAT        = "gopli-stdin-%d"
+	NATIVE_ERROR_FORMAT         = "ERROR %d (HY000): %s\n"
+	NATIVE_CONNECT_ERROR_FORMAT = "ERROR 2003 (HY000): Can't connect to MySQL server on '%s' (%v)\n"
 
-	CLEAN_TABLES_CMD_FORMAT                    = "mysql -u%s -p%s -B -N -e 'DELETE FROM %s.%s'"
-	CLEAN_TABLES_CMD_FORMAT_WITHOUT_PASSPHRASE = "mysql -u%s -B -N -e 'DELETE FROM %s.%s'"
+	DUMP_TOOL_MYSQL            = "mysql"
+	DUMP_TOOL_MYSQLSH          = "mysqlsh"
+	MYSQLSH_DUMP_TABLE         = "(mysqlsh dump)"
+	MYSQLSH_DUMP_METADATA_FILE = "@.json"
+	MYSQLSH_DUMP_SCRIPT_FORMAT = `util.dumpTables(%s, %s, os.getenv("GOPLI_DUMP_DIR"), {threads: %d, compression: %s, showProgress: false})`
+	MYSQLSH_LOAD_SCRIPT_FORMAT = `util.loadDump(%s, {schema: %s, threads: %d, loadDdl: false, ignoreExistingObjects: true, resetProgress: true, showProgress: false})`
 
-	DELETE_TABLE_QUERY_FORMAT = "DELETE FROM %s.%s"
-	LOAD_INFILE_QUERY_FORMAT  = "LOAD DATA LOCAL INFILE '%s' INTO TABLE %s.%s"
+	FLAVOR_MYSQL   = "mysql"
+	FLAVOR_MARIADB = "mariadb"
 
-	TMP_DIR_PATH = "/tmp/db_sync"
+	INNODB_ENGINE             = "InnoDB"
+	MYISAM_ENGINE             = "MyISAM"
+	ROCKSDB_ENGINE            = "ROCKSDB"
+	TOKUDB_ENGINE             = "TokuDB"
+	INNODB_LOAD_SESSION       = "SET autocommit=0; SET unique_checks=0; SET foreign_key_checks=0;\n"
+	ROCKSDB_LOAD_SESSION      = "SET SESSION rocksdb_bulk_load_allow_unsorted=1; SET SESSION rocksdb_bulk_load=1;\n"
+	TOKUDB_LOAD_SESSION       = "SET autocommit=0; SET unique_checks=0; SET SESSION tokudb_commit_sync=0;\n"
+	COMMIT_LOAD_SESSION       = ";\nCOMMIT;"
+	ROCKSDB_END_LOAD_SESSION  = ";\nSET SESSION rocksdb_bulk_load=0;"
+	DISABLE_KEYS_QUERY_FORMAT = "ALTER TABLE %s DISABLE KEYS"
+	ENABLE_KEYS_QUERY_FORMAT  = "ALTER TABLE %s ENABLE KEYS"
+
+	DISABLED_KEYS_QUERY_FORMAT = "SELECT DISTINCT table_name FROM information_schema.statistics WHERE table_schema = '%s' AND comment = 'disabled' ORDER BY table_name;"
+	GLOBAL_SETTINGS_QUERY      = "SELECT 'autocommit', @@GLOBAL.autocommit UNION ALL SELECT 'unique_checks', @@GLOBAL.unique_checks UNION ALL SELECT 'foreign_key_checks', @@GLOBAL.foreign_key_checks;"
+
+	PARTITIONS_QUERY_FORMAT         = "SELECT DISTINCT table_name, partition_name, partition_ordinal_position, IFNULL(partition_description, '') FROM information_schema.partitions WHERE table_schema = '%s' AND partition_name IS NOT NULL ORDER BY table_name, partition_ordinal_position;"
+	PRIMARY_KEYS_QUERY_FORMAT       = "SELECT table_name, column_name FROM information_schema.statistics WHERE table_schema = '%s' AND index_name = 'PRIMARY' ORDER BY table_name, seq_in_index;"
+	TABLE_KEYS_QUERY_FORMAT         = "SELECT table_schema, table_name, column_name FROM information_schema.statistics WHERE (%s) AND index_name = 'PRIMARY' ORDER BY table_schema, table_name, seq_in_index;"
+	TABLE_COLUMNS_QUERY_FORMAT      = "SELECT table_schema, table_name, column_name FROM information_schema.columns WHERE (%s) ORDER BY table_schema, table_name, ordinal_position;"
+	ORDER_BY_FORMAT                 = " ORDER BY %s"
+	WHERE_FORMAT                    = " WHERE %s"
+	LIMIT_FORMAT                    = " LIMIT %d"
+	SET_FORMAT                      = " SET %s"
+	COUNT_ROWS_QUERY_FORMAT         = "SELECT COUNT(*) FROM %s"
+	TRUNCATE_PARTITION_QUERY_FORMAT = "ALTER TABLE %s TRUNCATE PARTITION %s"
+	CHECKSUM_TABLE_QUERY_FORMAT     = "CHECKSUM TABLE %s"
+
+	TMP_DIR_PREFIX         = "db_sync_"
+	BACKUP_DIR_PREFIX      = "db_sync_backup_"
+	TMP_DIR_PATTERN        = "db_sync*"
+	TABLE_LIST_FILE        = "table_list.txt"
+	COLUMNS_FILE_SUFFIX    = ".columns"
+	PARTITIONS_FILE_SUFFIX = ".partitions"
+	SIZE_FILE_SUFFIX       = ".size"
+	GZIP_FILE_EXT          = ".gz"
+	// Files are written under this extension and renamed once complete.
+	PARTIAL_FILE_EXT = ".partial"
+	// Dumps stream to disk through a buffer of this size.
+	TABLE_WRITE_BUFFER_SIZE = 1024 * 1024
+	// Dumps holding fewer rows than this share of the source are counted
+	// exactly, and fail when they still fall short.
+	SHORT_DUMP_RATIO = 0.5
+	CHECKSUMS_FILE   = "checksums"
+
+	COMPRESSION_NONE = "none"
+	COMPRESSION_GZIP = "gzip"
+	COMPRESSION_ZSTD = "zstd"
+	COMPRESSION_LZ4  = "lz4"
+
+	TABLE_ERROR_ABORT = "abort"
+	TABLE_ERROR_SKIP  = "skip"
+
+	DEFAULT_DIR_MODE  = 0700
+	DEFAULT_FILE_MODE = 0600
+)
+
+const (
+	ACTIVE_CONNECTIONS_QUERY_FORMAT = "SELECT COUNT(*) FROM information_schema.processlist WHERE db = '%s' AND id <> CONNECTION_ID();"
+	DEFAULT_DRAIN_TIMEOUT_SECONDS   = 60
+	DRAIN_POLL_INTERVAL_SECONDS     = 1
+	DRAIN_HOOK_TIMEOUT_SECONDS      = 30
+
+	// The marker is a whole comment, so the end of the comment keeps the
+	// marker of dump 1 from matching dumps 10 and up.
+	DUMP_MARKER_FORMAT          = "/* gopli-dump:%d-%d */"
+	DUMP_PROCESSES_QUERY_FORMAT = "SELECT id FROM information_schema.processlist WHERE info LIKE '%%%s%%' AND id <> CONNECTION_ID();"
+	KILL_QUERY_FORMAT           = "KILL QUERY %s;"
+
+	LOAD_STATUS_QUERY          = "SHOW GLOBAL STATUS WHERE Variable_name IN ('Questions', 'Threads_connected');"
+	LOAD_SAMPLE_INTERVAL       = 10 * time.Second
+	DEFAULT_PEAK_RETRY_WAIT    = 15 * time.Minute
+	DEFAULT_MAX_PEAK_DEFERRALS = 8
+)
+
+const (
+	CREATE_DATABASE_QUERY_FORMAT = "CREATE DATABASE IF NOT EXISTS %s"
+	DROP_DATABASE_QUERY_FORMAT   = "DROP DATABASE IF EXISTS %s"
+	FOREIGN_KEY_CHECKS_OFF       = "SET foreign_key_checks = 0;\n"
+)
+
+const (
+	SEED_SQL_EXT          = ".sql"
+	SEED_CSV_EXT          = ".csv"
+	SEED_CSV_QUERY_FORMAT = "LOAD DATA LOCAL INFILE '%s' REPLACE INTO TABLE %s CHARACTER SET utf8mb4 FIELDS TERMINATED BY ',' OPTIONALLY ENCLOSED BY '\"' LINES TERMINATED BY '%s' IGNORE 1 LINES (%s)"
+	SEED_CSV_LF           = "\\n"
+	SEED_CSV_CRLF         = "\\r\\n"
+)
+
+const (
+	LOCK_WAIT_TIMEOUT_INIT_FORMAT = "SET SESSION innodb_lock_wait_timeout = %d, lock_wait_timeout = %d"
+	LOCK_WAIT_TIMEOUT_ERROR       = "ERROR 1205 "
+	DEADLOCK_ERROR                = "ERROR 1213 "
+	DEFAULT_LOCK_RETRIES          = 3
+	LOCK_RETRY_BACKOFF            = 500 * time.Millisecond
+	LOCK_HOLDERS_QUERY            = "SELECT t.trx_mysql_thread_id, IFNULL(p.user, ''), IFNULL(p.host, ''), t.trx_state, t.trx_started, IFNULL(t.trx_query, '') FROM information_schema.innodb_trx t LEFT JOIN information_schema.processlist p ON p.id = t.trx_mysql_thread_id WHERE t.trx_mysql_thread_id <> CONNECTION_ID() AND t.trx_tables_locked > 0 ORDER BY t.trx_started;"
 )
@@ -0,0 +1,11 @@
+package constants
+
+const (
+	ENV_SOURCE_PREFIX      = "GOPLI_SRC_"
+	ENV_DESTINATION_PREFIX = "GOPLI_DST_"
+
+	ENV_SOURCE_NAME      = "source"
+	ENV_DESTINATION_NAME = "destination"
+
+	JSON_SCHEMA_DRAFT = "http://json-schema.org/draft-07/schema#"
+)
@@ -0,0 +1,23 @@
+package constants
+
+// Exit codes of the CLI, telling scripts why a command failed.
+const (
+	EXIT_FAILURE               = 1
+	EXIT_USAGE                 = 2
+	EXIT_CONFIG                = 3
+	EXIT_CONNECTION            = 4
+	EXIT_SCHEMA_MISMATCH       = 5
+	EXIT_LOCAL_INFILE_DISABLED = 6
+	EXIT_LOCK_WAIT_TIMEOUT     = 7
+	EXIT_AUTHENTICATION        = 8
+	EXIT_SSH                   = 9
+	EXIT_DATABASE              = 10
+	EXIT_DATA_MISMATCH         = 11
+	EXIT_INTERRUPTED           = 130
+
+	LOCAL_INFILE_DISABLED_ERROR = "ERROR 3948 "
+	LOCAL_INFILE_REFUSED_ERROR  = "ERROR 1148 "
+
+	// Only the end of the stderr of a command is kept to explain its failure.
+	STDERR_TAIL_SIZE = 4096
+)
@@ -0,0 +1,6 @@
+package constants
+
+const (
+	LANG_EN = "en"
+	LANG_JA = "ja"
+)
@@ -1,4 +1,6 @@
 package constants
 
 const (
+	LOG_LEVEL_INFO  = "info"
+	LOG_LEVEL_ERROR = "error"
 )
@@ -0,0 +1,15 @@
+package constants
+
+const (
+	PLAN_ACTION_REPLACE = "replace"
+	PLAN_ACTION_SKIP    = "skip"
+
+	PLAN_REASON_EXCLUDED            = "excluded"
+	PLAN_REASON_FILTERED            = "filtered out"
+	PLAN_REASON_MISSING_DESTINATION = "missing on destination"
+	PLAN_REASON_NO_DATA_ENGINE      = "no data (%s)"
+	PLAN_REASON_SCHEMA_ONLY         = "schema only"
+
+	TABLE_CLASS_SCHEMA_ONLY = "schema_only"
+	TABLE_CLASS_DATA_ONLY   = "data_only"
+)
@@ -0,0 +1,37 @@
+package constants
+
+const (
+	MANAGEMENT_SYSTEM_MYSQL      = "mysql"
+	MANAGEMENT_SYSTEM_POSTGRESQL = "postgresql"
+
+	// PG_DEFAULT_SCHEMA holds the tables listed without a schema.
+	PG_DEFAULT_SCHEMA = "public"
+	// PG_MAINTENANCE_DATABASE is connected to for creating and dropping databases.
+	PG_MAINTENANCE_DATABASE = "postgres"
+
+	PG_LIST_TABLES_QUERY               = "SELECT table_schema, table_name FROM information_schema.tables WHERE table_type = 'BASE TABLE' AND table_schema NOT IN ('pg_catalog', 'information_schema') ORDER BY table_schema, table_name;"
+	PG_TABLE_STATS_QUERY               = "SELECT n.nspname, c.relname, GREATEST(c.reltuples, 0)::bigint, pg_table_size(c.oid) FROM pg_class c JOIN pg_namespace n ON n.oid = c.relnamespace WHERE c.relkind IN ('r', 'p') AND n.nspname NOT IN ('pg_catalog', 'information_schema') ORDER BY 1, 2;"
+	PG_SCHEMA_COLUMNS_QUERY            = "SELECT n.nspname, c.relname, a.attname, format_type(a.atttypid, a.atttypmod), NOT a.attnotnull, d.adbin IS NULL, COALESCE(pg_get_expr(d.adbin, d.adrelid), '') FROM pg_attribute a JOIN pg_class c ON c.oid = a.attrelid JOIN pg_namespace n ON n.oid = c.relnamespace LEFT JOIN pg_attrdef d ON d.adrelid = a.attrelid AND d.adnum = a.attnum WHERE c.relkind IN ('r', 'p') AND a.attnum > 0 AND NOT a.attisdropped AND n.nspname NOT IN ('pg_catalog', 'information_schema') ORDER BY n.nspname, c.relname, a.attnum;"
+	PG_SCHEMA_FINGERPRINT_QUERY        = "SELECT md5(string_agg(table_schema || '.' || table_name || '.' || column_name || ' ' || data_type || ' ' || is_nullable || ' ' || COALESCE(column_default, ''), ',' ORDER BY table_schema, table_name, ordinal_position)) FROM information_schema.columns WHERE table_schema NOT IN ('pg_catalog', 'information_schema');"
+	PG_LOAD_STATUS_QUERY_FORMAT        = "SELECT xact_commit + xact_rollback, numbackends FROM pg_stat_database WHERE datname = '%s';"
+	PG_ACTIVE_CONNECTIONS_QUERY_FORMAT = "SELECT count(*) FROM pg_stat_activity WHERE datname = '%s' AND pid <> pg_backend_pid();"
+	PG_COPY_OUT_QUERY_FORMAT           = "COPY %s TO STDOUT;"
+	PG_COPY_SELECT_OUT_QUERY_FORMAT    = "COPY (%s) TO STDOUT;"
+	PG_COPY_COLUMNS_OUT_QUERY_FORMAT   = "COPY %s (%s) TO STDOUT;"
+	PG_TABLE_HASH_QUERY_FORMAT         = "SELECT md5(COALESCE(string_agg(c, '' ORDER BY n), '')) FROM (SELECT n, md5(string_agg(h, '' ORDER BY h)) AS c FROM (SELECT h, (row_number() OVER (ORDER BY h) - 1) / 100000 AS n FROM (SELECT md5(t::text) AS h FROM %s t) r) numbered GROUP BY n) chunks;"
+	PG_COPY_IN_FORMAT                  = "\\copy %s FROM '%s'\n"
+	PG_COPY_COLUMNS_IN_FORMAT          = "\\copy %s (%s) FROM '%s'\n"
+	PG_COPY_STDIN_FORMAT               = "\\copy %s FROM pstdin"
+	PG_COPY_COLUMNS_STDIN_FORMAT       = "\\copy %s (%s) FROM pstdin"
+	PG_COPY_CSV_IN_FORMAT              = "\\copy %s (%s) FROM '%s' WITH (FORMAT csv, HEADER true)\n"
+	PG_TRUNCATE_QUERY_FORMAT           = "TRUNCATE TABLE %s;"
+	PG_DATABASE_EXISTS_QUERY_FORMAT    = "SELECT 1 FROM pg_database WHERE datname = '%s';"
+	PG_CREATE_DATABASE_QUERY_FORMAT    = "CREATE DATABASE %s;"
+	PG_DROP_DATABASE_QUERY_FORMAT      = "DROP DATABASE IF EXISTS %s;"
+	PG_FOREIGN_KEYS_QUERY              = "SELECT cn.nspname, c.relname, rn.nspname, r.relname FROM pg_constraint k JOIN pg_class c ON c.oid = k.conrelid JOIN pg_namespace cn ON cn.oid = c.relnamespace JOIN pg_class r ON r.oid = k.confrelid JOIN pg_namespace rn ON rn.oid = r.relnamespace WHERE k.contype = 'f';"
+
+	// The triggers defined by users don't fire for the loaded rows. Foreign
+	// keys are still checked, which needs no more than owning the table.
+	PG_DISABLE_TRIGGERS_FORMAT = "ALTER TABLE %s DISABLE TRIGGER USER;"
+	PG_ENABLE_TRIGGERS_FORMAT  = "ALTER TABLE %s ENABLE TRIGGER USER;"
+)
@@ -0,0 +1,17 @@
+package constants
+
+const (
+	PHASE_QUEUED    = "queued"
+	PHASE_FETCHING  = "fetching"
+	PHASE_FETCHED   = "fetched"
+	PHASE_CACHED    = "cached"
+	PHASE_UNCHANGED = "unchanged"
+	PHASE_DELETING  = "deleting"
+	PHASE_LOADING   = "loading"
+	PHASE_DONE      = "done"
+	PHASE_FAILED    = "failed"
+
+	TUI_REFRESH_MILLISECONDS = 250
+	TUI_LOG_LINES            = 5
+	TUI_ERROR_LINES          = 5
+)
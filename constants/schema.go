@@ -0,0 +1,26 @@
+package constants
+
+const (
+	COLUMN_ADD    = "add"
+	COLUMN_MODIFY = "modify"
+	COLUMN_DROP   = "drop"
+
+	ONLINE_DDL_GH_OST = "gh-ost"
+	ONLINE_DDL_PT_OSC = "pt-osc"
+
+	SCHEMA_COLUMNS_QUERY_FORMAT    = "SELECT table_name, column_name, column_type, is_nullable, column_default IS NULL, IFNULL(column_default, ''), extra FROM information_schema.columns WHERE table_schema = '%s' ORDER BY table_name, ordinal_position;"
+	CHECK_CONSTRAINTS_QUERY_FORMAT = "SELECT tc.table_name, cc.constraint_name, cc.check_clause FROM information_schema.table_constraints tc JOIN information_schema.check_constraints cc ON cc.constraint_schema = tc.constraint_schema AND cc.constraint_name = tc.constraint_name WHERE tc.constraint_type = 'CHECK' AND tc.table_schema = '%s' ORDER BY tc.table_name, cc.constraint_name;"
+	SHOW_CREATE_TABLE_QUERY_FORMAT = "SHOW CREATE TABLE %s;"
+	VIEWS_QUERY_FORMAT             = "SELECT table_name, view_definition, security_type, check_option FROM information_schema.views WHERE table_schema = '%s' ORDER BY table_name;"
+	TRIGGERS_QUERY_FORMAT          = "SELECT trigger_name, event_object_table, action_timing, event_manipulation, action_statement FROM information_schema.triggers WHERE trigger_schema = '%s' ORDER BY event_object_table, action_timing, event_manipulation, action_order;"
+	DROP_TABLE_FORMAT              = "DROP TABLE IF EXISTS %s;"
+	CREATE_VIEW_FORMAT             = "CREATE OR REPLACE SQL SECURITY %s VIEW %s AS %s%s;"
+	CHECK_OPTION_FORMAT            = " WITH %s CHECK OPTION"
+	DROP_TRIGGER_FORMAT            = "DROP TRIGGER IF EXISTS %s;"
+	DDL_FILE_TIME_FORMAT           = "20060102150405"
+	DDL_FILE_NAME_FORMAT           = "%s_gopli_%s.sql"
+
+	// Trigger bodies may hold several statements, so the mysql client has
+	// to split on another delimiter.
+	CREATE_TRIGGER_FORMAT = "DELIMITER ;;\nCREATE TRIGGER %s %s %s ON %s FOR EACH ROW %s;;\nDELIMITER ;"
+)
@@ -0,0 +1,14 @@
+package constants
+
+const (
+	SECRET_REF_VAULT  = "vault:"
+	SECRET_REF_AWS_SM = "aws-sm:"
+	SECRET_REF_GCP_SM = "gcp-sm:"
+
+	VAULT_AUTH_TOKEN         = "token"
+	VAULT_AUTH_APPROLE       = "approle"
+	VAULT_AUTH_KUBERNETES    = "kubernetes"
+	VAULT_TIMEOUT_SECONDS    = 10
+	VAULT_TOKEN_FILE         = "~/.vault-token"
+	KUBERNETES_SA_TOKEN_FILE = "/var/run/secrets/kubernetes.io/serviceaccount/token"
+)
@@ -4,4 +4,17 @@ const (
 	MaxFetchSession      = 3
 	MaxDeleteSession     = 3
 	MaxLoadInfileSession = 3
+
+	DefaultMaxAdaptiveSession = 16
+
+	// MaxSharedSessions is the most sessions of light tables sharing a slot.
+	MaxSharedSessions = 8
+
+	DefaultMaxOpenConnection = 1
+	DefaultMaxIdleConnection = 1
+	// DefaultMaxSessionsPerConnection is the MaxSessions default of sshd.
+	DefaultMaxSessionsPerConnection = 10
+	// SSHD_MAX_SESSIONS_COMMAND prints MaxSessions of sshd, from its
+	// effective settings when readable and from its configuration otherwise.
+	SSHD_MAX_SESSIONS_COMMAND = `{ /usr/sbin/sshd -T || cat /etc/ssh/sshd_config; } 2>/dev/null | awk 'tolower($1) == "maxsessions" { print $2; exit }'`
 )
@@ -0,0 +1,18 @@
+package constants
+
+const (
+	DEFAULT_SNAPSHOT_DIR = "~/.gopli/snapshots"
+	SNAPSHOT_META_FILE   = "snapshot.json"
+	SNAPSHOT_TIME_FORMAT = "20060102-150405"
+	SNAPSHOT_DATE_FORMAT = "2006-01-02"
+
+	SNAPSHOT_KIND_DUMP   = "dump"
+	SNAPSHOT_KIND_BACKUP = "backup"
+
+	BACKUP_ALL      = "all"
+	BACKUP_TARGETED = "targeted"
+
+	DEFAULT_CACHE_DIR   = "~/.gopli/cache"
+	CACHE_SIZE_FILE     = "size"
+	DEFAULT_HISTORY_DIR = "~/.gopli/history"
+)
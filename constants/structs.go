@@ -2,19 +2,242 @@ package constants
 
 // Database settings
 type Database struct {
-	Host             string
+	Host             string `toml:"host"`
+	Port             string `toml:"port"`
 	ManagementSystem string `toml:"management_system"`
-	Name             string
-	User             string
-	Password         string
-	Offset           int
-	IsContainer      bool `toml:"is_container"`
+	Name             string `toml:"name"`
+	User             string `toml:"user"`
+	Password         string `toml:"password"`
+	Offset           int    `toml:"offset"`
+	IsContainer      bool   `toml:"is_container"`
+	Concurrency      int    `toml:"concurrency"`
+	Adaptive         bool   `toml:"adaptive_concurrency"`
+	MaxConcurrency   int    `toml:"max_concurrency"`
+	Compression      string `toml:"compression"`
+	DumpTool         string `toml:"dump_tool"`
+	Failover         string `toml:"failover"`
+	Proxy            string `toml:"proxy"`
+	RouteComment     string `toml:"route_comment"`
+	// UseMyCnf leaves the user and password to ~/.my.cnf of the host.
+	UseMyCnf bool `toml:"use_my_cnf"`
+	// IAMAuth logs in to RDS with IAM auth tokens instead of Password.
+	IAMAuth   bool   `toml:"iam_auth"`
+	AWSRegion string `toml:"aws_region"`
+	// NativeDriver speaks the MySQL protocol over connections tunneled
+	// through SSH instead of running the mysql client on the hosts.
+	NativeDriver bool `toml:"native_driver"`
+	// LockTables deletes and loads every table under LOCK TABLES, so
+	// readers never see it partially loaded.
+	LockTables bool `toml:"lock_tables"`
+	// EngineCompat loads MyRocks and TokuDB tables with their bulk load
+	// settings, for Percona Server and MariaDB destinations using them.
+	EngineCompat bool `toml:"engine_compat"`
+	// MaintenanceOn and MaintenanceOff are SQL statements setting and
+	// clearing a maintenance flag around the delete and load.
+	MaintenanceOn  string `toml:"maintenance_on"`
+	MaintenanceOff string `toml:"maintenance_off"`
+	// DrainURL is posted to and DrainCommand run before the tables are
+	// deleted, to put the application into maintenance mode. The load
+	// waits until at most DrainMaxConnections other connections use the
+	// database, for up to DrainTimeout seconds.
+	DrainURL            string `toml:"drain_url"`
+	DrainCommand        string `toml:"drain_command"`
+	DrainMaxConnections int    `toml:"drain_max_connections"`
+	DrainTimeout        int    `toml:"drain_timeout"`
+	// LockWaitTimeout is the innodb_lock_wait_timeout and lock_wait_timeout
+	// in seconds of the sessions deleting and loading tables.
+	LockWaitTimeout int `toml:"lock_wait_timeout"`
+	// LockRetries is how many times deletes and loads failing on a
+	// deadlock or lock wait timeout are retried, 3 by default and none
+	// when negative.
+	LockRetries int `toml:"lock_retries"`
+	// DeleteBatchSize deletes tables this many rows at a time instead of
+	// in a single transaction.
+	DeleteBatchSize int `toml:"delete_batch_size"`
+	// SessionSettings are run before every dump on this source, e.g.
+	// "SET TRANSACTION ISOLATION LEVEL READ COMMITTED".
+	SessionSettings []string `toml:"session_settings"`
+	// SelectHint is put after the SELECT of every dump, e.g.
+	// "/*+ MAX_EXECUTION_TIME(600000) */".
+	SelectHint string `toml:"select_hint"`
+	// SeedDir holds .sql and .csv files applied in name order after every
+	// load into this destination.
+	SeedDir string `toml:"seed_dir"`
+	// SeedEnv holds the variables .sql seed files refer to as
+	// {{ .Env.NAME }}.
+	SeedEnv map[string]string `toml:"seed_env"`
+	// Preview destinations are created by sync and dropped by destroy.
+	// Their Name is a template filled in with --var, e.g. "app_pr_{{.PR}}".
+	Preview bool `toml:"preview"`
+	// NoPassword logs in without a password, instead of asking for one
+	// when Password is empty.
+	NoPassword bool `toml:"no_password"`
+	// DumpTimeout is how many seconds the dump of a table may take on this
+	// source before its query is killed and the table fails.
+	DumpTimeout int `toml:"dump_timeout"`
+	// PeakQPS and PeakThreads are the queries per second and connected
+	// threads at which --sample-load considers this source busy.
+	PeakQPS     int `toml:"peak_qps"`
+	PeakThreads int `toml:"peak_threads"`
+	// TableWeights sets how many concurrency slots the sessions of a table
+	// take. Weights below 1 let tables share a slot, e.g. 0.25 for four.
+	TableWeights map[string]float64 `toml:"table_weights"`
+	// SlotSize weighs the tables without a weight by their size, one slot
+	// per SlotSize bytes.
+	SlotSize int64 `toml:"slot_size"`
+	// IncludeTables and ExcludeTables select the tables synced from this
+	// source by glob, or by regular expression when written as /regexp/.
+	IncludeTables []string `toml:"include_tables"`
+	ExcludeTables []string `toml:"exclude_tables"`
+	// Tables narrows the rows fetched from single tables, keyed by table.
+	// Offset caps the rows fetched from the other tables, 0 for all rows.
+	Tables map[string]TableSettings `toml:"tables"`
+}
+
+// TableSettings selects the rows of a table fetched by a partial sync, and
+// the values given to its columns when it is loaded.
+type TableSettings struct {
+	// Where is the condition of the rows, e.g.
+	// "created_at > NOW() - INTERVAL 30 DAY".
+	Where string `toml:"where"`
+	// Limit caps the rows fetched, in place of Offset of the database.
+	Limit int `toml:"limit"`
+	// OrderBy sorts the rows, e.g. "id DESC" to keep the newest ones
+	// under Limit.
+	OrderBy string `toml:"order_by"`
+	// Set maps columns of the destination table to the SQL expressions
+	// they are set to while loading, e.g. "'staging'" or "NULL".
+	Set map[string]string `toml:"set"`
+}
+
+// ColumnSelection limits the columns of a table that are synced, e.g. to
+// leave huge blobs or sensitive fields out.
+type ColumnSelection struct {
+	// Include lists the columns fetched and loaded. The other columns of
+	// the destination table get their defaults.
+	Include []string `toml:"include"`
 }
 
 // SSH settings
 type SSH struct {
-	Host string
-	Port string
-	User string
-	Key  string
+	Host string `toml:"host"`
+	Port string `toml:"port"`
+	User string `toml:"user"`
+	Key  string `toml:"key"`
+	// UseAgent authenticates with the keys of the agent at SSH_AUTH_SOCK,
+	// and Password with a password, in addition to or instead of Key.
+	UseAgent bool   `toml:"use_agent"`
+	Password string `toml:"password"`
+	// KnownHosts verifies host keys, ~/.ssh/known_hosts by default.
+	KnownHosts string `toml:"known_hosts"`
+	// ProxyJump reaches the host through comma separated [user@]host[:port]
+	// jump hosts, which authenticate like the host itself.
+	ProxyJump string `toml:"proxy_jump"`
+	MaxOpen   int    `toml:"max_open"`
+	MaxIdle   int    `toml:"max_idle"`
+	// MaxSessions caps the sessions open at once on the host across all of
+	// its connections.
+	MaxSessions int `toml:"max_sessions"`
+	Connections int `toml:"connections"`
+	// BindInterface is the local network interface to connect from.
+	BindInterface string `toml:"bind_interface"`
+	PreferIPv4    bool   `toml:"prefer_ipv4"`
+	// ProxyURL is a socks5:// or http:// proxy to connect through.
+	ProxyURL string `toml:"proxy_url"`
+	// Transport is ssh, teleport or ssm.
+	Transport string `toml:"transport"`
+	// Auth is key, or gssapi for Kerberos through the OpenSSH client.
+	Auth                      string `toml:"auth"`
+	GSSAPIDelegateCredentials bool   `toml:"gssapi_delegate_credentials"`
+	// Cert is an OpenSSH certificate of Key, by default Key-cert.pub if present.
+	Cert string `toml:"cert"`
+	// VaultSign is the Vault SSH secrets engine path signing Key, e.g.
+	// ssh-client-signer/sign/deploy.
+	VaultSign string `toml:"vault_sign"`
+	// KeyData and CertData hold a key and certificate read from a secret
+	// store, in place of the files.
+	KeyData  []byte `toml:"-"`
+	CertData []byte `toml:"-"`
+	// RemoteSudoUser runs every command as this user through sudo.
+	RemoteSudoUser string `toml:"remote_sudo_user"`
+}
+
+// Snapshot settings
+type Snapshot struct {
+	Dir      string `toml:"dir"`
+	KeepLast int    `toml:"keep_last"`
+	KeepDays int    `toml:"keep_days"`
+	// FileName lays out the dump files of a snapshot, e.g.
+	// "{date}/{db}/{table}.{ext}". Files are kept flat by default.
+	FileName string `toml:"file_name"`
+}
+
+// Cache settings
+type Cache struct {
+	Dir      string `toml:"dir"`
+	KeepDays int    `toml:"keep_days"`
+}
+
+// History settings
+type HistoryConf struct {
+	Dir string `toml:"dir"`
+}
+
+// Defaults settings, used when neither a flag nor a database section sets
+// the value.
+type Defaults struct {
+	Concurrency int    `toml:"concurrency"`
+	Compression string `toml:"compression"`
+	// DryRun makes sync print what it would do unless --dry-run=false is
+	// given.
+	DryRun bool `toml:"dry_run"`
+	// NoPrompt never asks for missing passwords and passphrases, like
+	// without a terminal.
+	NoPrompt bool `toml:"no_prompt"`
+	// LogLevel is info, or error to only show the errors commands fail with.
+	LogLevel string `toml:"log_level"`
+}
+
+// Workspace settings
+type WorkspaceConf struct {
+	DirMode    string `toml:"dir_mode"`
+	FileMode   string `toml:"file_mode"`
+	MaxRowSize int    `toml:"max_row_size"`
+	// MaxFileSize splits dumps into files of at most this many bytes.
+	MaxFileSize int64 `toml:"max_file_size"`
+	// CompressDumps gzips the dump files as they are written.
+	CompressDumps bool `toml:"compress_dumps"`
+}
+
+// Filter settings
+type Filter struct {
+	IgnoreCase bool `toml:"ignore_case"`
+	// InternalTables are never synced, in any schema. Unset, it falls back to
+	// the tables gopli and Rails keep for themselves.
+	InternalTables []string `toml:"internal_tables"`
+	// SchemaOnly tables have their structure synced by `schema` but their
+	// data left alone, e.g. sessions or logs.
+	SchemaOnly []string `toml:"schema_only"`
+	// DataOnly tables have their data synced but are left out of `schema`.
+	DataOnly []string `toml:"data_only"`
+	// Include and Exclude are the table patterns of the source, merged with
+	// --only and --skip.
+	Include []string `toml:"-"`
+	Exclude []string `toml:"-"`
+}
+
+// Vault settings
+type Vault struct {
+	// Address defaults to VAULT_ADDR.
+	Address string `toml:"address"`
+	// AuthMethod is token, approle or kubernetes.
+	AuthMethod string `toml:"auth_method"`
+	// AuthMount is the mount of the auth method, by default its name.
+	AuthMount string `toml:"auth_mount"`
+	// Token defaults to VAULT_TOKEN, then ~/.vault-token.
+	Token    string `toml:"token"`
+	RoleID   string `toml:"role_id"`
+	SecretID string `toml:"secret_id"`
+	// Role is the role of the kubernetes auth method.
+	Role string `toml:"role"`
 }
@@ -0,0 +1,8 @@
+package constants
+
+const (
+	VERIFY_STATUS_MATCH               = "match"
+	VERIFY_STATUS_MISMATCH            = "mismatch"
+	VERIFY_STATUS_MISSING_SOURCE      = "missing_source"
+	VERIFY_STATUS_MISSING_DESTINATION = "missing_destination"
+)
@@ -0,0 +1,199 @@
+package database
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	. "github.com/timakin/gopli/constants"
+	. "github.com/timakin/gopli/lib"
+)
+
+// tableChecksums returns the checksum of every table the dialect of conn
+// computes. Tables without one, such as missing tables, are left out.
+func tableChecksums(conn DBConnector, tables []string) (map[string]string, error) {
+	return dialectOf(conn).tableChecksums(conn, tables)
+}
+
+// mysqlTableChecksums returns the CHECKSUM TABLE value of every table.
+func mysqlTableChecksums(conn DBConnector, tables []string) (map[string]string, error) {
+	qualified := make([]string, len(tables))
+	for i, table := range tables {
+		qualified[i] = qualifiedTable(conn.Name, table)
+	}
+	query := fmt.Sprintf(CHECKSUM_TABLE_QUERY_FORMAT, strings.Join(qualified, ", "))
+
+	var out bytes.Buffer
+	client, err := mysqlClient(conn, conn.IsContainer)
+	if err != nil {
+		return nil, err
+	}
+	cmd := client.Stdin(strings.NewReader(query)).Command()
+	cmd.Stdout = &out
+	if err := conn.Runner.Run(cmd); err != nil {
+		return nil, err
+	}
+
+	// Rows come back in the order of the tables.
+	checksums := make(map[string]string)
+	lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+	for i, line := range lines {
+		fields := strings.Split(line, "\t")
+		if i >= len(tables) || len(fields) != 2 {
+			break
+		}
+		if fields[1] != "NULL" {
+			checksums[tables[i]] = fields[1]
+		}
+	}
+	return checksums, nil
+}
+
+// sourceChecksums returns the checksums of the tables, or nil when they
+// can't be read, in which case every table is fetched.
+func sourceChecksums(conn DBConnector, tables []string) map[string]string {
+	if len(tables) == 0 {
+		return nil
+	}
+	log.Print("\t[Fetch] checksumming tables...")
+	checksums, err := tableChecksums(conn, tables)
+	if err != nil {
+		log.Print("\t[Fetch] failed to checksum tables, fetching all of them: " + err.Error())
+		return nil
+	}
+	return checksums
+}
+
+// dropUnchanged drops the tables whose known checksum equals the source
+// checksum from tables and the table list, as the destination already holds
+// the same rows. Every comparison is recorded in the stats.
+func dropUnchanged(conn DBConnector, tables []string, checksums map[string]string) ([]string, error) {
+	destination, err := conn.FetchOptions.KnownChecksums(tables)
+	if err != nil {
+		log.Print("\t[Fetch] failed to read destination checksums, fetching all of them: " + err.Error())
+		return tables, nil
+	}
+	var unchanged []string
+	for _, table := range tables {
+		source, ok := checksums[table]
+		if !ok {
+			continue
+		}
+		comparison := TableChecksum{Table: table, Source: source, Destination: destination[table]}
+		if checksum, ok := destination[table]; ok && checksum == source {
+			log.Print("\t[Fetch] skipping " + table + ", which is unchanged")
+			comparison.Unchanged = true
+			progress.SetPhase(table, PHASE_UNCHANGED, 0)
+			unchanged = append(unchanged, table)
+		}
+		conn.FetchOptions.Stats.AddChecksum(comparison)
+	}
+	if len(unchanged) == 0 {
+		return tables, nil
+	}
+	if err := dropFromTableList(conn.Workspace, tables, unchanged); err != nil {
+		return nil, err
+	}
+	return conn.Workspace.ReadTableList()
+}
+
+// cacheKeys returns the cache keys of the tables dumps can be cached for. The
+// checksums are recorded in the workspace for the load to skip tables the
+// destination already holds.
+func (fetcher *MySQLFetcher) cacheKeys(tables []string, columns []Column, checksums map[string]string) map[string]string {
+	tableColumns := make(map[string][]Column)
+	for _, column := range columns {
+		tableColumns[column.Table] = append(tableColumns[column.Table], column)
+	}
+	keys := make(map[string]string)
+	var checksumList bytes.Buffer
+	for _, table := range tables {
+		checksum, ok := checksums[table]
+		// Only the columns of the own schema are known.
+		if !ok || ParseTableName(table).Schema != "" {
+			continue
+		}
+		// The checksum covers the whole table, not a part of it.
+		if !isPartial(tableSelection(DBConnector(*fetcher), table)) && selectedColumns(fetcher.FetchOptions.Columns, table) == nil {
+			keys[table] = DumpKey(table, tableColumns[table], checksum)
+		}
+		checksumList.WriteString(table + "\t" + checksum + "\n")
+	}
+	if fetcher.FetchOptions.KnownChecksums == nil {
+		if err := fetcher.Workspace.WriteFile(CHECKSUMS_FILE, checksumList.Bytes()); err != nil {
+			log.Print("\t[Fetch] failed to record checksums: " + err.Error())
+		}
+	}
+	return keys
+}
+
+// fetchCachedTable restores the dump of table from the cache, and reports
+// whether it was there.
+func fetchCachedTable(conn DBConnector, key string, table string, columns []string) bool {
+	restored, err := conn.FetchOptions.Cache.Restore(key, conn.Workspace, table)
+	if err != nil {
+		log.Print("\t\t[Fetch] failed to read the cached dump of " + table + ": " + err.Error())
+		return false
+	}
+	if restored && len(columns) > 0 {
+		if err := conn.Workspace.WriteColumns(table, columns); err != nil {
+			return false
+		}
+	}
+	return restored
+}
+
+// skipUnchanged drops the tables whose destination checksum equals the one
+// recorded at the source from tables and the table list, as they already
+// hold the same rows.
+func (inserter *MySQLInserter) skipUnchanged(tables []string) ([]string, error) {
+	lines, err := ReadLinesLimit(filepath.Join(inserter.Workspace.Path, CHECKSUMS_FILE), inserter.Workspace.MaxRowSize)
+	if os.IsNotExist(err) {
+		// Checksums are only recorded with the cache.
+		return tables, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	source := make(map[string]string)
+	var checked []string
+	for _, line := range lines {
+		fields := strings.Split(line, "\t")
+		if len(fields) == 2 && containsString(tables, fields[0]) {
+			source[fields[0]] = fields[1]
+			checked = append(checked, fields[0])
+		}
+	}
+	if len(checked) == 0 {
+		return tables, nil
+	}
+	destination, err := tableChecksums(DBConnector(*inserter), checked)
+	if err != nil {
+		log.Print("[Delete] failed to checksum destination tables, loading all of them: " + err.Error())
+		return tables, nil
+	}
+
+	var remaining []string
+	var tableList bytes.Buffer
+	for _, table := range tables {
+		if checksum, ok := destination[table]; ok && checksum == source[table] {
+			log.Print("\t[Delete] skipping " + table + ", which is unchanged")
+			continue
+		}
+		remaining = append(remaining, table)
+		tableList.WriteString(table + "\n")
+	}
+	if len(remaining) == len(tables) {
+		return tables, nil
+	}
+	return remaining, inserter.Workspace.WriteFile(TABLE_LIST_FILE, tableList.Bytes())
+}
+
+// TableChecksums returns the CHECKSUM TABLE value of the tables that exist on
+// the destination.
+func (inserter *MySQLInserter) TableChecksums(tables []string) (map[string]string, error) {
+	return tableChecksums(DBConnector(*inserter), tables)
+}
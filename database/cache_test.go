@@ -0,0 +1,30 @@
+package database
+
+import (
+	"io"
+	"testing"
+)
+
+// cannedRunner answers every command with out.
+type cannedRunner struct {
+	out string
+}
+
+func (runner *cannedRunner) Run(cmd *Command) error {
+	_, err := io.WriteString(cmd.Stdout, runner.out)
+	return err
+}
+
+func TestTableChecksums(t *testing.T) {
+	runner := &cannedRunner{out: "app.users\t1234\napp.gone\tNULL\nlogs.events\t0\n"}
+	checksums, err := tableChecksums(DBConnector{Runner: runner, Name: "app"}, []string{"users", "gone", "logs.events"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(checksums) != 2 || checksums["users"] != "1234" || checksums["logs.events"] != "0" {
+		t.Errorf("unexpected checksums: %v", checksums)
+	}
+	if _, ok := checksums["gone"]; ok {
+		t.Error("expected no checksum for a missing table")
+	}
+}
@@ -0,0 +1,87 @@
+package database
+
+import (
+	"errors"
+	"io"
+	"math/rand"
+	"sync"
+)
+
+var (
+	dropSessionAfter int64
+	loadFailureRate  float64
+)
+
+// InjectFaults makes runners created afterwards fail on purpose: host
+// sessions are dropped once they produced dropAfter bytes of output and the
+// given fraction of loads fails. Zero values disable the respective fault.
+func InjectFaults(dropAfter int64, failureRate float64) {
+	dropSessionAfter = dropAfter
+	loadFailureRate = failureRate
+}
+
+func withHostFaults(runner Runner) Runner {
+	if dropSessionAfter <= 0 {
+		return runner
+	}
+	return &droppingRunner{runner: runner, limit: dropSessionAfter}
+}
+
+func withLoadFaults(runner Runner) Runner {
+	if loadFailureRate <= 0 {
+		return runner
+	}
+	return &failingRunner{runner: runner, rate: loadFailureRate}
+}
+
+// droppingRunner cuts the output of every command after limit bytes, like a
+// connection dropped in the middle of a transfer.
+type droppingRunner struct {
+	runner Runner
+	limit  int64
+}
+
+func (dropper *droppingRunner) Run(cmd *Command) error {
+	if cmd.Stdout == nil {
+		return dropper.runner.Run(cmd)
+	}
+	dropped := *cmd
+	dropped.Stdout = &limitedWriter{w: cmd.Stdout, remaining: dropper.limit}
+	return dropper.runner.Run(&dropped)
+}
+
+type limitedWriter struct {
+	w         io.Writer
+	remaining int64
+}
+
+func (lw *limitedWriter) Write(p []byte) (int, error) {
+	if int64(len(p)) > lw.remaining {
+		n, _ := lw.w.Write(p[:lw.remaining])
+		lw.remaining = 0
+		return n, errors.New("injected fault: session dropped")
+	}
+	lw.remaining -= int64(len(p))
+	return lw.w.Write(p)
+}
+
+// failingRunner fails a random fraction of the commands without running them.
+type failingRunner struct {
+	runner Runner
+	rate   float64
+	mu     sync.Mutex
+	rand   *rand.Rand
+}
+
+func (failer *failingRunner) Run(cmd *Command) error {
+	failer.mu.Lock()
+	if failer.rand == nil {
+		failer.rand = rand.New(rand.NewSource(rand.Int63()))
+	}
+	fail := failer.rand.Float64() < failer.rate
+	failer.mu.Unlock()
+	if fail {
+		return errors.New("injected fault: load failed")
+	}
+	return failer.runner.Run(cmd)
+}
@@ -0,0 +1,49 @@
+package database
+
+import (
+	"fmt"
+	"strings"
+
+	. "github.com/timakin/gopli/constants"
+	. "github.com/timakin/gopli/lib"
+)
+
+// selectedColumns returns the columns of table the [columns] settings
+// include, or nil when every column is synced.
+func selectedColumns(selections map[string]ColumnSelection, table string) []string {
+	for name, selection := range selections {
+		if SameTable(name, table) {
+			return selection.Include
+		}
+	}
+	return nil
+}
+
+// selectColumns narrows the column lists of the fetch down to the columns
+// the [columns] settings include. The selected columns are checked against
+// the definitions in columns, when the table has any.
+func selectColumns(lists map[string][]string, tables []string, columns []Column, selections map[string]ColumnSelection) error {
+	for _, table := range tables {
+		include := selectedColumns(selections, table)
+		if len(include) == 0 {
+			continue
+		}
+		definitions := make(map[string]Column)
+		for _, column := range columns {
+			if SameTable(column.Table, table) {
+				definitions[strings.ToLower(column.Name)] = column
+			}
+		}
+		for _, name := range include {
+			column, ok := definitions[strings.ToLower(name)]
+			if len(definitions) > 0 && !ok {
+				return fmt.Errorf("columns.%s: unknown column %q", table, name)
+			}
+			if column.Generated() {
+				return fmt.Errorf("columns.%s: generated column %q can't be loaded", table, name)
+			}
+		}
+		lists[table] = include
+	}
+	return nil
+}
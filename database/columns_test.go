@@ -0,0 +1,42 @@
+package database
+
+import (
+	"reflect"
+	"testing"
+
+	. "github.com/timakin/gopli/constants"
+	. "github.com/timakin/gopli/lib"
+)
+
+func TestSelectColumns(t *testing.T) {
+	columns := []Column{
+		{Table: "users", Name: "id"},
+		{Table: "users", Name: "name"},
+		{Table: "users", Name: "avatar"},
+		{Table: "users", Name: "name_length", Extra: "VIRTUAL GENERATED"},
+		{Table: "orders", Name: "id"},
+	}
+	lists := map[string][]string{}
+	selections := map[string]ColumnSelection{"users": {Include: []string{"id", "Name"}}}
+	if err := selectColumns(lists, []string{"users", "orders", "archive.logs"}, columns, selections); err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string][]string{"users": {"id", "Name"}}; !reflect.DeepEqual(lists, want) {
+		t.Errorf("expected only the selected columns of users, got %v", lists)
+	}
+
+	selections["users"] = ColumnSelection{Include: []string{"id", "email"}}
+	if err := selectColumns(lists, []string{"users"}, columns, selections); err == nil {
+		t.Error("expected an error for an unknown column")
+	}
+	selections["users"] = ColumnSelection{Include: []string{"id", "name_length"}}
+	if err := selectColumns(lists, []string{"users"}, columns, selections); err == nil {
+		t.Error("expected an error for a generated column")
+	}
+
+	// Tables of other schemas have no definitions to check against.
+	selections = map[string]ColumnSelection{"archive.logs": {Include: []string{"id"}}}
+	if err := selectColumns(lists, []string{"archive.logs"}, columns, selections); err != nil || len(lists["archive.logs"]) != 1 {
+		t.Errorf("expected the columns of archive.logs selected, got %v, %v", lists["archive.logs"], err)
+	}
+}
@@ -0,0 +1,131 @@
+package database
+
+import (
+	"io"
+	"strings"
+)
+
+// commandBuilder assembles a command line from arguments that are quoted one
+// by one, so no value can break out of its word or inject shell syntax.
+type commandBuilder struct {
+	args  []string
+	env   []string
+	stdin io.Reader
+	// stdinPrefix is fed to the command before stdin.
+	stdinPrefix string
+	// native marks mysql client invocations for the native driver.
+	native bool
+}
+
+func newCommandBuilder(name string, args ...string) *commandBuilder {
+	return (&commandBuilder{}).Arg(name).Arg(args...)
+}
+
+// Arg appends arguments to the command.
+func (builder *commandBuilder) Arg(args ...string) *commandBuilder {
+	builder.args = append(builder.args, args...)
+	return builder
+}
+
+// Env sets an environment variable for the command.
+func (builder *commandBuilder) Env(name string, value string) *commandBuilder {
+	builder.env = append(builder.env, name+"="+value)
+	return builder
+}
+
+// Stdin feeds input to the command. SQL is passed this way, so it never
+// appears on the command line.
+func (builder *commandBuilder) Stdin(stdin io.Reader) *commandBuilder {
+	builder.stdin = stdin
+	return builder
+}
+
+// StdinPrefix feeds prefix to the command before the input set by Stdin.
+func (builder *commandBuilder) StdinPrefix(prefix string) *commandBuilder {
+	builder.stdinPrefix = prefix
+	return builder
+}
+
+// Native lets runners of the native driver run the command, a mysql client
+// invocation, without the client.
+func (builder *commandBuilder) Native() *commandBuilder {
+	builder.native = true
+	return builder
+}
+
+func (builder *commandBuilder) input() io.Reader {
+	if builder.stdin == nil || builder.stdinPrefix == "" {
+		return builder.stdin
+	}
+	return io.MultiReader(strings.NewReader(builder.stdinPrefix), builder.stdin)
+}
+
+// Command builds a command for any runner. Remote shells don't receive the
+// client environment, so the shell reads the environment variables from stdin
+// ahead of the input of the command. That keeps them out of the command line,
+// which shows in process lists, sudo logs and fixtures.
+func (builder *commandBuilder) Command() *Command {
+	line := strings.Join(builder.quotedArgs(), " ")
+	if len(builder.env) == 0 {
+		return &Command{Line: line, Stdin: builder.input(), Native: builder.invocation()}
+	}
+	var names, values []string
+	for _, env := range builder.env {
+		pair := strings.SplitN(env, "=", 2)
+		names = append(names, pair[0])
+		values = append(values, strings.Replace(pair[1], "\n", "", -1)+"\n")
+	}
+	stdin := io.Reader(strings.NewReader(strings.Join(values, "")))
+	if input := builder.input(); input != nil {
+		stdin = io.MultiReader(stdin, input)
+	}
+	return &Command{Line: readingEnv(names, line), Stdin: stdin, SecretEnv: names, Native: builder.invocation()}
+}
+
+// readingEnv prefixes line with reading and exporting the variables names
+// from stdin.
+func readingEnv(names []string, line string) string {
+	reads := make([]string, len(names))
+	for i, name := range names {
+		reads[i] = "IFS= read -r " + name + " && export " + name
+	}
+	return "{ " + strings.Join(reads, " && ") + " && " + line + "; }"
+}
+
+// withoutReadingEnv returns the line readingEnv prefixed, or line when it
+// reads no variables.
+func withoutReadingEnv(names []string, line string) string {
+	if len(names) == 0 {
+		return line
+	}
+	prefix := strings.TrimSuffix(readingEnv(names, ""), "; }")
+	return strings.TrimSuffix(strings.TrimPrefix(line, prefix), "; }")
+}
+
+// LocalCommand builds a command for a local runner. Environment variables are
+// passed through the process environment, which keeps them out of the
+// process list.
+func (builder *commandBuilder) LocalCommand() *Command {
+	return &Command{Line: strings.Join(builder.quotedArgs(), " "), Env: builder.env, Stdin: builder.input(), Native: builder.invocation()}
+}
+
+// invocation returns the invocation native runners run, or nil for commands
+// they leave to the shell.
+func (builder *commandBuilder) invocation() *clientInvocation {
+	if !builder.native {
+		return nil
+	}
+	return &clientInvocation{
+		args:  append([]string(nil), builder.args...),
+		env:   append([]string(nil), builder.env...),
+		stdin: builder.input(),
+	}
+}
+
+func (builder *commandBuilder) quotedArgs() []string {
+	quoted := make([]string, len(builder.args))
+	for i, arg := range builder.args {
+		quoted[i] = shellQuote(arg)
+	}
+	return quoted
+}
@@ -0,0 +1,55 @@
+package database
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestCommandBuilderQuotesArguments(t *testing.T) {
+	hostile := []string{"a b", "it's", "$(touch /tmp/gopli_pwned)", "`id`", "x; rm -rf /", ""}
+	for _, build := range []func(*commandBuilder) *Command{(*commandBuilder).Command, (*commandBuilder).LocalCommand} {
+		cmd := build(newCommandBuilder("printf", "[%s]").Arg(hostile...).Env("GOPLI_TEST", "p'w $x"))
+		var out bytes.Buffer
+		cmd.Stdout = &out
+		if err := (&localRunner{}).Run(cmd); err != nil {
+			t.Fatal(err)
+		}
+		expected := ""
+		for _, arg := range hostile {
+			expected += "[" + arg + "]"
+		}
+		if out.String() != expected {
+			t.Errorf("expected %q, got %q", expected, out.String())
+		}
+	}
+}
+
+func TestCommandBuilderSetsEnv(t *testing.T) {
+	for _, build := range []func(*commandBuilder) *Command{(*commandBuilder).Command, (*commandBuilder).LocalCommand} {
+		cmd := build(newCommandBuilder("sh", "-c", `printf %s "$MYSQL_PWD"`).Env("MYSQL_PWD", "p'w $x"))
+		var out bytes.Buffer
+		cmd.Stdout = &out
+		if err := (&localRunner{}).Run(cmd); err != nil {
+			t.Fatal(err)
+		}
+		if out.String() != "p'w $x" {
+			t.Errorf("expected the password to survive the shell, got %q", out.String())
+		}
+		if strings.Contains(cmd.Line, "p'w") {
+			t.Errorf("expected the password to stay off the command line, got %q", cmd.Line)
+		}
+	}
+}
+
+func TestCommandPassesEnvAheadOfStdin(t *testing.T) {
+	cmd := newCommandBuilder("sh", "-c", `printf '%s:' "$MYSQL_PWD"; cat`).Env("MYSQL_PWD", "secret").Stdin(strings.NewReader("SELECT 1;\n")).Command()
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	if err := (&localRunner{}).Run(cmd); err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != "secret:SELECT 1;\n" {
+		t.Errorf("expected the input after the password, got %q", out.String())
+	}
+}
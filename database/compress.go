@@ -0,0 +1,138 @@
+package database
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+
+	. "github.com/timakin/gopli/constants"
+)
+
+// codec compresses dumps on the source host before they are transferred.
+type codec struct {
+	name string
+	// compress is the remote filter compressing stdin to stdout.
+	compress string
+	// decompress is the local filter reversing it. Empty means the codec is
+	// decoded in-process.
+	decompress string
+}
+
+var codecs = map[string]codec{
+	COMPRESSION_GZIP: {name: COMPRESSION_GZIP, compress: "gzip -c"},
+	COMPRESSION_ZSTD: {name: COMPRESSION_ZSTD, compress: "zstd -q -c", decompress: "zstd -q -d -c"},
+	COMPRESSION_LZ4:  {name: COMPRESSION_LZ4, compress: "lz4 -q -c", decompress: "lz4 -q -d -c"},
+}
+
+// selectCodec returns the codec to fetch with. A codec whose binaries are
+// missing falls back to gzip, and gzip to no compression.
+func (fetcher *MySQLFetcher) selectCodec() *codec {
+	name := fetcher.FetchOptions.Compression
+	if name == "" || name == COMPRESSION_NONE {
+		return nil
+	}
+	if recordDir != "" {
+		log.Print("[Fetch] recording fixtures, fetching uncompressed rows to leave their values out")
+		return nil
+	}
+	if fetcher.NativeDriver {
+		log.Print("[Fetch] the native driver can't compress on the source host, fetching uncompressed")
+		return nil
+	}
+	for _, candidate := range []string{name, COMPRESSION_GZIP} {
+		c, ok := codecs[candidate]
+		if !ok {
+			log.Print("[Fetch] unknown compression " + candidate + ", falling back to gzip")
+			continue
+		}
+		if fetcher.codecAvailable(c) {
+			if candidate != name {
+				log.Print("[Fetch] " + name + " is not available, compressing with " + candidate)
+			}
+			return &c
+		}
+	}
+	log.Print("[Fetch] gzip is not available on the source host, fetching uncompressed")
+	return nil
+}
+
+func (fetcher *MySQLFetcher) codecAvailable(c codec) bool {
+	if fetcher.Runner.Run(&Command{Line: "command -v " + c.name}) != nil {
+		return false
+	}
+	return c.decompress == "" || fetcher.LocalRunner.Run(&Command{Line: "command -v " + c.name}) == nil
+}
+
+// compressed wraps the fetch command so its output is compressed on the
+// source host. The exit status stays the one of cmd.
+func (c *codec) compressed(cmd *Command) *Command {
+	cmd.Line = pipeline(cmd.Line, c.compress)
+	return cmd
+}
+
+// newDecoder returns a writer decompressing what is fetched through c into w
+// as it arrives. External decompressors run through runner.
+func newDecoder(runner Runner, c *codec, w io.Writer) *streamDecoder {
+	reader, writer := io.Pipe()
+	decoder := &streamDecoder{writer: writer, done: make(chan error, 1)}
+	go func() {
+		var err error
+		if c.decompress == "" {
+			err = gunzip(reader, w)
+		} else {
+			var stderr bytes.Buffer
+			if err = runner.Run(&Command{Line: c.decompress, Stdin: reader, Stdout: w, Stderr: &stderr}); err != nil {
+				err = fmt.Errorf("%s: %v: %s", c.decompress, err, strings.TrimSpace(stderr.String()))
+			}
+		}
+		// Unblock the fetch when decoding stops early.
+		reader.CloseWithError(err)
+		decoder.done <- err
+	}()
+	return decoder
+}
+
+func gunzip(r io.Reader, w io.Writer) error {
+	reader, err := gzip.NewReader(r)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+	_, err = io.Copy(w, reader)
+	return err
+}
+
+// streamDecoder is the compressed end of a running decompression.
+type streamDecoder struct {
+	writer *io.PipeWriter
+	done   chan error
+}
+
+func (decoder *streamDecoder) Write(p []byte) (int, error) {
+	return decoder.writer.Write(p)
+}
+
+// finish ends the input with the error of the fetch, nil once it is
+// complete, and waits for the decompression to end.
+func (decoder *streamDecoder) finish(fetchErr error) error {
+	decoder.writer.CloseWithError(fetchErr)
+	return <-decoder.done
+}
+
+// byteCounter counts the bytes written to it, such as the compressed bytes
+// of a fetch.
+type byteCounter int64
+
+func (counter *byteCounter) Write(p []byte) (int, error) {
+	*counter += byteCounter(len(p))
+	return len(p), nil
+}
+
+// pipeline pipes the output of first into second and exits with the status
+// of first, which plain sh pipelines would lose.
+func pipeline(first string, second string) string {
+	return "exec 3>&1; status=$( { { " + first + "; echo $? >&4; } | " + second + " >&3; } 4>&1 ); exit ${status:-1}"
+}
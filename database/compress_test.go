@@ -0,0 +1,52 @@
+package database
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestPipelineKeepsExitStatus(t *testing.T) {
+	runner := &localRunner{}
+
+	var out bytes.Buffer
+	if err := runner.Run(&Command{Line: pipeline("printf abc", "tr a-z A-Z"), Stdout: &out}); err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != "ABC" {
+		t.Errorf("expected ABC, got %q", out.String())
+	}
+
+	if err := runner.Run(&Command{Line: pipeline("printf abc; exit 3", "cat"), Stdout: &out}); err == nil {
+		t.Error("expected the status of the first command")
+	}
+}
+
+func TestGzipRoundTrip(t *testing.T) {
+	fetcher := &MySQLFetcher{Runner: &localRunner{}, LocalRunner: &localRunner{}}
+	fetcher.FetchOptions.Compression = "gzip"
+	c := fetcher.selectCodec()
+	if c == nil {
+		t.Skip("gzip is not installed")
+	}
+
+	var compressed bytes.Buffer
+	cmd := c.compressed(&Command{Line: "printf '1\\tfoo\\n'"})
+	cmd.Stdout = &compressed
+	if err := fetcher.Runner.Run(cmd); err != nil {
+		t.Fatal(err)
+	}
+	var rows bytes.Buffer
+	decoder := newDecoder(fetcher.LocalRunner, c, &rows)
+	// The compressed dump arrives in pieces.
+	for _, piece := range [][]byte{compressed.Bytes()[:5], compressed.Bytes()[5:]} {
+		if _, err := decoder.Write(piece); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := decoder.finish(nil); err != nil {
+		t.Fatal(err)
+	}
+	if rows.String() != "1\tfoo\n" {
+		t.Errorf("unexpected rows: %q", rows.String())
+	}
+}
@@ -1,81 +1,318 @@
 package database
 
 import (
+	"time"
+
 	. "github.com/timakin/gopli/constants"
 	. "github.com/timakin/gopli/lib"
 	"golang.org/x/crypto/ssh"
-	"io/ioutil"
-	"os/user"
-	"path/filepath"
-	"strings"
 )
 
 type DBFetcher interface {
+	Ping() error
 	Fetch() error
+	TableStats() ([]TableStat, error)
+	SchemaFingerprint() (string, error)
+	Schema() (*Schema, error)
+	SchemaDDL(diff *SchemaDiff) ([]DDLStatement, error)
+	ViewDDL() ([]DDLStatement, error)
+	TriggerDDL(tables []string) ([]DDLStatement, error)
+	SampleLoad(duration time.Duration) (LoadSample, error)
+	RowCounts(tables []string) (map[string]int64, error)
+	TableChecksums(tables []string) (map[string]string, error)
+	TraceUnder(span *Span)
 }
 
 type DBInserter interface {
 	Clean() error
 	Insert() error
+	TableChecksums(tables []string) (map[string]string, error)
+	Doctor() ([]string, error)
+	StartMaintenance() (end func(), err error)
+	WaitForDrain() error
+	ApplySeed(path string) error
+	CreateDatabase() error
+	DropDatabase() error
+	ExecDDL(statements []DDLStatement, opts DDLOptions) error
+	TraceUnder(span *Span)
+}
+
+// DDLOptions controls how schema changes are applied to a destination.
+type DDLOptions struct {
+	// OnlineTool is gh-ost or pt-osc, or empty to run ALTER TABLE directly.
+	OnlineTool string
+	// OnlineTables are altered with OnlineTool.
+	OnlineTables []string
+	// NoForeignKeyChecks creates tables referring to tables created later.
+	NoForeignKeyChecks bool
+}
+
+// FetchOptions controls which tables a fetcher dumps and how it handles
+// failing tables.
+type FetchOptions struct {
+	// Tables restricts the fetch to these tables when non-empty.
+	Tables []string
+	// Retries is the number of extra attempts for a failing table.
+	Retries int
+	// SkipFailedTables drops tables that still fail after retrying from the
+	// run instead of aborting it.
+	SkipFailedTables bool
+	// Compression is the codec compressing dumps for the transfer: gzip,
+	// zstd, lz4, or empty for none.
+	Compression string
+	// DumpTool is mysqlsh to dump with MySQL Shell when it is available, or
+	// empty for the mysql client.
+	DumpTool string
+	// RecentPartitions limits partitioned tables to their last partitions
+	// when non-zero.
+	RecentPartitions int
+	// Stats collects the transfer accounting of every table when non-nil.
+	Stats *FetchStats
+	// Cache reuses the dumps of unchanged tables when non-nil.
+	Cache *DumpCache
+	// KnownChecksums returns the checksums the destination is known to hold
+	// for tables, read from it or recorded by the last sync. When non-nil,
+	// tables matching the source are skipped.
+	KnownChecksums func(tables []string) (map[string]string, error)
+	// OrderByPK dumps the rows of tables with a primary key in its order.
+	OrderByPK bool
+	// Filter leaves the tables it marks as schema only out of the fetch.
+	Filter Filter
+	// Columns limits the columns fetched, and then loaded, of the tables
+	// it names.
+	Columns map[string]ColumnSelection
 }
 
 type DBConnector struct {
-	SSHClient        *ssh.Client
+	// Runner executes commands on the database host.
+	Runner Runner
+	// LocalRunner executes commands on this machine, e.g. LOAD DATA LOCAL INFILE.
+	LocalRunner      Runner
 	Host             string
+	Port             string
 	ManagementSystem string
 	Name             string
 	User             string
 	Password         string
 	IsContainer      bool
+	Workspace        *Workspace
+	FetchOptions     FetchOptions
+	// Concurrency caps the parallel sessions of each phase. Zero means the defaults.
+	Concurrency int
+	// SessionCapacity returns the sessions the host accepts at once, or 0
+	// while unknown.
+	SessionCapacity func() int
+	// Adaptive tunes the parallel sessions between Concurrency and MaxConcurrency.
+	Adaptive       bool
+	MaxConcurrency int
+	// Proxy is proxysql or vitess when the database sits behind one.
+	Proxy string
+	// RouteComment is prefixed to every query for the routing rules of Proxy.
+	RouteComment string
+	// UseMyCnf leaves the user and password to ~/.my.cnf.
+	UseMyCnf bool
+	// IAMAuth logs in with RDS IAM auth tokens of AWSRegion instead of Password.
+	IAMAuth   bool
+	AWSRegion string
+	// NativeDriver runs the mysql client invocations through the runners
+	// speaking the MySQL protocol themselves.
+	NativeDriver bool
+	// LockTables deletes and loads every table in a single session under
+	// LOCK TABLES.
+	LockTables bool
+	// EngineCompat loads MyRocks and TokuDB tables with their bulk load settings.
+	EngineCompat bool
+	// MaintenanceOn and MaintenanceOff set and clear a maintenance flag
+	// on the destination.
+	MaintenanceOn  string
+	MaintenanceOff string
+	// DrainMaxConnections and DrainTimeout bound the wait for other
+	// connections to the destination database to go away.
+	DrainMaxConnections int
+	DrainTimeout        int
+	// LockWaitTimeout bounds how long sessions wait for row and metadata
+	// locks, in seconds.
+	LockWaitTimeout int
+	// LockRetries is how many times deletes and loads failing on lock
+	// conflicts are retried.
+	LockRetries int
+	// DeleteBatchSize deletes tables this many rows per statement.
+	DeleteBatchSize int
+	// SessionSettings are run before every dump.
+	SessionSettings []string
+	// SelectHint follows the SELECT of every dump.
+	SelectHint string
+	// SeedEnv holds the template variables of seed files.
+	SeedEnv map[string]string
+	// DumpTimeout bounds the dump of a table, in seconds.
+	DumpTimeout int
+	// TableWeights and SlotSize set how many concurrency slots the sessions
+	// of a table take.
+	TableWeights map[string]float64
+	SlotSize     int64
+	// Offset caps the rows dumped from every table, and Tables selects the
+	// rows dumped from single tables and sets their columns while loading.
+	Offset int
+	Tables map[string]TableSettings
+	// Span is the span of the phase the spans of the tables belong to.
+	Span *Span
+
+	// failedDeletes are the tables Clean failed to delete. Insert leaves
+	// them alone, since they still hold their old rows.
+	failedDeletes []string
 }
 
-func CreateFetcher(dbConf Database, sshConf SSH) (fetcher DBFetcher, err error) {
+func CreateFetcher(dbConf Database, sshConf SSH, ws *Workspace, opts FetchOptions) (fetcher DBFetcher, err error) {
+	if dbConf, err = PromptPassword(dbConf); err != nil {
+		return nil, err
+	}
 	// Connect to the host of the data soruce.
-	config := LoadSrcSSHConf(sshConf.User, sshConf.Key)
-	srcHostConn, err := ssh.Dial("tcp", sshConf.Host+":"+sshConf.Port, config)
+	srcHostRunner, err := newHostRunner(sshConf, dbConf.NativeDriver, func() (*ssh.ClientConfig, error) {
+		return LoadSrcSSHConf(sshConf)
+	})
 	if err != nil {
 		return nil, err
 	}
 
+	if opts.Compression == "" {
+		opts.Compression = dbConf.Compression
+	}
+	if opts.DumpTool == "" {
+		opts.DumpTool = dbConf.DumpTool
+	}
+
 	switch dbConf.ManagementSystem {
-	case "mysql":
+	case MANAGEMENT_SYSTEM_MYSQL:
 		return &MySQLFetcher{
-			SSHClient:   srcHostConn,
-			Host:        dbConf.Host,
-			Name:        dbConf.Name,
-			User:        dbConf.User,
-			Password:    dbConf.Password,
-			IsContainer: dbConf.IsContainer,
+			Runner:           srcHostRunner,
+			SessionCapacity:  hostSessionCapacity(sshConf),
+			LocalRunner:      newLocalRunner(dbConf.NativeDriver),
+			Host:             dbConf.Host,
+			Port:             dbConf.Port,
+			ManagementSystem: dbConf.ManagementSystem,
+			Name:             dbConf.Name,
+			User:             dbConf.User,
+			Password:         dbConf.Password,
+			IsContainer:      dbConf.IsContainer,
+			Proxy:            dbConf.Proxy,
+			RouteComment:     dbConf.RouteComment,
+			UseMyCnf:         dbConf.UseMyCnf,
+			IAMAuth:          dbConf.IAMAuth,
+			AWSRegion:        dbConf.AWSRegion,
+			NativeDriver:     dbConf.NativeDriver,
+			Workspace:        ws,
+			FetchOptions:     opts,
+			Concurrency:      dbConf.Concurrency,
+			Adaptive:         dbConf.Adaptive,
+			MaxConcurrency:   dbConf.MaxConcurrency,
+			TableWeights:     dbConf.TableWeights,
+			SlotSize:         dbConf.SlotSize,
+			Offset:           dbConf.Offset,
+			Tables:           dbConf.Tables,
+			SessionSettings:  dbConf.SessionSettings,
+			SelectHint:       dbConf.SelectHint,
+			DumpTimeout:      dbConf.DumpTimeout,
+		}, nil
+	case MANAGEMENT_SYSTEM_POSTGRESQL:
+		return &PostgreSQLFetcher{
+			Runner:           srcHostRunner,
+			SessionCapacity:  hostSessionCapacity(sshConf),
+			LocalRunner:      newLocalRunner(false),
+			Host:             dbConf.Host,
+			Port:             dbConf.Port,
+			ManagementSystem: dbConf.ManagementSystem,
+			Name:             dbConf.Name,
+			User:             dbConf.User,
+			Password:         dbConf.Password,
+			IsContainer:      dbConf.IsContainer,
+			Workspace:        ws,
+			FetchOptions:     opts,
+			Concurrency:      dbConf.Concurrency,
+			Adaptive:         dbConf.Adaptive,
+			MaxConcurrency:   dbConf.MaxConcurrency,
+			TableWeights:     dbConf.TableWeights,
+			SlotSize:         dbConf.SlotSize,
+			Offset:           dbConf.Offset,
+			Tables:           dbConf.Tables,
+			DumpTimeout:      dbConf.DumpTimeout,
 		}, nil
 	default:
 		return nil, nil
 	}
 }
 
-func CreateInserter(dbConf Database, sshConf SSH) (inserter DBInserter, err error) {
-	config, err := generateSSHSign(sshConf)
-	if err != nil {
+func CreateInserter(dbConf Database, sshConf SSH, ws *Workspace) (inserter DBInserter, err error) {
+	if dbConf, err = PromptPassword(dbConf); err != nil {
 		return nil, err
 	}
-	var dstHostConn *ssh.Client
-	if sshConf.Host == "localhost" || sshConf.Host == "127.0.0.1" {
-		dstHostConn = nil
-	} else {
-		dstHostConn, err = ssh.Dial("tcp", sshConf.Host+":"+sshConf.Port, config)
-		if err != nil {
-			return nil, err
-		}
+	dstHostRunner, err := newHostRunner(sshConf, dbConf.NativeDriver, func() (*ssh.ClientConfig, error) {
+		return generateSSHSign(sshConf)
+	})
+	if err != nil {
+		return nil, err
 	}
 
 	switch dbConf.ManagementSystem {
-	case "mysql":
+	case MANAGEMENT_SYSTEM_MYSQL:
 		return &MySQLInserter{
-			SSHClient:   dstHostConn,
-			Host:        dbConf.Host,
-			Name:        dbConf.Name,
-			User:        dbConf.User,
-			Password:    dbConf.Password,
-			IsContainer: dbConf.IsContainer,
+			Runner:              dstHostRunner,
+			SessionCapacity:     hostSessionCapacity(sshConf),
+			LocalRunner:         newLocalRunner(dbConf.NativeDriver),
+			Host:                dbConf.Host,
+			Port:                dbConf.Port,
+			ManagementSystem:    dbConf.ManagementSystem,
+			Name:                dbConf.Name,
+			User:                dbConf.User,
+			Password:            dbConf.Password,
+			IsContainer:         dbConf.IsContainer,
+			Proxy:               dbConf.Proxy,
+			RouteComment:        dbConf.RouteComment,
+			UseMyCnf:            dbConf.UseMyCnf,
+			IAMAuth:             dbConf.IAMAuth,
+			AWSRegion:           dbConf.AWSRegion,
+			NativeDriver:        dbConf.NativeDriver,
+			Workspace:           ws,
+			Concurrency:         dbConf.Concurrency,
+			Adaptive:            dbConf.Adaptive,
+			MaxConcurrency:      dbConf.MaxConcurrency,
+			TableWeights:        dbConf.TableWeights,
+			SlotSize:            dbConf.SlotSize,
+			LockTables:          dbConf.LockTables,
+			EngineCompat:        dbConf.EngineCompat,
+			MaintenanceOn:       dbConf.MaintenanceOn,
+			MaintenanceOff:      dbConf.MaintenanceOff,
+			DrainMaxConnections: dbConf.DrainMaxConnections,
+			DrainTimeout:        dbConf.DrainTimeout,
+			LockWaitTimeout:     dbConf.LockWaitTimeout,
+			LockRetries:         dbConf.LockRetries,
+			DeleteBatchSize:     dbConf.DeleteBatchSize,
+			SeedEnv:             dbConf.SeedEnv,
+			Tables:              dbConf.Tables,
+		}, nil
+	case MANAGEMENT_SYSTEM_POSTGRESQL:
+		return &PostgreSQLInserter{
+			Runner:              dstHostRunner,
+			SessionCapacity:     hostSessionCapacity(sshConf),
+			LocalRunner:         newLocalRunner(false),
+			Host:                dbConf.Host,
+			Port:                dbConf.Port,
+			ManagementSystem:    dbConf.ManagementSystem,
+			Name:                dbConf.Name,
+			User:                dbConf.User,
+			Password:            dbConf.Password,
+			IsContainer:         dbConf.IsContainer,
+			Workspace:           ws,
+			Concurrency:         dbConf.Concurrency,
+			Adaptive:            dbConf.Adaptive,
+			MaxConcurrency:      dbConf.MaxConcurrency,
+			TableWeights:        dbConf.TableWeights,
+			SlotSize:            dbConf.SlotSize,
+			MaintenanceOn:       dbConf.MaintenanceOn,
+			MaintenanceOff:      dbConf.MaintenanceOff,
+			DrainMaxConnections: dbConf.DrainMaxConnections,
+			DrainTimeout:        dbConf.DrainTimeout,
+			SeedEnv:             dbConf.SeedEnv,
+			Tables:              dbConf.Tables,
 		}, nil
 	default:
 		return nil, nil
@@ -83,18 +320,10 @@ func CreateInserter(dbConf Database, sshConf SSH) (inserter DBInserter, err erro
 }
 
 func generateSSHSign(sshConf SSH) (*ssh.ClientConfig, error) {
-	if sshConf.Host == "localhost" || sshConf.Host == "127.0.0.1" {
+	if isLocalHost(sshConf.Host) {
 		return nil, nil
 	}
-	usr, _ := user.Current()
-	keypathString := strings.Replace(sshConf.Key, "~", usr.HomeDir, 1)
-	keypath, _ := filepath.Abs(keypathString)
-	key, err := ioutil.ReadFile(keypath)
-	if err != nil {
-		return nil, err
-	}
-
-	signer, err := ssh.ParsePrivateKey(key)
+	signer, err := LoadSigner(sshConf)
 	if err != nil {
 		return nil, err
 	}
@@ -107,3 +336,19 @@ func generateSSHSign(sshConf SSH) (*ssh.ClientConfig, error) {
 	}
 	return config, nil
 }
+
+// sessionLimiter returns the limiter of the parallel sessions of a phase.
+func sessionLimiter(conn DBConnector, defaultLimit int, adaptive bool) SessionLimiter {
+	limit := defaultLimit
+	if conn.Concurrency > 0 {
+		limit = conn.Concurrency
+	}
+	if !adaptive || !conn.Adaptive {
+		return NewFixedLimiter(limit)
+	}
+	maxLimit := conn.MaxConcurrency
+	if maxLimit <= 0 {
+		maxLimit = DefaultMaxAdaptiveSession
+	}
+	return NewAdaptiveLimiter(limit, maxLimit)
+}
@@ -0,0 +1,109 @@
+package database
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"strconv"
+	"strings"
+
+	. "github.com/timakin/gopli/constants"
+)
+
+// runDelete runs a delete statement on the destination.
+func (inserter *MySQLInserter) runDelete(query string, stdout io.Writer, stderr io.Writer) error {
+	client, err := mysqlClient(DBConnector(*inserter), inserter.IsContainer && isLocalHost(inserter.Host))
+	if err != nil {
+		return err
+	}
+	var cmd *Command
+	if isLocalHost(inserter.Host) {
+		cmd = client.Stdin(strings.NewReader(query)).LocalCommand()
+	} else {
+		cmd = client.Stdin(strings.NewReader(query)).Command()
+	}
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	return inserter.Runner.Run(cmd)
+}
+
+// loadableTables returns tables without the ones Clean failed to delete.
+func loadableTables(tables []string, failedDeletes []string) []string {
+	var loadable []string
+	for _, table := range tables {
+		if !containsString(failedDeletes, table) {
+			loadable = append(loadable, table)
+		}
+	}
+	return loadable
+}
+
+// batchDelete empties a table DeleteBatchSize rows at a time, so huge tables
+// are never deleted in a single giant transaction. Batches follow orderBy,
+// which keeps them deterministic for statement based replication; without
+// it, the table is deleted in a single statement instead. Every batch is
+// retried on its own when it runs into a lock conflict.
+func (inserter *MySQLInserter) batchDelete(table string, orderBy []string) (string, error) {
+	if len(orderBy) == 0 {
+		log.Print("\t[Delete] found no columns to order the batches of " + table + " by, deleting it in a single statement")
+		return inserter.retryLocks(table, func(stderr io.Writer) error {
+			return inserter.runDelete(fmt.Sprintf(DELETE_TABLE_QUERY_FORMAT, qualifiedTable(inserter.Name, table)), nil, stderr)
+		})
+	}
+	query := fmt.Sprintf(BATCH_DELETE_QUERY_FORMAT, qualifiedTable(inserter.Name, table), fmt.Sprintf(ORDER_BY_FORMAT, columnList(orderBy)), inserter.DeleteBatchSize)
+	var total int64
+	for {
+		var out bytes.Buffer
+		stderr, err := inserter.retryLocks(table, func(stderr io.Writer) error {
+			out.Reset()
+			return inserter.runDelete(query, &out, stderr)
+		})
+		if err != nil {
+			return stderr, err
+		}
+		deleted, err := strconv.ParseInt(strings.TrimSpace(out.String()), 10, 64)
+		if err != nil {
+			return "", fmt.Errorf("unexpected row count %q: %v", out.String(), err)
+		}
+		total += deleted
+		log.Printf("\t[Delete] deleted %d rows of %s", total, table)
+		if deleted < int64(inserter.DeleteBatchSize) {
+			return "", nil
+		}
+	}
+}
+
+// batchDeleteKeys returns the columns ordering the batched deletes of every
+// table: its primary key, or all of its columns when it has none. Without an
+// order, every batch of DELETE ... LIMIT picks arbitrary rows, which
+// statement based replicas may not delete alike. Rows alike in all their
+// columns can't be told apart, so ordering by all of them is deterministic
+// as well, at the cost of sorting the table for every batch.
+func (inserter *MySQLInserter) batchDeleteKeys(tables []string) (map[string][]string, error) {
+	if inserter.DeleteBatchSize <= 0 || len(tables) == 0 {
+		return nil, nil
+	}
+	keys, err := tableColumns(DBConnector(*inserter), fmt.Sprintf(TABLE_KEYS_QUERY_FORMAT, tablesCondition(inserter.Name, tables)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the primary keys: %v", err)
+	}
+	var keyless []string
+	for _, table := range tables {
+		if len(keys[table]) == 0 {
+			keyless = append(keyless, table)
+		}
+	}
+	if len(keyless) == 0 {
+		return keys, nil
+	}
+	columns, err := tableColumns(DBConnector(*inserter), fmt.Sprintf(TABLE_COLUMNS_QUERY_FORMAT, tablesCondition(inserter.Name, keyless)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the columns: %v", err)
+	}
+	for _, table := range keyless {
+		log.Print("\t[Delete] " + table + " has no primary key, ordering its batches by all of its columns")
+		keys[table] = columns[table]
+	}
+	return keys, nil
+}
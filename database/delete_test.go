@@ -0,0 +1,100 @@
+package database
+
+import (
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+// rowCountRunner answers every command with the next of counts.
+type rowCountRunner struct {
+	counts  []string
+	queries []string
+}
+
+func (runner *rowCountRunner) Run(cmd *Command) error {
+	query, _ := ioutil.ReadAll(cmd.Stdin)
+	runner.queries = append(runner.queries, string(query))
+	count := runner.counts[0]
+	runner.counts = runner.counts[1:]
+	if cmd.Stdout == nil {
+		return nil
+	}
+	_, err := io.WriteString(cmd.Stdout, count+"\n")
+	return err
+}
+
+func TestBatchDelete(t *testing.T) {
+	runner := &rowCountRunner{counts: []string{"2", "2", "1"}}
+	inserter := &MySQLInserter{Runner: runner, Name: "app", DeleteBatchSize: 2}
+	if _, err := inserter.batchDelete("users", []string{"tenant_id", "id"}); err != nil {
+		t.Fatal(err)
+	}
+	if len(runner.queries) != 3 {
+		t.Fatalf("expected a batch until one deletes less than the batch size, got %d", len(runner.queries))
+	}
+	if !strings.HasPrefix(runner.queries[0], "DELETE FROM `app`.`users` ORDER BY `tenant_id`, `id` LIMIT 2;") {
+		t.Errorf("unexpected batch: %q", runner.queries[0])
+	}
+
+	// Without columns to order by, the table is deleted in one statement.
+	runner = &rowCountRunner{counts: []string{""}}
+	inserter.Runner = runner
+	if _, err := inserter.batchDelete("users", nil); err != nil {
+		t.Fatal(err)
+	}
+	if len(runner.queries) != 1 || runner.queries[0] != "DELETE FROM `app`.`users`" {
+		t.Errorf("unexpected delete: %q", runner.queries)
+	}
+}
+
+// queryRunner answers every command with the answer whose key its query
+// contains.
+type queryRunner struct {
+	answers map[string]string
+}
+
+func (runner *queryRunner) Run(cmd *Command) error {
+	query, _ := ioutil.ReadAll(cmd.Stdin)
+	for key, answer := range runner.answers {
+		if strings.Contains(string(query), key) {
+			_, err := io.WriteString(cmd.Stdout, answer)
+			return err
+		}
+	}
+	return nil
+}
+
+func TestBatchDeleteKeys(t *testing.T) {
+	runner := &queryRunner{answers: map[string]string{
+		"information_schema.statistics": "app\tusers\tid\n",
+		"information_schema.columns":    "app\tlogs\tat\napp\tlogs\tmessage\narchive\tlogs\tat\n",
+	}}
+	inserter := &MySQLInserter{Runner: runner, Name: "app", DeleteBatchSize: 100}
+	keys, err := inserter.batchDeleteKeys([]string{"users", "logs", "archive.logs"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(keys["users"], ",") != "id" || strings.Join(keys["logs"], ",") != "at,message" || strings.Join(keys["archive.logs"], ",") != "at" {
+		t.Errorf("expected the primary key or else all columns, got %v", keys)
+	}
+}
+
+func TestKeylessTables(t *testing.T) {
+	keys := map[string][]string{"users": {"id"}}
+	keyless := keylessTables([]string{"users", "logs", "archive.logs"}, keys)
+	if strings.Join(keyless, ",") != "logs" {
+		t.Errorf("expected only the unqualified table without a key, got %v", keyless)
+	}
+}
+
+func TestLoadableTables(t *testing.T) {
+	tables := loadableTables([]string{"users", "orders", "items"}, []string{"orders"})
+	if strings.Join(tables, ",") != "users,items" {
+		t.Errorf("expected the tables that failed to delete left out, got %v", tables)
+	}
+	if tables := loadableTables([]string{"users"}, nil); len(tables) != 1 {
+		t.Errorf("expected every table without failed deletes, got %v", tables)
+	}
+}
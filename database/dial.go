@@ -0,0 +1,180 @@
+package database
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+
+	. "github.com/timakin/gopli/constants"
+	. "github.com/timakin/gopli/lib"
+	"golang.org/x/crypto/ssh"
+)
+
+// sshAddress returns the address of the SSH server of sshConf. IPv6 literals
+// may be configured with or without brackets.
+func sshAddress(sshConf SSH) string {
+	return net.JoinHostPort(unbracket(sshConf.Host), sshConf.Port)
+}
+
+func unbracket(host string) string {
+	return strings.TrimSuffix(strings.TrimPrefix(host, "["), "]")
+}
+
+// dialSSH connects to the SSH server of sshConf, through its jump hosts or
+// proxy if any, or else trying every address the host resolves to until one
+// accepts the connection.
+func dialSSH(sshConf SSH, config *ssh.ClientConfig) (*ssh.Client, error) {
+	if sshConf.ProxyJump != "" {
+		return dialJump(sshConf, config)
+	}
+	if sshConf.ProxyURL != "" {
+		conn, err := dialProxy(sshConf.ProxyURL, sshAddress(sshConf), config.Timeout)
+		if err != nil {
+			return nil, err
+		}
+		return newSSHClient(conn, sshConf, config)
+	}
+
+	ips, err := resolveHost(unbracket(sshConf.Host), sshConf.PreferIPv4)
+	if err != nil {
+		return nil, err
+	}
+
+	var lastErr error
+	for _, ip := range ips {
+		dialer := net.Dialer{Timeout: config.Timeout}
+		if sshConf.BindInterface != "" {
+			local, err := interfaceIP(sshConf.BindInterface, ip.To4() != nil)
+			if err != nil {
+				lastErr = err
+				continue
+			}
+			dialer.LocalAddr = &net.TCPAddr{IP: local}
+		}
+		conn, err := dialer.Dial("tcp", net.JoinHostPort(ip.String(), sshConf.Port))
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		return newSSHClient(conn, sshConf, config)
+	}
+	return nil, lastErr
+}
+
+// dialJump connects to the first jump host of sshConf and tunnels the
+// connection to every next hop through the previous one. Closing the
+// returned client closes the jump hosts as well.
+func dialJump(sshConf SSH, config *ssh.ClientConfig) (*ssh.Client, error) {
+	hops := append(jumpHosts(sshConf), sshConf)
+	hops[len(hops)-1].ProxyJump = ""
+	client, err := dialSSH(hops[0], hopConfig(config, hops[0]))
+	if err != nil {
+		return nil, fmt.Errorf("jump host %s: %v", hops[0].Host, err)
+	}
+	for _, hop := range hops[1:] {
+		conn, err := client.Dial("tcp", sshAddress(hop))
+		if err != nil {
+			client.Close()
+			return nil, fmt.Errorf("%s through jump host: %v", hop.Host, err)
+		}
+		next, err := newSSHClient(conn, hop, hopConfig(config, hop))
+		if err != nil {
+			client.Close()
+			return nil, err
+		}
+		go func(next *ssh.Client, previous *ssh.Client) {
+			next.Wait()
+			previous.Close()
+		}(next, client)
+		client = next
+	}
+	return client, nil
+}
+
+// jumpHosts parses the proxy_jump of sshConf. Jump hosts take the user and
+// the credentials of sshConf unless they name their own user.
+func jumpHosts(sshConf SSH) []SSH {
+	var hops []SSH
+	for _, spec := range strings.Split(sshConf.ProxyJump, ",") {
+		hop := sshConf
+		hop.ProxyJump = ""
+		hop.Port = SSH_DEFAULT_PORT
+		hostPort := strings.TrimSpace(spec)
+		if i := strings.LastIndex(hostPort, "@"); i >= 0 {
+			hop.User = hostPort[:i]
+			hostPort = hostPort[i+1:]
+		}
+		host, port, err := net.SplitHostPort(hostPort)
+		if err != nil {
+			// No port given.
+			host = hostPort
+		} else {
+			hop.Port = port
+		}
+		hop.Host = host
+		hops = append(hops, hop)
+	}
+	return hops
+}
+
+func hopConfig(config *ssh.ClientConfig, hop SSH) *ssh.ClientConfig {
+	hopConfig := *config
+	hopConfig.User = hop.User
+	if config.HostKeyCallback != nil && !HostKeysIgnored() {
+		// Jump hosts have keys of their own.
+		hopConfig.HostKeyAlgorithms = KnownHostKeyAlgorithms(config.HostKeyCallback, hop)
+	}
+	return &hopConfig
+}
+
+func newSSHClient(conn net.Conn, sshConf SSH, config *ssh.ClientConfig) (*ssh.Client, error) {
+	// Host keys are checked against the configured name, not the address.
+	clientConn, chans, reqs, err := ssh.NewClientConn(conn, sshAddress(sshConf), config)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return ssh.NewClient(clientConn, chans, reqs), nil
+}
+
+// resolveHost returns the addresses of host, IPv4 ones first with preferIPv4.
+func resolveHost(host string, preferIPv4 bool) ([]net.IP, error) {
+	if ip := net.ParseIP(host); ip != nil {
+		return []net.IP{ip}, nil
+	}
+	ips, err := net.LookupIP(host)
+	if err != nil {
+		return nil, err
+	}
+	if preferIPv4 {
+		sort.SliceStable(ips, func(i, j int) bool {
+			return ips[i].To4() != nil && ips[j].To4() == nil
+		})
+	}
+	return ips, nil
+}
+
+// interfaceIP returns an address of the named interface in the given family.
+func interfaceIP(name string, ipv4 bool) (net.IP, error) {
+	iface, err := net.InterfaceByName(name)
+	if err != nil {
+		return nil, err
+	}
+	addrs, err := iface.Addrs()
+	if err != nil {
+		return nil, err
+	}
+	for _, addr := range addrs {
+		ipNet, ok := addr.(*net.IPNet)
+		if !ok || (ipNet.IP.To4() != nil) != ipv4 || ipNet.IP.IsLinkLocalUnicast() {
+			continue
+		}
+		return ipNet.IP, nil
+	}
+	family := "IPv6"
+	if ipv4 {
+		family = "IPv4"
+	}
+	return nil, fmt.Errorf("interface %s has no %s address", name, family)
+}
@@ -0,0 +1,49 @@
+package database
+
+import (
+	"net"
+	"testing"
+
+	. "github.com/timakin/gopli/constants"
+)
+
+func TestSSHAddress(t *testing.T) {
+	tests := map[string]string{
+		"db.example.com": "db.example.com:22",
+		"192.0.2.1":      "192.0.2.1:22",
+		"2001:db8::1":    "[2001:db8::1]:22",
+		"[2001:db8::1]":  "[2001:db8::1]:22",
+	}
+	for host, expected := range tests {
+		if actual := sshAddress(SSH{Host: host, Port: "22"}); actual != expected {
+			t.Errorf("%s: expected %s, got %s", host, expected, actual)
+		}
+	}
+}
+
+func TestResolveHostLiteral(t *testing.T) {
+	ips, err := resolveHost(unbracket("[::1]"), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ips) != 1 || !ips[0].Equal(net.IPv6loopback) {
+		t.Errorf("expected ::1, got %v", ips)
+	}
+	if !isLocalHost("[::1]") {
+		t.Error("expected [::1] to be the local host")
+	}
+}
+
+func TestJumpHosts(t *testing.T) {
+	sshConf := SSH{Host: "db.internal", Port: "2222", User: "deploy", Key: "~/.ssh/id_ed25519", ProxyJump: "bastion, ops@[2001:db8::1]:2200"}
+	hops := jumpHosts(sshConf)
+	if len(hops) != 2 {
+		t.Fatalf("expected 2 jump hosts, got %v", hops)
+	}
+	if hops[0].Host != "bastion" || hops[0].Port != "22" || hops[0].User != "deploy" || hops[0].Key != sshConf.Key {
+		t.Errorf("unexpected first hop %+v", hops[0])
+	}
+	if sshAddress(hops[1]) != "[2001:db8::1]:2200" || hops[1].User != "ops" || hops[1].ProxyJump != "" {
+		t.Errorf("unexpected second hop %+v", hops[1])
+	}
+}
@@ -0,0 +1,306 @@
+package database
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"strings"
+
+	. "github.com/timakin/gopli/constants"
+	. "github.com/timakin/gopli/lib"
+)
+
+// Dialect holds what the database systems differ in: their client, how
+// names and strings are quoted, the catalog queries, and how tables are
+// listed, dumped, truncated and loaded. The phases shared by the fetchers and
+// inserters go through the dialect of the connection.
+type Dialect interface {
+	// client builds a client invocation reading SQL from stdin and printing
+	// rows as tab separated values without headers.
+	client(conn DBConnector, withHost bool) (*commandBuilder, error)
+	// qualifiedTable quotes a table of the table list for use in SQL.
+	qualifiedTable(conn DBConnector, table string) string
+	// escapeString escapes s for use inside a single-quoted string literal.
+	escapeString(s string) string
+	// databaseExistsQuery prints 1 when database exists and the user can see
+	// it.
+	databaseExistsQuery(database string) string
+	// activeConnectionsQuery counts the other connections using database.
+	activeConnectionsQuery(database string) string
+	// tableStats returns the estimated row count and data size of every table.
+	tableStats(conn DBConnector) ([]TableStat, error)
+	// tableChecksums returns a checksum of every table that exists.
+	tableChecksums(conn DBConnector, tables []string) (map[string]string, error)
+	// listTables lists the tables to sync, one per line.
+	listTables(conn DBConnector) ([]byte, error)
+	// dumpCommand builds the command printing the rows of table selected by
+	// dump on the source host.
+	dumpCommand(conn DBConnector, table string, dump tableDump) (*Command, error)
+	// truncate empties tables of the destination together.
+	truncate(conn DBConnector, tables []string, stderr io.Writer) error
+	// prepareLoad readies table for its dump files to load, and returns what
+	// undoes it once they have, if anything.
+	prepareLoad(conn DBConnector, table string, load tableLoad) (restore func(), err error)
+	// loadCommand builds the command loading a dump file of table from this
+	// machine, and what closes the dump file after it ran.
+	loadCommand(conn DBConnector, table string, file string, load tableLoad) (cmd *Command, closeDump func(), err error)
+	// retry runs a delete or load of table, again as long as the failure
+	// allows it, and returns the stderr of the last attempt.
+	retry(conn DBConnector, table string, run func(stderr io.Writer) error) (string, error)
+	// explain turns a failed delete or load of table into the error telling
+	// its cause.
+	explain(conn DBConnector, err error, stderr string, table string) error
+}
+
+type mysqlDialect struct{}
+
+type postgresDialect struct{}
+
+// dialectOf returns the dialect of the database system of conn.
+func dialectOf(conn DBConnector) Dialect {
+	if conn.ManagementSystem == MANAGEMENT_SYSTEM_POSTGRESQL {
+		return postgresDialect{}
+	}
+	return mysqlDialect{}
+}
+
+func (mysqlDialect) client(conn DBConnector, withHost bool) (*commandBuilder, error) {
+	return mysqlClient(conn, withHost)
+}
+
+func (mysqlDialect) qualifiedTable(conn DBConnector, table string) string {
+	return qualifiedTable(conn.Name, table)
+}
+
+func (mysqlDialect) escapeString(s string) string {
+	return escapeString(s)
+}
+
+func (mysqlDialect) databaseExistsQuery(database string) string {
+	return fmt.Sprintf(SCHEMA_EXISTS_QUERY_FORMAT, escapeString(database))
+}
+
+func (mysqlDialect) activeConnectionsQuery(database string) string {
+	return fmt.Sprintf(ACTIVE_CONNECTIONS_QUERY_FORMAT, escapeString(database))
+}
+
+func (mysqlDialect) tableStats(conn DBConnector) ([]TableStat, error) {
+	return mysqlTableStats(conn)
+}
+
+func (mysqlDialect) tableChecksums(conn DBConnector, tables []string) (map[string]string, error) {
+	return mysqlTableChecksums(conn, tables)
+}
+
+func (postgresDialect) client(conn DBConnector, withHost bool) (*commandBuilder, error) {
+	return psqlClient(conn, withHost), nil
+}
+
+func (postgresDialect) qualifiedTable(conn DBConnector, table string) string {
+	return pgQualifiedTable(table)
+}
+
+func (postgresDialect) escapeString(s string) string {
+	return pgEscapeString(s)
+}
+
+func (postgresDialect) databaseExistsQuery(database string) string {
+	return fmt.Sprintf(PG_DATABASE_EXISTS_QUERY_FORMAT, pgEscapeString(database))
+}
+
+func (postgresDialect) activeConnectionsQuery(database string) string {
+	return fmt.Sprintf(PG_ACTIVE_CONNECTIONS_QUERY_FORMAT, pgEscapeString(database))
+}
+
+func (postgresDialect) tableStats(conn DBConnector) ([]TableStat, error) {
+	return pgTableStats(conn)
+}
+
+func (postgresDialect) tableChecksums(conn DBConnector, tables []string) (map[string]string, error) {
+	return pgTableChecksums(conn, tables)
+}
+
+func (mysqlDialect) listTables(conn DBConnector) ([]byte, error) {
+	fetcher := MySQLFetcher(conn)
+	return fetcher.listTables()
+}
+
+func (mysqlDialect) dumpCommand(conn DBConnector, table string, dump tableDump) (*Command, error) {
+	client, err := mysqlClient(conn, conn.IsContainer)
+	if err != nil {
+		return nil, err
+	}
+	selected := "*"
+	if len(dump.columns) > 0 {
+		selected = columnList(dump.columns)
+	}
+	from := qualifiedTable(conn.Name, table)
+	if len(dump.partitions) > 0 {
+		from += " PARTITION (" + columnList(dump.partitions) + ")"
+	}
+	if dump.marker != "" {
+		// The client strips comments unless told to keep them.
+		selected = dump.marker + " " + selected
+		client.Arg("--comments")
+	}
+	fetcher := MySQLFetcher(conn)
+	query := fetcher.selectQuery(selected, from, dump.orderBy, tableSelection(conn, table))
+	return client.Stdin(strings.NewReader(query)).Command(), nil
+}
+
+// truncate deletes the rows of every table, or truncates the fetched
+// partitions of partitioned dumps, as only those are replaced.
+func (mysqlDialect) truncate(conn DBConnector, tables []string, stderr io.Writer) error {
+	inserter := MySQLInserter(conn)
+	for _, table := range tables {
+		partitions, err := conn.Workspace.ReadPartitions(table)
+		if err != nil {
+			return err
+		}
+		query := fmt.Sprintf(DELETE_TABLE_QUERY_FORMAT, qualifiedTable(conn.Name, table))
+		if len(partitions) > 0 {
+			query = fmt.Sprintf(TRUNCATE_PARTITION_QUERY_FORMAT, qualifiedTable(conn.Name, table), columnList(partitions))
+		}
+		if err := inserter.runDelete(query, nil, stderr); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// prepareLoad disables the keys of MyISAM tables, which rebuild their
+// non-unique indexes once after the load instead of updating them row by
+// row.
+func (mysqlDialect) prepareLoad(conn DBConnector, table string, load tableLoad) (func(), error) {
+	if !strings.EqualFold(load.engine, MYISAM_ENGINE) {
+		return nil, nil
+	}
+	inserter := MySQLInserter(conn)
+	inserter.alterKeys(DISABLE_KEYS_QUERY_FORMAT, table)
+	return func() { inserter.alterKeys(ENABLE_KEYS_QUERY_FORMAT, table) }, nil
+}
+
+func (mysqlDialect) loadCommand(conn DBConnector, table string, file string, load tableLoad) (*Command, func(), error) {
+	inserter := MySQLInserter(conn)
+	client, err := mysqlClient(conn, conn.IsContainer || !isLocalHost(conn.Host))
+	if err != nil {
+		return nil, nil, err
+	}
+	into := inserter.loadTarget(table, load.partitions, load.columns)
+	closeDump := func() {}
+	if conn.Proxy != "" {
+		// Neither ProxySQL nor Vitess pass LOAD DATA LOCAL INFILE through.
+		// Every INSERT carries the route comment itself.
+		client.StdinPrefix("").Stdin(insertStatements(file, into, inserter.routePrefix(), conn.Workspace.MaxRowSize))
+	} else if IsCompressedDump(file) {
+		var dump io.Reader
+		if dump, closeDump, err = OpenDumps([]string{file}); err != nil {
+			return nil, nil, err
+		}
+		query := fmt.Sprintf(LOAD_INFILE_QUERY_FORMAT, STDIN_INFILE, into)
+		streamedLoad(client, conn, inserter.tunedLoadQuery(load.engine, query), dump)
+	} else {
+		query := fmt.Sprintf(LOAD_INFILE_QUERY_FORMAT, escapeString(file), into)
+		client.Arg("--enable-local-infile").Stdin(strings.NewReader(inserter.tunedLoadQuery(load.engine, query)))
+	}
+	return client.LocalCommand(), closeDump, nil
+}
+
+func (mysqlDialect) retry(conn DBConnector, table string, run func(stderr io.Writer) error) (string, error) {
+	inserter := MySQLInserter(conn)
+	return inserter.retryLocks(table, run)
+}
+
+func (mysqlDialect) explain(conn DBConnector, err error, stderr string, table string) error {
+	inserter := MySQLInserter(conn)
+	return inserter.explainLoadFailure(err, stderr, table)
+}
+
+func (postgresDialect) listTables(conn DBConnector) ([]byte, error) {
+	fetcher := PostgreSQLFetcher(conn)
+	return fetcher.listTables()
+}
+
+func (postgresDialect) dumpCommand(conn DBConnector, table string, dump tableDump) (*Command, error) {
+	query := fmt.Sprintf(PG_COPY_OUT_QUERY_FORMAT, pgQualifiedTable(table))
+	selected := "*"
+	if len(dump.columns) > 0 {
+		query = fmt.Sprintf(PG_COPY_COLUMNS_OUT_QUERY_FORMAT, pgQualifiedTable(table), pgColumnList(dump.columns))
+		selected = pgColumnList(dump.columns)
+	}
+	if selection := tableSelection(conn, table); isPartial(selection) || selection.OrderBy != "" {
+		query = fmt.Sprintf(PG_COPY_SELECT_OUT_QUERY_FORMAT, fmt.Sprintf(SELECT_TABLE_QUERY_FORMAT, selected, pgQualifiedTable(table))+selectionClauses(selection, nil))
+	}
+	return psqlClient(conn, conn.IsContainer).Stdin(strings.NewReader(query)).Command(), nil
+}
+
+// truncate empties every table in a single TRUNCATE, which PostgreSQL allows
+// for tables referencing each other only when they are truncated together.
+// Tables outside the sync referencing them make it fail rather than being
+// emptied too, as CASCADE would.
+func (postgresDialect) truncate(conn DBConnector, tables []string, stderr io.Writer) error {
+	qualified := make([]string, len(tables))
+	for i, table := range tables {
+		qualified[i] = pgQualifiedTable(table)
+	}
+	cmd := psqlClient(conn, conn.IsContainer || !isLocalHost(conn.Host)).
+		Stdin(strings.NewReader(fmt.Sprintf(PG_TRUNCATE_QUERY_FORMAT, strings.Join(qualified, ", ")))).
+		LocalCommand()
+	cmd.Stdout = ioutil.Discard
+	cmd.Stderr = stderr
+	return conn.LocalRunner.Run(cmd)
+}
+
+// prepareLoad disables the triggers users defined on table, which would
+// fire for every loaded row. Owning the table is enough for it, unlike for
+// turning off the system triggers checking foreign keys, so those are still
+// checked and the referenced tables load first.
+func (postgresDialect) prepareLoad(conn DBConnector, table string, load tableLoad) (func(), error) {
+	inserter := PostgreSQLInserter(conn)
+	if err := inserter.runStatement(fmt.Sprintf(PG_DISABLE_TRIGGERS_FORMAT, pgQualifiedTable(table))); err != nil {
+		return nil, fmt.Errorf("failed to disable the triggers of %s: %w", table, err)
+	}
+	return func() {
+		enable := fmt.Sprintf(PG_ENABLE_TRIGGERS_FORMAT, pgQualifiedTable(table))
+		if err := inserter.runStatement(enable); err != nil {
+			log.Print("\t[Load Infile] failed to enable the triggers of " + table + ", run " + enable + " by hand: " + err.Error())
+		}
+	}, nil
+}
+
+// loadCommand loads a dump file with \copy. Compressed dump files are read
+// from stdin, so they are never stored uncompressed, and the \copy goes on
+// the command line instead.
+func (postgresDialect) loadCommand(conn DBConnector, table string, file string, load tableLoad) (*Command, func(), error) {
+	client := psqlClient(conn, conn.IsContainer || !isLocalHost(conn.Host))
+	if IsCompressedDump(file) {
+		dump, closeDump, err := OpenDumps([]string{file})
+		if err != nil {
+			return nil, nil, err
+		}
+		copyIn := fmt.Sprintf(PG_COPY_STDIN_FORMAT, pgQualifiedTable(table))
+		if len(load.columns) > 0 {
+			copyIn = fmt.Sprintf(PG_COPY_COLUMNS_STDIN_FORMAT, pgQualifiedTable(table), pgColumnList(load.columns))
+		}
+		return client.Arg("-c", copyIn).Stdin(dump).LocalCommand(), closeDump, nil
+	}
+	copyIn := fmt.Sprintf(PG_COPY_IN_FORMAT, pgQualifiedTable(table), pgEscapeString(file))
+	if len(load.columns) > 0 {
+		copyIn = fmt.Sprintf(PG_COPY_COLUMNS_IN_FORMAT, pgQualifiedTable(table), pgColumnList(load.columns), pgEscapeString(file))
+	}
+	return client.Stdin(strings.NewReader(copyIn)).LocalCommand(), func() {}, nil
+}
+
+// retry runs once, as loads and truncates of PostgreSQL tables are not
+// retried.
+func (postgresDialect) retry(conn DBConnector, table string, run func(stderr io.Writer) error) (string, error) {
+	var stderr bytes.Buffer
+	err := run(&stderr)
+	return stderr.String(), err
+}
+
+func (postgresDialect) explain(conn DBConnector, err error, stderr string, table string) error {
+	return clientError(err, stderr)
+}
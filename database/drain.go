@@ -0,0 +1,58 @@
+package database
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	. "github.com/timakin/gopli/constants"
+)
+
+// WaitForDrain waits until at most DrainMaxConnections other connections use
+// the destination database, so the deletes don't queue behind their locks.
+func (inserter *MySQLInserter) WaitForDrain() error {
+	timeout := inserter.DrainTimeout
+	if timeout <= 0 {
+		timeout = DEFAULT_DRAIN_TIMEOUT_SECONDS
+	}
+	return waitForDrain(DBConnector(*inserter), inserter.DrainMaxConnections, time.Duration(timeout)*time.Second, DRAIN_POLL_INTERVAL_SECONDS*time.Second)
+}
+
+func waitForDrain(conn DBConnector, max int, timeout time.Duration, interval time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		active, err := activeConnections(conn)
+		if err != nil {
+			return err
+		}
+		if active <= max {
+			log.Printf("[Drain] %d other connections to %s", active, conn.Name)
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("%d connections to %s still open after %s, expected at most %d", active, conn.Name, timeout, max)
+		}
+		log.Printf("[Drain] waiting for %d connections to %s to close...", active, conn.Name)
+		time.Sleep(interval)
+	}
+}
+
+// activeConnections counts the other connections using the database.
+func activeConnections(conn DBConnector) (int, error) {
+	dialect := dialectOf(conn)
+	query := dialect.activeConnectionsQuery(conn.Name)
+	var out bytes.Buffer
+	client, err := dialect.client(conn, conn.IsContainer)
+	if err != nil {
+		return 0, err
+	}
+	cmd := client.Stdin(strings.NewReader(query)).Command()
+	cmd.Stdout = &out
+	if err := conn.Runner.Run(cmd); err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(strings.TrimSpace(out.String()))
+}
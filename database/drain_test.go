@@ -0,0 +1,16 @@
+package database
+
+import (
+	"testing"
+	"time"
+)
+
+func TestWaitForDrain(t *testing.T) {
+	conn := DBConnector{Runner: &cannedRunner{out: "2\n"}, Name: "app"}
+	if err := waitForDrain(conn, 2, 0, time.Millisecond); err != nil {
+		t.Errorf("expected connections at the threshold to pass, got %v", err)
+	}
+	if err := waitForDrain(conn, 1, time.Millisecond, time.Millisecond); err == nil {
+		t.Error("expected connections above the threshold to time out")
+	}
+}
@@ -0,0 +1,68 @@
+package database
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	. "github.com/timakin/gopli/constants"
+)
+
+var dumpMarkers int64
+
+// newDumpMarker returns a comment unique to a single dump query, by which a
+// control session finds the query in the process list.
+func newDumpMarker() string {
+	return fmt.Sprintf(DUMP_MARKER_FORMAT, os.Getpid(), atomic.AddInt64(&dumpMarkers, 1))
+}
+
+// watchDump kills the dump query tagged with marker once it runs longer than
+// DumpTimeout. The returned function stops watching and reports whether the
+// query was killed.
+func watchDump(conn DBConnector, table string, marker string) func() bool {
+	if conn.DumpTimeout <= 0 || marker == "" {
+		return func() bool { return false }
+	}
+	var killed int32
+	timer := time.AfterFunc(time.Duration(conn.DumpTimeout)*time.Second, func() {
+		atomic.StoreInt32(&killed, 1)
+		log.Printf("\t\t[Fetch] the dump of %s exceeded %ds, killing its query", table, conn.DumpTimeout)
+		if err := killDump(conn, marker); err != nil {
+			log.Print("\t\t[Fetch] failed to kill the dump of " + table + ": " + err.Error())
+		}
+	})
+	return func() bool {
+		timer.Stop()
+		return atomic.LoadInt32(&killed) == 1
+	}
+}
+
+// killDump runs KILL QUERY on the queries tagged with marker from a control
+// session of its own.
+func killDump(conn DBConnector, marker string) error {
+	var out bytes.Buffer
+	client, err := mysqlClient(conn, conn.IsContainer)
+	if err != nil {
+		return err
+	}
+	cmd := client.Stdin(strings.NewReader(fmt.Sprintf(DUMP_PROCESSES_QUERY_FORMAT, marker))).Command()
+	cmd.Stdout = &out
+	cmd.Control = true
+	if err := conn.Runner.Run(cmd); err != nil {
+		return err
+	}
+	var kills []string
+	for _, id := range strings.Fields(out.String()) {
+		kills = append(kills, fmt.Sprintf(KILL_QUERY_FORMAT, id))
+	}
+	if len(kills) == 0 {
+		return nil
+	}
+	kill := client.Stdin(strings.NewReader(strings.Join(kills, "\n"))).Command()
+	kill.Control = true
+	return conn.Runner.Run(kill)
+}
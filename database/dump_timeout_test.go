@@ -0,0 +1,87 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/timakin/gopli/constants"
+)
+
+// killRunner lists two dump queries in the process list and records the
+// statements killing them.
+type killRunner struct {
+	mu    sync.Mutex
+	kills []string
+}
+
+func (runner *killRunner) Run(cmd *Command) error {
+	if !cmd.Control {
+		return errors.New("expected a control command")
+	}
+	statement, err := ioutil.ReadAll(cmd.Stdin)
+	if err != nil {
+		return err
+	}
+	if strings.Contains(string(statement), "information_schema.processlist") {
+		if !strings.Contains(string(statement), "LIKE '%/* gopli-dump:") {
+			return io.ErrUnexpectedEOF
+		}
+		_, err := io.WriteString(cmd.Stdout, "42\n43\n")
+		return err
+	}
+	runner.mu.Lock()
+	defer runner.mu.Unlock()
+	runner.kills = append(runner.kills, string(statement))
+	return nil
+}
+
+func TestWatchDump(t *testing.T) {
+	runner := &killRunner{}
+	conn := DBConnector{Runner: runner, DumpTimeout: 1}
+
+	marker := newDumpMarker()
+	if marker == newDumpMarker() {
+		t.Fatal("expected every dump to get its own marker")
+	}
+	first := fmt.Sprintf(DUMP_MARKER_FORMAT, 100, 1)
+	if tenth := fmt.Sprintf(DUMP_MARKER_FORMAT, 100, 10); strings.Contains(tenth+" SELECT", first) {
+		t.Errorf("expected %s not to match %s", first, tenth)
+	}
+	timedOut := watchDump(conn, "users", marker)
+	if timedOut() {
+		t.Error("expected a dump finishing in time not to be killed")
+	}
+
+	done := make(chan bool)
+	timedOut = watchDump(conn, "users", marker)
+	go func() {
+		for {
+			runner.mu.Lock()
+			killed := len(runner.kills) > 0
+			runner.mu.Unlock()
+			if killed {
+				done <- timedOut()
+				return
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}()
+	if !<-done {
+		t.Error("expected the dump to be reported as killed")
+	}
+	if runner.kills[0] != "KILL QUERY 42;\nKILL QUERY 43;" {
+		t.Errorf("unexpected kill statements %q", runner.kills[0])
+	}
+}
+
+func TestWatchDumpWithoutTimeout(t *testing.T) {
+	if watchDump(DBConnector{}, "users", "")() {
+		t.Error("expected no timeout without dump_timeout")
+	}
+}
@@ -0,0 +1,244 @@
+package database
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	. "github.com/timakin/gopli/constants"
+	. "github.com/timakin/gopli/lib"
+	"golang.org/x/crypto/ssh"
+)
+
+// Command is a shell command line executed by a Runner.
+type Command struct {
+	Line string
+	// Env holds extra environment variables. Only local runners apply them,
+	// since sshd usually refuses client provided variables.
+	Env []string
+	// Stdin may be nil. Passing long inputs such as SQL through it keeps the
+	// command line short.
+	Stdin  io.Reader
+	Stdout io.Writer
+	Stderr io.Writer
+	// Control commands, such as killing a query, may take the session kept
+	// free on hosts at their max_sessions.
+	Control bool
+	// Rows marks commands printing table rows as tab separated lines, whose
+	// values recorded fixtures leave out.
+	Rows bool
+	// SecretEnv names the environment variables the command line reads from
+	// the leading lines of stdin, one per line, ahead of the input. Fixtures
+	// leave their values out.
+	SecretEnv []string
+	// Native is the mysql client invocation of the command, which runners
+	// of the native driver run without the client.
+	Native *clientInvocation
+}
+
+// Runner executes commands on a single host.
+type Runner interface {
+	Run(cmd *Command) error
+}
+
+type localRunner struct{}
+
+func (runner *localRunner) Run(cmd *Command) error {
+	localCmd := exec.Command("sh", "-c", cmd.Line)
+	if len(cmd.Env) > 0 {
+		localCmd.Env = append(os.Environ(), cmd.Env...)
+	}
+	localCmd.Stdin = cmd.Stdin
+	localCmd.Stdout = cmd.Stdout
+	localCmd.Stderr = cmd.Stderr
+	return localCmd.Run()
+}
+
+type sshRunner struct {
+	manager *ConnectionManager
+	key     string
+}
+
+// Run executes cmd in a session of a pooled connection. Sessions sshd refuses
+// because of its MaxSessions are retried once another session ended, and the
+// connections of the host carry fewer sessions from then on. A connection
+// that broke is dropped from the pool, and the session retried once on
+// another or a newly dialed one.
+func (runner *sshRunner) Run(cmd *Command) error {
+	redialed := false
+	for {
+		conn, err := runner.manager.acquire(runner.key, cmd.Control)
+		if err != nil {
+			return err
+		}
+		session, err := conn.client.NewSession()
+		if sessionRefused(err) && runner.manager.limitSessions(runner.key, conn) {
+			runner.manager.release(runner.key, conn)
+			continue
+		}
+		if sessionRefused(err) {
+			err = fmt.Errorf("%v: the host refused a session, check MaxSessions of its sshd", err)
+		} else if err != nil {
+			runner.manager.evict(runner.key, conn)
+			if !redialed {
+				redialed = true
+				runner.manager.release(runner.key, conn)
+				continue
+			}
+		}
+		if err != nil {
+			runner.manager.release(runner.key, conn)
+			return err
+		}
+		runner.manager.opened(conn)
+		err = runSession(session, cmd)
+		runner.manager.closed(conn)
+		runner.manager.release(runner.key, conn)
+		return err
+	}
+}
+
+// sessionRefused reports whether sshd refused to open a session, as it does
+// beyond its MaxSessions.
+func sessionRefused(err error) bool {
+	var openErr *ssh.OpenChannelError
+	return errors.As(err, &openErr) && openErr.Reason == ssh.Prohibited
+}
+
+func runSession(session *ssh.Session, cmd *Command) error {
+	defer session.Close()
+	session.Stdin = cmd.Stdin
+	session.Stdout = cmd.Stdout
+	session.Stderr = cmd.Stderr
+	return session.Run(cmd.Line)
+}
+
+// newHostRunner returns a runner executing commands on the host described by
+// sshConf, over pooled SSH connections unless it is the local host or another
+// transport is configured. With nativeDriver, the mysql client invocations
+// connect from the host through tunnels of the pooled connections instead.
+func newHostRunner(sshConf SSH, nativeDriver bool, config func() (*ssh.ClientConfig, error)) (Runner, error) {
+	if replayDir != "" {
+		return withHostFaults(&replayRunner{dir: replayDir}), nil
+	}
+
+	var runner Runner
+	var dial tunnelDialer
+	switch {
+	case sshConf.Transport == TRANSPORT_TELEPORT || sshConf.Transport == TRANSPORT_SSM || sshConf.Auth == SSH_AUTH_GSSAPI:
+		if nativeDriver {
+			return nil, fmt.Errorf("native_driver tunnels through the built-in SSH client, which %s doesn't use", sshConf.Host)
+		}
+		runner = newTransportRunner(sshConf)
+		// Run a no-op right away so unreachable hosts fail before any phase starts.
+		if err := runner.Run(&Command{Line: "true"}); err != nil {
+			return nil, sshFailure(sshConf, err)
+		}
+	case isLocalHost(sshConf.Host):
+		runner = &localRunner{}
+		dial = dialDirect
+	default:
+		key := hostKey(sshConf)
+		connections.register(key, sshConf, func() (*ssh.Client, error) {
+			clientConfig, err := config()
+			if err != nil {
+				return nil, err
+			}
+			return dialSSH(sshConf, clientConfig)
+		})
+		// Connect right away so unreachable hosts fail before any phase starts.
+		if sshConf.Connections > 1 {
+			if err := connections.open(key, sshConf.Connections); err != nil {
+				return nil, sshFailure(sshConf, err)
+			}
+		} else {
+			conn, err := connections.acquire(key, false)
+			if err != nil {
+				return nil, sshFailure(sshConf, err)
+			}
+			connections.release(key, conn)
+		}
+		runner = &sshRunner{manager: connections, key: key}
+		if connections.sessionCapacity(key) == 0 {
+			detectMaxSessions(runner, connections, key)
+		}
+		dial = func(control bool, network string, address string) (net.Conn, error) {
+			return connections.tunnel(key, control, network, address)
+		}
+	}
+	if sshConf.RemoteSudoUser != "" {
+		runner = withSudo(runner, sshConf.RemoteSudoUser, sshConf.Host)
+		// Fail right away when sudo asks for a password.
+		if err := runner.Run(&Command{Line: "true"}); err != nil {
+			return nil, err
+		}
+	}
+	if nativeDriver {
+		runner = withNativeDriver(runner, dial)
+	}
+	return withRecorder(withHostFaults(withStderr(runner))), nil
+}
+
+// hostKey names the connection pool of the host of sshConf.
+func hostKey(sshConf SSH) string {
+	return sshConf.User + "@" + sshAddress(sshConf)
+}
+
+// hostSessionCapacity returns the function telling how many sessions of the
+// phases the host of sshConf accepts at once, or 0 while unknown.
+func hostSessionCapacity(sshConf SSH) func() int {
+	key := hostKey(sshConf)
+	return func() int {
+		return connections.sessionCapacity(key)
+	}
+}
+
+// detectMaxSessions reads MaxSessions from the settings of sshd, so the
+// sessions of a host stay within it from the start. Hosts hiding their
+// settings have it learned from the sessions they refuse instead.
+func detectMaxSessions(runner Runner, manager *ConnectionManager, key string) {
+	var out bytes.Buffer
+	if err := runner.Run(&Command{Line: SSHD_MAX_SESSIONS_COMMAND, Stdout: &out}); err != nil {
+		return
+	}
+	if limit, err := strconv.Atoi(strings.TrimSpace(out.String())); err == nil && limit > 0 {
+		manager.detectSessionLimit(key, limit)
+	}
+}
+
+// sshFailure marks err as a failure to reach the host of sshConf over SSH.
+func sshFailure(sshConf SSH, err error) error {
+	return fmt.Errorf("%w to %s: %w", ErrSSHFailed, sshConf.Host, err)
+}
+
+// newLocalRunner returns a runner executing commands on this machine, and
+// with nativeDriver, connecting from it without the mysql client.
+func newLocalRunner(nativeDriver bool) Runner {
+	if replayDir != "" {
+		return withLoadFaults(&replayRunner{dir: replayDir})
+	}
+	var runner Runner = &localRunner{}
+	if nativeDriver {
+		runner = withNativeDriver(runner, dialDirect)
+	}
+	return withRecorder(withLoadFaults(withStderr(runner)))
+}
+
+func isLocalHost(host string) bool {
+	switch unbracket(host) {
+	case "localhost", "127.0.0.1", "::1":
+		return true
+	}
+	return false
+}
+
+// shellQuote quotes s as a single word for a POSIX shell.
+func shellQuote(s string) string {
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
@@ -0,0 +1,62 @@
+package database
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	. "github.com/timakin/gopli/constants"
+)
+
+// iamTokens caches the RDS IAM auth tokens by user and host. Tokens are valid
+// for 15 minutes, so long runs get fresh ones.
+var iamTokens = struct {
+	sync.Mutex
+	tokens map[string]iamToken
+}{tokens: make(map[string]iamToken)}
+
+type iamToken struct {
+	token     string
+	createdAt time.Time
+}
+
+// generateIAMToken returns an IAM auth token for conn, generated on this
+// machine by the aws CLI with its usual credentials. The token is only valid
+// for the port it was generated for.
+var generateIAMToken = func(conn DBConnector) (string, error) {
+	port := conn.Port
+	if port == "" {
+		port = RDS_PORT
+	}
+	args := []string{"rds", "generate-db-auth-token", "--hostname", conn.Host, "--port", port, "--username", conn.User}
+	if conn.AWSRegion != "" {
+		args = append(args, "--region", conn.AWSRegion)
+	}
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command("aws", args...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("%v: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return strings.TrimSpace(stdout.String()), nil
+}
+
+// iamPassword returns a valid IAM auth token for conn.
+func iamPassword(conn DBConnector) (string, error) {
+	key := conn.User + "@" + conn.Host + ":" + conn.Port
+	iamTokens.Lock()
+	defer iamTokens.Unlock()
+	if cached, ok := iamTokens.tokens[key]; ok && time.Since(cached.createdAt) < IAM_TOKEN_REFRESH_MINUTES*time.Minute {
+		return cached.token, nil
+	}
+	token, err := generateIAMToken(conn)
+	if err != nil {
+		return "", err
+	}
+	iamTokens.tokens[key] = iamToken{token: token, createdAt: time.Now()}
+	return token, nil
+}
@@ -0,0 +1,74 @@
+package database
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestIAMPasswordIsCached(t *testing.T) {
+	defer func(generate func(DBConnector) (string, error)) { generateIAMToken = generate }(generateIAMToken)
+	generated := 0
+	generateIAMToken = func(conn DBConnector) (string, error) {
+		generated++
+		return "token-" + strconv.Itoa(generated), nil
+	}
+
+	conn := DBConnector{Host: "db.rds.amazonaws.com", User: "gopli", IAMAuth: true}
+	first, _ := iamPassword(conn)
+	second, _ := iamPassword(conn)
+	if first != "token-1" || second != "token-1" {
+		t.Errorf("expected the cached token, got %s and %s", first, second)
+	}
+
+	// Expire the cached token.
+	iamTokens.Lock()
+	cached := iamTokens.tokens["gopli@db.rds.amazonaws.com:"]
+	cached.createdAt = time.Now().Add(-time.Hour)
+	iamTokens.tokens["gopli@db.rds.amazonaws.com:"] = cached
+	iamTokens.Unlock()
+	if refreshed, _ := iamPassword(conn); refreshed != "token-2" {
+		t.Errorf("expected a fresh token, got %s", refreshed)
+	}
+
+	// Tokens are signed for a port.
+	conn.Port = "3307"
+	if other, _ := iamPassword(conn); other != "token-3" {
+		t.Errorf("expected a token for the other port, got %s", other)
+	}
+}
+
+func TestMysqlClientFailsWithoutIAMToken(t *testing.T) {
+	defer func(generate func(DBConnector) (string, error)) { generateIAMToken = generate }(generateIAMToken)
+	generateIAMToken = func(conn DBConnector) (string, error) {
+		return "", errors.New("Unable to locate credentials")
+	}
+
+	conn := DBConnector{Host: "expired.rds.amazonaws.com", User: "gopli", IAMAuth: true}
+	if _, err := mysqlClient(conn, true); err == nil || !strings.Contains(err.Error(), "Unable to locate credentials") {
+		t.Errorf("expected the token error, got %v", err)
+	}
+}
+
+func TestMysqlClientUsesPort(t *testing.T) {
+	defer func(generate func(DBConnector) (string, error)) { generateIAMToken = generate }(generateIAMToken)
+	var port string
+	generateIAMToken = func(conn DBConnector) (string, error) {
+		port = conn.Port
+		return "token", nil
+	}
+
+	conn := DBConnector{Host: "port.rds.amazonaws.com", Port: "3307", User: "gopli", IAMAuth: true}
+	client, err := mysqlClient(conn, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if line := client.Command().Line; !strings.Contains(line, "-P3307") {
+		t.Errorf("expected the configured port, got %q", line)
+	}
+	if port != "3307" {
+		t.Errorf("expected the token for port 3307, got %q", port)
+	}
+}
@@ -0,0 +1,80 @@
+package database
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+
+	. "github.com/timakin/gopli/constants"
+	. "github.com/timakin/gopli/lib"
+)
+
+// insertStatements streams the dump file at path as batches of INSERT
+// statements into the table clause into, for destinations that can't run
+// LOAD DATA LOCAL INFILE. Every statement starts with prefix.
+func insertStatements(path string, into string, prefix string, maxRowSize int) io.Reader {
+	reader, writer := io.Pipe()
+	go func() {
+		file, err := OpenDump(path)
+		if err != nil {
+			writer.CloseWithError(err)
+			return
+		}
+		defer file.Close()
+		writer.CloseWithError(writeInsertStatements(writer, file, into, prefix, maxRowSize))
+	}()
+	return reader
+}
+
+func writeInsertStatements(w io.Writer, dump io.Reader, into string, prefix string, maxRowSize int) error {
+	scanner := bufio.NewScanner(dump)
+	scanner.Buffer(make([]byte, 64*1024), maxRowSize)
+
+	var batch bytes.Buffer
+	rows := 0
+	flush := func() error {
+		if rows == 0 {
+			return nil
+		}
+		batch.WriteString(";\n")
+		_, err := w.Write(batch.Bytes())
+		batch.Reset()
+		rows = 0
+		return err
+	}
+	for scanner.Scan() {
+		if rows == 0 {
+			batch.WriteString(prefix + fmt.Sprintf(INSERT_QUERY_FORMAT, into))
+		} else {
+			batch.WriteString(",")
+		}
+		batch.WriteString(insertValues(scanner.Text()))
+		rows++
+		if rows >= INSERT_BATCH_ROWS || batch.Len() >= INSERT_BATCH_SIZE {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	return flush()
+}
+
+// insertValues converts a row of a dump into a VALUES tuple. The dump escapes
+// backslashes, tabs, newlines and NUL the way string literals do, so only
+// quotes need escaping. \N is NULL, as with LOAD DATA.
+func insertValues(row string) string {
+	fields := strings.Split(row, "\t")
+	for i, field := range fields {
+		if field == `\N` {
+			fields[i] = "NULL"
+			continue
+		}
+		fields[i] = "'" + strings.Replace(field, "'", "''", -1) + "'"
+	}
+	return "(" + strings.Join(fields, ",") + ")"
+}
@@ -0,0 +1,19 @@
+package database
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestWriteInsertStatements(t *testing.T) {
+	dump := "1\tit's\n2\t\\N\n3\ta\\tb\n"
+	var out bytes.Buffer
+	if err := writeInsertStatements(&out, strings.NewReader(dump), "`users` (`id`, `name`)", "/* gopli */ ", 1024); err != nil {
+		t.Fatal(err)
+	}
+	expected := "/* gopli */ INSERT INTO `users` (`id`, `name`) VALUES ('1','it''s'),('2',NULL),('3','a\\tb');\n"
+	if out.String() != expected {
+		t.Errorf("expected %s, got %s", expected, out.String())
+	}
+}
@@ -0,0 +1,83 @@
+package database
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	. "github.com/timakin/gopli/constants"
+	. "github.com/timakin/gopli/lib"
+)
+
+// SampleLoad reads the global status of the source repeatedly for duration
+// and returns the average statements per second and the highest number of
+// connected threads.
+func (fetcher *MySQLFetcher) SampleLoad(duration time.Duration) (LoadSample, error) {
+	return sampleLoad(duration, func() (int64, int64, error) {
+		return loadStatus(DBConnector(*fetcher))
+	})
+}
+
+// sampleLoad calls status for a statement counter and the number of
+// connected threads repeatedly for duration.
+func sampleLoad(duration time.Duration, status func() (int64, int64, error)) (LoadSample, error) {
+	interval := LOAD_SAMPLE_INTERVAL
+	if duration < interval {
+		interval = duration
+	}
+
+	var sample LoadSample
+	firstStatements, threads, err := status()
+	if err != nil {
+		return sample, err
+	}
+	sample.Threads = threads
+	started := time.Now()
+	statements := firstStatements
+	for time.Since(started) < duration {
+		time.Sleep(interval)
+		if statements, threads, err = status(); err != nil {
+			return sample, err
+		}
+		if threads > sample.Threads {
+			sample.Threads = threads
+		}
+	}
+	if elapsed := time.Since(started).Seconds(); elapsed > 0 {
+		sample.QPS = float64(statements-firstStatements) / elapsed
+	}
+	return sample, nil
+}
+
+// loadStatus returns the Questions and Threads_connected status variables.
+func loadStatus(conn DBConnector) (int64, int64, error) {
+	var out bytes.Buffer
+	client, err := mysqlClient(conn, conn.IsContainer)
+	if err != nil {
+		return 0, 0, err
+	}
+	cmd := client.Stdin(strings.NewReader(LOAD_STATUS_QUERY)).Command()
+	cmd.Stdout = &out
+	if err := conn.Runner.Run(cmd); err != nil {
+		return 0, 0, err
+	}
+	status := make(map[string]int64)
+	for _, line := range strings.Split(out.String(), "\n") {
+		columns := strings.Split(line, "\t")
+		if len(columns) != 2 {
+			continue
+		}
+		value, err := strconv.ParseInt(strings.TrimSpace(columns[1]), 10, 64)
+		if err != nil {
+			return 0, 0, fmt.Errorf("unexpected %s status %q", columns[0], columns[1])
+		}
+		status[strings.ToLower(columns[0])] = value
+	}
+	questions, ok := status["questions"]
+	if !ok {
+		return 0, 0, fmt.Errorf("missing Questions in %q", out.String())
+	}
+	return questions, status["threads_connected"], nil
+}
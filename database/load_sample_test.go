@@ -0,0 +1,46 @@
+package database
+
+import (
+	"fmt"
+	"io"
+	"testing"
+	"time"
+)
+
+// statusRunner answers status queries with Questions growing by step on
+// every call.
+type statusRunner struct {
+	questions int64
+	step      int64
+	threads   []int64
+}
+
+func (runner *statusRunner) Run(cmd *Command) error {
+	threads := runner.threads[0]
+	if len(runner.threads) > 1 {
+		runner.threads = runner.threads[1:]
+	}
+	_, err := io.WriteString(cmd.Stdout, fmt.Sprintf("Questions\t%d\nThreads_connected\t%d\n", runner.questions, threads))
+	runner.questions += runner.step
+	return err
+}
+
+func TestSampleLoad(t *testing.T) {
+	runner := &statusRunner{questions: 1000, step: 50, threads: []int64{4, 12, 7}}
+	fetcher := &MySQLFetcher{Runner: runner}
+
+	sample, err := fetcher.SampleLoad(30 * time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sample.Threads != 12 {
+		t.Errorf("expected the highest thread count 12, got %d", sample.Threads)
+	}
+	if sample.QPS <= 0 {
+		t.Errorf("expected a positive rate, got %f", sample.QPS)
+	}
+
+	if _, _, err := loadStatus(DBConnector{Runner: &cannedRunner{out: "Threads_connected\t3\n"}}); err == nil {
+		t.Error("expected an error without Questions")
+	}
+}
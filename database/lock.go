@@ -0,0 +1,203 @@
+package database
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"strings"
+	"time"
+
+	. "github.com/timakin/gopli/constants"
+	. "github.com/timakin/gopli/lib"
+)
+
+// lockTables reports whether tables are deleted and loaded under LOCK TABLES.
+// Proxies pin or refuse the session holding the lock, so they never are.
+func (inserter *MySQLInserter) lockTables() bool {
+	return inserter.LockTables && inserter.Proxy == ""
+}
+
+// loadTarget returns the table, partitions and columns LOAD DATA writes into,
+// followed by the values it sets columns to.
+func (inserter *MySQLInserter) loadTarget(table string, partitions []string, columns []string) string {
+	into := qualifiedTable(inserter.Name, table)
+	if len(partitions) > 0 {
+		into += " PARTITION (" + columnList(partitions) + ")"
+	}
+	if len(columns) > 0 {
+		into += " (" + columnList(columns) + ")"
+	}
+	return into + columnAssignments(DBConnector(*inserter), table)
+}
+
+// lockedLoadQuery deletes the rows of a table and loads every dump file of
+// it while holding a write lock, so readers wait instead of seeing the
+// table empty or half loaded.
+func lockedLoadQuery(table string, partitions []string, into string, files []string) string {
+	query := fmt.Sprintf(LOCK_TABLE_QUERY_FORMAT, table)
+	if len(partitions) > 0 {
+		// Only the fetched partitions are replaced.
+		query += fmt.Sprintf(DELETE_PARTITION_FORMAT, table, columnList(partitions))
+	} else {
+		query += fmt.Sprintf(DELETE_TABLE_QUERY_FORMAT, table)
+	}
+	for _, file := range files {
+		query += ";\n" + fmt.Sprintf(LOAD_INFILE_QUERY_FORMAT, escapeString(file), into)
+	}
+	return query
+}
+
+// lockedLoad replaces the contents of a table in a single session under
+// LOCK TABLES.
+func (inserter *MySQLInserter) lockedLoad(table string, load tableLoad) error {
+	log.Print("\t[Load Infile] start to replace " + table + " under LOCK TABLES")
+	files := inserter.Workspace.TableFiles(table)
+	compressed := false
+	for _, file := range files {
+		compressed = compressed || IsCompressedDump(file)
+	}
+	loaded := files
+	if compressed {
+		// The parts end on whole rows, so a single load reads them all from
+		// stdin.
+		loaded = []string{STDIN_INFILE}
+	}
+	replace := lockedLoadQuery(qualifiedTable(inserter.Name, table), load.partitions, inserter.loadTarget(table, load.partitions, load.columns), loaded)
+	query := inserter.tunedLoadQuery(load.engine, replace) + UNLOCK_TABLES_QUERY
+
+	stderr, err := inserter.retryLocks(table, func(stderr io.Writer) error {
+		client, err := mysqlClient(DBConnector(*inserter), inserter.IsContainer || !isLocalHost(inserter.Host))
+		if err != nil {
+			return err
+		}
+		if compressed {
+			dump, closeDump, err := OpenDumps(files)
+			if err != nil {
+				return err
+			}
+			defer closeDump()
+			streamedLoad(client, DBConnector(*inserter), query, dump)
+		} else {
+			client.Arg("--enable-local-infile").Stdin(strings.NewReader(query))
+		}
+		cmd := client.LocalCommand()
+		cmd.Stderr = stderr
+		return inserter.LocalRunner.Run(cmd)
+	})
+	if err != nil {
+		log.Printf("\t[Load Infile] failed to replace %s: %v: %s", table, err, strings.TrimSpace(stderr))
+		return inserter.explainLoadFailure(err, stderr, table)
+	}
+	for _, file := range files {
+		progress.AddBytes(table, fileSize(file))
+	}
+	log.Print("\t[Load Infile] completed replacing " + table)
+	return nil
+}
+
+// lockWaitError is a delete or load that gave up waiting for a lock, with
+// the transactions of other connections holding locks at that time.
+type lockWaitError struct {
+	table   string
+	err     error
+	holders []string
+}
+
+// Unwrap returns ErrLockWaitTimeout, so errors.Is finds the cause.
+func (e *lockWaitError) Unwrap() error {
+	return ErrLockWaitTimeout
+}
+
+func (e *lockWaitError) Error() string {
+	message := "timed out waiting for a lock on " + e.table + ": " + e.err.Error()
+	if len(e.holders) == 0 {
+		return message
+	}
+	return message + "; held by " + strings.Join(e.holders, "; ")
+}
+
+// explainLockWait turns a lock wait timeout into a lockWaitError listing who
+// holds locks on the destination. Other errors are returned as they are.
+func (inserter *MySQLInserter) explainLockWait(err error, stderr string, table string) error {
+	if !strings.Contains(stderr, LOCK_WAIT_TIMEOUT_ERROR) {
+		return err
+	}
+	holders, holdersErr := lockHolders(DBConnector(*inserter))
+	if holdersErr != nil {
+		log.Print("\t[Load Infile] failed to list the transactions holding locks: " + holdersErr.Error())
+	}
+	return &lockWaitError{table: table, err: err, holders: holders}
+}
+
+// lockHolders describes the transactions of other connections holding locks.
+func lockHolders(conn DBConnector) ([]string, error) {
+	var out bytes.Buffer
+	client, err := mysqlClient(conn, conn.IsContainer)
+	if err != nil {
+		return nil, err
+	}
+	cmd := client.Stdin(strings.NewReader(LOCK_HOLDERS_QUERY)).Command()
+	cmd.Stdout = &out
+	if err := conn.Runner.Run(cmd); err != nil {
+		return nil, err
+	}
+	var holders []string
+	for _, line := range strings.Split(out.String(), "\n") {
+		fields := strings.Split(line, "\t")
+		if len(fields) < 6 {
+			continue
+		}
+		holder := fmt.Sprintf("thread %s (%s@%s, %s since %s)", fields[0], fields[1], fields[2], fields[3], fields[4])
+		if query := unescapeBatchValue(fields[5]); query != "" {
+			holder += ": " + query
+		}
+		holders = append(holders, holder)
+	}
+	return holders, nil
+}
+
+// lockRetries returns how many times a delete or load failing on a deadlock
+// or lock wait timeout is retried. Statements sent through a proxy are not,
+// as part of their batches may already be committed.
+func (inserter *MySQLInserter) lockRetries() int {
+	if inserter.Proxy != "" || inserter.LockRetries < 0 {
+		return 0
+	}
+	if inserter.LockRetries == 0 {
+		return DEFAULT_LOCK_RETRIES
+	}
+	return inserter.LockRetries
+}
+
+// retryLocks runs a delete or load, retrying it with a jittered backoff while
+// it fails on a deadlock or lock wait timeout. Both roll back the failing
+// statement or transaction, so it can be run again as is. The stderr of the
+// last attempt is returned.
+func (inserter *MySQLInserter) retryLocks(table string, run func(stderr io.Writer) error) (string, error) {
+	retries := inserter.lockRetries()
+	for attempt := 0; ; attempt++ {
+		var stderr bytes.Buffer
+		err := run(&stderr)
+		if err == nil || attempt >= retries || !isLockError(stderr.String()) {
+			return stderr.String(), err
+		}
+		backoff := lockRetryBackoff(attempt)
+		log.Printf("\t[Load Infile] %s hit a lock conflict, retrying in %s (%d/%d)", table, backoff, attempt+1, retries)
+		time.Sleep(backoff)
+	}
+}
+
+// isLockError reports whether the mysql client failed on a deadlock or a lock
+// wait timeout.
+func isLockError(stderr string) bool {
+	return strings.Contains(stderr, DEADLOCK_ERROR) || strings.Contains(stderr, LOCK_WAIT_TIMEOUT_ERROR)
+}
+
+// lockRetryBackoff doubles the wait with every attempt and picks a random
+// point in its upper half, so sessions that deadlocked don't collide again.
+func lockRetryBackoff(attempt int) time.Duration {
+	backoff := LOCK_RETRY_BACKOFF << uint(attempt)
+	return backoff/2 + time.Duration(rand.Int63n(int64(backoff/2)+1))
+}
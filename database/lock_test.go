@@ -0,0 +1,136 @@
+package database
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	. "github.com/timakin/gopli/constants"
+	. "github.com/timakin/gopli/lib"
+)
+
+func TestLockedLoadQuery(t *testing.T) {
+	query := lockedLoadQuery("`app`.`users`", nil, "`app`.`users`", []string{"/tmp/users.0", "/tmp/users.1"})
+	lines := strings.Split(query, ";\n")
+	expected := []string{
+		"LOCK TABLES `app`.`users` WRITE",
+		"DELETE FROM `app`.`users`",
+		"LOAD DATA LOCAL INFILE '/tmp/users.0' INTO TABLE `app`.`users`",
+		"LOAD DATA LOCAL INFILE '/tmp/users.1' INTO TABLE `app`.`users`",
+	}
+	if len(lines) != len(expected) {
+		t.Fatalf("expected %d statements, got %q", len(expected), query)
+	}
+	for i := range expected {
+		if lines[i] != expected[i] {
+			t.Errorf("statement %d: expected %q, got %q", i, expected[i], lines[i])
+		}
+	}
+}
+
+func TestLockedLoadQueryPartitions(t *testing.T) {
+	query := lockedLoadQuery("`app`.`logs`", []string{"p1"}, "`app`.`logs` PARTITION (`p1`)", []string{"/tmp/logs.0"})
+	if !strings.Contains(query, "DELETE FROM `app`.`logs` PARTITION (`p1`)") {
+		t.Errorf("expected only the fetched partition to be deleted, got %q", query)
+	}
+}
+
+func TestLoadTarget(t *testing.T) {
+	inserter := &MySQLInserter{Name: "app", Tables: map[string]TableSettings{
+		"users": {Set: map[string]string{"environment": "'staging'", "api_token": "NULL"}},
+	}}
+	into := inserter.loadTarget("users", nil, []string{"id", "api_token"})
+	expected := "`app`.`users` (`id`, `api_token`) SET `api_token` = NULL, `environment` = 'staging'"
+	if into != expected {
+		t.Errorf("expected %q, got %q", expected, into)
+	}
+	if into := inserter.loadTarget("orders", nil, nil); into != "`app`.`orders`" {
+		t.Errorf("expected no SET clause for other tables, got %q", into)
+	}
+}
+
+func TestSetColumnsThroughProxy(t *testing.T) {
+	ws, err := NewWorkspace(TMP_DIR_PREFIX, WorkspaceConf{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ws.Remove()
+	if err := ws.WriteFile(TABLE_LIST_FILE, []byte("users\n")); err != nil {
+		t.Fatal(err)
+	}
+	inserter := &MySQLInserter{Name: "app", Proxy: PROXY_PROXYSQL, Workspace: ws, Tables: map[string]TableSettings{
+		"users": {Set: map[string]string{"environment": "'staging'"}},
+	}}
+	if err := inserter.Clean(); err == nil || !strings.Contains(err.Error(), "can't be set through proxysql") {
+		t.Errorf("expected the load to fail before deleting, got %v", err)
+	}
+}
+
+func TestExplainLockWait(t *testing.T) {
+	runner := &cannedRunner{out: "42\tapp\t10.0.0.5:51234\tRUNNING\t2024-01-01 00:00:00\tUPDATE users SET name = 'a'\n"}
+	inserter := &MySQLInserter{Runner: runner, Name: "app"}
+	cause := errors.New("exit status 1")
+
+	if err := inserter.explainLockWait(cause, "ERROR 1146 (42S02) at line 1: Table doesn't exist", "users"); err != cause {
+		t.Errorf("expected other errors as they are, got %v", err)
+	}
+	err := inserter.explainLockWait(cause, "ERROR 1205 (HY000) at line 1: Lock wait timeout exceeded; try restarting transaction", "users")
+	if _, ok := err.(*lockWaitError); !ok {
+		t.Fatalf("expected a lock wait error, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "thread 42 (app@10.0.0.5:51234, RUNNING since 2024-01-01 00:00:00): UPDATE users SET name = 'a'") {
+		t.Errorf("expected the holding transaction in the error, got %q", err.Error())
+	}
+}
+
+func TestExplainLoadFailure(t *testing.T) {
+	inserter := &MySQLInserter{Name: "app"}
+	cause := errors.New("exit status 1")
+
+	err := inserter.explainLoadFailure(cause, "ERROR 3948 (42000) at line 1: Loading local data is disabled; this must be enabled on both the client and server sides", "users")
+	if !errors.Is(err, ErrLocalInfileDisabled) {
+		t.Errorf("expected ErrLocalInfileDisabled, got %v", err)
+	}
+	if err := inserter.explainLoadFailure(cause, "ERROR 1146 (42S02) at line 1: Table doesn't exist", "users"); err != cause {
+		t.Errorf("expected other errors as they are, got %v", err)
+	}
+	if !errors.Is(&lockWaitError{table: "users", err: cause}, ErrLockWaitTimeout) {
+		t.Error("expected lock wait errors to wrap ErrLockWaitTimeout")
+	}
+}
+
+func TestRetryLocks(t *testing.T) {
+	inserter := &MySQLInserter{LockRetries: 1}
+	attempts := 0
+	_, err := inserter.retryLocks("users", func(stderr io.Writer) error {
+		attempts++
+		if attempts == 1 {
+			io.WriteString(stderr, "ERROR 1213 (40001) at line 1: Deadlock found when trying to get lock; try restarting transaction")
+			return errors.New("exit status 1")
+		}
+		return nil
+	})
+	if err != nil || attempts != 2 {
+		t.Errorf("expected the deadlock to be retried once, got %d attempts and %v", attempts, err)
+	}
+
+	attempts = 0
+	stderr, err := inserter.retryLocks("users", func(stderr io.Writer) error {
+		attempts++
+		io.WriteString(stderr, "ERROR 1146 (42S02) at line 1: Table doesn't exist")
+		return errors.New("exit status 1")
+	})
+	if err == nil || attempts != 1 || !strings.Contains(stderr, "ERROR 1146") {
+		t.Errorf("expected other errors to fail at once, got %d attempts and %v", attempts, err)
+	}
+}
+
+func TestLockRetryBackoff(t *testing.T) {
+	for attempt := 0; attempt < 4; attempt++ {
+		max := LOCK_RETRY_BACKOFF << uint(attempt)
+		if backoff := lockRetryBackoff(attempt); backoff < max/2 || backoff > max {
+			t.Errorf("attempt %d: expected a backoff between %s and %s, got %s", attempt, max/2, max, backoff)
+		}
+	}
+}
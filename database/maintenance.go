@@ -0,0 +1,54 @@
+package database
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+)
+
+// StartMaintenance runs MaintenanceOn on the destination, e.g. to set a flag
+// applications honor or SET GLOBAL read_only. The returned function runs
+// MaintenanceOff, which also runs when the load fails or is interrupted.
+func (inserter *MySQLInserter) StartMaintenance() (end func(), err error) {
+	if inserter.MaintenanceOn == "" {
+		return func() {}, nil
+	}
+	log.Print("[Maintenance] setting the maintenance flag")
+	if err := inserter.runStatement(inserter.MaintenanceOn); err != nil {
+		return nil, err
+	}
+	var once sync.Once
+	clear := func() { once.Do(inserter.endMaintenance) }
+	done := deferRestore(clear)
+	return func() {
+		done()
+		clear()
+	}, nil
+}
+
+// endMaintenance runs MaintenanceOff. A failure is only logged, as the load
+// itself has finished or failed already.
+func (inserter *MySQLInserter) endMaintenance() {
+	if err := inserter.runStatement(inserter.MaintenanceOff); err != nil {
+		log.Print("[Maintenance] failed to clear the maintenance flag, run " + inserter.MaintenanceOff + " by hand: " + err.Error())
+		return
+	}
+	log.Print("[Maintenance] cleared the maintenance flag")
+}
+
+// runStatement runs a statement on the destination.
+func (inserter *MySQLInserter) runStatement(statement string) error {
+	client, err := mysqlClient(DBConnector(*inserter), inserter.IsContainer || !isLocalHost(inserter.Host))
+	if err != nil {
+		return err
+	}
+	cmd := client.Stdin(strings.NewReader(statement)).LocalCommand()
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := inserter.LocalRunner.Run(cmd); err != nil {
+		return fmt.Errorf("%v: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
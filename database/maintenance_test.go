@@ -0,0 +1,36 @@
+package database
+
+import (
+	"io/ioutil"
+	"testing"
+)
+
+// statementRunner records the SQL sent to every command.
+type statementRunner struct {
+	statements []string
+}
+
+func (runner *statementRunner) Run(cmd *Command) error {
+	statement, err := ioutil.ReadAll(cmd.Stdin)
+	runner.statements = append(runner.statements, string(statement))
+	return err
+}
+
+func TestStartMaintenance(t *testing.T) {
+	runner := &statementRunner{}
+	inserter := &MySQLInserter{
+		LocalRunner:    runner,
+		Host:           "localhost",
+		MaintenanceOn:  "SET GLOBAL read_only = 1",
+		MaintenanceOff: "SET GLOBAL read_only = 0",
+	}
+	end, err := inserter.StartMaintenance()
+	if err != nil {
+		t.Fatal(err)
+	}
+	RestoreDestinations()
+	end()
+	if len(runner.statements) != 2 || runner.statements[1] != "SET GLOBAL read_only = 0" {
+		t.Errorf("expected the flag to be set and cleared once, got %q", runner.statements)
+	}
+}
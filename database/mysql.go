@@ -2,148 +2,169 @@ package database
 
 import (
 	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	. "github.com/timakin/gopli/constants"
 	. "github.com/timakin/gopli/lib"
+	"io"
 	"io/ioutil"
 	"log"
 	"os"
-	"os/exec"
-	"sync"
+	"strconv"
+	"strings"
 )
 
 type MySQLFetcher DBConnector
 type MySQLInserter DBConnector
 
-func (fetcher *MySQLFetcher) Fetch() error {
-	log.Print("[Fetch] fetching the list of tables...")
-	session, err := fetcher.SSHClient.NewSession()
+// Ping checks that the database can be reached and queried.
+func (fetcher *MySQLFetcher) Ping() error {
+	client, err := mysqlClient(DBConnector(*fetcher), fetcher.IsContainer)
 	if err != nil {
 		return err
 	}
-	defer session.Close()
-
-	var listTableStdoutBuf bytes.Buffer
-	session.Stdout = &listTableStdoutBuf
-	listTableCmd := fmt.Sprintf(SHOW_TABLES_CMD_FORMAT, fetcher.Name, fetcher.User, fetcher.Password)
-	err = session.Run(listTableCmd)
+	var stderr bytes.Buffer
+	cmd := client.Stdin(strings.NewReader(PING_QUERY)).Command()
+	cmd.Stdout = ioutil.Discard
+	cmd.Stderr = &stderr
+	if err := fetcher.Runner.Run(cmd); err != nil {
+		return fmt.Errorf("%v: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
 
-	if err := os.MkdirAll(TMP_DIR_PATH, 0777); err != nil {
+func (fetcher *MySQLFetcher) Fetch() error {
+	tables, err := fetchTableList(DBConnector(*fetcher))
+	if err != nil {
 		return err
 	}
+	var checksums map[string]string
+	if fetcher.FetchOptions.KnownChecksums != nil || fetcher.FetchOptions.Cache != nil && fetcher.FetchOptions.RecentPartitions == 0 {
+		checksums = sourceChecksums(DBConnector(*fetcher), tables)
+	}
+	if fetcher.FetchOptions.KnownChecksums != nil && checksums != nil {
+		if tables, err = dropUnchanged(DBConnector(*fetcher), tables, checksums); err != nil {
+			return err
+		}
+	}
+	if fetcher.FetchOptions.DumpTool == DUMP_TOOL_MYSQLSH && len(tables) > 0 && fetcher.shellDumpable(tables) {
+		return fetcher.shellDump(tables)
+	}
 
-	tableListSavePath := TMP_DIR_PATH + "/table_list.txt"
-	ioutil.WriteFile(tableListSavePath, listTableStdoutBuf.Bytes(), os.ModePerm)
-	log.Print("[Fetch] completed fetching the list of tables")
-
-	log.Print("\t[Fetch] start to fetch table contents...")
-	tables, err := ReadLines(tableListSavePath)
+	columns, err := fetcher.Columns()
 	if err != nil {
 		return err
 	}
+	columnLists := loadColumns(columns)
+	if err := selectColumns(columnLists, tables, columns, fetcher.FetchOptions.Columns); err != nil {
+		return err
+	}
 
-	sem := make(chan int, MaxFetchSession)
-	var wg sync.WaitGroup
-	for _, table := range tables {
-		wg.Add(1)
-		go func(table string) {
-			sem <- 1
-			defer wg.Done()
-			defer func() { <-sem }()
-			session, err := fetcher.SSHClient.NewSession()
-			if err != nil {
-				panic(err)
-			}
-			defer session.Close()
-
-			var fetchResult bytes.Buffer
-			session.Stdout = &fetchResult
-			fetchRowsCmd := fmt.Sprintf(SELECT_TABLES_CMD_FORMAT, fetcher.User, fetcher.Password, fetcher.Name, table)
-			log.Print("\t\t[Fetch] fetching " + table)
-			err = session.Run(fetchRowsCmd)
-			if err != nil {
-				panic(err)
+	partitions := make(map[string][]string)
+	if fetcher.FetchOptions.RecentPartitions > 0 {
+		if partitions, err = fetcher.Partitions(); err != nil {
+			return err
+		}
+	}
+
+	primaryKeys := make(map[string][]string)
+	if fetcher.FetchOptions.OrderByPK {
+		if primaryKeys, err = fetcher.PrimaryKeys(); err != nil {
+			return err
+		}
+		for _, table := range keylessTables(tables, primaryKeys) {
+			if tableSelection(DBConnector(*fetcher), table).OrderBy != "" {
+				continue
 			}
-			dumpSavePath := TMP_DIR_PATH + "/" + table + ".txt"
-			ioutil.WriteFile(dumpSavePath, fetchResult.Bytes(), os.ModePerm)
-			log.Print("\t\t[Fetch] completed fetcing " + table)
-		}(table)
+			log.Print("\t[Fetch] " + table + " has no primary key, dumping its rows unordered")
+		}
 	}
-	wg.Wait()
-	log.Print("\t[Fetch] completed fetching all tables")
-	return nil
+
+	cacheKeys := make(map[string]string)
+	if fetcher.FetchOptions.Cache != nil && fetcher.FetchOptions.RecentPartitions == 0 {
+		cacheKeys = fetcher.cacheKeys(tables, columns, checksums)
+	}
+
+	dumps := make(map[string]tableDump)
+	for _, table := range tables {
+		dumps[table] = tableDump{
+			columns:    columnLists[table],
+			partitions: recentPartitions(partitions[table], fetcher.FetchOptions.RecentPartitions),
+			orderBy:    primaryKeys[table],
+		}
+	}
+	return fetchTables(DBConnector(*fetcher), tables, dumps, fetcher.selectCodec(), cacheKeys)
+}
+
+// dropFromTableList rewrites the table list without the skipped tables.
+func dropFromTableList(ws *Workspace, tables []string, skipped []string) error {
+	var tableList bytes.Buffer
+	for _, table := range tables {
+		if !containsString(skipped, table) {
+			tableList.WriteString(table + "\n")
+		}
+	}
+	return ws.WriteFile(TABLE_LIST_FILE, tableList.Bytes())
+}
+
+func containsString(list []string, s string) bool {
+	for _, elem := range list {
+		if elem == s {
+			return true
+		}
+	}
+	return false
 }
 
 func (inserter *MySQLInserter) Clean() error {
 	log.Print("[Delete] deleting existing tables...")
 	var tables []string
-	tableListSavePath := TMP_DIR_PATH + "/table_list.txt"
-	tables, err := ReadLines(tableListSavePath)
+	tables, err := inserter.Workspace.ReadTableList()
+	if err != nil {
+		return err
+	}
+	// Only LOAD DATA sets columns, so fail before deleting anything.
+	if assigned := assignedTables(DBConnector(*inserter), tables); len(assigned) > 0 {
+		if inserter.Proxy != "" {
+			return fmt.Errorf("the columns of %s can't be set through %s, which only passes INSERT statements", strings.Join(assigned, ", "), inserter.Proxy)
+		}
+		if hasShellDump(inserter.Workspace) {
+			return fmt.Errorf("the columns of %s can't be set while loading a MySQL Shell dump", strings.Join(assigned, ", "))
+		}
+	}
+	if tables, err = inserter.skipUnchanged(tables); err != nil {
+		return err
+	}
+	if inserter.lockTables() && !hasShellDump(inserter.Workspace) {
+		log.Print("[Delete] tables are deleted together with their load under LOCK TABLES")
+		return nil
+	}
+	keys, err := inserter.batchDeleteKeys(tables)
 	if err != nil {
 		return err
 	}
 
-	sem := make(chan int, 5)
-	var wg sync.WaitGroup
-	for _, table := range tables {
-		wg.Add(1)
-		go func(table string) {
-			sem <- 1
-			defer wg.Done()
-			defer func() { <-sem }()
-
-			log.Print("\t[Delete] deleting " + table)
-
-			if inserter.Host == "localhost" || inserter.Host == "127.0.0.1" {
-				var cleanTablesCmd *exec.Cmd
-				query := fmt.Sprintf(DELETE_TABLE_QUERY_FORMAT, inserter.Name, table)
-				userOption := "-u" + inserter.User
-				executeOption := "--execute=" + query
-				hostOption := "-h" + inserter.Host
-				var passwordOption string
-
-				if inserter.IsContainer {
-					cleanTablesCmd = exec.Command("mysql", userOption, hostOption, executeOption)
-				} else {
-					cleanTablesCmd = exec.Command("mysql", userOption, executeOption)
-				}
-
-				if len(inserter.Password) > 0 {
-					passwordOption = "MYSQL_PWD=" + inserter.Password
-					cleanTablesCmd.Env = append(os.Environ(), passwordOption)
-				}
-				var stderr bytes.Buffer
-				cleanTablesCmd.Stderr = &stderr
-				err := cleanTablesCmd.Run()
-
-				if err != nil {
-					fmt.Println(fmt.Sprint(err) + ": " + stderr.String())
-					panic(err)
-				}
-			} else {
-				var cleanTablesCmd string
-				if len(inserter.Password) > 0 {
-					cleanTablesCmd = fmt.Sprintf(CLEAN_TABLES_CMD_FORMAT, inserter.User, inserter.Password, inserter.Name, table)
-				} else {
-					cleanTablesCmd = fmt.Sprintf(CLEAN_TABLES_CMD_FORMAT_WITHOUT_PASSPHRASE, inserter.User, inserter.Name, table)
-				}
-
-				var CleantdoutBuf bytes.Buffer
-
-				session, err := inserter.SSHClient.NewSession()
-				if err != nil {
-					panic(err)
-				}
-				defer session.Close()
-				session.Stdout = &CleantdoutBuf
-				err = session.Run(cleanTablesCmd)
-				if err != nil {
-					panic(err)
-				}
-			}
-		}(table)
+	groups := make([][]string, len(tables))
+	for i, table := range tables {
+		groups[i] = []string{table}
+	}
+	failed, err := deleteTables(DBConnector(*inserter), groups, func(tables []string) (string, error) {
+		table := tables[0]
+		partitions, err := inserter.Workspace.ReadPartitions(table)
+		if err != nil {
+			return "", err
+		}
+		if len(partitions) == 0 && inserter.DeleteBatchSize > 0 {
+			return inserter.batchDelete(table, keys[table])
+		}
+		return truncateTables(DBConnector(*inserter), tables)
+	})
+	if err != nil {
+		inserter.failedDeletes = failed
+		return err
 	}
-	wg.Wait()
 	log.Print("[Delete] completed deleting tables")
 	return nil
 }
@@ -151,57 +172,410 @@ func (inserter *MySQLInserter) Clean() error {
 func (inserter *MySQLInserter) Insert() error {
 	log.Print("[Load Infile] start to send fetched contents...")
 	var tables []string
-	tableListSavePath := TMP_DIR_PATH + "/table_list.txt"
-	tables, err := ReadLines(tableListSavePath)
+	tables, err := inserter.Workspace.ReadTableList()
 	if err != nil {
 		return err
 	}
-	sem := make(chan int, MaxLoadInfileSession)
-	var wg sync.WaitGroup
+	if hasShellDump(inserter.Workspace) {
+		if len(inserter.failedDeletes) > 0 {
+			return errors.New("a MySQL Shell dump can't be loaded without the tables that failed to delete")
+		}
+		return inserter.shellLoad()
+	}
+	tables = loadableTables(tables, inserter.failedDeletes)
+	engines := inserter.tableEngines()
+	loadEngines := engines
+	if inserter.Proxy != "" {
+		// Proxies refuse or pin sessions on most session variables.
+		loadEngines = nil
+	}
+	var lockedLoad func(table string, load tableLoad) error
+	if inserter.lockTables() {
+		lockedLoad = inserter.lockedLoad
+	}
+	if err := loadTables(DBConnector(*inserter), tables, loadEngines, lockedLoad); err != nil {
+		return err
+	}
+	var myisamTables []string
 	for _, table := range tables {
-		wg.Add(1)
-		go func(table string) {
-			sem <- 1
-			defer wg.Done()
-			defer func() { <-sem }()
-			fetchedTableFile := TMP_DIR_PATH + "/" + table + ".txt"
-			query := fmt.Sprintf(LOAD_INFILE_QUERY_FORMAT, fetchedTableFile, inserter.Name, table)
-
-			log.Print("\t[Load Infile] start to send the contents inside of " + table)
-			var cmd *exec.Cmd
-			if inserter.Host == "localhost" || inserter.Host == "127.0.0.1" {
-				if inserter.IsContainer {
-					hostOption := "-h" + inserter.Host
-					cmd = exec.Command("mysql", "-u"+inserter.User, hostOption, "--enable-local-infile", "--execute="+query)
-				} else {
-					cmd = exec.Command("mysql", "-u"+inserter.User, "--enable-local-infile", "--execute="+query)
-				}
-
-				if len(inserter.Password) > 0 {
-					passwordOption := "MYSQL_PWD=" + inserter.Password
-					cmd.Env = append(os.Environ(), passwordOption)
-				}
-			} else {
-				var passwordOption string
-				if len(inserter.Password) > 0 {
-					passwordOption = fmt.Sprintf("-p%s", inserter.Password)
-				} else {
-					passwordOption = ""
-				}
-				cmd = exec.Command("mysql", "-u"+inserter.User, passwordOption, "-h"+inserter.Host, "--enable-local-infile", "--execute="+query)
-			}
-			var stderr bytes.Buffer
-			cmd.Stderr = &stderr
-			err := cmd.Run()
-			if err != nil {
-				fmt.Println(fmt.Sprint(err) + ": " + stderr.String())
-				panic(err)
-			}
-			log.Print("\t[Load Infile] completed sending the contents inside of " + table)
-		}(table)
-		wg.Wait()
+		if strings.EqualFold(engines[TableKey(table)], MYISAM_ENGINE) && inserter.Proxy == "" {
+			myisamTables = append(myisamTables, table)
+		}
+	}
+	if len(myisamTables) > 0 {
+		if err := inserter.verifyKeysEnabled(myisamTables); err != nil {
+			return err
+		}
 	}
 	log.Print("[Load Infile] completed sending fetched contents")
 	log.Print("[Finished] All tasks finished")
 	return nil
 }
+
+// explainLoadFailure wraps ErrLocalInfileDisabled around a load the
+// destination refused to read local files for, and explains lock wait
+// timeouts like explainLockWait.
+func (inserter *MySQLInserter) explainLoadFailure(err error, stderr string, table string) error {
+	if localInfileDisabled(stderr) {
+		return fmt.Errorf("%w: %s", ErrLocalInfileDisabled, strings.TrimSpace(stderr))
+	}
+	return inserter.explainLockWait(err, stderr, table)
+}
+
+// localInfileDisabled reports whether stderr of a LOAD DATA LOCAL INFILE
+// says local_infile is off on either end.
+func localInfileDisabled(stderr string) bool {
+	return strings.Contains(stderr, LOCAL_INFILE_DISABLED_ERROR) || strings.Contains(stderr, LOCAL_INFILE_REFUSED_ERROR)
+}
+
+func fileSize(path string) int64 {
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0
+	}
+	return info.Size()
+}
+
+// streamedLoad makes client run query, a load reading STDIN_INFILE, with the
+// uncompressed rows of dump on stdin. The query goes on the command line, as
+// stdin carries the rows.
+func streamedLoad(client *commandBuilder, conn DBConnector, query string, dump io.Reader) *commandBuilder {
+	if conn.RouteComment != "" {
+		query = conn.RouteComment + " " + query
+	}
+	return client.Arg("--enable-local-infile", "-e", query).StdinPrefix("").Stdin(dump)
+}
+
+// mysqlClient builds a batch mode mysql client invocation reading SQL from
+// stdin. The password is passed through MYSQL_PWD to keep it out of the
+// process list. With UseMyCnf, both are left to ~/.my.cnf. It fails when no
+// IAM auth token can be generated.
+func mysqlClient(conn DBConnector, withHost bool) (*commandBuilder, error) {
+	builder := newCommandBuilder("mysql")
+	if !conn.UseMyCnf {
+		builder.Arg("-u" + conn.User)
+	}
+	if withHost {
+		builder.Arg("-h" + conn.Host)
+		if conn.Port != "" {
+			builder.Arg("-P" + conn.Port)
+		}
+	} else if conn.NativeDriver {
+		// Tunnels reach the server of the host through TCP, not its socket.
+		builder.Arg("-h" + NATIVE_LOCAL_HOST)
+		if conn.Port != "" {
+			builder.Arg("-P" + conn.Port)
+		}
+	}
+	if conn.NativeDriver {
+		builder.Native()
+	}
+	password := conn.Password
+	if conn.UseMyCnf {
+		password = ""
+	}
+	if conn.IAMAuth {
+		// RDS only accepts IAM auth tokens in clear text over TLS.
+		builder.Arg("--enable-cleartext-plugin", "--ssl-mode=REQUIRED")
+		token, err := iamPassword(conn)
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate an IAM auth token for %s@%s: %w", conn.User, conn.Host, err)
+		}
+		password = token
+	}
+	if len(password) > 0 {
+		builder.Env("MYSQL_PWD", password)
+	}
+	if conn.LockWaitTimeout > 0 && conn.Proxy == "" {
+		builder.Arg("--init-command=" + fmt.Sprintf(LOCK_WAIT_TIMEOUT_INIT_FORMAT, conn.LockWaitTimeout, conn.LockWaitTimeout))
+	}
+	if conn.RouteComment != "" {
+		// The client strips comments unless told to keep them.
+		builder.Arg("--comments").StdinPrefix(conn.RouteComment + " ")
+	}
+	return builder.Arg("--default-character-set=utf8mb4", "-B", "-N"), nil
+}
+
+// listTables fetches the table names page by page so huge schemas never
+// depend on a single oversized result. The query is sent through stdin, so
+// restricting it to a long list of tables doesn't hit argv length limits.
+func (fetcher *MySQLFetcher) listTables() ([]byte, error) {
+	condition := "table_schema = '" + escapeString(fetcher.Name) + "'"
+	if len(fetcher.FetchOptions.Tables) > 0 {
+		condition = tablesCondition(fetcher.Name, fetcher.FetchOptions.Tables)
+	}
+
+	var tableList bytes.Buffer
+	for offset := 0; ; offset += TABLE_LIST_PAGE_SIZE {
+		query := fmt.Sprintf(LIST_TABLES_QUERY_FORMAT, condition, TABLE_LIST_PAGE_SIZE, offset)
+		var page bytes.Buffer
+		client, err := mysqlClient(DBConnector(*fetcher), fetcher.IsContainer)
+		if err != nil {
+			return nil, err
+		}
+		listTableCmd := client.Stdin(strings.NewReader(query)).Command()
+		listTableCmd.Stdout = &page
+		if err := fetcher.Runner.Run(listTableCmd); err != nil {
+			return nil, err
+		}
+		rows := strings.Split(strings.TrimSuffix(page.String(), "\n"), "\n")
+		for _, row := range rows {
+			columns := strings.Split(row, "\t")
+			if len(columns) != 3 {
+				continue
+			}
+			table := TableName{Schema: columns[0], Name: columns[1]}
+			if table.Schema == fetcher.Name {
+				table.Schema = ""
+			}
+			if !IsDataEngine(columns[2]) {
+				log.Printf("\t[Fetch] skipping %s, %s tables hold no data", table, columns[2])
+				fetcher.FetchOptions.Stats.Exclude(table.String(), fmt.Sprintf(PLAN_REASON_NO_DATA_ENGINE, columns[2]))
+				continue
+			}
+			if IsFilteredOut(fetcher.FetchOptions.Filter, table.String()) {
+				fetcher.FetchOptions.Stats.Exclude(table.String(), PLAN_REASON_FILTERED)
+				continue
+			}
+			class := TableClass(fetcher.FetchOptions.Filter, table.String())
+			if class != "" {
+				fetcher.FetchOptions.Stats.Classify(table.String(), class)
+			}
+			if class == TABLE_CLASS_SCHEMA_ONLY {
+				log.Printf("\t[Fetch] skipping %s, its data is not synced", table)
+				fetcher.FetchOptions.Stats.Exclude(table.String(), PLAN_REASON_SCHEMA_ONLY)
+				continue
+			}
+			tableList.WriteString(table.String() + "\n")
+		}
+		if len(rows) < TABLE_LIST_PAGE_SIZE {
+			break
+		}
+	}
+	return tableList.Bytes(), nil
+}
+
+// noTables tells an empty database from one the user can't see: a wrong
+// database name or missing grants list no tables without failing. Anything
+// but the database showing up counts as not seeing it.
+func noTables(conn DBConnector) error {
+	dialect := dialectOf(conn)
+	var out bytes.Buffer
+	client, err := dialect.client(conn, conn.IsContainer)
+	if err != nil {
+		return err
+	}
+	cmd := client.Stdin(strings.NewReader(dialect.databaseExistsQuery(conn.Name))).Command()
+	cmd.Stdout = &out
+	if err := conn.Runner.Run(cmd); err != nil {
+		return err
+	}
+	if strings.TrimSpace(out.String()) != "1" {
+		return fmt.Errorf("%w: database %s doesn't exist or %s can't access it", ErrConnectionFailed, conn.Name, conn.User)
+	}
+	return fmt.Errorf("%w in %s", ErrNoTables, conn.Name)
+}
+
+// tablesCondition restricts the table list to tables, grouped by schema.
+// Unqualified tables belong to defaultSchema.
+func tablesCondition(defaultSchema string, tables []string) string {
+	var schemas []string
+	names := make(map[string][]string)
+	for _, table := range tables {
+		parsed := ParseTableName(table)
+		if parsed.Schema == "" {
+			parsed.Schema = defaultSchema
+		}
+		if _, ok := names[parsed.Schema]; !ok {
+			schemas = append(schemas, parsed.Schema)
+		}
+		names[parsed.Schema] = append(names[parsed.Schema], "'"+escapeString(parsed.Name)+"'")
+	}
+
+	conditions := make([]string, len(schemas))
+	for i, schema := range schemas {
+		conditions[i] = "(table_schema = '" + escapeString(schema) + "' AND table_name IN (" + strings.Join(names[schema], ",") + "))"
+	}
+	return strings.Join(conditions, " OR ")
+}
+
+// TableStats returns the estimated row count and data size of every table.
+func (fetcher *MySQLFetcher) TableStats() ([]TableStat, error) {
+	return tableStats(DBConnector(*fetcher))
+}
+
+func tableStats(conn DBConnector) ([]TableStat, error) {
+	return dialectOf(conn).tableStats(conn)
+}
+
+func mysqlTableStats(conn DBConnector) ([]TableStat, error) {
+	query := fmt.Sprintf(TABLE_STATS_QUERY_FORMAT, escapeString(conn.Name))
+
+	client, err := mysqlClient(conn, conn.IsContainer)
+	if err != nil {
+		return nil, err
+	}
+	var statsBuf bytes.Buffer
+	statsCmd := client.Stdin(strings.NewReader(query)).Command()
+	statsCmd.Stdout = &statsBuf
+	if err := conn.Runner.Run(statsCmd); err != nil {
+		return nil, err
+	}
+
+	var stats []TableStat
+	for _, line := range strings.Split(statsBuf.String(), "\n") {
+		columns := strings.Split(line, "\t")
+		if len(columns) != 4 {
+			continue
+		}
+		rows, _ := strconv.ParseInt(columns[1], 10, 64)
+		size, _ := strconv.ParseInt(columns[2], 10, 64)
+		stats = append(stats, TableStat{Name: TableName{Name: columns[0]}.String(), Rows: rows, Bytes: size, Engine: columns[3]})
+	}
+	return stats, nil
+}
+
+// routePrefix is the route comment to put in front of a query.
+func (inserter *MySQLInserter) routePrefix() string {
+	if inserter.RouteComment == "" {
+		return ""
+	}
+	return inserter.RouteComment + " "
+}
+
+// serverFlavor tells MariaDB servers from MySQL ones by their version.
+func serverFlavor(conn DBConnector) (string, error) {
+	var out bytes.Buffer
+	client, err := mysqlClient(conn, conn.IsContainer)
+	if err != nil {
+		return "", err
+	}
+	cmd := client.Stdin(strings.NewReader(SERVER_VERSION_QUERY)).Command()
+	cmd.Stdout = &out
+	if err := conn.Runner.Run(cmd); err != nil {
+		return "", err
+	}
+	if strings.Contains(strings.ToLower(out.String()), FLAVOR_MARIADB) {
+		return FLAVOR_MARIADB, nil
+	}
+	return FLAVOR_MYSQL, nil
+}
+
+// tableEngines returns the storage engine of every destination table keyed
+// by TableKey. Loads go untuned when the engines can't be read.
+func (inserter *MySQLInserter) tableEngines() map[string]string {
+	engines := make(map[string]string)
+	stats, err := tableStats(DBConnector(*inserter))
+	if err != nil {
+		log.Print("[Load Infile] failed to read the table engines, loading without tuning: " + err.Error())
+		return engines
+	}
+	for _, stat := range stats {
+		engines[TableKey(stat.Name)] = stat.Engine
+	}
+	return engines
+}
+
+// loadSession is the session setup around the LOAD DATA of an engine.
+type loadSession struct {
+	before string
+	after  string
+}
+
+// loadSessions are keyed by the lower case engine name. InnoDB commits every
+// dump file as a single transaction without unique and foreign key checks.
+var loadSessions = map[string]loadSession{
+	strings.ToLower(INNODB_ENGINE): {INNODB_LOAD_SESSION, COMMIT_LOAD_SESSION},
+}
+
+// compatLoadSessions apply with EngineCompat only. TokuDB loads like InnoDB.
+// MyRocks writes every dump file straight into SST files with its bulk
+// loader, which commits when it is switched off.
+var compatLoadSessions = map[string]loadSession{
+	strings.ToLower(ROCKSDB_ENGINE): {ROCKSDB_LOAD_SESSION, ROCKSDB_END_LOAD_SESSION},
+	strings.ToLower(TOKUDB_ENGINE):  {TOKUDB_LOAD_SESSION, COMMIT_LOAD_SESSION},
+}
+
+// tunedLoadQuery wraps the LOAD DATA of a dump file in the session settings
+// suiting the engine of the destination table.
+func (inserter *MySQLInserter) tunedLoadQuery(engine string, load string) string {
+	session, ok := loadSessions[strings.ToLower(engine)]
+	if !ok && inserter.EngineCompat {
+		session, ok = compatLoadSessions[strings.ToLower(engine)]
+	}
+	if !ok {
+		return load
+	}
+	return session.before + load + session.after
+}
+
+// alterKeys runs DISABLE KEYS or ENABLE KEYS on a destination table. A
+// failure only costs load speed, so it is logged rather than returned.
+func (inserter *MySQLInserter) alterKeys(format string, table string) {
+	query := fmt.Sprintf(format, qualifiedTable(inserter.Name, table))
+	client, err := mysqlClient(DBConnector(*inserter), inserter.IsContainer || !isLocalHost(inserter.Host))
+	if err != nil {
+		log.Print("\t[Load Infile] failed to run " + query + ": " + err.Error())
+		return
+	}
+	cmd := client.Stdin(strings.NewReader(query)).LocalCommand()
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := inserter.LocalRunner.Run(cmd); err != nil {
+		log.Print("\t[Load Infile] failed to run " + query + ": " + err.Error() + ": " + stderr.String())
+	}
+}
+
+// quoteIdentifier quotes a database or table name, so reserved words, dashes
+// and dots are taken literally.
+func quoteIdentifier(name string) string {
+	return "`" + strings.Replace(name, "`", "``", -1) + "`"
+}
+
+// SchemaFingerprint returns a hash of the column definitions of every table,
+// which changes whenever the schema does.
+func (fetcher *MySQLFetcher) SchemaFingerprint() (string, error) {
+	query := fmt.Sprintf(SCHEMA_COLUMNS_QUERY_FORMAT, escapeString(fetcher.Name))
+
+	var columns bytes.Buffer
+	client, err := mysqlClient(DBConnector(*fetcher), fetcher.IsContainer)
+	if err != nil {
+		return "", err
+	}
+	columnsCmd := client.Stdin(strings.NewReader(query)).Command()
+	columnsCmd.Stdout = &columns
+	if err := fetcher.Runner.Run(columnsCmd); err != nil {
+		return "", err
+	}
+	hash := sha256.Sum256(columns.Bytes())
+	return hex.EncodeToString(hash[:]), nil
+}
+
+// qualifiedTable quotes table for use in SQL. Unqualified tables belong to
+// defaultSchema.
+func qualifiedTable(defaultSchema string, table string) string {
+	parsed := ParseTableName(table)
+	if parsed.Schema == "" {
+		parsed.Schema = defaultSchema
+	}
+	return quoteIdentifier(parsed.Schema) + "." + quoteIdentifier(parsed.Name)
+}
+
+// escapeString escapes s for use inside a single-quoted SQL string literal.
+func escapeString(s string) string {
+	s = strings.Replace(s, "\\", "\\\\", -1)
+	return strings.Replace(s, "'", "''", -1)
+}
+
+// selectQuery builds the dump query of a table limited to selection, run
+// after the session settings of the source.
+func (fetcher *MySQLFetcher) selectQuery(selected string, from string, orderBy []string, selection TableSettings) string {
+	if fetcher.SelectHint != "" {
+		selected = fetcher.SelectHint + " " + selected
+	}
+	query := fmt.Sprintf(SELECT_TABLE_QUERY_FORMAT, selected, from) + selectionClauses(selection, orderBy)
+	for i := len(fetcher.SessionSettings) - 1; i >= 0; i-- {
+		query = strings.TrimRight(fetcher.SessionSettings[i], "; \n") + ";\n" + query
+	}
+	return query
+}
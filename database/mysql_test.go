@@ -0,0 +1,215 @@
+package database
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	. "github.com/timakin/gopli/constants"
+	. "github.com/timakin/gopli/lib"
+)
+
+func TestQuoteIdentifier(t *testing.T) {
+	cases := map[string]string{
+		"users":      "`users`",
+		"order":      "`order`",
+		"user-posts": "`user-posts`",
+		"v1.events":  "`v1.events`",
+		"odd`name":   "`odd``name`",
+	}
+	for name, expected := range cases {
+		if actual := quoteIdentifier(name); actual != expected {
+			t.Errorf("quoteIdentifier(%q): expected %s, got %s", name, expected, actual)
+		}
+	}
+}
+
+func TestQueryPassesThroughShell(t *testing.T) {
+	query := fmt.Sprintf(SELECT_TABLE_QUERY_FORMAT, "*", qualifiedTable("it's-a", "`we``ird.table`"))
+	var out bytes.Buffer
+	err := (&localRunner{}).Run(&Command{Line: "printf %s " + shellQuote(query), Stdout: &out})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != query {
+		t.Errorf("expected %q, got %q", query, out.String())
+	}
+}
+
+func TestQualifiedTable(t *testing.T) {
+	cases := map[string]string{
+		"users":            "`app`.`users`",
+		"archive.users":    "`archive`.`users`",
+		"`v1.events`":      "`app`.`v1.events`",
+		"`a.b`.`c.d`":      "`a.b`.`c.d`",
+		"ユーザー":             "`app`.`ユーザー`",
+		"schema.`we``ird`": "`schema`.`we``ird`",
+	}
+	for table, expected := range cases {
+		if actual := qualifiedTable("app", table); actual != expected {
+			t.Errorf("qualifiedTable(%q): expected %s, got %s", table, expected, actual)
+		}
+	}
+}
+
+func TestTablesCondition(t *testing.T) {
+	actual := tablesCondition("app", []string{"users", "archive.users", "it's"})
+	expected := "(table_schema = 'app' AND table_name IN ('users','it''s')) OR (table_schema = 'archive' AND table_name IN ('users'))"
+	if actual != expected {
+		t.Errorf("expected %s, got %s", expected, actual)
+	}
+}
+
+func TestTunedLoadQuery(t *testing.T) {
+	load := "LOAD DATA LOCAL INFILE 'users.txt' INTO TABLE `users`"
+	expected := "SET autocommit=0; SET unique_checks=0; SET foreign_key_checks=0;\n" + load + ";\nCOMMIT;"
+	inserter := &MySQLInserter{}
+	if actual := inserter.tunedLoadQuery("innodb", load); actual != expected {
+		t.Errorf("expected %s, got %s", expected, actual)
+	}
+	if actual := inserter.tunedLoadQuery("ROCKSDB", load); actual != load {
+		t.Errorf("expected MyRocks to be loaded as is without engine_compat, got %s", actual)
+	}
+	inserter.EngineCompat = true
+	expected = "SET SESSION rocksdb_bulk_load_allow_unsorted=1; SET SESSION rocksdb_bulk_load=1;\n" + load + ";\nSET SESSION rocksdb_bulk_load=0;"
+	if actual := inserter.tunedLoadQuery("ROCKSDB", load); actual != expected {
+		t.Errorf("expected %s, got %s", expected, actual)
+	}
+	if actual := inserter.tunedLoadQuery("MyISAM", load); actual != load {
+		t.Errorf("expected %s, got %s", load, actual)
+	}
+}
+
+func TestMariaDBColumn(t *testing.T) {
+	tests := []struct {
+		value    string
+		expected *string
+	}{
+		{"NULL", nil},
+		{"'it''s'", stringPtr("it's")},
+		{"current_timestamp()", stringPtr("CURRENT_TIMESTAMP")},
+		{"current_timestamp(3)", stringPtr("CURRENT_TIMESTAMP(3)")},
+		{"0", stringPtr("0")},
+	}
+	for _, test := range tests {
+		value := test.value
+		column := mariaDBColumn(Column{Default: &value, Extra: "on update current_timestamp()"})
+		if column.Extra != "on update CURRENT_TIMESTAMP" {
+			t.Errorf("expected on update CURRENT_TIMESTAMP, got %s", column.Extra)
+		}
+		if (column.Default == nil) != (test.expected == nil) || column.Default != nil && *column.Default != *test.expected {
+			t.Errorf("%s: expected %v, got %v", test.value, test.expected, column.Default)
+		}
+	}
+}
+
+func stringPtr(s string) *string {
+	return &s
+}
+
+func TestLoadColumns(t *testing.T) {
+	columns := []Column{
+		{Table: "users", Name: "id"},
+		{Table: "users", Name: "token", Extra: "INVISIBLE"},
+		{Table: "users", Name: "full_name", Extra: "VIRTUAL GENERATED"},
+		{Table: "posts", Name: "id"},
+	}
+	lists := loadColumns(columns)
+	if len(lists) != 1 || columnList(lists["users"]) != "`id`, `token`" {
+		t.Errorf("unexpected column lists: %v", lists)
+	}
+}
+
+// testClient returns the mysql client of conn, connecting through the socket.
+func testClient(t *testing.T, conn DBConnector) *commandBuilder {
+	client, err := mysqlClient(conn, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client
+}
+
+func TestMysqlClientWithMyCnf(t *testing.T) {
+	command := testClient(t, DBConnector{User: "gopli", Password: "secret", UseMyCnf: true}).Command()
+	if strings.Contains(command.Line, "-u") || strings.Contains(command.Line, "MYSQL_PWD") {
+		t.Errorf("expected credentials to be left to ~/.my.cnf, got %q", command.Line)
+	}
+}
+
+func TestMysqlClientWithLockWaitTimeout(t *testing.T) {
+	command := testClient(t, DBConnector{User: "gopli", LockWaitTimeout: 10}).Command()
+	if !strings.Contains(command.Line, "innodb_lock_wait_timeout = 10, lock_wait_timeout = 10") {
+		t.Errorf("expected the lock wait timeout to be set on connect, got %q", command.Line)
+	}
+	command = testClient(t, DBConnector{User: "gopli", LockWaitTimeout: 10, Proxy: "proxysql"}).Command()
+	if strings.Contains(command.Line, "--init-command") {
+		t.Errorf("expected no session settings through a proxy, got %q", command.Line)
+	}
+}
+
+func TestPrimaryKeys(t *testing.T) {
+	runner := &cannedRunner{out: "order_items\torder_id\norder_items\tline\nusers\tid\n"}
+	fetcher := &MySQLFetcher{Runner: runner, Name: "app"}
+	primaryKeys, err := fetcher.PrimaryKeys()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if keys := primaryKeys["order_items"]; len(keys) != 2 || keys[0] != "order_id" || keys[1] != "line" {
+		t.Errorf("expected the columns in index order, got %v", keys)
+	}
+	if keys := primaryKeys["users"]; len(keys) != 1 || keys[0] != "id" {
+		t.Errorf("unexpected primary key of users: %v", keys)
+	}
+}
+
+func TestSelectQuery(t *testing.T) {
+	fetcher := &MySQLFetcher{
+		SessionSettings: []string{"SET TRANSACTION ISOLATION LEVEL READ COMMITTED;", "SET SESSION net_read_timeout = 600"},
+		SelectHint:      "/*+ MAX_EXECUTION_TIME(600000) */",
+	}
+	query := fetcher.selectQuery("*", "`app`.`users`", []string{"id"}, TableSettings{})
+	expected := "SET TRANSACTION ISOLATION LEVEL READ COMMITTED;\nSET SESSION net_read_timeout = 600;\nSELECT /*+ MAX_EXECUTION_TIME(600000) */ * FROM `app`.`users` ORDER BY `id`"
+	if query != expected {
+		t.Errorf("expected %q, got %q", expected, query)
+	}
+
+	fetcher = &MySQLFetcher{}
+	query = fetcher.selectQuery("*", "`app`.`events`", []string{"id"}, TableSettings{Where: "created_at > NOW() - INTERVAL 30 DAY", Limit: 1000, OrderBy: "id DESC"})
+	expected = "SELECT * FROM `app`.`events` WHERE created_at > NOW() - INTERVAL 30 DAY ORDER BY id DESC LIMIT 1000"
+	if query != expected {
+		t.Errorf("expected %q, got %q", expected, query)
+	}
+}
+
+func TestTableSelection(t *testing.T) {
+	conn := DBConnector{Offset: 500, Tables: map[string]TableSettings{
+		"events":      {Where: "created_at > NOW() - INTERVAL 30 DAY"},
+		"archive.log": {Limit: 10},
+	}}
+	if selection := tableSelection(conn, "events"); selection.Where == "" || selection.Limit != 500 {
+		t.Errorf("expected the condition capped at the offset, got %+v", selection)
+	}
+	if selection := tableSelection(conn, "archive.log"); selection.Limit != 10 {
+		t.Errorf("expected the limit of the table, got %+v", selection)
+	}
+	if selection := tableSelection(DBConnector{}, "users"); isPartial(selection) {
+		t.Errorf("expected the whole table, got %+v", selection)
+	}
+}
+
+func TestNoTables(t *testing.T) {
+	for _, system := range []string{MANAGEMENT_SYSTEM_MYSQL, MANAGEMENT_SYSTEM_POSTGRESQL} {
+		conn := DBConnector{Runner: &cannedRunner{out: "1\n"}, ManagementSystem: system, Name: "app", User: "gopli"}
+		if err := noTables(conn); !errors.Is(err, ErrNoTables) {
+			t.Errorf("%s: expected no tables in an empty database, got %v", system, err)
+		}
+		for _, out := range []string{"0\n", "", "Warning: unexpected\n"} {
+			conn.Runner = &cannedRunner{out: out}
+			if err := noTables(conn); !errors.Is(err, ErrConnectionFailed) {
+				t.Errorf("%s: expected a failure for %q, got %v", system, out, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,201 @@
+package database
+
+import (
+	"archive/tar"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	. "github.com/timakin/gopli/constants"
+	. "github.com/timakin/gopli/lib"
+)
+
+// shellDumpable reports whether the tables can be dumped with MySQL Shell
+// instead of the mysql client. dumpTables covers a single schema and whole
+// tables, and mysqlsh has to be installed on the source and this machine.
+func (fetcher *MySQLFetcher) shellDumpable(tables []string) bool {
+	if recordDir != "" {
+		log.Print("[Fetch] recording fixtures, dumping with the mysql client to leave the row values out")
+		return false
+	}
+	if fetcher.FetchOptions.RecentPartitions > 0 {
+		log.Print("[Fetch] mysqlsh can't limit tables to recent partitions, dumping with the mysql client")
+		return false
+	}
+	for _, table := range tables {
+		if selection := tableSelection(DBConnector(*fetcher), table); isPartial(selection) || selection.OrderBy != "" {
+			log.Print("[Fetch] " + table + " selects its rows, dumping with the mysql client")
+			return false
+		}
+		if selectedColumns(fetcher.FetchOptions.Columns, table) != nil {
+			log.Print("[Fetch] " + table + " selects its columns, dumping with the mysql client")
+			return false
+		}
+		if ParseTableName(table).Schema != "" {
+			log.Print("[Fetch] mysqlsh can't dump tables of other schemas such as " + table + ", dumping with the mysql client")
+			return false
+		}
+	}
+	if fetcher.Runner.Run(&Command{Line: "command -v mysqlsh"}) != nil || fetcher.LocalRunner.Run(&Command{Line: "command -v mysqlsh"}) != nil {
+		log.Print("[Fetch] mysqlsh is not available, dumping with the mysql client")
+		return false
+	}
+	return true
+}
+
+// shellDump dumps the tables with MySQL Shell into a remote working directory
+// on the source host and unpacks it into the workspace. mysqlsh chunks and
+// compresses the tables itself.
+func (fetcher *MySQLFetcher) shellDump(tables []string) error {
+	names := make([]string, len(tables))
+	for i, table := range tables {
+		names[i] = ParseTableName(table).Name
+	}
+	script := fmt.Sprintf(MYSQLSH_DUMP_SCRIPT_FORMAT, jsLiteral(fetcher.Name), jsLiteral(names), shellThreads(DBConnector(*fetcher)), jsLiteral(shellCompression(fetcher.FetchOptions.Compression)))
+	remote, err := newRemoteWorkspace(fetcher.Runner)
+	if err != nil {
+		return err
+	}
+	defer remote.Close()
+	dir := shellQuote(remote.File("dump"))
+	dump := shellClient(DBConnector(*fetcher), fetcher.IsContainer).Arg("-e", script).Command()
+	// mysqlsh logs to stdout, which carries the archive.
+	dump.Line = "GOPLI_DUMP_DIR=" + dir + " " + dump.Line + " >&2 && tar -C " + dir + " -cf - ."
+
+	log.Print("\t[Fetch] dumping " + strings.Join(tables, ", ") + " with mysqlsh")
+	start := time.Now()
+	reader, writer := io.Pipe()
+	counter := &countingReader{reader: reader}
+	done := make(chan error, 1)
+	go func() {
+		done <- untar(counter, fetcher.Workspace)
+	}()
+	dump.Stdout = writer
+	err = fetcher.Runner.Run(dump)
+	writer.CloseWithError(err)
+	if untarErr := <-done; err == nil {
+		err = untarErr
+	}
+	if err != nil {
+		return err
+	}
+	fetcher.FetchOptions.Stats.Add(NewTableTransfer(MYSQLSH_DUMP_TABLE, DUMP_TOOL_MYSQLSH, counter.n, counter.n, time.Since(start), 0, 0))
+	log.Print("\t[Fetch] completed fetching all tables")
+	return nil
+}
+
+// hasShellDump reports whether the workspace holds a MySQL Shell dump.
+func hasShellDump(ws *Workspace) bool {
+	_, err := os.Stat(filepath.Join(ws.Path, MYSQLSH_DUMP_METADATA_FILE))
+	return err == nil
+}
+
+// shellLoad loads the MySQL Shell dump in the workspace into the cleaned
+// destination tables.
+func (inserter *MySQLInserter) shellLoad() error {
+	log.Print("[Load Infile] loading the mysqlsh dump...")
+	script := fmt.Sprintf(MYSQLSH_LOAD_SCRIPT_FORMAT, jsLiteral(inserter.Workspace.Path), jsLiteral(inserter.Name), shellThreads(DBConnector(*inserter)))
+	cmd := shellClient(DBConnector(*inserter), inserter.IsContainer || !isLocalHost(inserter.Host)).Arg("-e", script).LocalCommand()
+	// Through the logger, so its progress shows in the progress screen
+	// instead of being drawn over.
+	cmd.Stdout = log.Writer()
+	cmd.Stderr = log.Writer()
+	if err := inserter.LocalRunner.Run(cmd); err != nil {
+		return err
+	}
+	log.Print("[Load Infile] completed loading the mysqlsh dump")
+	log.Print("[Finished] All tasks finished")
+	return nil
+}
+
+// shellClient builds a mysqlsh command for the database. The password is
+// passed through stdin.
+func shellClient(conn DBConnector, withHost bool) *commandBuilder {
+	builder := newCommandBuilder("mysqlsh", "--js", "-u"+conn.User)
+	if withHost {
+		builder.Arg("-h" + conn.Host)
+	}
+	if len(conn.Password) > 0 {
+		builder.Arg("--passwords-from-stdin").Stdin(strings.NewReader(conn.Password + "\n"))
+	}
+	return builder
+}
+
+func shellThreads(conn DBConnector) int {
+	if conn.Concurrency > 0 {
+		return conn.Concurrency
+	}
+	return MaxFetchSession
+}
+
+// shellCompression maps a compression setting to the ones of mysqlsh, which
+// knows no lz4 and compresses with zstd by default.
+func shellCompression(compression string) string {
+	switch compression {
+	case COMPRESSION_GZIP, COMPRESSION_NONE:
+		return compression
+	default:
+		return COMPRESSION_ZSTD
+	}
+}
+
+// jsLiteral renders value as a JavaScript literal for mysqlsh scripts.
+func jsLiteral(value interface{}) string {
+	literal, _ := json.Marshal(value)
+	return string(literal)
+}
+
+// untar unpacks the regular files of an archive into the workspace.
+func untar(r io.Reader, ws *Workspace) error {
+	archive := tar.NewReader(r)
+	for {
+		header, err := archive.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+		name := filepath.Base(header.Name)
+		if name != filepath.Clean(strings.TrimPrefix(header.Name, "./")) {
+			return fmt.Errorf("unexpected path %s in the mysqlsh dump", header.Name)
+		}
+		// Files only appear under their names once complete, so an
+		// interrupted untar leaves no dump that looks whole.
+		path := filepath.Join(ws.Path, name)
+		file, err := os.OpenFile(path+PARTIAL_FILE_EXT, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, ws.FileMode)
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(file, archive)
+		if closeErr := file.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			os.Remove(path + PARTIAL_FILE_EXT)
+			return err
+		}
+		if err := os.Rename(path+PARTIAL_FILE_EXT, path); err != nil {
+			return err
+		}
+	}
+}
+
+type countingReader struct {
+	reader io.Reader
+	n      int64
+}
+
+func (counter *countingReader) Read(p []byte) (int, error) {
+	n, err := counter.reader.Read(p)
+	counter.n += int64(n)
+	return n, err
+}
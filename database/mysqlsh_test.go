@@ -0,0 +1,60 @@
+package database
+
+import (
+	"archive/tar"
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/timakin/gopli/constants"
+	. "github.com/timakin/gopli/lib"
+)
+
+func TestUntar(t *testing.T) {
+	ws, err := NewWorkspace(TMP_DIR_PREFIX, WorkspaceConf{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ws.Remove()
+
+	var archive bytes.Buffer
+	writer := tar.NewWriter(&archive)
+	writer.WriteHeader(&tar.Header{Name: "./", Typeflag: tar.TypeDir, Mode: 0700})
+	writer.WriteHeader(&tar.Header{Name: "./@.json", Typeflag: tar.TypeReg, Mode: 0600, Size: 2})
+	writer.Write([]byte("{}"))
+	writer.Close()
+
+	if err := untar(&archive, ws); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := ioutil.ReadFile(filepath.Join(ws.Path, "@.json")); err != nil || string(data) != "{}" {
+		t.Errorf("expected {}, got %q (%v)", data, err)
+	}
+	if !hasShellDump(ws) {
+		t.Error("expected a mysqlsh dump")
+	}
+
+	archive.Reset()
+	writer = tar.NewWriter(&archive)
+	writer.WriteHeader(&tar.Header{Name: "../escape", Typeflag: tar.TypeReg, Mode: 0600})
+	writer.Close()
+	if err := untar(&archive, ws); err == nil {
+		t.Error("expected an error for a path outside of the workspace")
+	}
+
+	// An archive cut off in the middle of a file leaves no part of it.
+	archive.Reset()
+	writer = tar.NewWriter(&archive)
+	writer.WriteHeader(&tar.Header{Name: "./app@users@@0.tsv.zst", Typeflag: tar.TypeReg, Mode: 0600, Size: 10})
+	writer.Write([]byte("cut"))
+	if err := untar(&archive, ws); err == nil {
+		t.Error("expected an error for a truncated archive")
+	}
+	for _, name := range []string{"app@users@@0.tsv.zst", "app@users@@0.tsv.zst" + PARTIAL_FILE_EXT} {
+		if _, err := os.Stat(filepath.Join(ws.Path, name)); !os.IsNotExist(err) {
+			t.Errorf("expected no %s, got %v", name, err)
+		}
+	}
+}
@@ -0,0 +1,327 @@
+package database
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"strings"
+	"sync/atomic"
+
+	"github.com/go-sql-driver/mysql"
+	. "github.com/timakin/gopli/constants"
+)
+
+// clientInvocation is a mysql client invocation as mysqlClient builds it,
+// which the native driver runs without the client.
+type clientInvocation struct {
+	args  []string
+	env   []string
+	stdin io.Reader
+}
+
+// tunnelDialer connects to address from a host. Control connections may
+// use the connection the pool keeps free for control commands.
+type tunnelDialer func(control bool, network string, address string) (net.Conn, error)
+
+// dialDirect connects from this machine.
+func dialDirect(control bool, network string, address string) (net.Conn, error) {
+	return net.Dial(network, address)
+}
+
+// nativeNetworks and nativeReaders number the dial functions and stdin
+// handlers registered with the driver, which keeps them in global maps.
+var nativeNetworks, nativeReaders int64
+
+// nativeRunner runs mysql client invocations over connections of the driver,
+// and every other command through runner.
+type nativeRunner struct {
+	runner Runner
+	// network and control are the networks registered for connections of
+	// ordinary and of control commands.
+	network string
+	control string
+}
+
+// withNativeDriver makes the mysql client invocations run through
+// go-sql-driver/mysql, connecting through dial, so no client or shell
+// tooling is needed on the host and passwords never reach a process.
+func withNativeDriver(runner Runner, dial tunnelDialer) Runner {
+	network := fmt.Sprintf(NATIVE_NETWORK_FORMAT, atomic.AddInt64(&nativeNetworks, 1))
+	native := &nativeRunner{runner: runner, network: network, control: network + "-control"}
+	mysql.RegisterDialContext(native.network, func(ctx context.Context, address string) (net.Conn, error) {
+		return dial(false, "tcp", address)
+	})
+	mysql.RegisterDialContext(native.control, func(ctx context.Context, address string) (net.Conn, error) {
+		return dial(true, "tcp", address)
+	})
+	return native
+}
+
+// clientOptions are the options of a mysql client invocation. The client
+// options for batch output without headers, keeping comments and utf8mb4 are
+// what the driver does anyway.
+type clientOptions struct {
+	user        string
+	password    string
+	host        string
+	port        string
+	database    string
+	initCommand string
+	// execute is the statement of -e, which leaves stdin to LOAD DATA.
+	execute     string
+	hasExecute  bool
+	localInfile bool
+	cleartext   bool
+	requireTLS  bool
+	raw         bool
+}
+
+// parseClientInvocation reads the options of invocation, refusing any the
+// native driver can't honor.
+func parseClientInvocation(invocation *clientInvocation) (clientOptions, error) {
+	var options clientOptions
+	args := invocation.args
+	if len(args) == 0 || args[0] != "mysql" {
+		return options, fmt.Errorf("the native driver only runs the mysql client, not %q", args)
+	}
+	for i := 1; i < len(args); i++ {
+		arg := args[i]
+		switch {
+		case arg == "-e" && i+1 < len(args):
+			i++
+			options.execute = args[i]
+			options.hasExecute = true
+		case arg == "--enable-local-infile":
+			options.localInfile = true
+		case arg == "--enable-cleartext-plugin":
+			options.cleartext = true
+		case arg == "--ssl-mode=REQUIRED":
+			options.requireTLS = true
+		case arg == "--raw":
+			options.raw = true
+		case strings.HasPrefix(arg, "--init-command="):
+			options.initCommand = strings.TrimPrefix(arg, "--init-command=")
+		case strings.HasPrefix(arg, "--database="):
+			options.database = strings.TrimPrefix(arg, "--database=")
+		case arg == "--comments" || arg == "-B" || arg == "-N" || arg == "--default-character-set=utf8mb4":
+		case strings.HasPrefix(arg, "--"):
+			return options, fmt.Errorf("the native driver doesn't support the mysql client option %s", arg)
+		case strings.HasPrefix(arg, "-u"):
+			options.user = strings.TrimPrefix(arg, "-u")
+		case strings.HasPrefix(arg, "-h"):
+			options.host = strings.TrimPrefix(arg, "-h")
+		case strings.HasPrefix(arg, "-P"):
+			options.port = strings.TrimPrefix(arg, "-P")
+		default:
+			return options, fmt.Errorf("the native driver doesn't support the mysql client option %s", arg)
+		}
+	}
+	for _, env := range invocation.env {
+		if strings.HasPrefix(env, "MYSQL_PWD=") {
+			options.password = strings.TrimPrefix(env, "MYSQL_PWD=")
+		}
+	}
+	if options.host == "" {
+		options.host = NATIVE_LOCAL_HOST
+	}
+	if options.port == "" {
+		options.port = NATIVE_DEFAULT_PORT
+	}
+	return options, nil
+}
+
+// config returns the driver configuration of options, connecting through
+// network.
+func (options clientOptions) config(network string) *mysql.Config {
+	config := mysql.NewConfig()
+	config.User = options.user
+	config.Passwd = options.password
+	config.Net = network
+	config.Addr = net.JoinHostPort(unbracket(options.host), options.port)
+	config.DBName = options.database
+	config.Collation = NATIVE_COLLATION
+	config.MultiStatements = true
+	config.AllowAllFiles = options.localInfile
+	config.AllowCleartextPasswords = options.cleartext
+	if options.requireTLS {
+		// Like --ssl-mode=REQUIRED, which encrypts without verifying.
+		config.TLSConfig = "skip-verify"
+	}
+	return config
+}
+
+// Run runs the mysql client invocation of cmd through the driver, printing
+// errors to stderr the way the client does, and passes other commands on.
+func (runner *nativeRunner) Run(cmd *Command) error {
+	if cmd.Native == nil {
+		return runner.runner.Run(cmd)
+	}
+	stdout, stderr := cmd.Stdout, cmd.Stderr
+	if stdout == nil {
+		stdout = ioutil.Discard
+	}
+	if stderr == nil {
+		stderr = ioutil.Discard
+	}
+	options, err := parseClientInvocation(cmd.Native)
+	if err != nil {
+		return err
+	}
+	network := runner.network
+	if cmd.Control {
+		network = runner.control
+	}
+	err = runNative(options.config(network), options, cmd.Native.stdin, stdout)
+	var mysqlError *mysql.MySQLError
+	var connectError *nativeConnectError
+	switch {
+	case errors.As(err, &mysqlError):
+		fmt.Fprintf(stderr, NATIVE_ERROR_FORMAT, mysqlError.Number, mysqlError.Message)
+	case errors.As(err, &connectError):
+		fmt.Fprintf(stderr, NATIVE_CONNECT_ERROR_FORMAT, connectError.address, connectError.err)
+	case errors.Is(err, mysql.ErrInvalidConn):
+		fmt.Fprintf(stderr, NATIVE_ERROR_FORMAT, 2013, "Lost connection to MySQL server during query")
+	}
+	return err
+}
+
+// nativeConnectError is a connection to address the driver couldn't open.
+type nativeConnectError struct {
+	address string
+	err     error
+}
+
+func (connectError *nativeConnectError) Error() string {
+	return fmt.Sprintf("failed to connect to %s: %v", connectError.address, connectError.err)
+}
+
+func (connectError *nativeConnectError) Unwrap() error {
+	return connectError.err
+}
+
+// runNative runs the script of options in a single connection, writing the
+// rows of every result to stdout. LOAD DATA LOCAL INFILE of STDIN_INFILE
+// reads stdin, which the client would.
+func runNative(config *mysql.Config, options clientOptions, stdin io.Reader, stdout io.Writer) error {
+	script := options.execute
+	if !options.hasExecute {
+		if stdin != nil {
+			input, err := ioutil.ReadAll(stdin)
+			if err != nil {
+				return err
+			}
+			script = string(input)
+		}
+		stdin = nil
+	}
+	if options.localInfile && stdin != nil {
+		name := fmt.Sprintf(NATIVE_READER_FORMAT, atomic.AddInt64(&nativeReaders, 1))
+		// Hide Close from the driver, which would close stdin after the
+		// load while its opener still owns it.
+		reader := struct{ io.Reader }{stdin}
+		mysql.RegisterReaderHandler(name, func() io.Reader { return reader })
+		defer mysql.DeregisterReaderHandler(name)
+		script = strings.Replace(script, "'"+STDIN_INFILE+"'", "'Reader::"+name+"'", -1)
+	}
+
+	connector, err := mysql.NewConnector(config)
+	if err != nil {
+		return err
+	}
+	db := sql.OpenDB(connector)
+	defer db.Close()
+	ctx := context.Background()
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		var mysqlError *mysql.MySQLError
+		if errors.As(err, &mysqlError) {
+			return err
+		}
+		return &nativeConnectError{address: config.Addr, err: err}
+	}
+	defer conn.Close()
+	if options.initCommand != "" {
+		if _, err := conn.ExecContext(ctx, options.initCommand); err != nil {
+			return err
+		}
+	}
+	if strings.TrimSpace(script) == "" {
+		return nil
+	}
+	rows, err := conn.QueryContext(ctx, script)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	return writeRows(rows, stdout, options.raw)
+}
+
+// writeRows prints every result of rows like the batch mode of the mysql
+// client: tab separated without headers, NULL for NULL values and, unless
+// raw, with tabs, newlines, backslashes and NUL bytes escaped.
+func writeRows(rows *sql.Rows, w io.Writer, raw bool) error {
+	out := bufio.NewWriter(w)
+	for {
+		columns, err := rows.Columns()
+		if err != nil {
+			return err
+		}
+		values := make([]sql.RawBytes, len(columns))
+		dest := make([]interface{}, len(columns))
+		for i := range values {
+			dest[i] = &values[i]
+		}
+		for rows.Next() {
+			if err := rows.Scan(dest...); err != nil {
+				return err
+			}
+			for i, value := range values {
+				if i > 0 {
+					out.WriteByte('\t')
+				}
+				switch {
+				case value == nil:
+					out.WriteString("NULL")
+				case raw:
+					out.Write(value)
+				default:
+					writeEscaped(out, value)
+				}
+			}
+			if err := out.WriteByte('\n'); err != nil {
+				return err
+			}
+		}
+		if !rows.NextResultSet() {
+			break
+		}
+	}
+	if err := rows.Err(); err != nil {
+		out.Flush()
+		return err
+	}
+	return out.Flush()
+}
+
+// writeEscaped writes value escaped like the batch mode of the mysql client.
+func writeEscaped(out *bufio.Writer, value []byte) {
+	for _, b := range value {
+		switch b {
+		case 0:
+			out.WriteString(`\0`)
+		case '\t':
+			out.WriteString(`\t`)
+		case '\n':
+			out.WriteString(`\n`)
+		case '\\':
+			out.WriteString(`\\`)
+		default:
+			out.WriteByte(b)
+		}
+	}
+}
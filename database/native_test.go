@@ -0,0 +1,85 @@
+package database
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"net"
+	"strings"
+	"testing"
+
+	. "github.com/timakin/gopli/constants"
+	. "github.com/timakin/gopli/lib"
+)
+
+func TestParseClientInvocation(t *testing.T) {
+	conn := DBConnector{User: "gopli", Password: "secret", LockWaitTimeout: 10, RouteComment: "/* gopli */", NativeDriver: true}
+	cmd := testClient(t, conn).Stdin(strings.NewReader("SELECT 1;")).Command()
+	if cmd.Native == nil {
+		t.Fatal("expected a native invocation")
+	}
+	options, err := parseClientInvocation(cmd.Native)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if options.user != "gopli" || options.password != "secret" || options.host != "127.0.0.1" || options.port != "3306" || !strings.Contains(options.initCommand, "lock_wait_timeout = 10") {
+		t.Errorf("unexpected options %+v", options)
+	}
+	if options.hasExecute || options.localInfile {
+		t.Errorf("expected the script on stdin, got %+v", options)
+	}
+
+	load := streamedLoad(testClient(t, conn), conn, "LOAD DATA LOCAL INFILE '/dev/stdin' INTO TABLE `users`", strings.NewReader("1\talice\n")).LocalCommand()
+	options, err = parseClientInvocation(load.Native)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !options.hasExecute || !options.localInfile || !strings.HasPrefix(options.execute, "/* gopli */ LOAD DATA") {
+		t.Errorf("expected the load on the command line, got %+v", options)
+	}
+
+	if cmd := testClient(t, DBConnector{User: "gopli"}).Command(); cmd.Native != nil {
+		t.Errorf("expected no native invocation without native_driver, got %+v", cmd.Native)
+	}
+	if _, err := parseClientInvocation(&clientInvocation{args: []string{"mysql", "--xml"}}); err == nil {
+		t.Error("expected an unknown client option to be refused")
+	}
+}
+
+func TestNativeRunnerPassesOtherCommandsOn(t *testing.T) {
+	inner := &cannedRunner{out: "ok\n"}
+	var out bytes.Buffer
+	if err := withNativeDriver(inner, dialDirect).Run(&Command{Line: "true", Stdout: &out}); err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != "ok\n" {
+		t.Errorf("expected the command to run on the host, got %q", out.String())
+	}
+}
+
+func TestNativeRunnerConnectionFailure(t *testing.T) {
+	refused := func(control bool, network string, address string) (net.Conn, error) {
+		return nil, errors.New("tunnel refused")
+	}
+	conn := DBConnector{User: "gopli", NativeDriver: true}
+	cmd := testClient(t, conn).Stdin(strings.NewReader(PING_QUERY)).Command()
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	err := withStderr(withNativeDriver(&cannedRunner{}, refused)).Run(cmd)
+	if !errors.Is(err, ErrConnectionFailed) {
+		t.Errorf("expected a connection failure, got %v", err)
+	}
+	if !strings.Contains(stderr.String(), "ERROR 2003") || !strings.Contains(stderr.String(), "tunnel refused") {
+		t.Errorf("expected the error of the client, got %q", stderr.String())
+	}
+}
+
+func TestWriteEscaped(t *testing.T) {
+	var out bytes.Buffer
+	w := bufio.NewWriter(&out)
+	writeEscaped(w, []byte("a\tb\nc\\d\x00e"))
+	w.Flush()
+	if expected := `a\tb\nc\\d\0e`; out.String() != expected {
+		t.Errorf("expected %q, got %q", expected, out.String())
+	}
+}
@@ -0,0 +1,142 @@
+package database
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	. "github.com/timakin/gopli/constants"
+	. "github.com/timakin/gopli/lib"
+)
+
+// DropTableDDL returns the statements dropping tables, so they can be
+// created again from the source schema.
+func DropTableDDL(tables []string) []DDLStatement {
+	statements := make([]DDLStatement, len(tables))
+	for i, table := range tables {
+		statements[i] = DDLStatement{SQL: fmt.Sprintf(DROP_TABLE_FORMAT, quoteTableName(table))}
+	}
+	return statements
+}
+
+// ViewDDL returns the statements creating or replacing every view of the
+// source. References to the source database are left unqualified, so the
+// views refer to the tables of the destination, and the views are defined by
+// the user running them instead of the definer on the source.
+func (fetcher *MySQLFetcher) ViewDDL() ([]DDLStatement, error) {
+	rows, err := fetcher.schemaRows(VIEWS_QUERY_FORMAT, 4)
+	if err != nil {
+		return nil, err
+	}
+	var statements []DDLStatement
+	for _, fields := range rows {
+		var checkOption string
+		if fields[3] != "NONE" {
+			checkOption = fmt.Sprintf(CHECK_OPTION_FORMAT, fields[3])
+		}
+		definition := fetcher.unqualify(fields[1])
+		statements = append(statements, DDLStatement{SQL: fmt.Sprintf(CREATE_VIEW_FORMAT, fields[2], quoteIdentifier(fields[0]), definition, checkOption)})
+	}
+	return statements, nil
+}
+
+// TriggerDDL returns the statements replacing the triggers of tables on the
+// destination with the ones of the source.
+func (fetcher *MySQLFetcher) TriggerDDL(tables []string) ([]DDLStatement, error) {
+	rows, err := fetcher.schemaRows(TRIGGERS_QUERY_FORMAT, 5)
+	if err != nil {
+		return nil, err
+	}
+	var statements []DDLStatement
+	for _, fields := range rows {
+		table := TableName{Name: fields[1]}.String()
+		if !containsString(tables, table) {
+			continue
+		}
+		name := quoteIdentifier(fields[0])
+		statements = append(statements,
+			DDLStatement{SQL: fmt.Sprintf(DROP_TRIGGER_FORMAT, name)},
+			DDLStatement{SQL: fmt.Sprintf(CREATE_TRIGGER_FORMAT, name, fields[2], fields[3], quoteIdentifier(fields[1]), fetcher.unqualify(fields[4]))},
+		)
+	}
+	return statements, nil
+}
+
+// schemaRows runs an information_schema query on the database of the
+// fetcher and returns its rows having columns fields.
+func (fetcher *MySQLFetcher) schemaRows(format string, columns int) ([][]string, error) {
+	query := fmt.Sprintf(format, escapeString(fetcher.Name))
+
+	var out bytes.Buffer
+	client, err := mysqlClient(DBConnector(*fetcher), fetcher.IsContainer)
+	if err != nil {
+		return nil, err
+	}
+	cmd := client.Stdin(strings.NewReader(query)).Command()
+	cmd.Stdout = &out
+	if err := fetcher.Runner.Run(cmd); err != nil {
+		return nil, err
+	}
+
+	var rows [][]string
+	for _, line := range strings.Split(out.String(), "\n") {
+		fields := strings.Split(line, "\t")
+		if len(fields) != columns {
+			continue
+		}
+		for i, field := range fields {
+			fields[i] = unescapeBatchValue(field)
+		}
+		rows = append(rows, fields)
+	}
+	return rows, nil
+}
+
+// unqualify drops the source database from the names in definition, leaving
+// string literals and other quoted identifiers untouched.
+func (fetcher *MySQLFetcher) unqualify(definition string) string {
+	prefix := quoteIdentifier(fetcher.Name) + "."
+	var out strings.Builder
+	for i := 0; i < len(definition); i++ {
+		// A table named like the database is left alone after a qualifier.
+		if strings.HasPrefix(definition[i:], prefix) && (i == 0 || definition[i-1] != '.') {
+			i += len(prefix) - 1
+			continue
+		}
+		c := definition[i]
+		if c != '\'' && c != '"' && c != '`' {
+			out.WriteByte(c)
+			continue
+		}
+		end := quotedEnd(definition, i)
+		out.WriteString(definition[i:end])
+		i = end - 1
+	}
+	return out.String()
+}
+
+// quotedEnd returns the index right after the string literal or identifier
+// quoted at start of s. Quotes are escaped by doubling them, and inside
+// string literals by a backslash.
+func quotedEnd(s string, start int) int {
+	quote := s[start]
+	for i := start + 1; i < len(s); i++ {
+		switch {
+		case s[i] == '\\' && quote != '`':
+			i++
+		case s[i] == quote && i+1 < len(s) && s[i+1] == quote:
+			i++
+		case s[i] == quote:
+			return i + 1
+		}
+	}
+	return len(s)
+}
+
+func (fetcher *PostgreSQLFetcher) ViewDDL() ([]DDLStatement, error) {
+	return nil, unsupportedOnPostgreSQL("syncing views")
+}
+
+func (fetcher *PostgreSQLFetcher) TriggerDDL(tables []string) ([]DDLStatement, error) {
+	return nil, unsupportedOnPostgreSQL("syncing triggers")
+}
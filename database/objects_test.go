@@ -0,0 +1,67 @@
+package database
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestViewDDL(t *testing.T) {
+	runner := &cannedRunner{out: "active_users\tselect `app`.`users`.`id` AS `id` from `app`.`users` where (`app`.`users`.`active` = 1)\tDEFINER\tNONE\n" +
+		"local_orders\tselect `app`.`orders`.`id` AS `id` from `app`.`orders`\tINVOKER\tCASCADED\n"}
+	fetcher := &MySQLFetcher{Runner: runner, Name: "app"}
+	statements, err := fetcher.ViewDDL()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		"CREATE OR REPLACE SQL SECURITY DEFINER VIEW `active_users` AS select `users`.`id` AS `id` from `users` where (`users`.`active` = 1);",
+		"CREATE OR REPLACE SQL SECURITY INVOKER VIEW `local_orders` AS select `orders`.`id` AS `id` from `orders` WITH CASCADED CHECK OPTION;",
+	}
+	if len(statements) != len(expected) {
+		t.Fatalf("expected %d statements, got %v", len(expected), statements)
+	}
+	for i, statement := range statements {
+		if statement.SQL != expected[i] {
+			t.Errorf("expected %q, got %q", expected[i], statement.SQL)
+		}
+	}
+}
+
+func TestUnqualify(t *testing.T) {
+	fetcher := &MySQLFetcher{Name: "app"}
+	cases := []struct {
+		definition string
+		expected   string
+	}{
+		{"select `app`.`users`.`id` from `app`.`users`", "select `users`.`id` from `users`"},
+		{"select 'see `app`.`users`' AS `note` from `app`.`users`", "select 'see `app`.`users`' AS `note` from `users`"},
+		{"select 'it''s `app`.`a`', 'x\\' `app`.`b`' from `app`.`c`", "select 'it''s `app`.`a`', 'x\\' `app`.`b`' from `c`"},
+		{"select \"`app`.`users`\" from `app`.`users`", "select \"`app`.`users`\" from `users`"},
+		{"select `it's`, `app`.`users`.`id` from `app`.`users`", "select `it's`, `users`.`id` from `users`"},
+		{"select `other`.`app`.`x` from `app_old`.`users`", "select `other`.`app`.`x` from `app_old`.`users`"},
+	}
+	for _, c := range cases {
+		if actual := fetcher.unqualify(c.definition); actual != c.expected {
+			t.Errorf("unqualify(%q): expected %q, got %q", c.definition, c.expected, actual)
+		}
+	}
+}
+
+func TestTriggerDDL(t *testing.T) {
+	runner := &cannedRunner{out: "users_bi\tusers\tBEFORE\tINSERT\tBEGIN\\n  SET NEW.created_at = NOW();\\nEND\n" +
+		"orders_ai\torders\tAFTER\tINSERT\tUPDATE `app`.`stats` SET orders = orders + 1\n"}
+	fetcher := &MySQLFetcher{Runner: runner, Name: "app"}
+	statements, err := fetcher.TriggerDDL([]string{"users"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(statements) != 2 {
+		t.Fatalf("expected the triggers of the given tables only, got %v", statements)
+	}
+	if statements[0].SQL != "DROP TRIGGER IF EXISTS `users_bi`;" {
+		t.Errorf("unexpected drop %q", statements[0].SQL)
+	}
+	if !strings.HasPrefix(statements[1].SQL, "DELIMITER ;;\nCREATE TRIGGER `users_bi` BEFORE INSERT ON `users` FOR EACH ROW BEGIN\n  SET NEW.created_at = NOW();\nEND;;\n") {
+		t.Errorf("unexpected trigger %q", statements[1].SQL)
+	}
+}
@@ -0,0 +1,101 @@
+package database
+
+import (
+	"log"
+	"math"
+	"sort"
+
+	. "github.com/timakin/gopli/constants"
+	. "github.com/timakin/gopli/lib"
+)
+
+// estimatedSizes returns the size information_schema estimates for every
+// table, or nil when it can't be read.
+func estimatedSizes(conn DBConnector, phase string) map[string]int64 {
+	return statSizes(estimatedStats(conn, phase))
+}
+
+// estimatedStats returns the rows and size information_schema estimates for
+// every table keyed by TableKey, or nil when they can't be read.
+func estimatedStats(conn DBConnector, phase string) map[string]TableStat {
+	stats, err := tableStats(conn)
+	if err != nil {
+		log.Print("[" + phase + "] failed to estimate table sizes: " + err.Error())
+		return nil
+	}
+	keyed := make(map[string]TableStat)
+	for _, stat := range stats {
+		keyed[TableKey(stat.Name)] = stat
+	}
+	return keyed
+}
+
+// statSizes returns the size of every table of stats, or nil without stats.
+func statSizes(stats map[string]TableStat) map[string]int64 {
+	if stats == nil {
+		return nil
+	}
+	sizes := make(map[string]int64)
+	for key, stat := range stats {
+		sizes[key] = stat.Bytes
+	}
+	return sizes
+}
+
+// largestFirst returns the tables ordered by size descending, so the tables
+// taking longest start first and don't run on alone at the end of a phase.
+// Tables of unknown size keep their order after the others.
+func largestFirst(tables []string, sizes map[string]int64) []string {
+	ordered := append([]string(nil), tables...)
+	sort.SliceStable(ordered, func(i, j int) bool {
+		return sizes[TableKey(ordered[i])] > sizes[TableKey(ordered[j])]
+	})
+	return ordered
+}
+
+// fetchedSizes returns the size of the dump of every table before
+// compression, which is what loading it costs.
+func fetchedSizes(ws *Workspace, tables []string) map[string]int64 {
+	sizes := make(map[string]int64)
+	for _, table := range tables {
+		sizes[TableKey(table)] = ws.TableSize(table)
+	}
+	return sizes
+}
+
+// tableLimiters returns the limiter of the sessions of every table, taking
+// as many slots of the phase's sessions as the table weighs.
+func tableLimiters(conn DBConnector, defaultLimit int, adaptive bool, sizes map[string]int64) func(table string) SessionLimiter {
+	slots := defaultLimit
+	if conn.Concurrency > 0 {
+		slots = conn.Concurrency
+	}
+	weighted := NewWeightedLimiter(sessionLimiter(conn, defaultLimit, adaptive), slots)
+	if conn.SessionCapacity == nil {
+		return func(table string) SessionLimiter {
+			return weighted.For(tableWeight(conn, table, sizes))
+		}
+	}
+	// The sessions of the phase never exceed what the host accepts, once
+	// its MaxSessions is known.
+	gate := NewCapacityGate(conn.SessionCapacity)
+	return func(table string) SessionLimiter {
+		return gate.Limit(weighted.For(tableWeight(conn, table, sizes)))
+	}
+}
+
+// tableWeight returns the weight configured for table, or its size in
+// slots with SlotSize, or 1.
+func tableWeight(conn DBConnector, table string, sizes map[string]int64) float64 {
+	for name, weight := range conn.TableWeights {
+		if TableKey(name) == TableKey(table) {
+			return weight
+		}
+	}
+	size, ok := sizes[TableKey(table)]
+	if conn.SlotSize <= 0 || !ok {
+		return 1
+	}
+	// Even empty tables take a share of a slot.
+	return math.Max(float64(size)/float64(conn.SlotSize), 1.0/MaxSharedSessions)
+}
@@ -0,0 +1,30 @@
+package database
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestLargestFirst(t *testing.T) {
+	tables := []string{"small", "unknown", "large", "app.medium"}
+	sizes := map[string]int64{"small": 10, "large": 1000, "app.medium": 100}
+
+	got := largestFirst(tables, sizes)
+	want := []string{"large", "app.medium", "small", "unknown"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+	if tables[0] != "small" {
+		t.Error("expected the table list to be left as is")
+	}
+}
+
+func TestTableWeight(t *testing.T) {
+	conn := DBConnector{TableWeights: map[string]float64{"events": 3}, SlotSize: 1000}
+	sizes := map[string]int64{"events": 10, "users": 2000, "tags": 0}
+	for table, want := range map[string]float64{"events": 3, "users": 2, "tags": 0.125, "unknown": 1} {
+		if got := tableWeight(conn, table, sizes); got != want {
+			t.Errorf("tableWeight(%q) = %v, want %v", table, got, want)
+		}
+	}
+}
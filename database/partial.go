@@ -0,0 +1,79 @@
+package database
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	. "github.com/timakin/gopli/constants"
+	. "github.com/timakin/gopli/lib"
+)
+
+// tableSelection returns the rows of table a partial sync fetches. Tables
+// without settings of their own are capped at conn.Offset rows.
+func tableSelection(conn DBConnector, table string) TableSettings {
+	var selection TableSettings
+	for name, settings := range conn.Tables {
+		if SameTable(name, table) {
+			selection = settings
+			break
+		}
+	}
+	if selection.Limit == 0 {
+		selection.Limit = conn.Offset
+	}
+	return selection
+}
+
+// isPartial reports whether the dump of table may leave rows out.
+func isPartial(selection TableSettings) bool {
+	return selection.Where != "" || selection.Limit > 0
+}
+
+// columnAssignments returns the SET clause of the LOAD DATA of table, giving
+// columns the values of its set settings, or an empty string without any.
+func columnAssignments(conn DBConnector, table string) string {
+	set := tableSelection(conn, table).Set
+	columns := make([]string, 0, len(set))
+	for column := range set {
+		columns = append(columns, column)
+	}
+	if len(columns) == 0 {
+		return ""
+	}
+	sort.Strings(columns)
+	assignments := make([]string, len(columns))
+	for i, column := range columns {
+		assignments[i] = quoteIdentifier(column) + " = " + set[column]
+	}
+	return fmt.Sprintf(SET_FORMAT, strings.Join(assignments, ", "))
+}
+
+// assignedTables returns the tables whose columns are set while loading.
+func assignedTables(conn DBConnector, tables []string) []string {
+	var assigned []string
+	for _, table := range tables {
+		if len(tableSelection(conn, table).Set) > 0 {
+			assigned = append(assigned, table)
+		}
+	}
+	return assigned
+}
+
+// selectionClauses returns the WHERE, ORDER BY and LIMIT clauses of a dump
+// query. orderBy sorts the rows unless the selection sorts them itself.
+func selectionClauses(selection TableSettings, orderBy []string) string {
+	var clauses string
+	if selection.Where != "" {
+		clauses += fmt.Sprintf(WHERE_FORMAT, selection.Where)
+	}
+	if selection.OrderBy != "" {
+		clauses += fmt.Sprintf(ORDER_BY_FORMAT, selection.OrderBy)
+	} else if len(orderBy) > 0 {
+		clauses += fmt.Sprintf(ORDER_BY_FORMAT, columnList(orderBy))
+	}
+	if selection.Limit > 0 {
+		clauses += fmt.Sprintf(LIMIT_FORMAT, selection.Limit)
+	}
+	return clauses
+}
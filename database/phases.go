@@ -0,0 +1,414 @@
+package database
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	. "github.com/timakin/gopli/constants"
+	. "github.com/timakin/gopli/lib"
+)
+
+// The phases below are shared by the fetchers and inserters of every
+// database system, which differ only in their Dialect.
+
+// tableDump is the part of a table a dump selects.
+type tableDump struct {
+	// columns are dumped instead of every column when set.
+	columns []string
+	// partitions limit the dump to those partitions when set.
+	partitions []string
+	// orderBy sorts the rows by those columns when set.
+	orderBy []string
+	// marker tags the dump query, so it can be killed after dump_timeout.
+	marker string
+}
+
+// tableLoad is what the dump files of a table load into.
+type tableLoad struct {
+	columns    []string
+	partitions []string
+	// engine is the storage engine of a MySQL table, which loads are tuned
+	// for.
+	engine string
+}
+
+// fetchTableList writes the tables to sync to the table list of the
+// workspace and returns them.
+func fetchTableList(conn DBConnector) ([]string, error) {
+	log.Print("[Fetch] fetching the list of tables...")
+	tableList, err := dialectOf(conn).listTables(conn)
+	if err != nil {
+		return nil, err
+	}
+	if len(tableList) == 0 {
+		return nil, noTables(conn)
+	}
+	if err := conn.Workspace.WriteFile(TABLE_LIST_FILE, tableList); err != nil {
+		return nil, err
+	}
+	log.Print("[Fetch] completed fetching the list of tables")
+
+	log.Print("\t[Fetch] start to fetch table contents...")
+	return conn.Workspace.ReadTableList()
+}
+
+// fetchTables dumps tables as dumps selects them, largest first and as many
+// at a time as the session limits of conn allow. Tables with a cache key are
+// restored from the dump cache when it holds them, and stored there once
+// dumped.
+func fetchTables(conn DBConnector, tables []string, dumps map[string]tableDump, codec *codec, cacheKeys map[string]string) error {
+	stats := estimatedStats(conn, "Fetch")
+	sizes := statSizes(stats)
+	for _, table := range tables {
+		progress.SetPhase(table, PHASE_QUEUED, sizes[TableKey(table)])
+	}
+
+	limiter := tableLimiters(conn, MaxFetchSession, true, sizes)
+	order := NewStartOrder()
+	failures := NewTableErrors("fetch")
+	var wg sync.WaitGroup
+	for _, table := range largestFirst(tables, sizes) {
+		wg.Add(1)
+		go func(table string, limiter *OrderedLimiter) {
+			defer wg.Done()
+			defer limiter.Pass()
+			dump := dumps[table]
+			key := cacheKeys[table]
+			if key != "" && fetchCachedTable(conn, key, table, dump.columns) {
+				log.Print("\t\t[Fetch] reused the cached dump of " + table)
+				progress.SetPhase(table, PHASE_CACHED, 0)
+				return
+			}
+			log.Print("\t\t[Fetch] fetching " + table)
+			span := startTableSpan("fetch", table, conn)
+			err := dumpTable(conn, limiter, codec, table, dump)
+			if err == nil {
+				err = verifyDump(conn, table, dump.partitions, stats[TableKey(table)].Rows)
+			}
+			span.End(err)
+			if err != nil {
+				log.Print("\t\t[Fetch] failed to fetch " + table + ": " + err.Error())
+				failures.Add(table, err)
+				progress.Fail(table, err)
+				return
+			}
+			progress.SetPhase(table, PHASE_FETCHED, 0)
+			if key != "" {
+				if err := conn.FetchOptions.Cache.Store(key, conn.Workspace, table); err != nil {
+					log.Print("\t\t[Fetch] failed to cache the dump of " + table + ": " + err.Error())
+				}
+			}
+			log.Print("\t\t[Fetch] completed fetcing " + table)
+		}(table, order.Next(limiter(table)))
+	}
+	wg.Wait()
+
+	if failures.Len() > 0 {
+		if !conn.FetchOptions.SkipFailedTables {
+			return failures
+		}
+		// Later phases must leave the destination copies of skipped tables alone.
+		if err := dropFromTableList(conn.Workspace, tables, failures.Tables()); err != nil {
+			return err
+		}
+		failures.Skipped = true
+		log.Printf("\t[Fetch] completed fetching tables, skipped %d failed tables", failures.Len())
+		return failures
+	}
+	if stats := conn.FetchOptions.Stats; stats != nil && stats.TransferredBytes > 0 {
+		log.Printf("\t[Fetch] transferred %s for %s of dumps (ratio %.1f)", HumanBytes(stats.TransferredBytes), HumanBytes(stats.Bytes), stats.CompressionRatio)
+	}
+	log.Print("\t[Fetch] completed fetching all tables")
+	return nil
+}
+
+// dumpTable dumps a single table into the workspace, retrying as configured.
+// Rows stream to disk as they arrive, so tables never have to fit in memory.
+func dumpTable(conn DBConnector, limiter SessionLimiter, codec *codec, table string, dump tableDump) error {
+	if len(dump.columns) > 0 {
+		if err := conn.Workspace.WriteColumns(table, dump.columns); err != nil {
+			return err
+		}
+	}
+	if len(dump.partitions) > 0 {
+		log.Print("\t\t[Fetch] limiting " + table + " to partitions " + strings.Join(dump.partitions, ", "))
+		if err := conn.Workspace.WritePartitions(table, dump.partitions); err != nil {
+			return err
+		}
+	}
+	if selection := tableSelection(conn, table); isPartial(selection) {
+		log.Print("\t\t[Fetch] fetching part of " + table + ":" + selectionClauses(selection, nil))
+	}
+
+	dialect := dialectOf(conn)
+	var err error
+	for attempt := 0; attempt <= conn.FetchOptions.Retries; attempt++ {
+		if attempt > 0 {
+			log.Printf("\t\t[Fetch] retrying %s (%d/%d)", table, attempt, conn.FetchOptions.Retries)
+			time.Sleep(time.Duration(attempt) * time.Second)
+		}
+
+		if conn.DumpTimeout > 0 {
+			dump.marker = newDumpMarker()
+		}
+		var cmd *Command
+		if cmd, err = dialect.dumpCommand(conn, table, dump); err != nil {
+			return err
+		}
+		cmd.Rows = true
+		if codec != nil {
+			cmd = codec.compressed(cmd)
+		}
+		var writer *TableWriter
+		if writer, err = conn.Workspace.CreateTable(table); err != nil {
+			return err
+		}
+		limiter.Acquire()
+		progress.SetPhase(table, PHASE_FETCHING, 0)
+		start := time.Now()
+		var transferred byteCounter
+		var rows io.Writer = writer
+		var decoder *streamDecoder
+		var codecName string
+		if codec != nil {
+			codecName = codec.name
+			decoder = newDecoder(conn.LocalRunner, codec, writer)
+			rows = decoder
+		}
+		var stderr bytes.Buffer
+		cmd.Stdout = io.MultiWriter(rows, &transferred, progress.Writer(table))
+		cmd.Stderr = &stderr
+		timedOut := watchDump(conn, table, dump.marker)
+		err = conn.Runner.Run(cmd)
+		if decoder != nil {
+			if decodeErr := decoder.finish(err); err == nil {
+				err = decodeErr
+			}
+		}
+		network := time.Since(start)
+		limiter.Release(int64(transferred), err)
+		if err != nil {
+			writer.Abort()
+			err = clientError(err, stderr.String())
+		}
+		if timedOut() {
+			// Retrying would only hit the same timeout.
+			return fmt.Errorf("dump took longer than dump_timeout of %ds and was killed: %v", conn.DumpTimeout, err)
+		}
+		if err != nil {
+			continue
+		}
+
+		diskStart := time.Now()
+		if err := writer.Close(); err != nil {
+			return err
+		}
+		conn.FetchOptions.Stats.Add(NewTableTransfer(table, codecName, int64(transferred), writer.Size(), network, 0, time.Since(diskStart)))
+		return nil
+	}
+	return err
+}
+
+// clientError adds what a failed client printed to err, unless err is a
+// MySQLError telling it already.
+func clientError(err error, stderr string) error {
+	var mysqlError *MySQLError
+	stderr = strings.TrimSpace(stderr)
+	if stderr == "" || errors.As(err, &mysqlError) {
+		return err
+	}
+	return fmt.Errorf("%w: %s", err, stderr)
+}
+
+// deleteTables empties the destination copies of every group of tables,
+// largest first and as many groups at a time as the session limits of conn
+// allow. The tables of a group are emptied together by empty, or by the
+// dialect when empty is nil. It returns the tables that failed to delete.
+func deleteTables(conn DBConnector, groups [][]string, empty func(tables []string) (string, error)) ([]string, error) {
+	if empty == nil {
+		empty = func(tables []string) (string, error) {
+			return truncateTables(conn, tables)
+		}
+	}
+	heads := make([]string, len(groups))
+	grouped := make(map[string][]string)
+	for i, group := range groups {
+		heads[i] = group[0]
+		grouped[group[0]] = group
+	}
+	var sizes map[string]int64
+	if len(groups) > 1 {
+		// Groups are ordered by the size of their first table.
+		sizes = estimatedSizes(conn, "Delete")
+	}
+
+	dialect := dialectOf(conn)
+	limiter := tableLimiters(conn, MaxDeleteSession, false, sizes)
+	order := NewStartOrder()
+	failures := NewTableErrors("delete")
+	var wg sync.WaitGroup
+	for _, head := range largestFirst(heads, sizes) {
+		wg.Add(1)
+		go func(tables []string, limiter *OrderedLimiter) {
+			limiter.Acquire()
+			defer wg.Done()
+
+			spans := make([]*Span, len(tables))
+			for i, table := range tables {
+				log.Print("\t[Delete] deleting " + table)
+				progress.SetPhase(table, PHASE_DELETING, 0)
+				spans[i] = startTableSpan("delete", table, conn)
+			}
+			stderr, err := empty(tables)
+			limiter.Release(0, err)
+			if err != nil {
+				name := strings.Join(tables, ", ")
+				log.Printf("\t[Delete] failed to delete %s: %v: %s", name, err, strings.TrimSpace(stderr))
+				err = dialect.explain(conn, err, stderr, name)
+				for _, table := range tables {
+					failures.Add(table, err)
+					progress.Fail(table, err)
+				}
+			}
+			for _, span := range spans {
+				span.End(err)
+			}
+		}(grouped[head], order.Next(limiter(head)))
+	}
+	wg.Wait()
+	if failures.Len() > 0 {
+		return failures.Tables(), failures
+	}
+	return nil, nil
+}
+
+// truncateTables empties tables of the destination together, retrying as
+// the dialect allows, and returns the stderr of the last attempt.
+func truncateTables(conn DBConnector, tables []string) (string, error) {
+	dialect := dialectOf(conn)
+	return dialect.retry(conn, strings.Join(tables, ", "), func(stderr io.Writer) error {
+		return dialect.truncate(conn, tables, stderr)
+	})
+}
+
+// loadTables loads the dump files of tables on the destination, largest
+// first and as many at a time as the session limits of conn allow. Every
+// dump file loads in a session of its own, unless loadTable is set to load
+// all dump files of a table in a single one. engines holds the storage
+// engine of MySQL tables by TableKey.
+func loadTables(conn DBConnector, tables []string, engines map[string]string, loadTable func(table string, load tableLoad) error) error {
+	dialect := dialectOf(conn)
+	sizes := fetchedSizes(conn.Workspace, tables)
+	limiter := tableLimiters(conn, MaxLoadInfileSession, true, sizes)
+	order := NewStartOrder()
+	failures := NewTableErrors("load")
+	var wg sync.WaitGroup
+	for _, table := range largestFirst(tables, sizes) {
+		columns, err := conn.Workspace.ReadColumns(table)
+		if err != nil {
+			return err
+		}
+		partitions, err := conn.Workspace.ReadPartitions(table)
+		if err != nil {
+			return err
+		}
+		load := tableLoad{columns: columns, partitions: partitions, engine: engines[TableKey(table)]}
+		wg.Add(1)
+		go func(table string, limiter *OrderedLimiter) {
+			defer wg.Done()
+			defer limiter.Pass()
+			restore, err := dialect.prepareLoad(conn, table, load)
+			if err != nil {
+				failures.Add(table, err)
+				progress.Fail(table, err)
+				return
+			}
+			if restore != nil {
+				done := deferRestore(restore)
+				defer func() {
+					done()
+					restore()
+				}()
+			}
+
+			var size int64
+			for _, fetchedTableFile := range conn.Workspace.TableFiles(table) {
+				size += fileSize(fetchedTableFile)
+			}
+			progress.SetPhase(table, PHASE_LOADING, size)
+			span := startTableSpan("load", table, conn)
+
+			if loadTable != nil {
+				limiter.Acquire()
+				err := loadTable(table, load)
+				limiter.Release(size, err)
+				span.End(err)
+				if err != nil {
+					failures.Add(table, err)
+					progress.Fail(table, err)
+					return
+				}
+				progress.SetPhase(table, PHASE_DONE, 0)
+				return
+			}
+
+			var tableWg sync.WaitGroup
+			for _, fetchedTableFile := range conn.Workspace.TableFiles(table) {
+				tableWg.Add(1)
+				go func(fetchedTableFile string) {
+					limiter.Acquire()
+					defer tableWg.Done()
+					err := loadFile(conn, table, fetchedTableFile, load)
+					limiter.Release(fileSize(fetchedTableFile), err)
+					if err != nil {
+						failures.Add(table, err)
+						progress.Fail(table, err)
+						return
+					}
+					progress.AddBytes(table, fileSize(fetchedTableFile))
+				}(fetchedTableFile)
+			}
+			tableWg.Wait()
+			err = failures.Get(table)
+			span.End(err)
+			if err == nil {
+				progress.SetPhase(table, PHASE_DONE, 0)
+			}
+		}(table, order.Next(limiter(table)))
+	}
+	wg.Wait()
+	if failures.Len() > 0 {
+		return failures
+	}
+	return nil
+}
+
+// loadFile loads a dump file of table on the destination from this machine.
+func loadFile(conn DBConnector, table string, fetchedTableFile string, load tableLoad) error {
+	dialect := dialectOf(conn)
+	log.Print("\t[Load Infile] start to send the contents inside of " + filepath.Base(fetchedTableFile))
+	stderr, err := dialect.retry(conn, table, func(stderr io.Writer) error {
+		cmd, closeDump, err := dialect.loadCommand(conn, table, fetchedTableFile, load)
+		if err != nil {
+			return err
+		}
+		defer closeDump()
+		cmd.Stdout = ioutil.Discard
+		cmd.Stderr = stderr
+		return conn.LocalRunner.Run(cmd)
+	})
+	if err != nil {
+		log.Printf("\t[Load Infile] failed to send %s: %v: %s", filepath.Base(fetchedTableFile), err, strings.TrimSpace(stderr))
+		return dialect.explain(conn, err, stderr, table)
+	}
+	log.Print("\t[Load Infile] completed sending the contents inside of " + filepath.Base(fetchedTableFile))
+	return nil
+}
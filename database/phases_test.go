@@ -0,0 +1,39 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	. "github.com/timakin/gopli/constants"
+	. "github.com/timakin/gopli/lib"
+)
+
+// erringRunner fails every command with err.
+type erringRunner struct {
+	err  error
+	runs int
+}
+
+func (runner *erringRunner) Run(cmd *Command) error {
+	runner.runs++
+	return runner.err
+}
+
+func TestDumpTableReturnsLastError(t *testing.T) {
+	ws, err := NewWorkspace(TMP_DIR_PREFIX, WorkspaceConf{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ws.Remove()
+
+	runner := &erringRunner{err: fmt.Errorf("%w: can't connect", ErrConnectionFailed)}
+	conn := DBConnector{Runner: runner, Name: "app", User: "gopli", Workspace: ws, FetchOptions: FetchOptions{Retries: 1}}
+	err = dumpTable(conn, NewFixedLimiter(1), nil, "users", tableDump{})
+	if !errors.Is(err, ErrConnectionFailed) {
+		t.Errorf("expected the error of the last attempt, got %v", err)
+	}
+	if runner.runs != 2 {
+		t.Errorf("expected 2 attempts, got %d", runner.runs)
+	}
+}
@@ -0,0 +1,365 @@
+package database
+
+import (
+	"errors"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+
+	. "github.com/timakin/gopli/constants"
+	"golang.org/x/crypto/ssh"
+)
+
+// ConnectionManager pools the SSH connections to every host, so all phases of
+// a run share them instead of dialing their own.
+type ConnectionManager struct {
+	mu    sync.Mutex
+	cond  *sync.Cond
+	pools map[string]*hostPool
+}
+
+type hostPool struct {
+	dial        func() (*ssh.Client, error)
+	maxOpen     int
+	maxIdle     int
+	maxSessions int
+	conns       []*pooledConn
+	dialing     int
+	// active is the number of sessions open on all connections.
+	active int
+	waited bool
+	// sessionLimit is the MaxSessions of sshd, as read from its settings or
+	// learned from refused sessions, or 0 while unknown.
+	sessionLimit int
+}
+
+type pooledConn struct {
+	client *ssh.Client
+	// active counts the sessions acquired on the connection, and open the
+	// ones sshd accepted.
+	active   int
+	open     int
+	sessions int
+}
+
+var connections = NewConnectionManager()
+
+// NewConnectionManager returns an empty connection manager.
+func NewConnectionManager() *ConnectionManager {
+	manager := &ConnectionManager{pools: make(map[string]*hostPool)}
+	manager.cond = sync.NewCond(&manager.mu)
+	return manager
+}
+
+// CloseConnections closes every pooled connection. Call it when a run is over.
+func CloseConnections() {
+	connections.CloseAll()
+}
+
+// register sets up the pool of a host unless it already exists.
+func (manager *ConnectionManager) register(key string, sshConf SSH, dial func() (*ssh.Client, error)) {
+	manager.mu.Lock()
+	defer manager.mu.Unlock()
+	if _, ok := manager.pools[key]; ok {
+		return
+	}
+	maxOpen := sshConf.MaxOpen
+	if maxOpen <= 0 {
+		maxOpen = DefaultMaxOpenConnection
+	}
+	maxIdle := sshConf.MaxIdle
+	if maxIdle <= 0 {
+		maxIdle = DefaultMaxIdleConnection
+	}
+	// Connections opened up front stay open for the whole run.
+	if sshConf.Connections > maxOpen {
+		maxOpen = sshConf.Connections
+	}
+	if sshConf.Connections > maxIdle {
+		maxIdle = sshConf.Connections
+	}
+	// By default every connection may carry as many sessions as sshd allows.
+	maxSessions := sshConf.MaxSessions
+	if maxSessions <= 0 {
+		maxSessions = maxOpen * DefaultMaxSessionsPerConnection
+	}
+	manager.pools[key] = &hostPool{dial: dial, maxOpen: maxOpen, maxIdle: maxIdle, maxSessions: maxSessions}
+}
+
+// acquire returns the least busy connection of a host. A new connection is
+// dialed only when every open connection is busy and the host is below its
+// max-open setting; otherwise sessions are multiplexed on existing ones.
+// Once the host has max-sessions sessions open, acquire waits for one of
+// them to end, so sshd never refuses a session. The last of them is kept for
+// control commands, so they never wait behind the sessions they control.
+func (manager *ConnectionManager) acquire(key string, control bool) (*pooledConn, error) {
+	manager.mu.Lock()
+	defer manager.mu.Unlock()
+	pool := manager.pools[key]
+	maxSessions := pool.maxSessions
+	if !control && maxSessions > 1 {
+		maxSessions--
+	}
+	for {
+		if pool.active >= maxSessions {
+			if !pool.waited {
+				pool.waited = true
+				log.Printf("[Connection] %d sessions open on %s, waiting for one to end", pool.active, key)
+			}
+			manager.cond.Wait()
+			continue
+		}
+		var least *pooledConn
+		for _, conn := range pool.conns {
+			if pool.sessionLimit > 0 && conn.active >= pool.sessionLimit {
+				continue
+			}
+			if least == nil || conn.active < least.active {
+				least = conn
+			}
+		}
+		canOpen := len(pool.conns)+pool.dialing < pool.maxOpen
+		if least != nil && (least.active == 0 || !canOpen) {
+			least.active++
+			least.sessions++
+			pool.active++
+			return least, nil
+		}
+		if canOpen {
+			pool.dialing++
+			pool.active++
+			manager.mu.Unlock()
+			client, err := pool.dial()
+			manager.mu.Lock()
+			pool.dialing--
+			manager.cond.Broadcast()
+			if err != nil {
+				pool.active--
+				return nil, err
+			}
+			conn := &pooledConn{client: client, active: 1, sessions: 1}
+			pool.conns = append(pool.conns, conn)
+			manager.watch(key, conn)
+			return conn, nil
+		}
+		manager.cond.Wait()
+	}
+}
+
+// opened records that sshd accepted a session on conn, and closed that the
+// session ended.
+func (manager *ConnectionManager) opened(conn *pooledConn) {
+	manager.mu.Lock()
+	defer manager.mu.Unlock()
+	conn.open++
+}
+
+func (manager *ConnectionManager) closed(conn *pooledConn) {
+	manager.mu.Lock()
+	defer manager.mu.Unlock()
+	conn.open--
+}
+
+// limitSessions lowers the sessions every connection of a host carries to the
+// sessions sshd accepted on conn before refusing one. It reports false when
+// conn had no session open, so waiting for one to end can't help.
+func (manager *ConnectionManager) limitSessions(key string, conn *pooledConn) bool {
+	manager.mu.Lock()
+	defer manager.mu.Unlock()
+	if conn.open < 1 {
+		return false
+	}
+	manager.setSessionLimit(key, conn.open, "refused a session")
+	return true
+}
+
+// detectSessionLimit carries at most limit sessions, the MaxSessions read
+// from the settings of sshd, per connection of a host.
+func (manager *ConnectionManager) detectSessionLimit(key string, limit int) {
+	manager.mu.Lock()
+	defer manager.mu.Unlock()
+	manager.setSessionLimit(key, limit, "allows "+strconv.Itoa(limit)+" sessions")
+}
+
+func (manager *ConnectionManager) setSessionLimit(key string, limit int, reason string) {
+	pool := manager.pools[key]
+	if pool.sessionLimit != 0 && limit >= pool.sessionLimit {
+		return
+	}
+	pool.sessionLimit = limit
+	if capacity := limit * pool.maxOpen; capacity < pool.maxSessions {
+		pool.maxSessions = capacity
+	}
+	log.Printf("[Connection] %s %s, carrying at most %d sessions per connection", key, reason, limit)
+}
+
+// sessionCapacity returns how many sessions of the phases a host carries at
+// once, or 0 while its MaxSessions is unknown.
+func (manager *ConnectionManager) sessionCapacity(key string) int {
+	manager.mu.Lock()
+	defer manager.mu.Unlock()
+	pool, ok := manager.pools[key]
+	if !ok || pool.sessionLimit == 0 {
+		return 0
+	}
+	if pool.maxSessions > 1 {
+		// One session is kept for control commands.
+		return pool.maxSessions - 1
+	}
+	return pool.maxSessions
+}
+
+// open dials n connections to a host in parallel, so sessions are spread
+// over all of them from the start.
+func (manager *ConnectionManager) open(key string, n int) error {
+	manager.mu.Lock()
+	pool := manager.pools[key]
+	missing := n - len(pool.conns) - pool.dialing
+	if missing <= 0 {
+		manager.mu.Unlock()
+		return nil
+	}
+	pool.dialing += missing
+	manager.mu.Unlock()
+
+	var wg sync.WaitGroup
+	errs := make(chan error, n)
+	for i := 0; i < missing; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			client, err := pool.dial()
+			manager.mu.Lock()
+			defer manager.mu.Unlock()
+			pool.dialing--
+			manager.cond.Broadcast()
+			if err != nil {
+				errs <- err
+				return
+			}
+			conn := &pooledConn{client: client}
+			pool.conns = append(pool.conns, conn)
+			manager.watch(key, conn)
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	return <-errs
+}
+
+// release hands a connection back, closing it when the host already keeps
+// enough idle connections.
+func (manager *ConnectionManager) release(key string, released *pooledConn) {
+	manager.mu.Lock()
+	defer manager.mu.Unlock()
+	defer manager.cond.Broadcast()
+	pool := manager.pools[key]
+	pool.active--
+	released.active--
+	if released.active > 0 {
+		return
+	}
+
+	idle := 0
+	for _, conn := range pool.conns {
+		if conn.active == 0 {
+			idle++
+		}
+	}
+	if idle <= pool.maxIdle {
+		return
+	}
+	for i, conn := range pool.conns {
+		if conn == released {
+			pool.conns = append(pool.conns[:i], pool.conns[i+1:]...)
+			break
+		}
+	}
+	released.client.Close()
+}
+
+// tunnel connects to address from the host of key through a pooled
+// connection, which stays acquired until the tunnel is closed so the pool
+// keeps as many connections to the database as sessions. A connection that
+// broke is dropped from the pool.
+func (manager *ConnectionManager) tunnel(key string, control bool, network string, address string) (net.Conn, error) {
+	conn, err := manager.acquire(key, control)
+	if err != nil {
+		return nil, err
+	}
+	tunneled, err := conn.client.Dial(network, address)
+	if err != nil {
+		var openErr *ssh.OpenChannelError
+		if !errors.As(err, &openErr) {
+			manager.evict(key, conn)
+		}
+		manager.release(key, conn)
+		return nil, err
+	}
+	return &tunnelConn{Conn: tunneled, release: func() { manager.release(key, conn) }}, nil
+}
+
+// tunnelConn hands its pooled connection back once closed.
+type tunnelConn struct {
+	net.Conn
+	once    sync.Once
+	release func()
+}
+
+func (conn *tunnelConn) Close() error {
+	err := conn.Conn.Close()
+	conn.once.Do(conn.release)
+	return err
+}
+
+// watch evicts conn from the pool of a host once its connection drops, so
+// later sessions go to the other connections or a new one.
+func (manager *ConnectionManager) watch(key string, conn *pooledConn) {
+	go func() {
+		conn.client.Wait()
+		manager.evict(key, conn)
+	}()
+}
+
+// evict drops conn from the pool of a host and closes it. Sessions still
+// holding it release it as usual.
+func (manager *ConnectionManager) evict(key string, evicted *pooledConn) {
+	manager.mu.Lock()
+	defer manager.mu.Unlock()
+	defer manager.cond.Broadcast()
+	pool, ok := manager.pools[key]
+	if !ok {
+		return
+	}
+	for i, conn := range pool.conns {
+		if conn == evicted {
+			pool.conns = append(pool.conns[:i], pool.conns[i+1:]...)
+			log.Print("[Connection] dropped a broken connection to " + key)
+			break
+		}
+	}
+	evicted.client.Close()
+}
+
+// CloseAll closes every connection and forgets every host.
+func (manager *ConnectionManager) CloseAll() {
+	manager.mu.Lock()
+	defer manager.mu.Unlock()
+	for key, pool := range manager.pools {
+		if len(pool.conns) > 1 {
+			sessions := make([]string, len(pool.conns))
+			for i, conn := range pool.conns {
+				sessions[i] = strconv.Itoa(conn.sessions)
+			}
+			log.Printf("[Connection] %d connections to %s carried %s sessions", len(pool.conns), key, strings.Join(sessions, "/"))
+		}
+		for _, conn := range pool.conns {
+			if err := conn.client.Close(); err != nil {
+				log.Print("[Connection] failed to close a connection to " + key + ": " + err.Error())
+			}
+		}
+		delete(manager.pools, key)
+	}
+}
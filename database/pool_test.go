@@ -0,0 +1,228 @@
+package database
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"net"
+	"testing"
+	"time"
+
+	. "github.com/timakin/gopli/constants"
+	"golang.org/x/crypto/ssh"
+)
+
+// sshDial returns a dial function connecting to an in-process SSH server,
+// which accepts connections but no sessions.
+func sshDial(t *testing.T) func() (*ssh.Client, error) {
+	_, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hostKey, err := ssh.NewSignerFromKey(private)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serverConfig := &ssh.ServerConfig{NoClientAuth: true}
+	serverConfig.AddHostKey(hostKey)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				_, chans, reqs, err := ssh.NewServerConn(conn, serverConfig)
+				if err != nil {
+					return
+				}
+				go ssh.DiscardRequests(reqs)
+				for newChannel := range chans {
+					newChannel.Reject(ssh.Prohibited, "no sessions")
+				}
+			}()
+		}
+	}()
+	return func() (*ssh.Client, error) {
+		return ssh.Dial("tcp", listener.Addr().String(), &ssh.ClientConfig{HostKeyCallback: ssh.InsecureIgnoreHostKey()})
+	}
+}
+
+func TestAcquireWaitsForMaxSessions(t *testing.T) {
+	manager := NewConnectionManager()
+	// One of the sessions is kept for control commands.
+	manager.register("deploy@db:22", SSH{MaxSessions: 3, MaxIdle: 2}, sshDial(t))
+	first, err := manager.acquire("deploy@db:22", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := manager.acquire("deploy@db:22", false); err != nil {
+		t.Fatal(err)
+	}
+
+	acquired := make(chan *pooledConn)
+	go func() {
+		conn, _ := manager.acquire("deploy@db:22", false)
+		acquired <- conn
+	}()
+	select {
+	case <-acquired:
+		t.Fatal("expected a third session to wait")
+	case <-time.After(50 * time.Millisecond):
+	}
+	manager.release("deploy@db:22", first)
+	select {
+	case conn := <-acquired:
+		if conn != first {
+			t.Error("expected the session to reuse the connection")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected the session to start once another ended")
+	}
+}
+
+func TestControlSessionAtMaxSessions(t *testing.T) {
+	// The dumps of a phase with concurrency 3 take every session but the
+	// one kept for killing them.
+	manager := NewConnectionManager()
+	manager.register("deploy@db:22", SSH{MaxSessions: 3}, sshDial(t))
+	acquired := make(chan *pooledConn, 3)
+	for i := 0; i < 3; i++ {
+		go func() {
+			conn, _ := manager.acquire("deploy@db:22", false)
+			acquired <- conn
+		}()
+	}
+	for i := 0; i < 2; i++ {
+		select {
+		case <-acquired:
+		case <-time.After(time.Second):
+			t.Fatal("expected two dumps to start")
+		}
+	}
+
+	controlled := make(chan *pooledConn)
+	go func() {
+		conn, _ := manager.acquire("deploy@db:22", true)
+		controlled <- conn
+	}()
+	select {
+	case <-controlled:
+	case <-time.After(time.Second):
+		t.Fatal("expected the control session not to wait for the dumps")
+	}
+	select {
+	case <-acquired:
+		t.Error("expected the third dump to wait")
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestLimitSessions(t *testing.T) {
+	manager := NewConnectionManager()
+	manager.register("deploy@db:22", SSH{}, sshDial(t))
+	var conns []*pooledConn
+	for i := 0; i < 4; i++ {
+		conn, err := manager.acquire("deploy@db:22", false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		conns = append(conns, conn)
+	}
+	if capacity := manager.sessionCapacity("deploy@db:22"); capacity != 0 {
+		t.Errorf("expected no capacity before sshd refused a session, got %d", capacity)
+	}
+	// sshd accepted 2 sessions and refused the third one, while the fourth
+	// is still being opened.
+	manager.opened(conns[0])
+	manager.opened(conns[1])
+	if !manager.limitSessions("deploy@db:22", conns[2]) {
+		t.Fatal("expected the refused session to be retried")
+	}
+	// One of the 2 sessions is kept for control commands.
+	if capacity := manager.sessionCapacity("deploy@db:22"); capacity != 1 {
+		t.Errorf("expected the phases to be held to 1 session, got %d", capacity)
+	}
+	manager.release("deploy@db:22", conns[2])
+	manager.release("deploy@db:22", conns[3])
+
+	acquired := make(chan *pooledConn)
+	go func() {
+		conn, _ := manager.acquire("deploy@db:22", false)
+		acquired <- conn
+	}()
+	select {
+	case <-acquired:
+		t.Fatal("expected the session to wait below the learned limit")
+	case <-time.After(50 * time.Millisecond):
+	}
+	for _, conn := range conns[:2] {
+		manager.closed(conn)
+		manager.release("deploy@db:22", conn)
+	}
+	select {
+	case <-acquired:
+	case <-time.After(time.Second):
+		t.Fatal("expected the session to start once the others ended")
+	}
+
+	single := NewConnectionManager()
+	single.register("deploy@db:22", SSH{}, sshDial(t))
+	conn, _ := single.acquire("deploy@db:22", false)
+	if single.limitSessions("deploy@db:22", conn) {
+		t.Error("expected a refused first session to fail")
+	}
+}
+
+func TestDetectSessionLimit(t *testing.T) {
+	manager := NewConnectionManager()
+	manager.register("deploy@db:22", SSH{MaxOpen: 2}, sshDial(t))
+	manager.detectSessionLimit("deploy@db:22", 4)
+	if capacity := manager.sessionCapacity("deploy@db:22"); capacity != 7 {
+		t.Errorf("expected 2 connections of 4 sessions but a control one, got %d", capacity)
+	}
+	// The limit is only ever lowered.
+	manager.detectSessionLimit("deploy@db:22", 6)
+	if capacity := manager.sessionCapacity("deploy@db:22"); capacity != 7 {
+		t.Errorf("expected the limit to stay, got %d", capacity)
+	}
+}
+
+func TestEvictBrokenConnection(t *testing.T) {
+	manager := NewConnectionManager()
+	manager.register("deploy@db:22", SSH{}, sshDial(t))
+	defer manager.CloseAll()
+	conn, err := manager.acquire("deploy@db:22", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	manager.release("deploy@db:22", conn)
+
+	// The connection drops while idle.
+	conn.client.Close()
+	deadline := time.Now().Add(time.Second)
+	for {
+		manager.mu.Lock()
+		evicted := len(manager.pools["deploy@db:22"].conns) == 0
+		manager.mu.Unlock()
+		if evicted {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("expected the broken connection to be dropped")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	redialed, err := manager.acquire("deploy@db:22", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if redialed == conn {
+		t.Error("expected a new connection")
+	}
+	manager.release("deploy@db:22", redialed)
+}
@@ -0,0 +1,605 @@
+package database
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	. "github.com/timakin/gopli/constants"
+	. "github.com/timakin/gopli/lib"
+)
+
+// PostgreSQL tables are dumped with COPY TO STDOUT and loaded with the
+// \copy of psql, the PostgreSQL counterpart of LOAD DATA LOCAL INFILE. Both
+// use the tab separated text format of the MySQL dumps.
+type PostgreSQLFetcher DBConnector
+type PostgreSQLInserter DBConnector
+
+// psqlClient builds a psql invocation reading SQL from stdin, printing rows
+// as tab separated values without headers like mysqlClient. The password is
+// passed through PGPASSWORD to keep it out of the process list.
+func psqlClient(conn DBConnector, withHost bool) *commandBuilder {
+	return pgClient(newCommandBuilder("psql", "-X", "-q", "-A", "-t", "-F", "\t", "-v", "ON_ERROR_STOP=1"), conn, withHost)
+}
+
+// pgClient adds the connection arguments of conn to a PostgreSQL client.
+func pgClient(builder *commandBuilder, conn DBConnector, withHost bool) *commandBuilder {
+	if conn.User != "" {
+		builder.Arg("-U", conn.User)
+	}
+	if withHost {
+		builder.Arg("-h", conn.Host)
+		if conn.Port != "" {
+			builder.Arg("-p", conn.Port)
+		}
+	}
+	if conn.Password != "" {
+		builder.Env("PGPASSWORD", conn.Password)
+	}
+	return builder.Arg("-d", conn.Name)
+}
+
+// pgQuoteIdentifier quotes a PostgreSQL database, schema or table name.
+func pgQuoteIdentifier(name string) string {
+	return `"` + strings.Replace(name, `"`, `""`, -1) + `"`
+}
+
+// pgQualifiedTable quotes a table of the table list, which leaves the
+// public schema out.
+func pgQualifiedTable(table string) string {
+	parsed := ParseTableName(table)
+	if parsed.Schema == "" {
+		parsed.Schema = PG_DEFAULT_SCHEMA
+	}
+	return pgQuoteIdentifier(parsed.Schema) + "." + pgQuoteIdentifier(parsed.Name)
+}
+
+// pgEscapeString escapes s for use inside a single-quoted SQL string literal
+// with standard_conforming_strings on.
+func pgEscapeString(s string) string {
+	return strings.Replace(s, "'", "''", -1)
+}
+
+func pgColumnList(columns []string) string {
+	quoted := make([]string, len(columns))
+	for i, column := range columns {
+		quoted[i] = pgQuoteIdentifier(column)
+	}
+	return strings.Join(quoted, ", ")
+}
+
+// unsupportedOnPostgreSQL is returned by the operations only MySQL hosts
+// support so far.
+func unsupportedOnPostgreSQL(operation string) error {
+	return fmt.Errorf("%s is not supported for PostgreSQL", operation)
+}
+
+// pgQuery runs a query on the host of conn and returns its output.
+func pgQuery(conn DBConnector, query string) (string, error) {
+	var out, stderr bytes.Buffer
+	cmd := psqlClient(conn, conn.IsContainer).Stdin(strings.NewReader(query)).Command()
+	cmd.Stdout = &out
+	cmd.Stderr = &stderr
+	if err := conn.Runner.Run(cmd); err != nil {
+		return "", fmt.Errorf("%v: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return out.String(), nil
+}
+
+// Ping checks that the database can be reached and queried.
+func (fetcher *PostgreSQLFetcher) Ping() error {
+	_, err := pgQuery(DBConnector(*fetcher), PING_QUERY)
+	return err
+}
+
+func (fetcher *PostgreSQLFetcher) Fetch() error {
+	if err := fetcher.checkFetchOptions(); err != nil {
+		return err
+	}
+	tables, err := fetchTableList(DBConnector(*fetcher))
+	if err != nil {
+		return err
+	}
+	if fetcher.FetchOptions.KnownChecksums != nil {
+		if checksums := sourceChecksums(DBConnector(*fetcher), tables); checksums != nil {
+			if tables, err = dropUnchanged(DBConnector(*fetcher), tables, checksums); err != nil {
+				return err
+			}
+		}
+	}
+	dumps := make(map[string]tableDump)
+	for _, table := range tables {
+		dumps[table] = tableDump{columns: selectedColumns(fetcher.FetchOptions.Columns, table)}
+	}
+	return fetchTables(DBConnector(*fetcher), tables, dumps, nil, nil)
+}
+
+// checkFetchOptions fails on the fetch options only MySQL sources support.
+// COPY dumps whole tables in a single statement, which can't be cached by
+// checksum, limited to partitions, compressed on the source host or killed
+// by its marker.
+func (fetcher *PostgreSQLFetcher) checkFetchOptions() error {
+	opts := fetcher.FetchOptions
+	switch {
+	case opts.Cache != nil:
+		return unsupportedOnPostgreSQL("the dump cache")
+	case opts.RecentPartitions > 0:
+		return unsupportedOnPostgreSQL("--recent-partitions")
+	case opts.OrderByPK:
+		return unsupportedOnPostgreSQL("--order-by-pk")
+	case opts.Compression != "" && opts.Compression != COMPRESSION_NONE:
+		return unsupportedOnPostgreSQL("compression")
+	case opts.DumpTool == DUMP_TOOL_MYSQLSH:
+		return unsupportedOnPostgreSQL("dump_tool " + DUMP_TOOL_MYSQLSH)
+	case fetcher.DumpTimeout > 0:
+		return unsupportedOnPostgreSQL("dump_timeout")
+	}
+	return nil
+}
+
+// listTables lists the tables of every schema but the system ones. Tables
+// of the public schema are listed without it.
+func (fetcher *PostgreSQLFetcher) listTables() ([]byte, error) {
+	out, err := pgQuery(DBConnector(*fetcher), PG_LIST_TABLES_QUERY)
+	if err != nil {
+		return nil, err
+	}
+	wanted := make(map[string]bool)
+	for _, table := range fetcher.FetchOptions.Tables {
+		wanted[TableKey(table)] = true
+	}
+
+	var tableList bytes.Buffer
+	for _, row := range strings.Split(strings.TrimSuffix(out, "\n"), "\n") {
+		columns := strings.Split(row, "\t")
+		if len(columns) != 2 {
+			continue
+		}
+		table := TableName{Schema: columns[0], Name: columns[1]}
+		if table.Schema == PG_DEFAULT_SCHEMA {
+			table.Schema = ""
+		}
+		if len(wanted) > 0 && !wanted[TableKey(table.String())] {
+			continue
+		}
+		if IsFilteredOut(fetcher.FetchOptions.Filter, table.String()) {
+			fetcher.FetchOptions.Stats.Exclude(table.String(), PLAN_REASON_FILTERED)
+			continue
+		}
+		class := TableClass(fetcher.FetchOptions.Filter, table.String())
+		if class != "" {
+			fetcher.FetchOptions.Stats.Classify(table.String(), class)
+		}
+		if class == TABLE_CLASS_SCHEMA_ONLY {
+			log.Printf("\t[Fetch] skipping %s, its data is not synced", table)
+			fetcher.FetchOptions.Stats.Exclude(table.String(), PLAN_REASON_SCHEMA_ONLY)
+			continue
+		}
+		tableList.WriteString(table.String() + "\n")
+	}
+	return tableList.Bytes(), nil
+}
+
+// TableStats returns the estimated row count and data size of every table.
+func (fetcher *PostgreSQLFetcher) TableStats() ([]TableStat, error) {
+	return pgTableStats(DBConnector(*fetcher))
+}
+
+func pgTableStats(conn DBConnector) ([]TableStat, error) {
+	out, err := pgQuery(conn, PG_TABLE_STATS_QUERY)
+	if err != nil {
+		return nil, err
+	}
+	var stats []TableStat
+	for _, line := range strings.Split(out, "\n") {
+		columns := strings.Split(line, "\t")
+		if len(columns) != 4 {
+			continue
+		}
+		table := TableName{Schema: columns[0], Name: columns[1]}
+		if table.Schema == PG_DEFAULT_SCHEMA {
+			table.Schema = ""
+		}
+		rows, _ := strconv.ParseInt(columns[2], 10, 64)
+		size, _ := strconv.ParseInt(columns[3], 10, 64)
+		stats = append(stats, TableStat{Name: table.String(), Rows: rows, Bytes: size})
+	}
+	return stats, nil
+}
+
+// SchemaFingerprint returns a hash of the column definitions of every table,
+// which changes whenever the schema does.
+func (fetcher *PostgreSQLFetcher) SchemaFingerprint() (string, error) {
+	out, err := pgQuery(DBConnector(*fetcher), PG_SCHEMA_FINGERPRINT_QUERY)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(out), nil
+}
+
+// Schema returns the columns of every table. PostgreSQL CHECK constraints
+// are not compared.
+func (fetcher *PostgreSQLFetcher) Schema() (*Schema, error) {
+	out, err := pgQuery(DBConnector(*fetcher), PG_SCHEMA_COLUMNS_QUERY)
+	if err != nil {
+		return nil, err
+	}
+	var columns []Column
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.Split(line, "\t")
+		if len(fields) != 7 {
+			continue
+		}
+		table := TableName{Schema: fields[0], Name: fields[1]}
+		if table.Schema == PG_DEFAULT_SCHEMA {
+			table.Schema = ""
+		}
+		column := Column{Table: table.String(), Name: fields[2], Type: fields[3], Nullable: fields[4] == "t"}
+		if fields[5] == "f" {
+			value := fields[6]
+			column.Default = &value
+		}
+		columns = append(columns, column)
+	}
+	return &Schema{Columns: columns}, nil
+}
+
+// SchemaDDL generates the statements turning the destination schema into
+// the source one. Missing tables are created as pg_dump dumps them.
+func (fetcher *PostgreSQLFetcher) SchemaDDL(diff *SchemaDiff) ([]DDLStatement, error) {
+	var statements []DDLStatement
+	for _, table := range diff.MissingTables {
+		statement, err := fetcher.createTableStatement(table)
+		if err != nil {
+			return nil, err
+		}
+		statements = append(statements, DDLStatement{SQL: statement})
+	}
+	for _, table := range diff.ChangedTables {
+		var clauses []string
+		for _, change := range diff.Changes[table] {
+			column := pgQuoteIdentifier(change.Column.Name)
+			switch change.Action {
+			case COLUMN_ADD:
+				clauses = append(clauses, "ADD COLUMN "+pgColumnDefinition(change.Column))
+			case COLUMN_MODIFY:
+				clauses = append(clauses, "ALTER COLUMN "+column+" TYPE "+change.Column.Type)
+				if change.Column.Nullable {
+					clauses = append(clauses, "ALTER COLUMN "+column+" DROP NOT NULL")
+				} else {
+					clauses = append(clauses, "ALTER COLUMN "+column+" SET NOT NULL")
+				}
+				if change.Column.Default == nil {
+					clauses = append(clauses, "ALTER COLUMN "+column+" DROP DEFAULT")
+				} else {
+					clauses = append(clauses, "ALTER COLUMN "+column+" SET DEFAULT "+*change.Column.Default)
+				}
+			case COLUMN_DROP:
+				clauses = append(clauses, "DROP COLUMN "+column)
+			}
+		}
+		if len(clauses) > 0 {
+			statements = append(statements, DDLStatement{
+				SQL:   "ALTER TABLE " + pgQualifiedTable(table) + "\n  " + strings.Join(clauses, ",\n  ") + ";",
+				Table: table,
+				Alter: strings.Join(clauses, ", "),
+			})
+		}
+	}
+	statements = append(statements, extraColumnComments(diff)...)
+	for _, table := range diff.ExtraTables {
+		statements = append(statements, DDLStatement{SQL: fmt.Sprintf("-- %s exists only on the destination and is left alone", table)})
+	}
+	return statements, nil
+}
+
+// createTableStatement dumps the definition of table, with its indexes and
+// constraints, through pg_dump on the source host.
+func (fetcher *PostgreSQLFetcher) createTableStatement(table string) (string, error) {
+	builder := newCommandBuilder("pg_dump", "--schema-only", "--no-owner", "--no-privileges", "-t", pgQualifiedTable(table))
+	var out, stderr bytes.Buffer
+	cmd := pgClient(builder, DBConnector(*fetcher), fetcher.IsContainer).Command()
+	cmd.Stdout = &out
+	cmd.Stderr = &stderr
+	if err := fetcher.Runner.Run(cmd); err != nil {
+		return "", fmt.Errorf("failed to dump the definition of %s: %v: %s", table, err, strings.TrimSpace(stderr.String()))
+	}
+	return strings.TrimSpace(out.String()), nil
+}
+
+// pgColumnDefinition is the definition of column in ADD COLUMN.
+func pgColumnDefinition(column Column) string {
+	definition := pgQuoteIdentifier(column.Name) + " " + column.Type
+	if !column.Nullable {
+		definition += " NOT NULL"
+	}
+	if column.Default != nil {
+		definition += " DEFAULT " + *column.Default
+	}
+	return definition
+}
+
+// SampleLoad samples the transactions per second and the connected backends
+// of the source database.
+func (fetcher *PostgreSQLFetcher) SampleLoad(duration time.Duration) (LoadSample, error) {
+	query := fmt.Sprintf(PG_LOAD_STATUS_QUERY_FORMAT, pgEscapeString(fetcher.Name))
+	return sampleLoad(duration, func() (int64, int64, error) {
+		out, err := pgQuery(DBConnector(*fetcher), query)
+		if err != nil {
+			return 0, 0, err
+		}
+		columns := strings.Split(strings.TrimSpace(out), "\t")
+		if len(columns) != 2 {
+			return 0, 0, fmt.Errorf("unexpected pg_stat_database row %q", out)
+		}
+		transactions, err := strconv.ParseInt(columns[0], 10, 64)
+		if err != nil {
+			return 0, 0, err
+		}
+		backends, err := strconv.ParseInt(columns[1], 10, 64)
+		return transactions, backends, err
+	})
+}
+
+// Clean empties every table in a single TRUNCATE, see postgresDialect.
+func (inserter *PostgreSQLInserter) Clean() error {
+	log.Print("[Delete] deleting existing tables...")
+	tables, err := inserter.Workspace.ReadTableList()
+	if err != nil {
+		return err
+	}
+	if len(assignedTables(DBConnector(*inserter), tables)) > 0 {
+		return unsupportedOnPostgreSQL("setting columns while loading")
+	}
+	if len(tables) == 0 {
+		return nil
+	}
+	if inserter.failedDeletes, err = deleteTables(DBConnector(*inserter), [][]string{tables}, nil); err != nil {
+		return err
+	}
+	log.Print("[Delete] completed deleting tables")
+	return nil
+}
+
+// Insert loads the tables referenced by foreign keys before the tables
+// referencing them, as the foreign keys are checked while loading.
+func (inserter *PostgreSQLInserter) Insert() error {
+	log.Print("[Load Infile] start to send fetched contents...")
+	tables, err := inserter.Workspace.ReadTableList()
+	if err != nil {
+		return err
+	}
+	tables = loadableTables(tables, inserter.failedDeletes)
+	references, err := pgForeignKeys(DBConnector(*inserter))
+	if err != nil {
+		return fmt.Errorf("failed to read the foreign keys: %v", err)
+	}
+	for _, level := range referenceLevels(tables, references) {
+		if err := loadTables(DBConnector(*inserter), level, nil, nil); err != nil {
+			return err
+		}
+	}
+	log.Print("[Load Infile] completed sending all contents")
+	return nil
+}
+
+// pgForeignKeys returns the tables every table references by TableKey.
+func pgForeignKeys(conn DBConnector) (map[string][]string, error) {
+	out, err := pgQuery(conn, PG_FOREIGN_KEYS_QUERY)
+	if err != nil {
+		return nil, err
+	}
+	references := make(map[string][]string)
+	for _, row := range strings.Split(out, "\n") {
+		columns := strings.Split(row, "\t")
+		if len(columns) != 4 {
+			continue
+		}
+		table := TableName{Schema: columns[0], Name: columns[1]}
+		referenced := TableName{Schema: columns[2], Name: columns[3]}
+		for _, name := range []*TableName{&table, &referenced} {
+			if name.Schema == PG_DEFAULT_SCHEMA {
+				name.Schema = ""
+			}
+		}
+		key := TableKey(table.String())
+		references[key] = append(references[key], TableKey(referenced.String()))
+	}
+	return references, nil
+}
+
+// referenceLevels splits tables into levels loading one after the other,
+// every table after the tables it references. References to the table
+// itself or to tables outside tables don't order anything. Tables caught in
+// a reference cycle, and the ones referencing them, make up the last level.
+func referenceLevels(tables []string, references map[string][]string) [][]string {
+	pending := make(map[string]bool)
+	for _, table := range tables {
+		pending[TableKey(table)] = true
+	}
+	var levels [][]string
+	for len(pending) > 0 {
+		var level []string
+		for _, table := range tables {
+			key := TableKey(table)
+			if !pending[key] {
+				continue
+			}
+			ready := true
+			for _, referenced := range references[key] {
+				if referenced != key && pending[referenced] {
+					ready = false
+					break
+				}
+			}
+			if ready {
+				level = append(level, table)
+			}
+		}
+		if len(level) == 0 {
+			for _, table := range tables {
+				if pending[TableKey(table)] {
+					level = append(level, table)
+				}
+			}
+			log.Print("\t[Load Infile] " + strings.Join(level, ", ") + " reference each other, loading them together")
+		}
+		for _, table := range level {
+			delete(pending, TableKey(table))
+		}
+		levels = append(levels, level)
+	}
+	return levels
+}
+
+// runStatement runs SQL, including psql meta-commands reading local files,
+// on the destination from this machine.
+func (inserter *PostgreSQLInserter) runStatement(statement string) error {
+	cmd := psqlClient(DBConnector(*inserter), inserter.IsContainer || !isLocalHost(inserter.Host)).
+		Stdin(strings.NewReader(statement)).
+		LocalCommand()
+	cmd.Stdout = ioutil.Discard
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := inserter.LocalRunner.Run(cmd); err != nil {
+		return fmt.Errorf("%v: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
+
+// TableChecksums returns the md5 of the sorted rows of the tables that exist
+// on the destination.
+func (inserter *PostgreSQLInserter) TableChecksums(tables []string) (map[string]string, error) {
+	return tableChecksums(DBConnector(*inserter), tables)
+}
+
+// pgTableChecksums returns the md5 of the sorted rows of every table that
+// exists, as PostgreSQL has no CHECKSUM TABLE. It reads the whole tables, but
+// hashes them in chunks of rows, as a single value can't exceed 1GB.
+func pgTableChecksums(conn DBConnector, tables []string) (map[string]string, error) {
+	out, err := pgQuery(conn, PG_LIST_TABLES_QUERY)
+	if err != nil {
+		return nil, err
+	}
+	existing := make(map[string]bool)
+	for _, row := range strings.Split(out, "\n") {
+		columns := strings.Split(row, "\t")
+		if len(columns) == 2 {
+			existing[pgQuoteIdentifier(columns[0])+"."+pgQuoteIdentifier(columns[1])] = true
+		}
+	}
+
+	checksums := make(map[string]string)
+	for _, table := range tables {
+		if !existing[pgQualifiedTable(table)] {
+			continue
+		}
+		out, err := pgQuery(conn, fmt.Sprintf(PG_TABLE_HASH_QUERY_FORMAT, pgQualifiedTable(table)))
+		if err != nil {
+			return nil, fmt.Errorf("failed to checksum %s: %v", table, err)
+		}
+		checksums[table] = strings.TrimSpace(out)
+	}
+	return checksums, nil
+}
+
+// Doctor has nothing to check on PostgreSQL, whose loads change no global
+// or table settings.
+func (inserter *PostgreSQLInserter) Doctor() ([]string, error) {
+	return nil, nil
+}
+
+func (inserter *PostgreSQLInserter) StartMaintenance() (end func(), err error) {
+	if inserter.MaintenanceOn == "" {
+		return func() {}, nil
+	}
+	log.Print("[Maintenance] setting the maintenance flag")
+	if err := inserter.runStatement(inserter.MaintenanceOn); err != nil {
+		return nil, err
+	}
+	var once sync.Once
+	clear := func() {
+		once.Do(func() {
+			if err := inserter.runStatement(inserter.MaintenanceOff); err != nil {
+				log.Print("[Maintenance] failed to clear the maintenance flag, run " + inserter.MaintenanceOff + " by hand: " + err.Error())
+				return
+			}
+			log.Print("[Maintenance] cleared the maintenance flag")
+		})
+	}
+	done := deferRestore(clear)
+	return func() {
+		done()
+		clear()
+	}, nil
+}
+
+func (inserter *PostgreSQLInserter) WaitForDrain() error {
+	timeout := inserter.DrainTimeout
+	if timeout <= 0 {
+		timeout = DEFAULT_DRAIN_TIMEOUT_SECONDS
+	}
+	return waitForDrain(DBConnector(*inserter), inserter.DrainMaxConnections, time.Duration(timeout)*time.Second, DRAIN_POLL_INTERVAL_SECONDS*time.Second)
+}
+
+// ApplySeed runs a SQL seed file, or copies a CSV seed file into the table
+// named after it.
+func (inserter *PostgreSQLInserter) ApplySeed(path string) error {
+	if strings.ToLower(filepath.Ext(path)) == SEED_CSV_EXT {
+		// COPY in CSV format accepts both line endings.
+		header, _, err := seedCSVHeader(path)
+		if err != nil {
+			return err
+		}
+		return inserter.runStatement(fmt.Sprintf(PG_COPY_CSV_IN_FORMAT, pgQualifiedTable(SeedTable(path)), pgColumnList(header), pgEscapeString(path)))
+	}
+	query, err := RenderSeed(path, inserter.SeedEnv)
+	if err != nil {
+		return err
+	}
+	return inserter.runStatement(query)
+}
+
+// CreateDatabase creates the destination database unless it exists.
+func (inserter *PostgreSQLInserter) CreateDatabase() error {
+	out, err := pgQuery(inserter.maintenanceConnector(), fmt.Sprintf(PG_DATABASE_EXISTS_QUERY_FORMAT, pgEscapeString(inserter.Name)))
+	if err != nil || strings.TrimSpace(out) != "" {
+		return err
+	}
+	_, err = pgQuery(inserter.maintenanceConnector(), fmt.Sprintf(PG_CREATE_DATABASE_QUERY_FORMAT, pgQuoteIdentifier(inserter.Name)))
+	return err
+}
+
+func (inserter *PostgreSQLInserter) DropDatabase() error {
+	_, err := pgQuery(inserter.maintenanceConnector(), fmt.Sprintf(PG_DROP_DATABASE_QUERY_FORMAT, pgQuoteIdentifier(inserter.Name)))
+	return err
+}
+
+// maintenanceConnector connects to the maintenance database instead, as a
+// database can't be created or dropped from a session using it.
+func (inserter *PostgreSQLInserter) maintenanceConnector() DBConnector {
+	conn := DBConnector(*inserter)
+	conn.Name = PG_MAINTENANCE_DATABASE
+	return conn
+}
+
+// ExecDDL runs the statements one by one. Online schema change tools only
+// support MySQL, so tables are always altered directly.
+func (inserter *PostgreSQLInserter) ExecDDL(statements []DDLStatement, opts DDLOptions) error {
+	for _, statement := range statements {
+		if statement.IsComment() {
+			continue
+		}
+		log.Print("\t[Schema] " + strings.SplitN(statement.SQL, "\n", 2)[0])
+		if _, err := pgQuery(DBConnector(*inserter), statement.SQL); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,236 @@
+package database
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	. "github.com/timakin/gopli/constants"
+	. "github.com/timakin/gopli/lib"
+)
+
+func TestPsqlClient(t *testing.T) {
+	conn := DBConnector{Host: "db.internal", Name: "app", User: "gopli", Password: "secret"}
+	line := psqlClient(conn, true).Command().Line
+	for _, want := range []string{"export PGPASSWORD && 'psql' ", "'-U' 'gopli'", "'-h' 'db.internal'", "'-d' 'app'", "'ON_ERROR_STOP=1'"} {
+		if !strings.Contains(line, want) {
+			t.Errorf("expected %q in %s", want, line)
+		}
+	}
+	if strings.Contains(line, "secret") {
+		t.Errorf("expected the password to stay off the command line, got %s", line)
+	}
+	if strings.Contains(psqlClient(conn, false).Command().Line, "db.internal") {
+		t.Error("expected no host when connecting locally")
+	}
+}
+
+func TestPgQualifiedTable(t *testing.T) {
+	for table, want := range map[string]string{
+		"users":            `"public"."users"`,
+		"audit.events":     `"audit"."events"`,
+		"`odd\"name`":      `"public"."odd""name"`,
+		"audit.`v1.event`": `"audit"."v1.event"`,
+	} {
+		if got := pgQualifiedTable(table); got != want {
+			t.Errorf("pgQualifiedTable(%q) = %s, want %s", table, got, want)
+		}
+	}
+}
+
+func TestPgTableStats(t *testing.T) {
+	runner := &cannedRunner{out: "public\tusers\t1200\t81920\naudit\tevents\t0\t8192\n"}
+	stats, err := tableStats(DBConnector{Runner: runner, ManagementSystem: "postgresql", Name: "app"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stats) != 2 || stats[0].Name != "users" || stats[0].Rows != 1200 || stats[0].Bytes != 81920 || stats[1].Name != "audit.events" {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+}
+
+// copyRunner records the command lines and the input of concurrent psql
+// sessions.
+type copyRunner struct {
+	mu         sync.Mutex
+	lines      []string
+	statements []string
+}
+
+func (runner *copyRunner) Run(cmd *Command) error {
+	statement, err := ioutil.ReadAll(cmd.Stdin)
+	runner.mu.Lock()
+	defer runner.mu.Unlock()
+	runner.lines = append(runner.lines, cmd.Line)
+	runner.statements = append(runner.statements, string(statement))
+	return err
+}
+
+func pgWorkspace(t *testing.T, tables map[string]string) *Workspace {
+	ws, err := NewWorkspace(TMP_DIR_PREFIX, WorkspaceConf{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var tableList []string
+	for table, rows := range tables {
+		writer, err := ws.CreateTable(table)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := io.WriteString(writer, rows); err != nil {
+			t.Fatal(err)
+		}
+		if err := writer.Close(); err != nil {
+			t.Fatal(err)
+		}
+		tableList = append(tableList, table)
+	}
+	sort.Strings(tableList)
+	if err := ws.WriteFile(TABLE_LIST_FILE, []byte(strings.Join(tableList, "\n")+"\n")); err != nil {
+		t.Fatal(err)
+	}
+	return ws
+}
+
+func TestPostgreSQLCleanTruncatesTogether(t *testing.T) {
+	ws := pgWorkspace(t, map[string]string{"users": "1\talice\n", "audit.events": "1\t1\n"})
+	defer ws.Remove()
+	runner := &copyRunner{}
+	inserter := &PostgreSQLInserter{LocalRunner: runner, ManagementSystem: "postgresql", Name: "app", Workspace: ws}
+	if err := inserter.Clean(); err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{`TRUNCATE TABLE "audit"."events", "public"."users";`}
+	if !reflect.DeepEqual(runner.statements, expected) {
+		t.Errorf("expected a single TRUNCATE of every table, got %q", runner.statements)
+	}
+}
+
+func TestPostgreSQLInsertLoadsReferencedTablesFirst(t *testing.T) {
+	ws := pgWorkspace(t, map[string]string{"users": "1\talice\n", "orders": "1\t1\n"})
+	defer ws.Remove()
+	runner := &copyRunner{}
+	foreignKeys := &cannedRunner{out: "public\torders\tpublic\tusers\n"}
+	inserter := &PostgreSQLInserter{Runner: foreignKeys, LocalRunner: runner, ManagementSystem: "postgresql", Name: "app", Workspace: ws}
+	if err := inserter.Insert(); err != nil {
+		t.Fatal(err)
+	}
+	var expected []string
+	for _, table := range []string{"users", "orders"} {
+		expected = append(expected,
+			fmt.Sprintf(PG_DISABLE_TRIGGERS_FORMAT, pgQualifiedTable(table)),
+			fmt.Sprintf(PG_COPY_IN_FORMAT, pgQualifiedTable(table), ws.TablePath(table)),
+			fmt.Sprintf(PG_ENABLE_TRIGGERS_FORMAT, pgQualifiedTable(table)))
+	}
+	if !reflect.DeepEqual(runner.statements, expected) {
+		t.Errorf("expected users to load before the orders referencing it with triggers disabled, got %q", runner.statements)
+	}
+}
+
+func TestPostgreSQLInsertStreamsCompressedDumps(t *testing.T) {
+	ws, err := NewWorkspace(TMP_DIR_PREFIX, WorkspaceConf{CompressDumps: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ws.Remove()
+	if err := ws.WriteTable("users", []byte("1\talice\n")); err != nil {
+		t.Fatal(err)
+	}
+	if err := ws.WriteFile(TABLE_LIST_FILE, []byte("users\n")); err != nil {
+		t.Fatal(err)
+	}
+	runner := &copyRunner{}
+	inserter := &PostgreSQLInserter{Runner: &cannedRunner{}, LocalRunner: runner, ManagementSystem: "postgresql", Name: "app", Workspace: ws}
+	if err := inserter.Insert(); err != nil {
+		t.Fatal(err)
+	}
+	if len(runner.statements) != 3 || runner.statements[1] != "1\talice\n" {
+		t.Fatalf("expected the rows uncompressed on stdin, got %q", runner.statements)
+	}
+	if want := shellQuote(fmt.Sprintf(PG_COPY_STDIN_FORMAT, pgQualifiedTable("users"))); !strings.Contains(runner.lines[1], want) {
+		t.Errorf("expected %s in %s", want, runner.lines[1])
+	}
+	if _, err := os.Stat(strings.TrimSuffix(ws.TableFiles("users")[0], GZIP_FILE_EXT)); !os.IsNotExist(err) {
+		t.Errorf("expected no uncompressed dump on disk, got %v", err)
+	}
+}
+
+func TestReferenceLevels(t *testing.T) {
+	references := map[string][]string{
+		"orders":      {"users", "products"},
+		"users":       {"users"},
+		"order_items": {"orders", "archive.orders"},
+		"a":           {"b"},
+		"b":           {"a"},
+	}
+	levels := referenceLevels([]string{"order_items", "orders", "products", "users", "a", "b"}, references)
+	expected := [][]string{{"products", "users"}, {"orders"}, {"order_items"}, {"a", "b"}}
+	if !reflect.DeepEqual(levels, expected) {
+		t.Errorf("expected %q, got %q", expected, levels)
+	}
+}
+
+func TestPostgreSQLFetchRejectsMySQLOnlyOptions(t *testing.T) {
+	for name, fetcher := range map[string]*PostgreSQLFetcher{
+		"recent partitions": {FetchOptions: FetchOptions{RecentPartitions: 2}},
+		"order by pk":       {FetchOptions: FetchOptions{OrderByPK: true}},
+		"compression":       {FetchOptions: FetchOptions{Compression: COMPRESSION_GZIP}},
+		"dump tool":         {FetchOptions: FetchOptions{DumpTool: DUMP_TOOL_MYSQLSH}},
+		"dump timeout":      {DumpTimeout: 60},
+	} {
+		err := fetcher.Fetch()
+		if err == nil || !strings.Contains(err.Error(), "not supported for PostgreSQL") {
+			t.Errorf("%s: expected the fetch to be refused, got %v", name, err)
+		}
+	}
+	if err := (&PostgreSQLFetcher{FetchOptions: FetchOptions{Compression: COMPRESSION_NONE}}).checkFetchOptions(); err != nil {
+		t.Errorf("expected no compression to be accepted, got %v", err)
+	}
+}
+
+func TestPostgreSQLSchema(t *testing.T) {
+	runner := &cannedRunner{out: "public\tusers\tid\tbigint\tf\tf\tnextval('users_id_seq'::regclass)\npublic\tusers\tname\tcharacter varying(255)\tt\tt\t\naudit\tevents\tid\tinteger\tf\tt\t\n"}
+	fetcher := &PostgreSQLFetcher{Runner: runner, ManagementSystem: "postgresql", Name: "app"}
+	schema, err := fetcher.Schema()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(schema.Columns) != 3 {
+		t.Fatalf("expected 3 columns, got %+v", schema.Columns)
+	}
+	id, name, event := schema.Columns[0], schema.Columns[1], schema.Columns[2]
+	if id.Table != "users" || id.Nullable || id.Default == nil || *id.Default != "nextval('users_id_seq'::regclass)" {
+		t.Errorf("unexpected column %+v", id)
+	}
+	if name.Type != "character varying(255)" || !name.Nullable || name.Default != nil {
+		t.Errorf("unexpected column %+v", name)
+	}
+	if event.Table != "audit.events" {
+		t.Errorf("expected the schema of other schemas, got %+v", event)
+	}
+}
+
+func TestPostgreSQLSchemaDDL(t *testing.T) {
+	value := "'active'::text"
+	diff := &SchemaDiff{
+		ChangedTables: []string{"users"},
+		Changes: map[string][]ColumnChange{"users": {
+			{Action: COLUMN_ADD, Column: Column{Name: "status", Type: "text", Default: &value}},
+			{Action: COLUMN_DROP, Column: Column{Name: "legacy"}},
+		}},
+	}
+	statements, err := (&PostgreSQLFetcher{}).SchemaDDL(diff)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "ALTER TABLE \"public\".\"users\"\n  ADD COLUMN \"status\" text NOT NULL DEFAULT 'active'::text,\n  DROP COLUMN \"legacy\";"
+	if len(statements) != 1 || statements[0].SQL != expected {
+		t.Errorf("expected %q, got %+v", expected, statements)
+	}
+}
@@ -0,0 +1,17 @@
+package database
+
+import (
+	"fmt"
+
+	. "github.com/timakin/gopli/constants"
+)
+
+// CreateDatabase creates the destination database unless it exists.
+func (inserter *MySQLInserter) CreateDatabase() error {
+	return inserter.runStatement(fmt.Sprintf(CREATE_DATABASE_QUERY_FORMAT, quoteIdentifier(inserter.Name)))
+}
+
+// DropDatabase drops the destination database with all its tables.
+func (inserter *MySQLInserter) DropDatabase() error {
+	return inserter.runStatement(fmt.Sprintf(DROP_DATABASE_QUERY_FORMAT, quoteIdentifier(inserter.Name)))
+}
@@ -0,0 +1,13 @@
+package database
+
+import (
+	. "github.com/timakin/gopli/lib"
+)
+
+var progress *Progress
+
+// TrackProgress reports the phase and transferred bytes of every table to p
+// from now on. A nil p stops reporting.
+func TrackProgress(p *Progress) {
+	progress = p
+}
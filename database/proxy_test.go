@@ -0,0 +1,70 @@
+package database
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"testing"
+)
+
+func TestSocks5Connect(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	go func() {
+		defer server.Close()
+		greeting := make([]byte, 4)
+		io.ReadFull(server, greeting)
+		server.Write([]byte{0x05, 0x02})
+		auth := make([]byte, 1+1+4+1+6)
+		io.ReadFull(server, auth)
+		if string(auth[2:6]) != "user" || string(auth[7:]) != "secret" {
+			server.Write([]byte{0x01, 0x01})
+			return
+		}
+		server.Write([]byte{0x01, 0x00})
+		request := make([]byte, 5+len("bastion")+2)
+		io.ReadFull(server, request)
+		if request[3] != 0x03 || string(request[5:12]) != "bastion" || request[12] != 0 || request[13] != 22 {
+			server.Write([]byte{0x05, 0x01, 0x00, 0x01})
+			return
+		}
+		server.Write([]byte{0x05, 0x00, 0x00, 0x01, 127, 0, 0, 1, 0, 22})
+		server.Write([]byte("SSH-2.0-test\r\n"))
+	}()
+
+	if err := socks5Connect(client, "bastion:22", url.UserPassword("user", "secret")); err != nil {
+		t.Fatal(err)
+	}
+	banner, _ := bufio.NewReader(client).ReadString('\n')
+	if banner != "SSH-2.0-test\r\n" {
+		t.Errorf("expected the SSH banner, got %q", banner)
+	}
+}
+
+func TestHTTPConnect(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	go func() {
+		defer server.Close()
+		request, err := http.ReadRequest(bufio.NewReader(server))
+		if err != nil || request.Method != http.MethodConnect || request.Host != "[2001:db8::1]:22" {
+			server.Write([]byte("HTTP/1.1 400 Bad Request\r\n\r\n"))
+			return
+		}
+		// The banner arrives together with the response.
+		server.Write([]byte("HTTP/1.1 200 Connection established\r\n\r\nSSH-2.0-test\r\n"))
+	}()
+
+	conn, err := httpConnect(client, "[2001:db8::1]:22", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var banner bytes.Buffer
+	io.Copy(&banner, conn)
+	if banner.String() != "SSH-2.0-test\r\n" {
+		t.Errorf("expected the SSH banner, got %q", banner.String())
+	}
+}
@@ -0,0 +1,173 @@
+package database
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// workspacePath matches the per-run working directory, whose random name
+// would otherwise make every recorded load command unique.
+var workspacePath = regexp.MustCompile(`[^\s'"]*/db_sync_[^/\s'"]*`)
+
+var (
+	recordDir string
+	replayDir string
+)
+
+// RecordTo makes every runner created afterwards save the commands it runs
+// and their output as fixtures in dir.
+func RecordTo(dir string) error {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	recordDir = dir
+	return nil
+}
+
+// ReplayFrom makes every runner created afterwards answer commands from the
+// fixtures in dir instead of contacting any host.
+func ReplayFrom(dir string) error {
+	if _, err := os.Stat(dir); err != nil {
+		return err
+	}
+	replayDir = dir
+	return nil
+}
+
+// fixture is a recorded command invocation.
+type fixture struct {
+	Line   string `json:"line"`
+	Stdout []byte `json:"stdout"`
+	Stderr []byte `json:"stderr"`
+	Error  string `json:"error,omitempty"`
+}
+
+func withRecorder(runner Runner) Runner {
+	if recordDir == "" {
+		return runner
+	}
+	return &recordingRunner{runner: runner, dir: recordDir}
+}
+
+type recordingRunner struct {
+	runner Runner
+	dir    string
+}
+
+func (recorder *recordingRunner) Run(cmd *Command) error {
+	stdin, err := readStdin(cmd)
+	if err != nil {
+		return err
+	}
+
+	var stdout, stderr bytes.Buffer
+	recorded := *cmd
+	recorded.Stdin = bytes.NewReader(stdin)
+	recorded.Stdout = teeWriter(&stdout, cmd.Stdout)
+	recorded.Stderr = teeWriter(&stderr, cmd.Stderr)
+	runErr := recorder.runner.Run(&recorded)
+
+	f := fixture{Line: cmd.Line, Stdout: stdout.Bytes(), Stderr: stderr.Bytes()}
+	if cmd.Rows {
+		f.Stdout = maskRows(f.Stdout)
+	}
+	if runErr != nil {
+		f.Error = runErr.Error()
+	}
+	fixtureBytes, err := json.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(fixturePath(recorder.dir, cmd, stdin), fixtureBytes, 0600); err != nil {
+		return err
+	}
+	return runErr
+}
+
+type replayRunner struct {
+	dir string
+}
+
+func (replayer *replayRunner) Run(cmd *Command) error {
+	stdin, err := readStdin(cmd)
+	if err != nil {
+		return err
+	}
+	fixtureBytes, err := ioutil.ReadFile(fixturePath(replayer.dir, cmd, stdin))
+	if err != nil {
+		return errors.New("no recorded fixture for command: " + cmd.Line)
+	}
+	var f fixture
+	if err := json.Unmarshal(fixtureBytes, &f); err != nil {
+		return err
+	}
+	if cmd.Stdout != nil {
+		cmd.Stdout.Write(f.Stdout)
+	}
+	if cmd.Stderr != nil {
+		cmd.Stderr.Write(f.Stderr)
+	}
+	if f.Error != "" {
+		return errors.New(f.Error)
+	}
+	return nil
+}
+
+// fixturePath names a fixture after everything that determines the command's
+// output, so identical invocations share a fixture. Passwords are left out,
+// as the names of fixtures shared with others must not reveal them.
+func fixturePath(dir string, cmd *Command, stdin []byte) string {
+	hash := sha1.New()
+	io.WriteString(hash, workspacePath.ReplaceAllString(cmd.Line, "$$WORKSPACE"))
+	for _, env := range cmd.Env {
+		io.WriteString(hash, "\x00"+strings.SplitN(env, "=", 2)[0])
+	}
+	io.WriteString(hash, "\x00")
+	for range cmd.SecretEnv {
+		if end := bytes.IndexByte(stdin, '\n'); end >= 0 {
+			stdin = stdin[end+1:]
+		}
+	}
+	hash.Write(workspacePath.ReplaceAll(stdin, []byte("$$WORKSPACE")))
+	return filepath.Join(dir, hex.EncodeToString(hash.Sum(nil))+".json")
+}
+
+// maskRows replaces every value of tab separated rows with NULL, keeping the
+// rows and columns the replayed phases count.
+func maskRows(out []byte) []byte {
+	var masked bytes.Buffer
+	for _, line := range strings.SplitAfter(string(out), "\n") {
+		if line == "" {
+			continue
+		}
+		row := strings.TrimSuffix(line, "\n")
+		masked.WriteString(strings.Repeat("\\N\t", strings.Count(row, "\t")) + "\\N")
+		if row != line {
+			masked.WriteString("\n")
+		}
+	}
+	return masked.Bytes()
+}
+
+func readStdin(cmd *Command) ([]byte, error) {
+	if cmd.Stdin == nil {
+		return nil, nil
+	}
+	return ioutil.ReadAll(cmd.Stdin)
+}
+
+func teeWriter(buf *bytes.Buffer, w io.Writer) io.Writer {
+	if w == nil {
+		return buf
+	}
+	return io.MultiWriter(buf, w)
+}
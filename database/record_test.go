@@ -0,0 +1,84 @@
+package database
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRecordAndReplay(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gopli_fixtures")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	recorder := &recordingRunner{runner: &localRunner{}, dir: dir}
+	var recorded bytes.Buffer
+	err = recorder.Run(&Command{Line: "cat", Stdin: strings.NewReader("show tables"), Stdout: &recorded})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	replayer := &replayRunner{dir: dir}
+	var replayed bytes.Buffer
+	err = replayer.Run(&Command{Line: "cat", Stdin: strings.NewReader("show tables"), Stdout: &replayed})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if replayed.String() != "show tables" || replayed.String() != recorded.String() {
+		t.Errorf("expected replayed output %q, got %q", recorded.String(), replayed.String())
+	}
+
+	if err := replayer.Run(&Command{Line: "cat", Stdin: strings.NewReader("other input")}); err == nil {
+		t.Error("expected an error for a command without fixture")
+	}
+}
+
+func TestRecordLeavesPasswordsAndRowsOut(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gopli_fixtures")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	dump := func(password string) *Command {
+		cmd := newCommandBuilder("mysql").Env("MYSQL_PWD", password).Stdin(strings.NewReader("SELECT * FROM users")).Command()
+		cmd.Rows = true
+		return cmd
+	}
+	recorder := &recordingRunner{runner: &cannedRunner{out: "1\talice\n2\tbob\\tsmith\n"}, dir: dir}
+	cmd := dump("hunter2")
+	cmd.Stdout = ioutil.Discard
+	if err := recorder.Run(cmd); err != nil {
+		t.Fatal(err)
+	}
+
+	files, err := ioutil.ReadDir(dir)
+	if err != nil || len(files) != 1 {
+		t.Fatalf("expected a single fixture, got %v, %v", files, err)
+	}
+	recorded, err := ioutil.ReadFile(filepath.Join(dir, files[0].Name()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, secret := range []string{"hunter2", "alice", "bob"} {
+		if strings.Contains(string(recorded), secret) {
+			t.Errorf("expected %q to be left out of %s", secret, recorded)
+		}
+	}
+
+	// Replaying with another password finds the same fixture.
+	var replayed bytes.Buffer
+	cmd = dump("changed")
+	cmd.Stdout = &replayed
+	if err := (&replayRunner{dir: dir}).Run(cmd); err != nil {
+		t.Fatal(err)
+	}
+	if replayed.String() != "\\N\t\\N\n\\N\t\\N\n" {
+		t.Errorf("expected the rows and columns without their values, got %q", replayed.String())
+	}
+}
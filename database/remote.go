@@ -0,0 +1,58 @@
+package database
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"path"
+	"strings"
+
+	. "github.com/timakin/gopli/constants"
+)
+
+// remoteWorkspace is the working directory of a phase on a host, for tools
+// writing files there rather than to stdout. clean only looks for local
+// directories, so it is removed on Close, or by RestoreDestinations when the
+// run is interrupted before.
+type remoteWorkspace struct {
+	runner Runner
+	Path   string
+	files  []string
+	done   func()
+}
+
+// newRemoteWorkspace creates a directory only the user commands run as can
+// access, under the temp dir of the host.
+func newRemoteWorkspace(runner Runner) (*remoteWorkspace, error) {
+	var out, stderr bytes.Buffer
+	cmd := &Command{Line: `umask 077 && mktemp -d "${TMPDIR:-/tmp}/` + TMP_DIR_PREFIX + `XXXXXX"`, Stdout: &out, Stderr: &stderr}
+	if err := runner.Run(cmd); err != nil {
+		return nil, fmt.Errorf("failed to create a remote working directory: %v: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	dir := strings.TrimSpace(out.String())
+	if !path.IsAbs(dir) {
+		return nil, fmt.Errorf("failed to create a remote working directory: unexpected path %q", dir)
+	}
+	ws := &remoteWorkspace{runner: runner, Path: dir}
+	ws.done = deferRestore(ws.remove)
+	return ws, nil
+}
+
+// File returns the path of a file in the directory and tracks it until Close.
+func (ws *remoteWorkspace) File(name string) string {
+	ws.files = append(ws.files, name)
+	return path.Join(ws.Path, name)
+}
+
+// Close removes the directory with every file in it, whether tracked or not.
+// Failures are logged, since they must not hide the error of the phase.
+func (ws *remoteWorkspace) Close() {
+	ws.done()
+	ws.remove()
+}
+
+func (ws *remoteWorkspace) remove() {
+	if err := ws.runner.Run(&Command{Line: "rm -rf " + shellQuote(ws.Path)}); err != nil {
+		log.Printf("[Clean] failed to remove the remote working directory %s (%d files): %v", ws.Path, len(ws.files), err)
+	}
+}
@@ -0,0 +1,37 @@
+package database
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestRemoteWorkspace(t *testing.T) {
+	remote, err := newRemoteWorkspace(&localRunner{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(remote.Path)
+	if err != nil || info.Mode().Perm() != 0700 {
+		t.Fatalf("expected a private directory, got %v (%v)", info, err)
+	}
+	if err := ioutil.WriteFile(remote.File("dump"), []byte("data"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	remote.Close()
+	if _, err := os.Stat(remote.Path); !os.IsNotExist(err) {
+		t.Errorf("expected %s to be removed, got %v", remote.Path, err)
+	}
+}
+
+func TestRemoteWorkspaceRemovedOnInterrupt(t *testing.T) {
+	remote, err := newRemoteWorkspace(&localRunner{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The run is interrupted before the phase closes the directory.
+	RestoreDestinations()
+	if _, err := os.Stat(remote.Path); !os.IsNotExist(err) {
+		t.Errorf("expected %s to be removed, got %v", remote.Path, err)
+	}
+}
@@ -0,0 +1,132 @@
+package database
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+
+	. "github.com/timakin/gopli/constants"
+)
+
+// pendingRestores holds what has to be undone on destinations when a run
+// stops in the middle of a load. Session variables need nothing, as every
+// load runs in its own session, but disabled MyISAM keys stay disabled.
+// Remote working directories are removed this way too.
+var pendingRestores = struct {
+	sync.Mutex
+	next  int
+	funcs map[int]func()
+}{funcs: make(map[int]func())}
+
+// deferRestore registers restore until the returned function is called.
+func deferRestore(restore func()) (done func()) {
+	pendingRestores.Lock()
+	defer pendingRestores.Unlock()
+	id := pendingRestores.next
+	pendingRestores.next++
+	pendingRestores.funcs[id] = restore
+	return func() {
+		pendingRestores.Lock()
+		defer pendingRestores.Unlock()
+		delete(pendingRestores.funcs, id)
+	}
+}
+
+// RestoreDestinations undoes the pending changes to destinations, e.g.
+// when a run is cancelled or fails during a load.
+func RestoreDestinations() {
+	pendingRestores.Lock()
+	funcs := pendingRestores.funcs
+	pendingRestores.funcs = make(map[int]func())
+	pendingRestores.Unlock()
+	for _, restore := range funcs {
+		restore()
+	}
+}
+
+// disabledKeys returns the MyISAM tables whose keys are disabled.
+func disabledKeys(conn DBConnector) ([]string, error) {
+	query := fmt.Sprintf(DISABLED_KEYS_QUERY_FORMAT, escapeString(conn.Name))
+	var out bytes.Buffer
+	client, err := mysqlClient(conn, conn.IsContainer)
+	if err != nil {
+		return nil, err
+	}
+	cmd := client.Stdin(strings.NewReader(query)).Command()
+	cmd.Stdout = &out
+	if err := conn.Runner.Run(cmd); err != nil {
+		return nil, err
+	}
+	var tables []string
+	for _, line := range strings.Split(out.String(), "\n") {
+		if line != "" {
+			tables = append(tables, unescapeBatchValue(line))
+		}
+	}
+	return tables, nil
+}
+
+// verifyKeysEnabled checks that the keys of the loaded tables were enabled
+// again, retrying once for those that were not.
+func (inserter *MySQLInserter) verifyKeysEnabled(tables []string) error {
+	disabled, err := disabledKeys(DBConnector(*inserter))
+	if err != nil {
+		log.Print("[Load Infile] failed to verify the keys of MyISAM tables: " + err.Error())
+		return nil
+	}
+	var leaked []string
+	for _, table := range disabled {
+		if !containsString(tables, table) {
+			continue
+		}
+		inserter.alterKeys(ENABLE_KEYS_QUERY_FORMAT, table)
+		leaked = append(leaked, table)
+	}
+	if len(leaked) == 0 {
+		return nil
+	}
+	if disabled, err = disabledKeys(DBConnector(*inserter)); err != nil {
+		return err
+	}
+	for _, table := range leaked {
+		if containsString(disabled, table) {
+			return fmt.Errorf("keys of %s are still disabled, enable them with "+ENABLE_KEYS_QUERY_FORMAT, table, qualifiedTable(inserter.Name, table))
+		}
+	}
+	return nil
+}
+
+// Doctor looks for settings a load may have left behind on the destination:
+// disabled MyISAM keys, and checks turned off globally instead of per
+// session.
+func (inserter *MySQLInserter) Doctor() ([]string, error) {
+	conn := DBConnector(*inserter)
+	var problems []string
+	disabled, err := disabledKeys(conn)
+	if err != nil {
+		return nil, err
+	}
+	for _, table := range disabled {
+		problems = append(problems, fmt.Sprintf("keys of %s are disabled, enable them with "+ENABLE_KEYS_QUERY_FORMAT, table, qualifiedTable(inserter.Name, table)))
+	}
+
+	var out bytes.Buffer
+	client, err := mysqlClient(conn, conn.IsContainer)
+	if err != nil {
+		return nil, err
+	}
+	cmd := client.Stdin(strings.NewReader(GLOBAL_SETTINGS_QUERY)).Command()
+	cmd.Stdout = &out
+	if err := conn.Runner.Run(cmd); err != nil {
+		return nil, err
+	}
+	for _, line := range strings.Split(out.String(), "\n") {
+		fields := strings.Split(line, "\t")
+		if len(fields) == 2 && fields[1] != "1" {
+			problems = append(problems, fmt.Sprintf("%s is off globally, turn it on with SET GLOBAL %s = 1", fields[0], fields[0]))
+		}
+	}
+	return problems, nil
+}
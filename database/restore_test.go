@@ -0,0 +1,19 @@
+package database
+
+import "testing"
+
+func TestRestoreDestinations(t *testing.T) {
+	var restored []string
+	done := deferRestore(func() { restored = append(restored, "users") })
+	deferRestore(func() { restored = append(restored, "posts") })
+	done()
+
+	RestoreDestinations()
+	if len(restored) != 1 || restored[0] != "posts" {
+		t.Errorf("expected only the pending restore to run, got %v", restored)
+	}
+	RestoreDestinations()
+	if len(restored) != 1 {
+		t.Errorf("expected restores to run once, got %v", restored)
+	}
+}
@@ -0,0 +1,550 @@
+package database
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"strings"
+
+	. "github.com/timakin/gopli/constants"
+	. "github.com/timakin/gopli/lib"
+)
+
+// Columns returns the column definitions of every table. Definitions read
+// from MariaDB are converted to the form MySQL reports them in, so schemas of
+// both compare equal.
+func (fetcher *MySQLFetcher) Columns() ([]Column, error) {
+	flavor, err := serverFlavor(DBConnector(*fetcher))
+	if err != nil {
+		return nil, err
+	}
+
+	query := fmt.Sprintf(SCHEMA_COLUMNS_QUERY_FORMAT, escapeString(fetcher.Name))
+
+	var out bytes.Buffer
+	client, err := mysqlClient(DBConnector(*fetcher), fetcher.IsContainer)
+	if err != nil {
+		return nil, err
+	}
+	cmd := client.Stdin(strings.NewReader(query)).Command()
+	cmd.Stdout = &out
+	if err := fetcher.Runner.Run(cmd); err != nil {
+		return nil, err
+	}
+
+	var columns []Column
+	for _, line := range strings.Split(out.String(), "\n") {
+		fields := strings.Split(line, "\t")
+		if len(fields) != 7 {
+			continue
+		}
+		column := Column{
+			Table:    TableName{Name: unescapeBatchValue(fields[0])}.String(),
+			Name:     unescapeBatchValue(fields[1]),
+			Type:     unescapeBatchValue(fields[2]),
+			Nullable: fields[3] == "YES",
+			Extra:    unescapeBatchValue(fields[6]),
+		}
+		if fields[4] == "0" {
+			value := unescapeBatchValue(fields[5])
+			column.Default = &value
+		}
+		if flavor == FLAVOR_MARIADB {
+			column = mariaDBColumn(column)
+		}
+		columns = append(columns, column)
+	}
+	return columns, nil
+}
+
+// mariaDBColumn converts a column read from MariaDB, which quotes string
+// defaults, reports a NULL default as the string NULL and spells
+// CURRENT_TIMESTAMP as current_timestamp(), to the form MySQL reports.
+func mariaDBColumn(column Column) Column {
+	column.Extra = strings.Replace(column.Extra, "current_timestamp()", "CURRENT_TIMESTAMP", -1)
+	if column.Default == nil {
+		return column
+	}
+	value := *column.Default
+	switch {
+	case value == "NULL":
+		column.Default = nil
+		return column
+	case len(value) >= 2 && strings.HasPrefix(value, "'") && strings.HasSuffix(value, "'"):
+		value = strings.Replace(value[1:len(value)-1], "''", "'", -1)
+	case strings.EqualFold(value, "current_timestamp()"):
+		value = "CURRENT_TIMESTAMP"
+	case strings.HasPrefix(strings.ToLower(value), "current_timestamp("):
+		value = strings.ToUpper(value)
+	}
+	column.Default = &value
+	return column
+}
+
+// Schema returns the columns and CHECK constraints of every table.
+func (fetcher *MySQLFetcher) Schema() (*Schema, error) {
+	columns, err := fetcher.Columns()
+	if err != nil {
+		return nil, err
+	}
+	checks, err := fetcher.CheckConstraints()
+	if err != nil {
+		// Servers before MySQL 8.0.16 have no CHECK constraints to compare.
+		log.Print("[Schema] no CHECK constraints on " + fetcher.Name + ": " + err.Error())
+	}
+	return &Schema{Columns: columns, Checks: checks}, nil
+}
+
+// CheckConstraints returns the CHECK constraints of every table.
+func (fetcher *MySQLFetcher) CheckConstraints() ([]CheckConstraint, error) {
+	query := fmt.Sprintf(CHECK_CONSTRAINTS_QUERY_FORMAT, escapeString(fetcher.Name))
+
+	var out bytes.Buffer
+	client, err := mysqlClient(DBConnector(*fetcher), fetcher.IsContainer)
+	if err != nil {
+		return nil, err
+	}
+	cmd := client.Stdin(strings.NewReader(query)).Command()
+	cmd.Stdout = &out
+	if err := fetcher.Runner.Run(cmd); err != nil {
+		return nil, err
+	}
+
+	var checks []CheckConstraint
+	for _, line := range strings.Split(out.String(), "\n") {
+		fields := strings.Split(line, "\t")
+		if len(fields) != 3 {
+			continue
+		}
+		checks = append(checks, CheckConstraint{
+			Table:  TableName{Name: unescapeBatchValue(fields[0])}.String(),
+			Name:   unescapeBatchValue(fields[1]),
+			Clause: unescapeBatchValue(fields[2]),
+		})
+	}
+	return checks, nil
+}
+
+// Partitions returns the partitions of every partitioned table, in order.
+// Partitions bounded by MAXVALUE only catch rows beyond the last range, so
+// they are left out.
+func (fetcher *MySQLFetcher) Partitions() (map[string][]string, error) {
+	query := fmt.Sprintf(PARTITIONS_QUERY_FORMAT, escapeString(fetcher.Name))
+
+	var out bytes.Buffer
+	client, err := mysqlClient(DBConnector(*fetcher), fetcher.IsContainer)
+	if err != nil {
+		return nil, err
+	}
+	cmd := client.Stdin(strings.NewReader(query)).Command()
+	cmd.Stdout = &out
+	if err := fetcher.Runner.Run(cmd); err != nil {
+		return nil, err
+	}
+	return parsePartitions(out.String()), nil
+}
+
+func parsePartitions(out string) map[string][]string {
+	partitions := make(map[string][]string)
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.Split(line, "\t")
+		if len(fields) != 4 {
+			continue
+		}
+		if maxValuePartition(unescapeBatchValue(fields[3])) {
+			continue
+		}
+		table := TableName{Name: unescapeBatchValue(fields[0])}.String()
+		partitions[table] = append(partitions[table], unescapeBatchValue(fields[1]))
+	}
+	return partitions
+}
+
+// maxValuePartition reports whether a partition description is bounded by
+// MAXVALUE, e.g. "MAXVALUE" or "'2024-01-01',MAXVALUE" for RANGE COLUMNS.
+func maxValuePartition(description string) bool {
+	for _, bound := range strings.Split(description, ",") {
+		if strings.TrimSpace(bound) == "MAXVALUE" {
+			return true
+		}
+	}
+	return false
+}
+
+// PrimaryKeys returns the primary key columns of every table having one, in
+// index order.
+func (fetcher *MySQLFetcher) PrimaryKeys() (map[string][]string, error) {
+	return primaryKeys(DBConnector(*fetcher))
+}
+
+func primaryKeys(conn DBConnector) (map[string][]string, error) {
+	query := fmt.Sprintf(PRIMARY_KEYS_QUERY_FORMAT, escapeString(conn.Name))
+
+	var out bytes.Buffer
+	client, err := mysqlClient(conn, conn.IsContainer)
+	if err != nil {
+		return nil, err
+	}
+	cmd := client.Stdin(strings.NewReader(query)).Command()
+	cmd.Stdout = &out
+	if err := conn.Runner.Run(cmd); err != nil {
+		return nil, err
+	}
+
+	primaryKeys := make(map[string][]string)
+	for _, line := range strings.Split(out.String(), "\n") {
+		fields := strings.Split(line, "\t")
+		if len(fields) != 2 {
+			continue
+		}
+		table := TableName{Name: unescapeBatchValue(fields[0])}.String()
+		primaryKeys[table] = append(primaryKeys[table], unescapeBatchValue(fields[1]))
+	}
+	return primaryKeys, nil
+}
+
+// tableColumns runs a query listing the table_schema, table_name and
+// column_name of columns, and returns the columns by table.
+func tableColumns(conn DBConnector, query string) (map[string][]string, error) {
+	var out bytes.Buffer
+	client, err := mysqlClient(conn, conn.IsContainer)
+	if err != nil {
+		return nil, err
+	}
+	cmd := client.Stdin(strings.NewReader(query)).Command()
+	cmd.Stdout = &out
+	if err := conn.Runner.Run(cmd); err != nil {
+		return nil, err
+	}
+
+	columns := make(map[string][]string)
+	for _, line := range strings.Split(out.String(), "\n") {
+		fields := strings.Split(line, "\t")
+		if len(fields) != 3 {
+			continue
+		}
+		table := TableName{Schema: unescapeBatchValue(fields[0]), Name: unescapeBatchValue(fields[1])}
+		if table.Schema == conn.Name {
+			table.Schema = ""
+		}
+		columns[table.String()] = append(columns[table.String()], unescapeBatchValue(fields[2]))
+	}
+	return columns, nil
+}
+
+// keylessTables returns the tables without a primary key. primaryKeys only
+// covers the database of the connection, so tables qualified with another
+// schema are never reported.
+func keylessTables(tables []string, primaryKeys map[string][]string) []string {
+	var keyless []string
+	for _, table := range tables {
+		if ParseTableName(table).Schema == "" && len(primaryKeys[table]) == 0 {
+			keyless = append(keyless, table)
+		}
+	}
+	return keyless
+}
+
+// recentPartitions returns the last n of partitions, which are the most
+// recent ones of tables partitioned by time.
+func recentPartitions(partitions []string, n int) []string {
+	if n <= 0 || len(partitions) <= n {
+		return nil
+	}
+	return partitions[len(partitions)-n:]
+}
+
+// CreateTableStatement returns the CREATE TABLE statement of table.
+func (fetcher *MySQLFetcher) CreateTableStatement(table string) (string, error) {
+	query := fmt.Sprintf(SHOW_CREATE_TABLE_QUERY_FORMAT, qualifiedTable(fetcher.Name, table))
+
+	var out bytes.Buffer
+	client, err := mysqlClient(DBConnector(*fetcher), fetcher.IsContainer)
+	if err != nil {
+		return "", err
+	}
+	cmd := client.Arg("--raw").Stdin(strings.NewReader(query)).Command()
+	cmd.Stdout = &out
+	if err := fetcher.Runner.Run(cmd); err != nil {
+		return "", err
+	}
+	// The output is the table name and the statement, separated by a tab.
+	fields := strings.SplitN(strings.TrimSpace(out.String()), "\t", 2)
+	if len(fields) != 2 {
+		return "", fmt.Errorf("unexpected SHOW CREATE TABLE output for %s", table)
+	}
+	return fields[1] + ";", nil
+}
+
+// SchemaDDL renders the statements bringing a destination in line with this
+// source. Tables are not qualified with a database name, so the statements
+// fit into the destination's migrations.
+func (fetcher *MySQLFetcher) SchemaDDL(diff *SchemaDiff) ([]DDLStatement, error) {
+	var statements []DDLStatement
+	for _, table := range diff.MissingTables {
+		statement, err := fetcher.CreateTableStatement(table)
+		if err != nil {
+			return nil, err
+		}
+		statements = append(statements, DDLStatement{SQL: statement})
+	}
+	for _, table := range diff.ChangedTables {
+		var clauses []string
+		for _, change := range diff.Changes[table] {
+			if change.Column.Generated() && change.Action != COLUMN_DROP {
+				statements = append(statements, DDLStatement{SQL: fmt.Sprintf("-- %s.%s is a generated column and has to be changed by hand", table, change.Column.Name)})
+				continue
+			}
+			switch change.Action {
+			case COLUMN_ADD:
+				clause := "ADD COLUMN " + columnDefinition(change.Column)
+				if change.After == "" {
+					clause += " FIRST"
+				} else {
+					clause += " AFTER " + quoteIdentifier(change.After)
+				}
+				clauses = append(clauses, clause)
+			case COLUMN_MODIFY:
+				clauses = append(clauses, "MODIFY COLUMN "+columnDefinition(change.Column))
+			case COLUMN_DROP:
+				clauses = append(clauses, "DROP COLUMN "+quoteIdentifier(change.Column.Name))
+			}
+		}
+		for _, change := range diff.CheckChanges[table] {
+			switch change.Action {
+			case COLUMN_ADD:
+				clauses = append(clauses, "ADD CONSTRAINT "+quoteIdentifier(change.Check.Name)+" CHECK "+checkClause(change.Check.Clause))
+			case COLUMN_DROP:
+				clauses = append(clauses, "DROP CHECK "+quoteIdentifier(change.Check.Name))
+			}
+		}
+		if len(clauses) > 0 {
+			statements = append(statements, DDLStatement{
+				SQL:   "ALTER TABLE " + quoteTableName(table) + "\n  " + strings.Join(clauses, ",\n  ") + ";",
+				Table: table,
+				Alter: strings.Join(clauses, ", "),
+			})
+		}
+	}
+	statements = append(statements, extraColumnComments(diff)...)
+	for _, table := range diff.ExtraTables {
+		statements = append(statements, DDLStatement{SQL: fmt.Sprintf("-- %s exists only on the destination and is left alone", table)})
+	}
+	return statements, nil
+}
+
+// extraColumnComments notes the columns of the destination only, which are
+// kept unless dropping them was asked for.
+func extraColumnComments(diff *SchemaDiff) []DDLStatement {
+	var statements []DDLStatement
+	for _, table := range diff.ExtraColumnTables() {
+		for _, column := range diff.ExtraColumns[table] {
+			statements = append(statements, DDLStatement{SQL: fmt.Sprintf("-- %s.%s exists only on the destination and is left alone", table, column)})
+		}
+	}
+	return statements
+}
+
+// ExecDDL runs statements one by one on the destination database, skipping
+// comments. ALTER TABLE statements on opts.OnlineTables go through the
+// online schema change tool instead, which avoids locking busy tables.
+func (inserter *MySQLInserter) ExecDDL(statements []DDLStatement, opts DDLOptions) error {
+	for _, statement := range statements {
+		if statement.IsComment() {
+			continue
+		}
+
+		var cmd *Command
+		if statement.Alter != "" && opts.OnlineTool != "" && containsString(opts.OnlineTables, statement.Table) {
+			log.Printf("\t[Schema] altering %s with %s", statement.Table, opts.OnlineTool)
+			builder, err := inserter.onlineSchemaChange(opts.OnlineTool, statement)
+			if err != nil {
+				return err
+			}
+			cmd = builder.Command()
+		} else {
+			log.Print("\t[Schema] " + strings.SplitN(statement.SQL, "\n", 2)[0])
+			query := statement.SQL
+			if opts.NoForeignKeyChecks {
+				query = FOREIGN_KEY_CHECKS_OFF + query
+			}
+			client, err := mysqlClient(DBConnector(*inserter), inserter.IsContainer)
+			if err != nil {
+				return err
+			}
+			cmd = client.Arg("--database=" + inserter.Name).
+				Stdin(strings.NewReader(query)).
+				Command()
+		}
+
+		var stderr bytes.Buffer
+		cmd.Stderr = &stderr
+		if err := inserter.Runner.Run(cmd); err != nil {
+			return fmt.Errorf("%v: %s", err, strings.TrimSpace(stderr.String()))
+		}
+	}
+	return nil
+}
+
+// onlineSchemaChange builds a gh-ost or pt-online-schema-change invocation
+// running the ALTER TABLE statement on the destination host.
+func (inserter *MySQLInserter) onlineSchemaChange(tool string, statement DDLStatement) (*commandBuilder, error) {
+	table := ParseTableName(statement.Table)
+	if table.Schema == "" {
+		table.Schema = inserter.Name
+	}
+
+	switch tool {
+	case ONLINE_DDL_GH_OST:
+		builder := newCommandBuilder("gh-ost",
+			"--database="+table.Schema,
+			"--table="+table.Name,
+			"--alter="+statement.Alter,
+			"--allow-on-master",
+			"--initially-drop-ghost-table",
+			"--initially-drop-old-table",
+			"--ok-to-drop-table",
+			"--execute")
+		if !inserter.UseMyCnf {
+			builder.Arg("--user=" + inserter.User)
+		}
+		// gh-ost reads no MYSQL_PWD, but a config file, here its stdin.
+		if len(inserter.Password) > 0 && !inserter.UseMyCnf {
+			builder.Arg("--conf=/dev/stdin").Stdin(strings.NewReader("[client]\npassword = " + gcfgString(inserter.Password) + "\n"))
+		}
+		if inserter.IsContainer {
+			builder.Arg("--host=" + inserter.Host)
+		}
+		return builder, nil
+	case ONLINE_DDL_PT_OSC:
+		dsn := "D=" + table.Schema + ",t=" + table.Name
+		if !inserter.UseMyCnf {
+			dsn += ",u=" + inserter.User
+		}
+		if inserter.IsContainer {
+			dsn += ",h=" + inserter.Host
+		}
+		builder := newCommandBuilder("pt-online-schema-change", "--alter", statement.Alter, "--execute", dsn)
+		// Without a password in the DSN, the client library reads MYSQL_PWD.
+		if len(inserter.Password) > 0 && !inserter.UseMyCnf {
+			builder.Env("MYSQL_PWD", inserter.Password)
+		}
+		return builder, nil
+	default:
+		return nil, fmt.Errorf("unknown online schema change tool: %s", tool)
+	}
+}
+
+// gcfgString quotes s as a value of the git-config style files of gh-ost.
+func gcfgString(s string) string {
+	s = strings.Replace(s, "\\", "\\\\", -1)
+	return `"` + strings.Replace(s, `"`, `\"`, -1) + `"`
+}
+
+// columnDefinition renders column as in a CREATE TABLE statement.
+func columnDefinition(column Column) string {
+	definition := quoteIdentifier(column.Name) + " " + column.Type
+	if column.Nullable {
+		definition += " NULL"
+	} else {
+		definition += " NOT NULL"
+	}
+	if column.Default != nil {
+		definition += " DEFAULT " + defaultValue(column)
+	}
+	extra := strings.TrimSpace(strings.Replace(column.Extra, "DEFAULT_GENERATED", "", -1))
+	if extra != "" {
+		definition += " " + strings.ToUpper(extra)
+	}
+	return definition
+}
+
+func defaultValue(column Column) string {
+	value := *column.Default
+	upper := strings.ToUpper(value)
+	if strings.HasPrefix(upper, "CURRENT_TIMESTAMP") || strings.Contains(column.Extra, "DEFAULT_GENERATED") {
+		return value
+	}
+	if numericTypes[columnTypeName(column.Type)] {
+		return value
+	}
+	return "'" + escapeString(value) + "'"
+}
+
+// numericTypes are the column types whose defaults are written unquoted.
+var numericTypes = map[string]bool{
+	"tinyint": true, "smallint": true, "mediumint": true, "int": true, "integer": true, "bigint": true,
+	"decimal": true, "numeric": true, "float": true, "double": true, "real": true, "bit": true,
+	"bool": true, "boolean": true,
+}
+
+// columnTypeName returns the name of a column type without its length and
+// attributes, e.g. int for "int(10) unsigned".
+func columnTypeName(columnType string) string {
+	name := strings.ToLower(strings.TrimSpace(columnType))
+	if i := strings.IndexAny(name, "( "); i >= 0 {
+		name = name[:i]
+	}
+	return name
+}
+
+// checkClause parenthesizes a clause from information_schema, which MySQL
+// reports with or without parentheses depending on the version.
+func checkClause(clause string) string {
+	if strings.HasPrefix(clause, "(") && strings.HasSuffix(clause, ")") {
+		return clause
+	}
+	return "(" + clause + ")"
+}
+
+// loadColumns returns the columns to fetch and load for every table that
+// can't be copied with SELECT *: invisible columns are left out of it, and
+// generated columns can't be loaded.
+func loadColumns(columns []Column) map[string][]string {
+	tables := make(map[string][]Column)
+	special := make(map[string]bool)
+	for _, column := range columns {
+		tables[column.Table] = append(tables[column.Table], column)
+		if column.Invisible() || column.Generated() {
+			special[column.Table] = true
+		}
+	}
+
+	lists := make(map[string][]string)
+	for table := range special {
+		for _, column := range tables[table] {
+			if !column.Generated() {
+				lists[table] = append(lists[table], column.Name)
+			}
+		}
+	}
+	return lists
+}
+
+// columnList quotes columns for a SELECT or LOAD DATA column list.
+func columnList(columns []string) string {
+	quoted := make([]string, len(columns))
+	for i, column := range columns {
+		quoted[i] = quoteIdentifier(column)
+	}
+	return strings.Join(quoted, ", ")
+}
+
+// quoteTableName quotes a table without qualifying it with a database.
+func quoteTableName(table string) string {
+	parsed := ParseTableName(table)
+	if parsed.Schema == "" {
+		return quoteIdentifier(parsed.Name)
+	}
+	return quoteIdentifier(parsed.Schema) + "." + quoteIdentifier(parsed.Name)
+}
+
+// unescapeBatchValue reverses the escaping of special characters in the
+// batch mode output of the mysql client.
+func unescapeBatchValue(value string) string {
+	if !strings.Contains(value, "\\") {
+		return value
+	}
+	replacer := strings.NewReplacer(`\\`, `\`, `\t`, "\t", `\n`, "\n", `\0`, "\x00")
+	return replacer.Replace(value)
+}
@@ -0,0 +1,83 @@
+package database
+
+import (
+	"strings"
+	"testing"
+
+	. "github.com/timakin/gopli/constants"
+	. "github.com/timakin/gopli/lib"
+)
+
+func TestOnlineSchemaChange(t *testing.T) {
+	inserter := &MySQLInserter{Name: "app", User: "gopli", Password: `p"w\d`}
+	statement := DDLStatement{Table: "users", Alter: "ADD COLUMN `age` int NULL"}
+
+	builder, err := inserter.onlineSchemaChange(ONLINE_DDL_GH_OST, statement)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cmd := builder.Command()
+	for _, want := range []string{"'--database=app'", "'--table=users'", "'--alter=ADD COLUMN `age` int NULL'", "'--user=gopli'", "'--conf=/dev/stdin'"} {
+		if !strings.Contains(cmd.Line, want) {
+			t.Errorf("expected %q in %s", want, cmd.Line)
+		}
+	}
+	if conf, _ := readStdin(cmd); string(conf) != "[client]\npassword = \"p\\\"w\\\\d\"\n" {
+		t.Errorf("expected the password in the config file on stdin, got %q", conf)
+	}
+
+	builder, err = inserter.onlineSchemaChange(ONLINE_DDL_PT_OSC, statement)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cmd = builder.Command()
+	if !strings.Contains(cmd.Line, "'D=app,t=users,u=gopli'") || !strings.Contains(cmd.Line, "export MYSQL_PWD && 'pt-online-schema-change'") {
+		t.Errorf("unexpected command line: %s", cmd.Line)
+	}
+	if stdin, _ := readStdin(cmd); string(stdin) != "p\"w\\d\n" {
+		t.Errorf("expected the password on stdin, got %q", stdin)
+	}
+
+	for _, tool := range []string{ONLINE_DDL_GH_OST, ONLINE_DDL_PT_OSC} {
+		builder, _ := inserter.onlineSchemaChange(tool, statement)
+		if line := builder.Command().Line; strings.Contains(line, "p\"w") || strings.Contains(line, "password") {
+			t.Errorf("%s: expected the password to stay off the command line, got %s", tool, line)
+		}
+	}
+}
+
+func TestDefaultValue(t *testing.T) {
+	for _, test := range []struct {
+		columnType string
+		value      string
+		expected   string
+	}{
+		{"int(10) unsigned", "0", "0"},
+		{"decimal(10,2)", "1.50", "1.50"},
+		{"point", "POINT(0 0)", "'POINT(0 0)'"},
+		{"varchar(255)", "interval", "'interval'"},
+	} {
+		value := test.value
+		if definition := defaultValue(Column{Type: test.columnType, Default: &value}); definition != test.expected {
+			t.Errorf("defaultValue(%s) = %s, want %s", test.columnType, definition, test.expected)
+		}
+	}
+}
+
+func TestRecentPartitions(t *testing.T) {
+	partitions := parsePartitions("events\tp202401\t1\t'2024-02-01'\n" +
+		"events\tp202402\t2\t'2024-03-01'\n" +
+		"events\tp202403\t3\t'2024-04-01'\n" +
+		"events\tpmax\t4\tMAXVALUE\n" +
+		"metrics\tp0\t1\t'2024-01-01',100\n" +
+		"metrics\tpmax\t2\t'2024-01-01',MAXVALUE\n")
+	if recent := recentPartitions(partitions["events"], 2); strings.Join(recent, ",") != "p202402,p202403" {
+		t.Errorf("expected the last two partitions before MAXVALUE, got %v", recent)
+	}
+	if recent := recentPartitions(partitions["metrics"], 1); recent != nil {
+		t.Errorf("expected every partition of metrics to be synced, got %v", recent)
+	}
+	if recent := recentPartitions(partitions["events"], 0); recent != nil {
+		t.Errorf("expected no restriction without --recent-partitions, got %v", recent)
+	}
+}
@@ -0,0 +1,83 @@
+package database
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	. "github.com/timakin/gopli/constants"
+	. "github.com/timakin/gopli/lib"
+)
+
+// ApplySeed runs a .sql seed file on the destination, or loads a .csv seed
+// file into its table, replacing rows with the same keys. The first line of
+// a CSV file names the columns.
+func (inserter *MySQLInserter) ApplySeed(path string) error {
+	client, err := mysqlClient(DBConnector(*inserter), inserter.IsContainer || !isLocalHost(inserter.Host))
+	if err != nil {
+		return err
+	}
+	if strings.ToLower(filepath.Ext(path)) == SEED_CSV_EXT {
+		query, err := seedCSVQuery(inserter.Name, path)
+		if err != nil {
+			return err
+		}
+		client.Arg("--enable-local-infile").Stdin(strings.NewReader(query))
+	} else {
+		query, err := RenderSeed(path, inserter.SeedEnv)
+		if err != nil {
+			return err
+		}
+		client.Stdin(strings.NewReader(query))
+	}
+	cmd := client.LocalCommand()
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := inserter.LocalRunner.Run(cmd); err != nil {
+		if localInfileDisabled(stderr.String()) {
+			return fmt.Errorf("%w: %s", ErrLocalInfileDisabled, strings.TrimSpace(stderr.String()))
+		}
+		return fmt.Errorf("%v: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
+
+// seedCSVQuery builds the LOAD DATA of a CSV seed file, reading its columns
+// and line endings from the header line.
+func seedCSVQuery(defaultSchema string, path string) (string, error) {
+	header, lineEnd, err := seedCSVHeader(path)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf(SEED_CSV_QUERY_FORMAT, escapeString(path), qualifiedTable(defaultSchema, SeedTable(path)), lineEnd, columnList(header)), nil
+}
+
+// seedCSVHeader reads the columns of a CSV seed file from its header line,
+// and whether its lines end with CRLF, as files saved on Windows do.
+func seedCSVHeader(path string) ([]string, string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, "", err
+	}
+	defer file.Close()
+	line, err := bufio.NewReader(file).ReadString('\n')
+	if err != nil && line == "" {
+		return nil, "", fmt.Errorf("failed to read the header of %s: %v", filepath.Base(path), err)
+	}
+	lineEnd := SEED_CSV_LF
+	if strings.HasSuffix(line, "\r\n") {
+		lineEnd = SEED_CSV_CRLF
+	}
+	header, err := csv.NewReader(strings.NewReader(line)).Read()
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read the header of %s: %v", filepath.Base(path), err)
+	}
+	for i := range header {
+		header[i] = strings.TrimSpace(header[i])
+	}
+	return header, lineEnd, nil
+}
@@ -0,0 +1,42 @@
+package database
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSeedCSVQuery(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gopli_seed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "10_feature_flags.csv")
+	if err := ioutil.WriteFile(path, []byte("name, enabled\nnew_checkout,1\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	query, err := seedCSVQuery("app", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "LOAD DATA LOCAL INFILE '" + path + "' REPLACE INTO TABLE `app`.`feature_flags` CHARACTER SET utf8mb4 FIELDS TERMINATED BY ',' OPTIONALLY ENCLOSED BY '\"' LINES TERMINATED BY '\\n' IGNORE 1 LINES (`name`, `enabled`)"
+	if query != expected {
+		t.Errorf("expected %q, got %q", expected, query)
+	}
+
+	// Files saved on Windows end their lines with CRLF.
+	if err := ioutil.WriteFile(path, []byte("name,enabled\r\nnew_checkout,1\r\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if query, err = seedCSVQuery("app", path); err != nil {
+		t.Fatal(err)
+	}
+	expected = strings.Replace(expected, "'\\n'", "'\\r\\n'", 1)
+	if query != expected {
+		t.Errorf("expected %q, got %q", expected, query)
+	}
+}
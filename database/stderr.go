@@ -0,0 +1,44 @@
+package database
+
+import (
+	"io"
+	"io/ioutil"
+
+	. "github.com/timakin/gopli/constants"
+	. "github.com/timakin/gopli/lib"
+)
+
+// stderrRunner keeps the end of the stderr of every command, so a failing
+// mysql client explains itself instead of looking like an empty result.
+type stderrRunner struct {
+	runner Runner
+}
+
+func withStderr(runner Runner) Runner {
+	return &stderrRunner{runner: runner}
+}
+
+func (runner *stderrRunner) Run(cmd *Command) error {
+	stderr := cmd.Stderr
+	if stderr == nil {
+		stderr = ioutil.Discard
+	}
+	var tail stderrTail
+	captured := *cmd
+	captured.Stderr = io.MultiWriter(stderr, &tail)
+	return ParseMySQLError(runner.runner.Run(&captured), string(tail.data))
+}
+
+// stderrTail keeps the last STDERR_TAIL_SIZE bytes written to it, where
+// the mysql client prints the error it exits with.
+type stderrTail struct {
+	data []byte
+}
+
+func (tail *stderrTail) Write(p []byte) (int, error) {
+	tail.data = append(tail.data, p...)
+	if len(tail.data) > STDERR_TAIL_SIZE {
+		tail.data = tail.data[len(tail.data)-STDERR_TAIL_SIZE:]
+	}
+	return len(p), nil
+}
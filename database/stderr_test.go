@@ -0,0 +1,38 @@
+package database
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	. "github.com/timakin/gopli/constants"
+	. "github.com/timakin/gopli/lib"
+)
+
+func TestStderrRunner(t *testing.T) {
+	runner := withStderr(&localRunner{})
+	err := runner.Run(&Command{Line: "echo 'ERROR 1045 (28000): Access denied for user' >&2; exit 1"})
+	if !errors.Is(err, ErrAuthenticationFailed) {
+		t.Errorf("expected an authentication failure, got %v", err)
+	}
+
+	var stderr bytes.Buffer
+	err = runner.Run(&Command{Line: "echo 'ERROR 2003 (HY000): Can'\\''t connect' >&2; exit 1", Stderr: &stderr})
+	if !errors.Is(err, ErrConnectionFailed) || !strings.Contains(stderr.String(), "ERROR 2003") {
+		t.Errorf("expected a connection failure passed through, got %v and %q", err, stderr.String())
+	}
+
+	if err := runner.Run(&Command{Line: "echo 'ERROR 1045 (28000): Access denied' >&2"}); err != nil {
+		t.Errorf("expected the successful command to pass, got %v", err)
+	}
+}
+
+func TestStderrTail(t *testing.T) {
+	var tail stderrTail
+	tail.Write(bytes.Repeat([]byte("x"), STDERR_TAIL_SIZE))
+	tail.Write([]byte("ERROR 1205"))
+	if len(tail.data) != STDERR_TAIL_SIZE || !strings.HasSuffix(string(tail.data), "ERROR 1205") {
+		t.Errorf("expected the last %d bytes, got %d", STDERR_TAIL_SIZE, len(tail.data))
+	}
+}
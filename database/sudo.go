@@ -0,0 +1,65 @@
+package database
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+)
+
+// sudoRunner executes commands as another user on the host through sudo.
+// sudo runs non-interactively, so hosts asking for a password fail instead
+// of hanging. Secret variables are read before sudo and kept with
+// --preserve-env, so they never show in the command sudo logs.
+type sudoRunner struct {
+	runner Runner
+	user   string
+	host   string
+}
+
+func withSudo(runner Runner, user string, host string) Runner {
+	if user == "" {
+		return runner
+	}
+	return &sudoRunner{runner: runner, user: user, host: host}
+}
+
+func (runner *sudoRunner) Run(cmd *Command) error {
+	stderr := cmd.Stderr
+	if stderr == nil {
+		stderr = ioutil.Discard
+	}
+	var prompt sudoPrompt
+	wrapped := *cmd
+	sudo := newCommandBuilder("sudo", "-n")
+	if len(cmd.SecretEnv) > 0 {
+		sudo.Arg("--preserve-env=" + strings.Join(cmd.SecretEnv, ","))
+	}
+	line := sudo.Arg("-u", runner.user, "sh", "-c", withoutReadingEnv(cmd.SecretEnv, cmd.Line)).Command().Line
+	if len(cmd.SecretEnv) > 0 {
+		line = readingEnv(cmd.SecretEnv, line)
+	}
+	wrapped.Line = line
+	wrapped.Stderr = io.MultiWriter(stderr, &prompt)
+	err := runner.runner.Run(&wrapped)
+	if err != nil && prompt.found {
+		return fmt.Errorf("sudo -u %s on %s requires a password; allow it without one (NOPASSWD) in sudoers", runner.user, runner.host)
+	}
+	return err
+}
+
+// sudoPrompt watches stderr for sudo refusing to run without a password.
+type sudoPrompt struct {
+	head  bytes.Buffer
+	found bool
+}
+
+func (prompt *sudoPrompt) Write(p []byte) (int, error) {
+	// sudo reports before the command starts, so the beginning suffices.
+	if prompt.head.Len() < 1024 {
+		prompt.head.Write(p)
+		prompt.found = strings.Contains(prompt.head.String(), "sudo: a password is required")
+	}
+	return len(p), nil
+}
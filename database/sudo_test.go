@@ -0,0 +1,47 @@
+package database
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// promptingRunner fails like sudo -n on a host requiring a password.
+type promptingRunner struct {
+	line string
+}
+
+func (runner *promptingRunner) Run(cmd *Command) error {
+	runner.line = cmd.Line
+	fmt.Fprintln(cmd.Stderr, "sudo: a password is required")
+	return fmt.Errorf("Process exited with status 1")
+}
+
+func TestSudoRunner(t *testing.T) {
+	prompting := &promptingRunner{}
+	err := withSudo(prompting, "mysql", "db1").Run(&Command{Line: "echo it's"})
+	if prompting.line != `'sudo' '-n' '-u' 'mysql' 'sh' '-c' 'echo it'\''s'` {
+		t.Errorf("unexpected command line: %s", prompting.line)
+	}
+	if err == nil || !strings.Contains(err.Error(), "requires a password") {
+		t.Errorf("expected a password error, got %v", err)
+	}
+}
+
+func TestSudoRunnerPreservesSecretEnv(t *testing.T) {
+	local := &lineRunner{}
+	cmd := testClient(t, DBConnector{User: "app", Password: "hunter2"}).Stdin(strings.NewReader("SELECT 1")).Command()
+	if err := withSudo(local, "mysql", "db1").Run(cmd); err != nil {
+		t.Fatal(err)
+	}
+	prefix := "{ IFS= read -r MYSQL_PWD && export MYSQL_PWD && 'sudo' '-n' '--preserve-env=MYSQL_PWD' '-u' 'mysql' 'sh' '-c' ''\\''mysql'\\'' "
+	if !strings.HasPrefix(local.line, prefix) || !strings.HasSuffix(local.line, "; }") {
+		t.Errorf("expected the password to be read ahead of sudo, got %s", local.line)
+	}
+	if strings.Contains(local.line, "hunter2") || strings.Count(local.line, "read -r") != 1 {
+		t.Errorf("unexpected command line: %s", local.line)
+	}
+	if local.stdin != "hunter2\nSELECT 1" {
+		t.Errorf("expected the password and the query on stdin, got %q", local.stdin)
+	}
+}
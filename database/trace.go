@@ -0,0 +1,52 @@
+package database
+
+import (
+	. "github.com/timakin/gopli/lib"
+)
+
+var tracer *Tracer
+
+// TraceSpans records a span for the fetch, delete and load of every table
+// with t from now on. A nil t stops recording.
+func TraceSpans(t *Tracer) {
+	tracer = t
+}
+
+// StartSpan starts the span of a phase of the run.
+func StartSpan(phase string, attributes map[string]string) *Span {
+	return tracer.Start(phase, nil, attributes)
+}
+
+// startTableSpan starts the span of a table phase on the host of conn, a
+// child of the span of the phase.
+func startTableSpan(phase string, table string, conn DBConnector) *Span {
+	return tracer.Start(phase+" "+table, conn.Span, map[string]string{
+		"db.system":     conn.ManagementSystem,
+		"db.name":       conn.Name,
+		"db.sql.table":  table,
+		"net.peer.name": conn.Host,
+		"gopli.phase":   phase,
+	})
+}
+
+// TraceUnder makes span the parent of the spans of the tables fetched.
+func (fetcher *MySQLFetcher) TraceUnder(span *Span) {
+	fetcher.Span = span
+}
+
+// TraceUnder makes span the parent of the spans of the tables deleted and
+// loaded.
+func (inserter *MySQLInserter) TraceUnder(span *Span) {
+	inserter.Span = span
+}
+
+// TraceUnder makes span the parent of the spans of the tables fetched.
+func (fetcher *PostgreSQLFetcher) TraceUnder(span *Span) {
+	fetcher.Span = span
+}
+
+// TraceUnder makes span the parent of the spans of the tables deleted and
+// loaded.
+func (inserter *PostgreSQLInserter) TraceUnder(span *Span) {
+	inserter.Span = span
+}
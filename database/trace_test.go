@@ -0,0 +1,50 @@
+package database
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	. "github.com/timakin/gopli/lib"
+)
+
+func TestTableSpansBelongToPhase(t *testing.T) {
+	var received struct {
+		ResourceSpans []struct {
+			ScopeSpans []struct {
+				Spans []struct {
+					SpanID       string `json:"spanId"`
+					ParentSpanID string `json:"parentSpanId"`
+					Name         string `json:"name"`
+				} `json:"spans"`
+			} `json:"scopeSpans"`
+		} `json:"resourceSpans"`
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&received)
+	}))
+	defer server.Close()
+
+	tracer := StartTrace(server.URL, "sync", nil)
+	TraceSpans(tracer)
+	defer TraceSpans(nil)
+	phase := StartSpan("load", nil)
+	inserter := &MySQLInserter{Name: "app"}
+	inserter.TraceUnder(phase)
+	startTableSpan("load", "users", DBConnector(*inserter)).End(nil)
+	phase.End(nil)
+	if err := tracer.Flush(nil); err != nil {
+		t.Fatal(err)
+	}
+
+	ids := make(map[string]string)
+	parents := make(map[string]string)
+	for _, span := range received.ResourceSpans[0].ScopeSpans[0].Spans {
+		ids[span.Name] = span.SpanID
+		parents[span.Name] = span.ParentSpanID
+	}
+	if parents["load users"] != ids["load"] || parents["load"] != ids["sync"] {
+		t.Errorf("expected sync > load > load users, got %v with ids %v", parents, ids)
+	}
+}
@@ -0,0 +1,115 @@
+package database
+
+import (
+	"errors"
+
+	. "github.com/timakin/gopli/constants"
+	. "github.com/timakin/gopli/lib"
+)
+
+// newTransportRunner returns the runner of a transport other than the
+// built-in SSH client.
+func newTransportRunner(sshConf SSH) Runner {
+	switch {
+	case sshConf.Transport == TRANSPORT_SSM:
+		return &ssmRunner{local: &localRunner{}, sshConf: sshConf}
+	case sshConf.Transport == TRANSPORT_TELEPORT:
+		return &teleportRunner{local: &localRunner{}, sshConf: sshConf}
+	default:
+		return &opensshRunner{local: &localRunner{}, sshConf: sshConf}
+	}
+}
+
+// opensshClient builds an OpenSSH client invocation with the user, port,
+// jump hosts and known hosts of sshConf. The command line of the wrapped
+// command holds no secrets, which it reads from stdin.
+func opensshClient(sshConf SSH, options ...string) *commandBuilder {
+	client := newCommandBuilder("ssh", "-o", "BatchMode=yes")
+	for _, option := range options {
+		client.Arg("-o", option)
+	}
+	if sshConf.User != "" {
+		client.Arg("-l", sshConf.User)
+	}
+	if sshConf.Port != "" {
+		client.Arg("-p", sshConf.Port)
+	}
+	if sshConf.ProxyJump != "" {
+		client.Arg("-J", sshConf.ProxyJump)
+	}
+	if HostKeysIgnored() {
+		client.Arg("-o", "StrictHostKeyChecking=no", "-o", "UserKnownHostsFile=/dev/null")
+	} else if sshConf.KnownHosts != "" {
+		client.Arg("-o", "UserKnownHostsFile="+sshConf.KnownHosts)
+	}
+	return client
+}
+
+// opensshRunner executes commands on a host through the OpenSSH client,
+// which authenticates with GSSAPI using the Kerberos tickets of this machine.
+type opensshRunner struct {
+	local   Runner
+	sshConf SSH
+}
+
+func (runner *opensshRunner) Run(cmd *Command) error {
+	delegate := "no"
+	if runner.sshConf.GSSAPIDelegateCredentials {
+		delegate = "yes"
+	}
+	client := opensshClient(runner.sshConf,
+		"GSSAPIAuthentication=yes",
+		"GSSAPIDelegateCredentials="+delegate,
+		"PreferredAuthentications=gssapi-with-mic")
+	wrapped := *cmd
+	wrapped.Line = client.Arg(unbracket(runner.sshConf.Host), cmd.Line).Command().Line
+	return runner.local.Run(&wrapped)
+}
+
+// teleportRunner executes commands on a host through Teleport's tsh, which
+// passes stdin, stdout, stderr and the exit status through.
+type teleportRunner struct {
+	local   Runner
+	sshConf SSH
+}
+
+func (runner *teleportRunner) Run(cmd *Command) error {
+	tsh := newCommandBuilder("tsh", "ssh")
+	if runner.sshConf.User != "" {
+		tsh.Arg("-l", runner.sshConf.User)
+	}
+	if runner.sshConf.Port != "" {
+		tsh.Arg("-p", runner.sshConf.Port)
+	}
+	wrapped := *cmd
+	wrapped.Line = tsh.Arg(runner.sshConf.Host, cmd.Line).Command().Line
+	return runner.local.Run(&wrapped)
+}
+
+// ssmRunner executes commands on an EC2 instance through the OpenSSH client
+// tunnelled over AWS SSM Session Manager, which passes stdin, stdout, stderr
+// and the exit status through as they stream. Only the port to tunnel to is
+// a session parameter, so commands and their input stay out of the session
+// history and CloudTrail. The client authenticates with the key file or the
+// agent.
+type ssmRunner struct {
+	local   Runner
+	sshConf SSH
+}
+
+func (runner *ssmRunner) Run(cmd *Command) error {
+	if runner.sshConf.Key == "" && len(runner.sshConf.KeyData) > 0 {
+		return errors.New("ssm transport needs the key in a file, set key instead of reading it from a secret store")
+	}
+	client := opensshClient(runner.sshConf, "ProxyCommand="+SSM_PROXY_COMMAND)
+	if runner.sshConf.Key != "" {
+		key, err := ExpandPath(runner.sshConf.Key)
+		if err != nil {
+			return err
+		}
+		client.Arg("-i", key)
+	}
+	wrapped := *cmd
+	wrapped.Line = client.Arg(runner.sshConf.Host, cmd.Line).Command().Line
+	return runner.local.Run(&wrapped)
+}
@@ -0,0 +1,80 @@
+package database
+
+import (
+	"strings"
+	"testing"
+
+	. "github.com/timakin/gopli/constants"
+)
+
+// lineRunner records the command line and stdin it is asked to run.
+type lineRunner struct {
+	line  string
+	stdin string
+}
+
+func (runner *lineRunner) Run(cmd *Command) error {
+	runner.line = cmd.Line
+	stdin, err := readStdin(cmd)
+	runner.stdin = string(stdin)
+	return err
+}
+
+func TestTransportsKeepPasswordsOffTheCommandLine(t *testing.T) {
+	for _, transport := range []string{TRANSPORT_SSM, TRANSPORT_TELEPORT} {
+		local := &lineRunner{}
+		sshConf := SSH{Host: "i-0123456789abcdef0", User: "deploy", Key: "/keys/deploy", Transport: transport}
+		var runner Runner = &ssmRunner{local: local, sshConf: sshConf}
+		if transport == TRANSPORT_TELEPORT {
+			runner = &teleportRunner{local: local, sshConf: sshConf}
+		}
+		cmd := testClient(t, DBConnector{User: "app", Password: "hunter2"}).Stdin(strings.NewReader("SELECT 1")).Command()
+		if err := runner.Run(cmd); err != nil {
+			t.Fatal(err)
+		}
+		if strings.Contains(local.line, "hunter2") {
+			t.Errorf("%s: expected the password to stay off the command line, got %s", transport, local.line)
+		}
+		if local.stdin != "hunter2\nSELECT 1" {
+			t.Errorf("%s: expected the password and the query on stdin, got %q", transport, local.stdin)
+		}
+	}
+}
+
+func TestSSMRunnerTunnelsSSH(t *testing.T) {
+	local := &lineRunner{}
+	runner := &ssmRunner{local: local, sshConf: SSH{Host: "i-0123456789abcdef0", User: "ec2-user", Key: "/keys/deploy"}}
+	if err := runner.Run(&Command{Line: "echo hello"}); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"'ssh' ", "'ProxyCommand=aws ssm start-session --target %h --document-name AWS-StartSSHSession --parameters portNumber=%p'", "'-i' '/keys/deploy'", "'-l' 'ec2-user'", "'i-0123456789abcdef0' 'echo hello'"} {
+		if !strings.Contains(local.line, want) {
+			t.Errorf("expected %q in %s", want, local.line)
+		}
+	}
+
+	runner.sshConf = SSH{Host: "i-0123456789abcdef0", KeyData: []byte("key")}
+	if err := runner.Run(&Command{Line: "echo hello"}); err == nil {
+		t.Error("expected keys from a secret store to be refused")
+	}
+}
+
+func TestOpensshRunner(t *testing.T) {
+	local := &lineRunner{}
+	runner := &opensshRunner{local: local, sshConf: SSH{Host: "db1.corp.example.com", User: "deploy", Port: "2222", Auth: SSH_AUTH_GSSAPI, GSSAPIDelegateCredentials: true}}
+	cmd := testClient(t, DBConnector{User: "app", Password: "hunter2"}).Stdin(strings.NewReader("SELECT 1")).Command()
+	if err := runner.Run(cmd); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"'GSSAPIAuthentication=yes'", "'GSSAPIDelegateCredentials=yes'", "'-l' 'deploy'", "'-p' '2222'", "'db1.corp.example.com' '{ IFS= read -r MYSQL_PWD && export MYSQL_PWD && "} {
+		if !strings.Contains(local.line, want) {
+			t.Errorf("expected %q in %s", want, local.line)
+		}
+	}
+	if strings.Contains(local.line, "hunter2") {
+		t.Errorf("expected the password to stay off the remote command line, got %s", local.line)
+	}
+	if local.stdin != "hunter2\nSELECT 1" {
+		t.Errorf("expected the password and the query on stdin, got %q", local.stdin)
+	}
+}
@@ -0,0 +1,116 @@
+package database
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+
+	. "github.com/timakin/gopli/constants"
+	. "github.com/timakin/gopli/lib"
+)
+
+// verifyDump compares the rows dumped for table with the rows of the source,
+// so a dump cut short by a failure nobody noticed is caught before the
+// destination copy is deleted. Only empty dumps and dumps falling short of the
+// estimate of information_schema have the source rows counted exactly. A dump
+// limited to partitions is counted within them.
+func verifyDump(conn DBConnector, table string, partitions []string, estimated int64) error {
+	dumped, err := conn.Workspace.CountRows(table)
+	if err != nil {
+		return err
+	}
+	selection := tableSelection(conn, table)
+	expected := estimated
+	if selection.Limit > 0 && int64(selection.Limit) < expected {
+		expected = int64(selection.Limit)
+	}
+	// Estimates of 0 are common for tables whose statistics are stale, so
+	// empty dumps are always suspicious. The estimate covers the whole table,
+	// so dumps of selected rows or partitions are only when empty.
+	suspicious := dumped == 0
+	if selection.Where == "" && len(partitions) == 0 {
+		suspicious = suspicious || shortDump(dumped, expected)
+	}
+	if !suspicious {
+		return nil
+	}
+
+	counted, err := countRows(conn, table, partitions, selection)
+	if err != nil {
+		return fmt.Errorf("failed to count the rows of %s: %v", table, err)
+	}
+	if selection.Limit > 0 && int64(selection.Limit) < counted {
+		counted = int64(selection.Limit)
+	}
+	if shortDump(dumped, counted) {
+		return fmt.Errorf("%w: %s holds %d rows on the source, but only %d were dumped", ErrDumpIncomplete, table, counted, dumped)
+	}
+	return nil
+}
+
+func shortDump(dumped int64, expected int64) bool {
+	return float64(dumped) < float64(expected)*SHORT_DUMP_RATIO
+}
+
+// countRows counts the rows of table the selection fetches, within partitions
+// when any are given.
+func countRows(conn DBConnector, table string, partitions []string, selection TableSettings) (int64, error) {
+	where := TableSettings{Where: selection.Where}
+	dialect := dialectOf(conn)
+	from := dialect.qualifiedTable(conn, table)
+	if len(partitions) > 0 {
+		from += " PARTITION (" + columnList(partitions) + ")"
+	}
+	query := fmt.Sprintf(COUNT_ROWS_QUERY_FORMAT, from) + selectionClauses(where, nil)
+	var out bytes.Buffer
+	client, err := dialect.client(conn, conn.IsContainer)
+	if err != nil {
+		return 0, err
+	}
+	cmd := client.Stdin(strings.NewReader(query + ";")).Command()
+	cmd.Stdout = &out
+	if err := conn.Runner.Run(cmd); err != nil {
+		return 0, err
+	}
+	return strconv.ParseInt(strings.TrimSpace(out.String()), 10, 64)
+}
+
+// rowCounts counts the rows of every table the configured selection of the
+// host fetches, so a destination loaded from a partial sync still matches.
+func rowCounts(conn DBConnector, tables []string) (map[string]int64, error) {
+	counts := make(map[string]int64)
+	for _, table := range tables {
+		selection := tableSelection(conn, table)
+		counted, err := countRows(conn, table, nil, selection)
+		if err != nil {
+			return nil, fmt.Errorf("failed to count the rows of %s: %v", table, err)
+		}
+		if selection.Limit > 0 && int64(selection.Limit) < counted {
+			counted = int64(selection.Limit)
+		}
+		counts[table] = counted
+	}
+	return counts, nil
+}
+
+// RowCounts returns the exact row count of the tables.
+func (fetcher *MySQLFetcher) RowCounts(tables []string) (map[string]int64, error) {
+	return rowCounts(DBConnector(*fetcher), tables)
+}
+
+// TableChecksums returns the CHECKSUM TABLE value of the tables that exist on
+// the host.
+func (fetcher *MySQLFetcher) TableChecksums(tables []string) (map[string]string, error) {
+	return tableChecksums(DBConnector(*fetcher), tables)
+}
+
+// RowCounts returns the exact row count of the tables.
+func (fetcher *PostgreSQLFetcher) RowCounts(tables []string) (map[string]int64, error) {
+	return rowCounts(DBConnector(*fetcher), tables)
+}
+
+// TableChecksums returns the md5 of the sorted rows of every table.
+func (fetcher *PostgreSQLFetcher) TableChecksums(tables []string) (map[string]string, error) {
+	return tableChecksums(DBConnector(*fetcher), tables)
+}
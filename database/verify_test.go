@@ -0,0 +1,85 @@
+package database
+
+import (
+	"errors"
+	"testing"
+
+	. "github.com/timakin/gopli/constants"
+	. "github.com/timakin/gopli/lib"
+)
+
+func TestVerifyDump(t *testing.T) {
+	ws, err := NewWorkspace(TMP_DIR_PREFIX, WorkspaceConf{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ws.Remove()
+	if err := ws.WriteTable("users", []byte("1\tfoo\n2\tbar\n")); err != nil {
+		t.Fatal(err)
+	}
+
+	// Close enough to the estimate, the source isn't counted.
+	conn := DBConnector{Name: "app", Workspace: ws, Runner: &cannedRunner{out: "garbage\n"}}
+	if err := verifyDump(conn, "users", nil, 3); err != nil {
+		t.Errorf("unexpected error %v", err)
+	}
+	// Far below the estimate, but the source really shrank.
+	conn.Runner = &cannedRunner{out: "2\n"}
+	if err := verifyDump(conn, "users", nil, 1000); err != nil {
+		t.Errorf("unexpected error %v", err)
+	}
+	conn.Runner = &cannedRunner{out: "1000\n"}
+	if err := verifyDump(conn, "users", nil, 1000); !errors.Is(err, ErrDumpIncomplete) {
+		t.Errorf("expected an incomplete dump, got %v", err)
+	}
+	// The limit caps the rows expected.
+	conn.Tables = map[string]TableSettings{"users": {Limit: 2}}
+	if err := verifyDump(conn, "users", nil, 1000); err != nil {
+		t.Errorf("unexpected error %v", err)
+	}
+}
+
+func TestVerifyDumpEmptyAndPartitioned(t *testing.T) {
+	ws, err := NewWorkspace(TMP_DIR_PREFIX, WorkspaceConf{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ws.Remove()
+	if err := ws.WriteTable("events", []byte("1\tfoo\n")); err != nil {
+		t.Fatal(err)
+	}
+	if err := ws.WriteTable("users", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// An empty dump is counted even when the estimate is 0.
+	conn := DBConnector{Name: "app", Workspace: ws, Runner: &cannedRunner{out: "5\n"}}
+	if err := verifyDump(conn, "users", nil, 0); !errors.Is(err, ErrDumpIncomplete) {
+		t.Errorf("expected an incomplete dump, got %v", err)
+	}
+	conn.Runner = &cannedRunner{out: "0\n"}
+	if err := verifyDump(conn, "users", nil, 0); err != nil {
+		t.Errorf("unexpected error %v", err)
+	}
+
+	// Dumps of partitions aren't compared with the estimate of the table,
+	// and are counted within their partitions when empty.
+	conn.Runner = &queryRunner{answers: map[string]string{"PARTITION (`p2`)": "3\n"}}
+	if err := verifyDump(conn, "events", []string{"p2"}, 1000); err != nil {
+		t.Errorf("unexpected error %v", err)
+	}
+	if err := verifyDump(conn, "users", []string{"p2"}, 1000); !errors.Is(err, ErrDumpIncomplete) {
+		t.Errorf("expected an incomplete dump, got %v", err)
+	}
+}
+
+func TestRowCounts(t *testing.T) {
+	conn := DBConnector{Name: "app", Runner: &cannedRunner{out: "1000\n"}, Tables: map[string]TableSettings{"events": {Limit: 10}}}
+	counts, err := rowCounts(conn, []string{"users", "events"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if counts["users"] != 1000 || counts["events"] != 10 {
+		t.Errorf("unexpected counts %v", counts)
+	}
+}
@@ -0,0 +1,62 @@
+package lib
+
+import (
+	"sort"
+	"time"
+)
+
+// BenchResult is the outcome of a benchmark run at one setting.
+type BenchResult struct {
+	Concurrency int
+	Duration    time.Duration
+	Bytes       int64
+}
+
+// Throughput returns the transferred bytes per second.
+func (result BenchResult) Throughput() float64 {
+	if result.Duration <= 0 {
+		return 0
+	}
+	return float64(result.Bytes) / result.Duration.Seconds()
+}
+
+// PickSampleTables picks n mid-size tables, i.e. the ones around the median
+// data size, skipping empty and excluded tables.
+func PickSampleTables(stats []TableStat, n int) []string {
+	var candidates []TableStat
+	for _, stat := range stats {
+		if stat.Bytes > 0 && stat.ExclusionReason() == "" {
+			candidates = append(candidates, stat)
+		}
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		return candidates[i].Bytes < candidates[j].Bytes
+	})
+
+	start := len(candidates)/2 - n/2
+	if start < 0 {
+		start = 0
+	}
+	end := start + n
+	if end > len(candidates) {
+		end = len(candidates)
+	}
+
+	var tables []string
+	for _, stat := range candidates[start:end] {
+		tables = append(tables, stat.Name)
+	}
+	return tables
+}
+
+// RecommendConcurrency returns the setting with the best throughput,
+// preferring fewer sessions when the difference is within 5%.
+func RecommendConcurrency(results []BenchResult) BenchResult {
+	var best BenchResult
+	for _, result := range results {
+		if result.Throughput() > best.Throughput()*1.05 {
+			best = result
+		}
+	}
+	return best
+}
@@ -0,0 +1,137 @@
+package lib
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	. "github.com/timakin/gopli/constants"
+)
+
+// DumpCache keeps table dumps keyed by their content, so tables that did not
+// change since an earlier run need not be fetched again.
+type DumpCache struct {
+	Dir string
+}
+
+// OpenDumpCache opens the cache directory, creating it when missing, and
+// removes the entries not used within conf.KeepDays.
+func OpenDumpCache(conf Cache) (*DumpCache, error) {
+	dir := conf.Dir
+	if dir == "" {
+		dir = DEFAULT_CACHE_DIR
+	}
+	dir, err := ExpandPath(dir)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	cache := &DumpCache{Dir: dir}
+	if conf.KeepDays > 0 {
+		if err := cache.prune(time.Now().AddDate(0, 0, -conf.KeepDays)); err != nil {
+			return nil, err
+		}
+	}
+	return cache, nil
+}
+
+// DumpKey identifies the dump of table with the given columns and CHECKSUM
+// TABLE value.
+func DumpKey(table string, columns []Column, checksum string) string {
+	hash := sha256.New()
+	fmt.Fprintf(hash, "%q\n", table)
+	for _, column := range columns {
+		fmt.Fprintf(hash, "%q %q %v %v %q\n", column.Name, column.Type, column.Nullable, column.Default != nil, column.Extra)
+		if column.Default != nil {
+			fmt.Fprintf(hash, "%q\n", *column.Default)
+		}
+	}
+	fmt.Fprintf(hash, "%s\n", checksum)
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// Restore copies the cached dump of key into ws as the dump of table, and
+// reports whether there was one.
+func (cache *DumpCache) Restore(key string, ws *Workspace, table string) (bool, error) {
+	entry := filepath.Join(cache.Dir, key)
+	for part := 0; ; part++ {
+		dst := ws.TablePath(table)
+		if part > 0 {
+			dst = ws.tablePartPath(table, part)
+		}
+		src := filepath.Join(entry, strconv.Itoa(part))
+		if _, err := os.Stat(src + GZIP_FILE_EXT); err == nil {
+			// Compressed dumps stay compressed.
+			src += GZIP_FILE_EXT
+			dst += GZIP_FILE_EXT
+		} else if _, err := os.Stat(src); os.IsNotExist(err) {
+			if part == 0 {
+				return false, nil
+			}
+			break
+		}
+		if err := copyFile(src, dst); err != nil {
+			return false, err
+		}
+	}
+	if _, err := os.Stat(filepath.Join(entry, CACHE_SIZE_FILE)); err == nil {
+		if err := copyFile(filepath.Join(entry, CACHE_SIZE_FILE), ws.TablePath(table)+SIZE_FILE_SUFFIX); err != nil {
+			return false, err
+		}
+	}
+	// Entries are pruned by the time they were last used.
+	now := time.Now()
+	return true, os.Chtimes(entry, now, now)
+}
+
+// Store saves the dump of table in ws under key.
+func (cache *DumpCache) Store(key string, ws *Workspace, table string) error {
+	tmp, err := ioutil.TempDir(cache.Dir, ".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmp)
+	for part, path := range ws.TableFiles(table) {
+		name := strconv.Itoa(part)
+		if IsCompressedDump(path) {
+			name += GZIP_FILE_EXT
+		}
+		if err := copyFile(path, filepath.Join(tmp, name)); err != nil {
+			return err
+		}
+	}
+	if _, err := os.Stat(ws.TablePath(table) + SIZE_FILE_SUFFIX); err == nil {
+		if err := copyFile(ws.TablePath(table)+SIZE_FILE_SUFFIX, filepath.Join(tmp, CACHE_SIZE_FILE)); err != nil {
+			return err
+		}
+	}
+	// Concurrent runs may store the same dump, of which either is fine.
+	if err := os.Rename(tmp, filepath.Join(cache.Dir, key)); err != nil && !os.IsExist(err) {
+		if _, statErr := os.Stat(filepath.Join(cache.Dir, key)); statErr != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (cache *DumpCache) prune(threshold time.Time) error {
+	entries, err := ioutil.ReadDir(cache.Dir)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if entry.IsDir() && entry.ModTime().Before(threshold) {
+			if err := os.RemoveAll(filepath.Join(cache.Dir, entry.Name())); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
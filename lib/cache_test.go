@@ -0,0 +1,52 @@
+package lib
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	. "github.com/timakin/gopli/constants"
+)
+
+func TestDumpCache(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gopli_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	cache, err := OpenDumpCache(Cache{Dir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	src, err := NewWorkspace("gopli_test", WorkspaceConf{MaxFileSize: 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer src.Remove()
+	if err := src.WriteTable("users", []byte("1\ta\n2\tb\n")); err != nil {
+		t.Fatal(err)
+	}
+	columns := []Column{{Table: "users", Name: "id", Type: "int"}}
+	key := DumpKey("users", columns, "1234")
+	if err := cache.Store(key, src, "users"); err != nil {
+		t.Fatal(err)
+	}
+
+	dst, err := NewWorkspace("gopli_test", WorkspaceConf{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dst.Remove()
+	if restored, err := cache.Restore(key, dst, "users"); err != nil || !restored {
+		t.Fatalf("expected the cached dump, got %v (%v)", restored, err)
+	}
+	if files := dst.TableFiles("users"); len(files) != 2 {
+		t.Errorf("expected 2 dump files, got %v", files)
+	}
+
+	columns[0].Type = "bigint"
+	if restored, err := cache.Restore(DumpKey("users", columns, "1234"), dst, "users"); err != nil || restored {
+		t.Errorf("expected a schema change to miss the cache, got %v (%v)", restored, err)
+	}
+}
@@ -0,0 +1,169 @@
+package lib
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+
+	. "github.com/timakin/gopli/constants"
+)
+
+const redactedValue = "********"
+
+// Redacted returns a copy of the configuration with secrets masked, safe to
+// print or attach to bug reports.
+func (tmlconf TomlConfig) Redacted() TomlConfig {
+	redacted := tmlconf
+	redacted.Database = make(map[string]Database, len(tmlconf.Database))
+	for name, dbConf := range tmlconf.Database {
+		if dbConf.Password != "" {
+			dbConf.Password = redactedValue
+		}
+		if dbConf.DrainURL != "" {
+			dbConf.DrainURL = RedactURL(dbConf.DrainURL)
+		}
+		redacted.Database[name] = dbConf
+	}
+	if redacted.Vault.Token != "" {
+		redacted.Vault.Token = redactedValue
+	}
+	if redacted.Vault.SecretID != "" {
+		redacted.Vault.SecretID = redactedValue
+	}
+	redacted.SSH = make(map[string]SSH, len(tmlconf.SSH))
+	for name, sshConf := range tmlconf.SSH {
+		if sshConf.Password != "" {
+			sshConf.Password = redactedValue
+		}
+		if proxy, err := url.Parse(sshConf.ProxyURL); err == nil && proxy.User != nil {
+			if _, ok := proxy.User.Password(); ok {
+				proxy.User = url.UserPassword(proxy.User.Username(), redactedValue)
+				sshConf.ProxyURL = proxy.String()
+			}
+		}
+		redacted.SSH[name] = sshConf
+	}
+	return redacted
+}
+
+// RequireHosts returns an error wrapping ErrConfigMissingSection for the
+// first host without a database section, or an error when the hosts don't
+// share their management system.
+func (tmlconf TomlConfig) RequireHosts(hosts ...string) error {
+	for _, host := range hosts {
+		if _, ok := tmlconf.Database[host]; !ok {
+			return fmt.Errorf("database.%s: %w", host, ErrConfigMissingSection)
+		}
+	}
+	for _, host := range hosts {
+		if system := tmlconf.Database[host].ManagementSystem; system != tmlconf.Database[hosts[0]].ManagementSystem {
+			return fmt.Errorf("database.%s.management_system: %q can't be synced with %q of %s", host, system, tmlconf.Database[hosts[0]].ManagementSystem, hosts[0])
+		}
+	}
+	return nil
+}
+
+// Validate checks the configuration used to sync between the given hosts.
+// Empty host names are ignored. Every problem found is returned.
+func (tmlconf TomlConfig) Validate(hosts ...string) []error {
+	var errs []error
+	for _, host := range hosts {
+		if host == "" {
+			continue
+		}
+		dbConf, ok := tmlconf.Database[host]
+		if !ok {
+			errs = append(errs, fmt.Errorf("database.%s: %w", host, ErrConfigMissingSection))
+			continue
+		}
+		if dbConf.ManagementSystem != MANAGEMENT_SYSTEM_MYSQL && dbConf.ManagementSystem != MANAGEMENT_SYSTEM_POSTGRESQL {
+			errs = append(errs, fmt.Errorf("database.%s.management_system: unsupported %q", host, dbConf.ManagementSystem))
+		}
+		if dbConf.Name == "" {
+			errs = append(errs, fmt.Errorf("database.%s.name: missing", host))
+		}
+		if dbConf.User == "" && !dbConf.UseMyCnf {
+			errs = append(errs, fmt.Errorf("database.%s.user: missing", host))
+		}
+		if _, ok := tmlconf.Database[dbConf.Failover]; dbConf.Failover != "" && !ok {
+			errs = append(errs, fmt.Errorf("database.%s.failover: %w %q", host, ErrConfigMissingSection, dbConf.Failover))
+		}
+		if dbConf.DumpTool != "" && dbConf.DumpTool != DUMP_TOOL_MYSQL && dbConf.DumpTool != DUMP_TOOL_MYSQLSH {
+			errs = append(errs, fmt.Errorf("database.%s.dump_tool: unsupported %q", host, dbConf.DumpTool))
+		}
+		if dbConf.Proxy != "" && dbConf.Proxy != PROXY_PROXYSQL && dbConf.Proxy != PROXY_VITESS {
+			errs = append(errs, fmt.Errorf("database.%s.proxy: unsupported %q", host, dbConf.Proxy))
+		}
+		if dbConf.NativeDriver {
+			if dbConf.ManagementSystem != MANAGEMENT_SYSTEM_MYSQL {
+				errs = append(errs, fmt.Errorf("database.%s.native_driver: only supported for MySQL", host))
+			}
+			if dbConf.UseMyCnf {
+				errs = append(errs, fmt.Errorf("database.%s.native_driver: can't read ~/.my.cnf, set user and password instead of use_my_cnf", host))
+			}
+			if dbConf.DumpTool == DUMP_TOOL_MYSQLSH {
+				errs = append(errs, fmt.Errorf("database.%s.native_driver: can't be combined with dump_tool %q", host, dbConf.DumpTool))
+			}
+			if sshConf, ok := tmlconf.SSH[host]; ok && (sshConf.Transport == TRANSPORT_TELEPORT || sshConf.Transport == TRANSPORT_SSM || sshConf.Auth == SSH_AUTH_GSSAPI) {
+				errs = append(errs, fmt.Errorf("database.%s.native_driver: needs the built-in SSH client, not transport %q or auth %q", host, sshConf.Transport, sshConf.Auth))
+			}
+		}
+		for _, pattern := range append(append([]string(nil), dbConf.IncludeTables...), dbConf.ExcludeTables...) {
+			if err := ValidateTablePattern(pattern); err != nil {
+				errs = append(errs, fmt.Errorf("database.%s: table pattern %q: %v", host, pattern, err))
+			}
+		}
+		if dbConf.Offset < 0 {
+			errs = append(errs, fmt.Errorf("database.%s.offset: negative", host))
+		}
+		for table, settings := range dbConf.Tables {
+			if settings.Limit < 0 {
+				errs = append(errs, fmt.Errorf("database.%s.tables.%s.limit: negative", host, table))
+			}
+			for column, value := range settings.Set {
+				if value == "" {
+					errs = append(errs, fmt.Errorf("database.%s.tables.%s.set.%s: missing", host, table, column))
+				}
+			}
+			if len(settings.Set) > 0 && dbConf.Proxy != "" {
+				errs = append(errs, fmt.Errorf("database.%s.tables.%s.set: can't be applied through %s", host, table, dbConf.Proxy))
+			}
+		}
+		if (dbConf.MaintenanceOn == "") != (dbConf.MaintenanceOff == "") {
+			errs = append(errs, fmt.Errorf("database.%s: maintenance_on and maintenance_off must be set together", host))
+		}
+		if sshConf, ok := tmlconf.SSH[host]; ok && sshConf.Port != "" {
+			if _, err := strconv.Atoi(sshConf.Port); err != nil {
+				errs = append(errs, fmt.Errorf("ssh.%s.port: %v", host, err))
+			}
+		}
+		if sshConf, ok := tmlconf.SSH[host]; ok && sshConf.Transport != "" && sshConf.Transport != TRANSPORT_SSH && sshConf.Transport != TRANSPORT_TELEPORT && sshConf.Transport != TRANSPORT_SSM {
+			errs = append(errs, fmt.Errorf("ssh.%s.transport: unsupported %q", host, sshConf.Transport))
+		}
+		if sshConf, ok := tmlconf.SSH[host]; ok && sshConf.Auth != "" && sshConf.Auth != SSH_AUTH_KEY && sshConf.Auth != SSH_AUTH_GSSAPI {
+			errs = append(errs, fmt.Errorf("ssh.%s.auth: unsupported %q", host, sshConf.Auth))
+		}
+		if sshConf, ok := tmlconf.SSH[host]; ok && sshConf.ProxyURL != "" {
+			if proxy, err := url.Parse(sshConf.ProxyURL); err != nil {
+				errs = append(errs, fmt.Errorf("ssh.%s.proxy_url: %v", host, err))
+			} else if proxy.Scheme != "socks5" && proxy.Scheme != "socks5h" && proxy.Scheme != "http" {
+				errs = append(errs, fmt.Errorf("ssh.%s.proxy_url: unsupported scheme %q", host, proxy.Scheme))
+			}
+		}
+	}
+	for table, selection := range tmlconf.Columns {
+		if len(selection.Include) == 0 {
+			errs = append(errs, fmt.Errorf("columns.%s.include: missing", table))
+		}
+	}
+	if err := ValidateFileNameTemplate(tmlconf.Snapshot.FileName); err != nil {
+		errs = append(errs, fmt.Errorf("snapshot.file_name: %v", err))
+	}
+	if _, err := parseFileMode(tmlconf.Workspace.DirMode, DEFAULT_DIR_MODE); err != nil {
+		errs = append(errs, fmt.Errorf("workspace.dir_mode: %v", err))
+	}
+	if _, err := parseFileMode(tmlconf.Workspace.FileMode, DEFAULT_FILE_MODE); err != nil {
+		errs = append(errs, fmt.Errorf("workspace.file_mode: %v", err))
+	}
+	return errs
+}
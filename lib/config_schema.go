@@ -0,0 +1,65 @@
+package lib
+
+import (
+	"reflect"
+	"strings"
+
+	. "github.com/timakin/gopli/constants"
+)
+
+// configEnums lists the values accepted by settings with a fixed set of
+// values, by their path in the configuration file. Host names are left out
+// of the path.
+var configEnums = map[string][]string{
+	"database.management_system": {MANAGEMENT_SYSTEM_MYSQL, MANAGEMENT_SYSTEM_POSTGRESQL},
+	"database.dump_tool":         {DUMP_TOOL_MYSQL, DUMP_TOOL_MYSQLSH},
+	"database.proxy":             {PROXY_PROXYSQL, PROXY_VITESS},
+	"ssh.transport":              {TRANSPORT_SSH, TRANSPORT_TELEPORT, TRANSPORT_SSM},
+	"ssh.auth":                   {SSH_AUTH_KEY, SSH_AUTH_GSSAPI},
+	"vault.auth_method":          {VAULT_AUTH_TOKEN, VAULT_AUTH_APPROLE, VAULT_AUTH_KUBERNETES},
+	"defaults.log_level":         {LOG_LEVEL_INFO, LOG_LEVEL_ERROR},
+}
+
+// ConfigSchema returns a JSON Schema of the configuration file, for editors
+// to complete and validate configurations with and for tools generating them.
+func ConfigSchema() map[string]interface{} {
+	schema := typeSchema(reflect.TypeOf(TomlConfig{}), "")
+	schema["$schema"] = JSON_SCHEMA_DRAFT
+	schema["title"] = "gopli configuration"
+	return schema
+}
+
+// typeSchema returns the schema of values of type t found at path.
+func typeSchema(t reflect.Type, path string) map[string]interface{} {
+	switch t.Kind() {
+	case reflect.Struct:
+		properties := make(map[string]interface{})
+		for i := 0; i < t.NumField(); i++ {
+			name := strings.Split(t.Field(i).Tag.Get("toml"), ",")[0]
+			if name == "" || name == "-" {
+				continue
+			}
+			properties[name] = typeSchema(t.Field(i).Type, strings.TrimPrefix(path+"."+name, "."))
+		}
+		return map[string]interface{}{"type": "object", "properties": properties, "additionalProperties": false}
+	case reflect.Map:
+		// Maps are keyed by host, table or variable names.
+		return map[string]interface{}{"type": "object", "additionalProperties": typeSchema(t.Elem(), path)}
+	case reflect.Slice:
+		return map[string]interface{}{"type": "array", "items": typeSchema(t.Elem(), path)}
+	case reflect.String:
+		schema := map[string]interface{}{"type": "string"}
+		if enum, ok := configEnums[path]; ok {
+			schema["enum"] = enum
+		}
+		return schema
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	default:
+		return map[string]interface{}{}
+	}
+}
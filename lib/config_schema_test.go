@@ -0,0 +1,61 @@
+package lib
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestConfigSchema(t *testing.T) {
+	schemaBytes, err := json.Marshal(ConfigSchema())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var schema struct {
+		Properties struct {
+			Database struct {
+				AdditionalProperties struct {
+					Properties map[string]struct {
+						Type  string   `json:"type"`
+						Enum  []string `json:"enum"`
+						Items struct {
+							Type string `json:"type"`
+						} `json:"items"`
+					} `json:"properties"`
+					AdditionalProperties bool `json:"additionalProperties"`
+				} `json:"additionalProperties"`
+			} `json:"database"`
+		} `json:"properties"`
+	}
+	if err := json.Unmarshal(schemaBytes, &schema); err != nil {
+		t.Fatal(err)
+	}
+
+	database := schema.Properties.Database.AdditionalProperties
+	if database.AdditionalProperties {
+		t.Error("expected unknown database settings to be rejected")
+	}
+	if host := database.Properties["host"]; host.Type != "string" {
+		t.Errorf("expected host to be a string, got %+v", host)
+	}
+	if concurrency := database.Properties["concurrency"]; concurrency.Type != "integer" {
+		t.Errorf("expected concurrency to be an integer, got %+v", concurrency)
+	}
+	if settings := database.Properties["session_settings"]; settings.Type != "array" || settings.Items.Type != "string" {
+		t.Errorf("expected session_settings to be an array of strings, got %+v", settings)
+	}
+	if proxy := database.Properties["proxy"]; !reflect.DeepEqual(proxy.Enum, []string{"proxysql", "vitess"}) {
+		t.Errorf("expected the proxies as enum, got %+v", proxy)
+	}
+}
+
+func TestConfigSchemaSkipsInternalFields(t *testing.T) {
+	ssh := ConfigSchema()["properties"].(map[string]interface{})["ssh"].(map[string]interface{})["additionalProperties"].(map[string]interface{})
+	properties := ssh["properties"].(map[string]interface{})
+	if _, ok := properties["KeyData"]; ok {
+		t.Error("expected fields without a toml key to be left out")
+	}
+	if _, ok := properties["key"]; !ok {
+		t.Error("expected the ssh key setting")
+	}
+}
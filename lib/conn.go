@@ -2,35 +2,257 @@ package lib
 
 import (
 	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
 
+	"errors"
+	"net"
+	"os"
 	"os/user"
 	"path/filepath"
+	"sync"
 
 	"io/ioutil"
 
-	"log"
+	"fmt"
 	"strings"
+	"time"
+
+	. "github.com/timakin/gopli/constants"
 )
 
-func LoadSrcSSHConf(sshUser string, keypath string) *ssh.ClientConfig {
-	usr, _ := user.Current()
-	keypath = strings.Replace(keypath, "~", usr.HomeDir, 1)
-	absKeyPath, _ := filepath.Abs(keypath)
-	key, err := ioutil.ReadFile(absKeyPath)
+var ignoreHostKeys bool
+
+// IgnoreHostKeys turns host key verification off, for
+// --insecure-ignore-host-key.
+func IgnoreHostKeys(ignore bool) {
+	ignoreHostKeys = ignore
+}
+
+// HostKeysIgnored reports whether host keys go unverified.
+func HostKeysIgnored() bool {
+	return ignoreHostKeys
+}
+
+// LoadSrcSSHConf returns the client configuration of sshConf. The agent, the
+// key and the password are tried in this order, as far as they are set. The
+// password is also answered to keyboard-interactive prompts, which many sshd
+// configurations use in place of password authentication.
+func LoadSrcSSHConf(sshConf SSH) (*ssh.ClientConfig, error) {
+	var auth []ssh.AuthMethod
+	if sshConf.UseAgent {
+		keyring, err := sshAgent()
+		if err != nil {
+			return nil, fmt.Errorf("unable to use ssh-agent: %w", err)
+		}
+		auth = append(auth, ssh.PublicKeysCallback(keyring.Signers))
+	}
+	if sshConf.Key != "" || sshConf.KeyData != nil || (!sshConf.UseAgent && sshConf.Password == "") {
+		signer, err := LoadSigner(sshConf)
+		if err != nil {
+			return nil, fmt.Errorf("unable to load private key: %w", err)
+		}
+		auth = append(auth, ssh.PublicKeys(signer))
+	}
+	if sshConf.Password != "" {
+		auth = append(auth, ssh.Password(sshConf.Password), ssh.KeyboardInteractive(passwordChallenge(sshConf.Password)))
+	}
+
+	hostKeyCallback, err := loadHostKeyCallback(sshConf)
 	if err != nil {
-		log.Fatalf("unable to read private key: %v", err)
+		return nil, err
+	}
+	config := &ssh.ClientConfig{
+		User:            sshConf.User,
+		Auth:            auth,
+		HostKeyCallback: hostKeyCallback,
+	}
+	if !ignoreHostKeys {
+		config.HostKeyAlgorithms = KnownHostKeyAlgorithms(hostKeyCallback, sshConf)
+	}
+	return config, nil
+}
+
+// passwordChallenge answers every keyboard-interactive question with
+// password.
+func passwordChallenge(password string) ssh.KeyboardInteractiveChallenge {
+	return func(user, instruction string, questions []string, echos []bool) ([]string, error) {
+		answers := make([]string, len(questions))
+		for i := range answers {
+			answers[i] = password
+		}
+		return answers, nil
 	}
+}
 
-	signer, err := ssh.ParsePrivateKey(key)
+// KnownHostKeyAlgorithms returns the host key algorithms of the keys known
+// for the host of sshConf, so the server offers a key that can be verified
+// instead of one of a type missing from known_hosts, which would look like a
+// changed key. It returns nil, leaving the defaults, for unknown hosts.
+func KnownHostKeyAlgorithms(callback ssh.HostKeyCallback, sshConf SSH) []string {
+	port := sshConf.Port
+	if port == "" {
+		port = SSH_DEFAULT_PORT
+	}
+	// No key matches the probe, so the error lists the known ones.
+	host := strings.TrimSuffix(strings.TrimPrefix(sshConf.Host, "["), "]")
+	err := callback(net.JoinHostPort(host, port), &net.TCPAddr{}, probeKey{})
+	var keyErr *knownhosts.KeyError
+	if !errors.As(err, &keyErr) {
+		return nil
+	}
+	var algorithms []string
+	for _, known := range keyErr.Want {
+		switch keyType := known.Key.Type(); keyType {
+		case ssh.KeyAlgoRSA:
+			algorithms = append(algorithms, ssh.KeyAlgoRSASHA512, ssh.KeyAlgoRSASHA256, ssh.KeyAlgoRSA)
+		default:
+			algorithms = append(algorithms, keyType)
+		}
+	}
+	return algorithms
+}
+
+// probeKey is a host key of no algorithm, matching no known key.
+type probeKey struct{}
+
+func (probeKey) Type() string                                 { return "" }
+func (probeKey) Marshal() []byte                              { return nil }
+func (probeKey) Verify(data []byte, sig *ssh.Signature) error { return errors.New("probe key") }
+
+var (
+	agentMu     sync.Mutex
+	agentClient agent.ExtendedAgent
+)
+
+// sshAgent returns a client of the agent at SSH_AUTH_SOCK, shared by every
+// connection.
+func sshAgent() (agent.ExtendedAgent, error) {
+	agentMu.Lock()
+	defer agentMu.Unlock()
+	if agentClient != nil {
+		return agentClient, nil
+	}
+	sock := os.Getenv(SSH_AGENT_SOCK_ENV)
+	if sock == "" {
+		return nil, errors.New(SSH_AGENT_SOCK_ENV + " is not set")
+	}
+	conn, err := net.Dial("unix", sock)
 	if err != nil {
-		log.Fatalf("unable to parse private key: %v", err)
+		return nil, err
 	}
+	agentClient = agent.NewClient(conn)
+	return agentClient, nil
+}
 
-	config := &ssh.ClientConfig{
-		User: sshUser,
-		Auth: []ssh.AuthMethod{
-			ssh.PublicKeys(signer),
-		},
+// loadHostKeyCallback verifies host keys against the known_hosts file of
+// sshConf, explaining unknown and changed keys.
+func loadHostKeyCallback(sshConf SSH) (ssh.HostKeyCallback, error) {
+	if ignoreHostKeys {
+		return ssh.InsecureIgnoreHostKey(), nil
+	}
+	path := sshConf.KnownHosts
+	if path == "" {
+		path = KNOWN_HOSTS_FILE
+	}
+	callback, err := knownhosts.New(expandPath(path))
+	if err != nil {
+		return nil, fmt.Errorf("unable to read known hosts, pass --insecure-ignore-host-key to connect without verifying host keys: %w", err)
+	}
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		err := callback(hostname, remote, key)
+		var keyErr *knownhosts.KeyError
+		if errors.As(err, &keyErr) {
+			if len(keyErr.Want) == 0 {
+				return &hostKeyError{fmt.Sprintf("host key of %s is not in %s, add it with ssh-keyscan or connect once with ssh", hostname, path), keyErr}
+			}
+			return &hostKeyError{fmt.Sprintf("host key of %s does not match %s:%d, the host may have been reinstalled or the connection intercepted", hostname, keyErr.Want[0].Filename, keyErr.Want[0].Line), keyErr}
+		}
+		return err
+	}, nil
+}
+
+// hostKeyError explains a *knownhosts.KeyError, which it wraps.
+type hostKeyError struct {
+	message string
+	err     *knownhosts.KeyError
+}
+
+func (e *hostKeyError) Error() string {
+	return e.message
+}
+
+func (e *hostKeyError) Unwrap() error {
+	return e.err
+}
+
+// LoadSigner reads the private key of sshConf. When the configured
+// certificate, or the <key>-cert.pub file OpenSSH would pick up, holds a
+// certificate, the key authenticates with the certificate. Keys and
+// certificates read from a secret store are used in place of the files.
+func LoadSigner(sshConf SSH) (ssh.Signer, error) {
+	signer, err := loadPrivateKey(sshConf)
+	if err != nil {
+		return nil, err
 	}
-	return config
+
+	keypath := expandPath(sshConf.Key)
+	certpath := sshConf.Cert
+	certBytes := sshConf.CertData
+	if certBytes == nil {
+		if certpath == "" {
+			certpath = keypath + "-cert.pub"
+			if _, err := os.Stat(certpath); err != nil || sshConf.KeyData != nil {
+				return signer, nil
+			}
+		}
+		if certBytes, err = ioutil.ReadFile(expandPath(certpath)); err != nil {
+			return nil, err
+		}
+	}
+	pub, _, _, _, err := ssh.ParseAuthorizedKey(certBytes)
+	if err != nil {
+		return nil, err
+	}
+	cert, ok := pub.(*ssh.Certificate)
+	if !ok {
+		return nil, fmt.Errorf("%s is not a certificate", certpath)
+	}
+	if cert.ValidBefore != ssh.CertTimeInfinity && time.Now().Unix() >= int64(cert.ValidBefore) {
+		return nil, fmt.Errorf("certificate %s expired at %s", certpath, time.Unix(int64(cert.ValidBefore), 0).Format(time.RFC3339))
+	}
+	return ssh.NewCertSigner(cert, signer)
+}
+
+func loadPrivateKey(sshConf SSH) (ssh.Signer, error) {
+	key := sshConf.KeyData
+	if key == nil {
+		var err error
+		if key, err = ioutil.ReadFile(expandPath(sshConf.Key)); err != nil {
+			return nil, err
+		}
+	}
+	signer, err := ssh.ParsePrivateKey(key)
+	if _, ok := err.(*ssh.PassphraseMissingError); ok {
+		name := sshConf.Key
+		if sshConf.KeyData != nil {
+			name = "the key of " + sshConf.Host
+		}
+		passphrase, err := askSecret("ssh key "+name, T("Passphrase for ")+name+": ")
+		if err == errNoTerminal || err == errNoPrompt {
+			return nil, fmt.Errorf("%s is encrypted: %w, and %v to ask for its passphrase", name, ErrCredentialsMissing, err)
+		}
+		if err != nil {
+			return nil, err
+		}
+		return ssh.ParsePrivateKeyWithPassphrase(key, []byte(passphrase))
+	}
+	return signer, err
+}
+
+func expandPath(path string) string {
+	usr, _ := user.Current()
+	path = strings.Replace(path, "~", usr.HomeDir, 1)
+	absPath, _ := filepath.Abs(path)
+	return absPath
 }
@@ -0,0 +1,149 @@
+package lib
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	. "github.com/timakin/gopli/constants"
+	"golang.org/x/crypto/ssh"
+)
+
+func TestLoadSignerWithCertificate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gopli-cert")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	_, userKey, _ := ed25519.GenerateKey(rand.Reader)
+	_, caKey, _ := ed25519.GenerateKey(rand.Reader)
+	der, err := x509.MarshalPKCS8PrivateKey(userKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keypath := filepath.Join(dir, "id_ed25519")
+	ioutil.WriteFile(keypath, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0600)
+
+	userSigner, _ := ssh.NewSignerFromKey(userKey)
+	caSigner, _ := ssh.NewSignerFromKey(caKey)
+	writeCert := func(validBefore time.Time) {
+		cert := &ssh.Certificate{
+			Key:             userSigner.PublicKey(),
+			CertType:        ssh.UserCert,
+			ValidPrincipals: []string{"deploy"},
+			ValidBefore:     uint64(validBefore.Unix()),
+		}
+		if err := cert.SignCert(rand.Reader, caSigner); err != nil {
+			t.Fatal(err)
+		}
+		ioutil.WriteFile(keypath+"-cert.pub", ssh.MarshalAuthorizedKey(cert), 0600)
+	}
+
+	writeCert(time.Now().Add(time.Hour))
+	signer, err := LoadSigner(SSH{Key: keypath})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := signer.PublicKey().(*ssh.Certificate); !ok {
+		t.Error("expected the certificate next to the key to be used")
+	}
+
+	writeCert(time.Now().Add(-time.Hour))
+	if _, err := LoadSigner(SSH{Key: keypath}); err == nil {
+		t.Error("expected an error for an expired certificate")
+	}
+}
+
+func TestLoadHostKeyCallback(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gopli-known-hosts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	hostPublic, _, _ := ed25519.GenerateKey(rand.Reader)
+	otherPublic, _, _ := ed25519.GenerateKey(rand.Reader)
+	hostKey, _ := ssh.NewPublicKey(hostPublic)
+	otherKey, _ := ssh.NewPublicKey(otherPublic)
+	path := filepath.Join(dir, "known_hosts")
+	ioutil.WriteFile(path, []byte("bastion.example.com "+string(ssh.MarshalAuthorizedKey(hostKey))), 0600)
+
+	remote := &net.TCPAddr{IP: net.ParseIP("192.0.2.1"), Port: 22}
+	callback, err := loadHostKeyCallback(SSH{KnownHosts: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := callback("bastion.example.com:22", remote, hostKey); err != nil {
+		t.Errorf("unexpected error %v", err)
+	}
+	if err := callback("bastion.example.com:22", remote, otherKey); err == nil {
+		t.Error("expected a changed host key to be refused")
+	}
+	if err := callback("db.example.com:22", remote, hostKey); err == nil {
+		t.Error("expected an unknown host to be refused")
+	}
+
+	IgnoreHostKeys(true)
+	defer IgnoreHostKeys(false)
+	callback, err = loadHostKeyCallback(SSH{KnownHosts: filepath.Join(dir, "missing")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := callback("db.example.com:22", remote, otherKey); err != nil {
+		t.Errorf("expected host keys to be ignored, got %v", err)
+	}
+}
+
+func TestKnownHostKeyAlgorithms(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gopli-known-hosts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	edPublic, _, _ := ed25519.GenerateKey(rand.Reader)
+	edKey, _ := ssh.NewPublicKey(edPublic)
+	rsaPrivate, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaKey, _ := ssh.NewPublicKey(&rsaPrivate.PublicKey)
+	path := filepath.Join(dir, "known_hosts")
+	known := "bastion.example.com " + string(ssh.MarshalAuthorizedKey(edKey)) +
+		"[db.example.com]:2222 " + string(ssh.MarshalAuthorizedKey(rsaKey))
+	ioutil.WriteFile(path, []byte(known), 0600)
+
+	callback, err := loadHostKeyCallback(SSH{KnownHosts: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []struct {
+		conf SSH
+		want []string
+	}{
+		{SSH{Host: "bastion.example.com"}, []string{ssh.KeyAlgoED25519}},
+		{SSH{Host: "db.example.com", Port: "2222"}, []string{ssh.KeyAlgoRSASHA512, ssh.KeyAlgoRSASHA256, ssh.KeyAlgoRSA}},
+		{SSH{Host: "unknown.example.com"}, nil},
+	} {
+		if got := KnownHostKeyAlgorithms(callback, c.conf); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("KnownHostKeyAlgorithms(%s) = %v, want %v", c.conf.Host, got, c.want)
+		}
+	}
+}
+
+func TestPasswordChallenge(t *testing.T) {
+	answers, err := passwordChallenge("secret")("app", "", []string{"Password: ", "Verification: "}, []bool{false, false})
+	if err != nil || !reflect.DeepEqual(answers, []string{"secret", "secret"}) {
+		t.Errorf("unexpected answers %q, %v", answers, err)
+	}
+}
@@ -0,0 +1,48 @@
+package lib
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	. "github.com/timakin/gopli/constants"
+)
+
+// WriteDDLFile saves statements as a timestamped migration file in dir,
+// named after name, and returns its path.
+func WriteDDLFile(dir string, name string, statements []DDLStatement) (string, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	fileName := fmt.Sprintf(DDL_FILE_NAME_FORMAT, time.Now().Format(DDL_FILE_TIME_FORMAT), sanitizeFileName(name))
+	path := filepath.Join(dir, fileName)
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_EXCL, 0644)
+	if err != nil {
+		return "", err
+	}
+	if _, err := file.WriteString(JoinDDL(statements) + "\n"); err != nil {
+		file.Close()
+		return "", err
+	}
+	return path, file.Close()
+}
+
+func sanitizeFileName(name string) string {
+	return strings.Map(func(r rune) rune {
+		if isSafeFileRune(r) && r != '.' {
+			return r
+		}
+		return '_'
+	}, name)
+}
+
+// JoinDDL renders statements as a SQL script.
+func JoinDDL(statements []DDLStatement) string {
+	sqls := make([]string, len(statements))
+	for i, statement := range statements {
+		sqls[i] = statement.SQL
+	}
+	return strings.Join(sqls, "\n\n")
+}
@@ -0,0 +1,39 @@
+package lib
+
+import "strings"
+
+// DestinationResult is the outcome of loading into one of several
+// destinations.
+type DestinationResult struct {
+	Host string `json:"host"`
+	// Seeds lists the seed files applied after the load.
+	Seeds []string `json:"seeds,omitempty"`
+	Error string   `json:"error,omitempty"`
+}
+
+// SplitHosts returns the comma separated host names of hosts, ignoring
+// blanks and duplicates.
+func SplitHosts(hosts string) []string {
+	var split []string
+	seen := make(map[string]bool)
+	for _, host := range strings.Split(hosts, ",") {
+		host = strings.TrimSpace(host)
+		if host == "" || seen[host] {
+			continue
+		}
+		seen[host] = true
+		split = append(split, host)
+	}
+	return split
+}
+
+// FailedDestinations returns the hosts of the destinations that failed.
+func (report *Report) FailedDestinations() []string {
+	var failed []string
+	for _, result := range report.Destinations {
+		if result.Error != "" {
+			failed = append(failed, result.Host)
+		}
+	}
+	return failed
+}
@@ -0,0 +1,28 @@
+package lib
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSplitHosts(t *testing.T) {
+	got := SplitHosts(" staging, qa,,staging ")
+	want := []string{"staging", "qa"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("SplitHosts = %v, want %v", got, want)
+	}
+	if got := SplitHosts("staging"); !reflect.DeepEqual(got, []string{"staging"}) {
+		t.Errorf("SplitHosts = %v, want [staging]", got)
+	}
+}
+
+func TestFailedDestinations(t *testing.T) {
+	report := NewReport("production", "staging,qa")
+	report.Destinations = []DestinationResult{
+		{Host: "staging"},
+		{Host: "qa", Error: "Failed to insert: timeout"},
+	}
+	if got := report.FailedDestinations(); !reflect.DeepEqual(got, []string{"qa"}) {
+		t.Errorf("FailedDestinations = %v, want [qa]", got)
+	}
+}
@@ -3,6 +3,10 @@ package lib
 import (
 	"github.com/k0kubun/pp"
 	"os"
+	"os/user"
+	"path/filepath"
+	"strings"
+	"time"
 )
 
 func Isnil(x interface{}) bool {
@@ -15,3 +19,38 @@ func DeleteTmpDir(dirPath string) {
 		pp.Print(err)
 	}
 }
+
+// ExpandPath replaces a leading "~" with the home directory of the current
+// user and returns the absolute path.
+func ExpandPath(path string) (string, error) {
+	if strings.HasPrefix(path, "~") {
+		usr, err := user.Current()
+		if err != nil {
+			return "", err
+		}
+		path = strings.Replace(path, "~", usr.HomeDir, 1)
+	}
+	return filepath.Abs(path)
+}
+
+// FindStaleTmpDirs returns the directories matching pattern which have not
+// been modified for longer than olderThan.
+func FindStaleTmpDirs(pattern string, olderThan time.Duration) ([]string, error) {
+	matches, err := filepath.Glob(pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	threshold := time.Now().Add(-olderThan)
+	var stale []string
+	for _, match := range matches {
+		info, err := os.Stat(match)
+		if err != nil || !info.IsDir() {
+			continue
+		}
+		if info.ModTime().Before(threshold) {
+			stale = append(stale, match)
+		}
+	}
+	return stale, nil
+}
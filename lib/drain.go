@@ -0,0 +1,41 @@
+package lib
+
+import (
+	"context"
+	"log"
+	"os/exec"
+	"time"
+
+	. "github.com/timakin/gopli/constants"
+)
+
+// RunDrainHook asks the application using a destination to stop, by posting
+// a drain notification to DrainURL and running DrainCommand.
+func RunDrainHook(dbConf Database) error {
+	if dbConf.DrainURL != "" {
+		log.Print("[Drain] notifying " + RedactURL(dbConf.DrainURL))
+		err := Notify(dbConf.DrainURL, Notification{
+			Event:   NOTIFY_EVENT_DRAIN,
+			To:      dbConf.Name,
+			Message: dbConf.Name + " is about to be replaced",
+			At:      time.Now(),
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if dbConf.DrainCommand != "" {
+		log.Print("[Drain] running " + dbConf.DrainCommand)
+		ctx, cancel := context.WithTimeout(context.Background(), DRAIN_HOOK_TIMEOUT_SECONDS*time.Second)
+		defer cancel()
+		cmd := exec.CommandContext(ctx, "sh", "-c", dbConf.DrainCommand)
+		// Through the logger, so its output shows in the progress screen
+		// instead of being drawn over.
+		cmd.Stdout = log.Writer()
+		cmd.Stderr = log.Writer()
+		if err := cmd.Run(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
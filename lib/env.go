@@ -0,0 +1,70 @@
+package lib
+
+import (
+	"os"
+	"strconv"
+
+	. "github.com/timakin/gopli/constants"
+)
+
+// LoadEnvConf builds a configuration for a single job from environment
+// variables, so containers can run without a configuration file.
+// The source is read from GOPLI_SRC_* and the destination from GOPLI_DST_*.
+func LoadEnvConf() (tmlconf TomlConfig) {
+	tmlconf.Database = map[string]Database{
+		ENV_SOURCE_NAME:      loadEnvDatabase(ENV_SOURCE_PREFIX),
+		ENV_DESTINATION_NAME: loadEnvDatabase(ENV_DESTINATION_PREFIX),
+	}
+	tmlconf.SSH = map[string]SSH{
+		ENV_SOURCE_NAME:      loadEnvSSH(ENV_SOURCE_PREFIX),
+		ENV_DESTINATION_NAME: loadEnvSSH(ENV_DESTINATION_PREFIX),
+	}
+	tmlconf.Snapshot = Snapshot{
+		Dir:      os.Getenv("GOPLI_SNAPSHOT_DIR"),
+		KeepLast: envInt("GOPLI_SNAPSHOT_KEEP_LAST"),
+		KeepDays: envInt("GOPLI_SNAPSHOT_KEEP_DAYS"),
+	}
+	tmlconf.Workspace = WorkspaceConf{
+		DirMode:     os.Getenv("GOPLI_WORKSPACE_DIR_MODE"),
+		FileMode:    os.Getenv("GOPLI_WORKSPACE_FILE_MODE"),
+		MaxRowSize:  envInt("GOPLI_WORKSPACE_MAX_ROW_SIZE"),
+		MaxFileSize: int64(envInt("GOPLI_WORKSPACE_MAX_FILE_SIZE")),
+	}
+	return tmlconf
+}
+
+func loadEnvDatabase(prefix string) Database {
+	managementSystem := os.Getenv(prefix + "DB_MANAGEMENT_SYSTEM")
+	if managementSystem == "" {
+		managementSystem = MANAGEMENT_SYSTEM_MYSQL
+	}
+	isContainer, _ := strconv.ParseBool(os.Getenv(prefix + "DB_IS_CONTAINER"))
+	noPassword, _ := strconv.ParseBool(os.Getenv(prefix + "DB_NO_PASSWORD"))
+	return Database{
+		Host:             os.Getenv(prefix + "DB_HOST"),
+		ManagementSystem: managementSystem,
+		Name:             os.Getenv(prefix + "DB_NAME"),
+		User:             os.Getenv(prefix + "DB_USER"),
+		Password:         os.Getenv(prefix + "DB_PASSWORD"),
+		IsContainer:      isContainer,
+		NoPassword:       noPassword,
+	}
+}
+
+func loadEnvSSH(prefix string) SSH {
+	port := os.Getenv(prefix + "SSH_PORT")
+	if port == "" {
+		port = "22"
+	}
+	return SSH{
+		Host: os.Getenv(prefix + "SSH_HOST"),
+		Port: port,
+		User: os.Getenv(prefix + "SSH_USER"),
+		Key:  os.Getenv(prefix + "SSH_KEY"),
+	}
+}
+
+func envInt(name string) int {
+	value, _ := strconv.Atoi(os.Getenv(name))
+	return value
+}
@@ -0,0 +1,175 @@
+package lib
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	. "github.com/timakin/gopli/constants"
+)
+
+// The causes of failures programs driving gopli can branch on with
+// errors.Is. Returned errors wrap them with the details.
+var (
+	// ErrConfigMissingSection is a host without a section in the configuration.
+	ErrConfigMissingSection = errors.New("missing section")
+	// ErrInvalidConfig is a configuration file that can't be read, or
+	// secrets it refers to that can't be resolved.
+	ErrInvalidConfig = errors.New("invalid configuration")
+	// ErrCredentialsMissing is a password or passphrase that isn't
+	// configured and can't be asked for.
+	ErrCredentialsMissing = errors.New("credentials missing")
+	// ErrConnectionFailed is a host that can't be reached.
+	ErrConnectionFailed = errors.New("connection failed")
+	// ErrSSHFailed is an SSH server that can't be connected to.
+	ErrSSHFailed = errors.New("ssh connection failed")
+	// ErrTableSchemaMismatch is a table whose schema differs between hosts.
+	ErrTableSchemaMismatch = errors.New("table schema mismatch")
+	// ErrLocalInfileDisabled is a destination refusing LOAD DATA LOCAL INFILE.
+	ErrLocalInfileDisabled = errors.New("LOAD DATA LOCAL INFILE is disabled")
+	// ErrLockWaitTimeout is a delete or load that gave up waiting for a lock.
+	ErrLockWaitTimeout = errors.New("lock wait timeout")
+	// ErrAuthenticationFailed is a database refusing the configured user.
+	ErrAuthenticationFailed = errors.New("authentication failed")
+	// ErrDumpIncomplete is a dump holding far fewer rows than the source
+	// table, often a failure of the source going unnoticed.
+	ErrDumpIncomplete = errors.New("incomplete dump")
+	// ErrDataMismatch is a table whose rows differ between hosts.
+	ErrDataMismatch = errors.New("data mismatch")
+	// ErrNoTables is a source without any table to sync.
+	ErrNoTables = errors.New("no tables to sync")
+)
+
+// ExitError is a failure exiting with Code instead of the code of its cause.
+type ExitError struct {
+	Code int
+	Err  error
+}
+
+func (exitError *ExitError) Error() string {
+	return exitError.Err.Error()
+}
+
+// Unwrap returns the failure, so errors.Is still finds its cause.
+func (exitError *ExitError) Unwrap() error {
+	return exitError.Err
+}
+
+// ExitCode returns the exit code of the CLI for err, 0 for nil.
+func ExitCode(err error) int {
+	var exitError *ExitError
+	var mysqlError *MySQLError
+	switch {
+	case err == nil:
+		return 0
+	case errors.As(err, &exitError):
+		return exitError.Code
+	case errors.Is(err, ErrConfigMissingSection), errors.Is(err, ErrCredentialsMissing), errors.Is(err, ErrInvalidConfig):
+		return EXIT_CONFIG
+	case errors.Is(err, ErrAuthenticationFailed):
+		return EXIT_AUTHENTICATION
+	case errors.Is(err, ErrSSHFailed):
+		return EXIT_SSH
+	case errors.Is(err, ErrConnectionFailed):
+		return EXIT_CONNECTION
+	case errors.Is(err, ErrTableSchemaMismatch):
+		return EXIT_SCHEMA_MISMATCH
+	case errors.Is(err, ErrLocalInfileDisabled):
+		return EXIT_LOCAL_INFILE_DISABLED
+	case errors.Is(err, ErrLockWaitTimeout):
+		return EXIT_LOCK_WAIT_TIMEOUT
+	case errors.Is(err, ErrDataMismatch):
+		return EXIT_DATA_MISMATCH
+	case errors.As(err, &mysqlError):
+		return EXIT_DATABASE
+	default:
+		return EXIT_FAILURE
+	}
+}
+
+// TableErrors collects the failures of individual tables during a phase.
+type TableErrors struct {
+	Phase string
+	// Skipped is set when the failed tables were dropped from the run
+	// instead of aborting it.
+	Skipped bool
+
+	mu     sync.Mutex
+	errors map[string]error
+}
+
+// NewTableErrors returns an empty collection for phase.
+func NewTableErrors(phase string) *TableErrors {
+	return &TableErrors{Phase: phase, errors: make(map[string]error)}
+}
+
+// Add records the failure of table. It is safe for concurrent use.
+func (tableErrors *TableErrors) Add(table string, err error) {
+	tableErrors.mu.Lock()
+	defer tableErrors.mu.Unlock()
+	tableErrors.errors[table] = err
+}
+
+// Get returns the failure of table, or nil when it didn't fail.
+func (tableErrors *TableErrors) Get(table string) error {
+	tableErrors.mu.Lock()
+	defer tableErrors.mu.Unlock()
+	return tableErrors.errors[table]
+}
+
+// Unwrap returns the failures of the tables, so errors.Is finds their causes.
+func (tableErrors *TableErrors) Unwrap() []error {
+	tableErrors.mu.Lock()
+	defer tableErrors.mu.Unlock()
+	errs := make([]error, 0, len(tableErrors.errors))
+	for _, err := range tableErrors.errors {
+		errs = append(errs, err)
+	}
+	return errs
+}
+
+// Len returns the number of failed tables.
+func (tableErrors *TableErrors) Len() int {
+	tableErrors.mu.Lock()
+	defer tableErrors.mu.Unlock()
+	return len(tableErrors.errors)
+}
+
+// Tables returns the failed tables in order.
+func (tableErrors *TableErrors) Tables() []string {
+	tableErrors.mu.Lock()
+	defer tableErrors.mu.Unlock()
+	tables := make([]string, 0, len(tableErrors.errors))
+	for table := range tableErrors.errors {
+		tables = append(tables, table)
+	}
+	sort.Strings(tables)
+	return tables
+}
+
+// Messages returns the error message of every failed table.
+func (tableErrors *TableErrors) Messages() map[string]string {
+	tableErrors.mu.Lock()
+	defer tableErrors.mu.Unlock()
+	messages := make(map[string]string)
+	for table, err := range tableErrors.errors {
+		messages[table] = err.Error()
+	}
+	return messages
+}
+
+func (tableErrors *TableErrors) Error() string {
+	messages := tableErrors.Messages()
+	tables := make([]string, 0, len(messages))
+	for table := range messages {
+		tables = append(tables, table)
+	}
+	sort.Strings(tables)
+	var failures []string
+	for _, table := range tables {
+		failures = append(failures, table+": "+messages[table])
+	}
+	return fmt.Sprintf("%s failed for %d tables (%s)", tableErrors.Phase, len(failures), strings.Join(failures, "; "))
+}
@@ -0,0 +1,70 @@
+package lib
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"testing"
+
+	. "github.com/timakin/gopli/constants"
+)
+
+func TestExitCode(t *testing.T) {
+	tableErrors := NewTableErrors("load")
+	tableErrors.Add("users", fmt.Errorf("%w: ERROR 3948", ErrLocalInfileDisabled))
+
+	for _, test := range []struct {
+		err  error
+		code int
+	}{
+		{nil, 0},
+		{errors.New("exit status 1"), EXIT_FAILURE},
+		{fmt.Errorf("Invalid configuration: %w", TomlConfig{}.RequireHosts("staging")), EXIT_CONFIG},
+		{fmt.Errorf("Failed to connect to production: %w: timeout", ErrConnectionFailed), EXIT_CONNECTION},
+		{fmt.Errorf("Failed to connect to production: %w: %w to bastion: timeout", ErrConnectionFailed, ErrSSHFailed), EXIT_SSH},
+		{fmt.Errorf("%w: gopli.toml: expected a value", ErrInvalidConfig), EXIT_CONFIG},
+		{&MySQLError{Code: 1146, Message: "Table 'app.users' doesn't exist", Err: errors.New("exit status 1")}, EXIT_DATABASE},
+		{fmt.Errorf("Failed to insert: %w", tableErrors), EXIT_LOCAL_INFILE_DISABLED},
+		{(&SchemaDiff{ChangedTables: []string{"users"}}).Err(), EXIT_SCHEMA_MISMATCH},
+		{(&VerifyReport{Tables: []VerifyEntry{{Table: "users", Status: VERIFY_STATUS_MISMATCH}}}).Err(), EXIT_DATA_MISMATCH},
+		{fmt.Errorf("Failed to fetch: %w", &ExitError{Code: 10, Err: ErrNoTables}), 10},
+	} {
+		if code := ExitCode(test.err); code != test.code {
+			t.Errorf("ExitCode(%v) = %d, want %d", test.err, code, test.code)
+		}
+	}
+}
+
+func TestRequireHosts(t *testing.T) {
+	tmlconf := TomlConfig{Database: map[string]Database{"production": {}}}
+	if err := tmlconf.RequireHosts("production"); err != nil {
+		t.Errorf("unexpected error %v", err)
+	}
+	if err := tmlconf.RequireHosts("production", "staging"); !errors.Is(err, ErrConfigMissingSection) || err.Error() != "database.staging: missing section" {
+		t.Errorf("expected the missing staging section, got %v", err)
+	}
+
+	tmlconf.Database["production"] = Database{ManagementSystem: MANAGEMENT_SYSTEM_MYSQL}
+	tmlconf.Database["staging"] = Database{ManagementSystem: MANAGEMENT_SYSTEM_POSTGRESQL}
+	if err := tmlconf.RequireHosts("production", "staging"); err == nil {
+		t.Error("expected an error syncing MySQL into PostgreSQL")
+	}
+}
+
+func TestTableErrorsConcurrentError(t *testing.T) {
+	tableErrors := NewTableErrors("load")
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			tableErrors.Add("table"+strconv.Itoa(i), errors.New("exit status 1"))
+			_ = tableErrors.Error()
+		}(i)
+	}
+	wg.Wait()
+	if msg := tableErrors.Error(); msg == "" || tableErrors.Len() != 10 {
+		t.Errorf("unexpected error %q", msg)
+	}
+}
@@ -2,14 +2,154 @@ package lib
 
 import (
 	"bufio"
+	"fmt"
+	"io"
 	"os"
+	"path"
+	"regexp"
+	"strings"
+
+	. "github.com/timakin/gopli/constants"
 )
 
-var tableBlackList = [4]string{"ar_internal_metadata", "schema_migrations", "repli_chk", "repli_clock"}
+var defaultInternalTables = []string{"ar_internal_metadata", "schema_migrations", "repli_chk", "repli_clock"}
+
+// internalTables are the tables never synced, see SetInternalTables.
+var internalTables = defaultInternalTables
+
+// noDataEngines hold no data of their own, so dumping and loading them is
+// meaningless or harmful. Views and MariaDB sequences are listed by their
+// table type.
+var noDataEngines = []string{"FEDERATED", "BLACKHOLE", "MRG_MYISAM", "MERGE", "CONNECT", "VIEW", "SYSTEM VIEW", "SEQUENCE"}
+
+// IsDataEngine reports whether tables of engine hold data worth syncing.
+func IsDataEngine(engine string) bool {
+	for _, noDataEngine := range noDataEngines {
+		if strings.EqualFold(engine, noDataEngine) {
+			return false
+		}
+	}
+	return true
+}
+
+// ignoreTableCase makes table names match regardless of their case, as they
+// do on servers running with lower_case_table_names.
+var ignoreTableCase bool
+
+// IgnoreTableCase switches case-insensitive table name matching on or off.
+func IgnoreTableCase(ignore bool) {
+	ignoreTableCase = ignore
+}
+
+// SetInternalTables replaces the tables never synced, or restores the default
+// ones when tables is nil.
+func SetInternalTables(tables []string) {
+	if tables == nil {
+		tables = defaultInternalTables
+	}
+	internalTables = tables
+}
+
+// NormalizeTableName strips the whitespace and line terminators around name.
+func NormalizeTableName(name string) string {
+	return strings.TrimSpace(name)
+}
+
+// SameTable reports whether a and b name the same table.
+func SameTable(a string, b string) bool {
+	return TableKey(a) == TableKey(b)
+}
+
+// TableKey returns the form of name used to look tables up, e.g. as a map key.
+func TableKey(name string) string {
+	name = NormalizeTableName(name)
+	if ignoreTableCase {
+		return strings.ToLower(name)
+	}
+	return name
+}
+
+// IsExcludedTable reports whether table is never synced, in any schema.
+func IsExcludedTable(table string) bool {
+	return isListedTable(internalTables, ParseTableName(table).Name)
+}
+
+// TableClass returns TABLE_CLASS_SCHEMA_ONLY or TABLE_CLASS_DATA_ONLY when
+// filter marks table as such, or an empty string for tables synced in full.
+// Unqualified names match the table in any schema.
+func TableClass(filter Filter, table string) string {
+	switch {
+	case isListedTable(filter.SchemaOnly, table):
+		return TABLE_CLASS_SCHEMA_ONLY
+	case isListedTable(filter.DataOnly, table):
+		return TABLE_CLASS_DATA_ONLY
+	}
+	return ""
+}
+
+// IsFilteredOut reports whether the table patterns of filter leave table out:
+// it matches an Exclude pattern, or Include patterns are set and it matches
+// none.
+func IsFilteredOut(filter Filter, table string) bool {
+	for _, pattern := range filter.Exclude {
+		if MatchTablePattern(pattern, table) {
+			return true
+		}
+	}
+	for _, pattern := range filter.Include {
+		if MatchTablePattern(pattern, table) {
+			return false
+		}
+	}
+	return len(filter.Include) > 0
+}
+
+// MatchTablePattern reports whether table matches a glob, or a regular
+// expression written as /regexp/. Unqualified patterns match the table in
+// any schema. Invalid patterns match nothing.
+func MatchTablePattern(pattern string, table string) bool {
+	parsed := ParseTableName(table)
+	names := []string{parsed.Name}
+	if parsed.Schema != "" {
+		names = append(names, parsed.Schema+"."+parsed.Name)
+	}
+	if len(pattern) > 1 && strings.HasPrefix(pattern, "/") && strings.HasSuffix(pattern, "/") {
+		expr := pattern[1 : len(pattern)-1]
+		if ignoreTableCase {
+			expr = "(?i)" + expr
+		}
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return false
+		}
+		for _, name := range names {
+			if re.MatchString(name) {
+				return true
+			}
+		}
+		return false
+	}
+	for _, name := range names {
+		if matched, _ := path.Match(TableKey(pattern), TableKey(name)); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidateTablePattern returns why pattern is not a valid glob or /regexp/.
+func ValidateTablePattern(pattern string) error {
+	if len(pattern) > 1 && strings.HasPrefix(pattern, "/") && strings.HasSuffix(pattern, "/") {
+		_, err := regexp.Compile(pattern[1 : len(pattern)-1])
+		return err
+	}
+	_, err := path.Match(pattern, "")
+	return err
+}
 
-func isInBlackList(table string) bool {
-	for _, blackListElem := range tableBlackList {
-		if blackListElem == table {
+func isListedTable(list []string, table string) bool {
+	for _, listed := range list {
+		if SameTable(listed, table) || SameTable(listed, ParseTableName(table).Name) {
 			return true
 		}
 	}
@@ -17,6 +157,14 @@ func isInBlackList(table string) bool {
 }
 
 func ReadLines(path string) ([]string, error) {
+	return ReadLinesLimit(path, MAX_LINE_SIZE)
+}
+
+// ReadLinesLimit reads the table names listed in path, failing instead of
+// truncating when a line is longer than maxLineSize bytes. A maxLineSize of 0
+// means no limit. Names are normalized, and blank lines and blacklisted tables
+// are dropped.
+func ReadLinesLimit(path string, maxLineSize int) ([]string, error) {
 	file, err := os.Open(path)
 	if err != nil {
 		return nil, err
@@ -24,12 +172,39 @@ func ReadLines(path string) ([]string, error) {
 	defer file.Close()
 
 	var lines []string
-	scanner := bufio.NewScanner(file)
-	for scanner.Scan() {
-		if isInBlackList(scanner.Text()) {
+	reader := bufio.NewReader(file)
+	for {
+		line, err := ReadLine(reader, maxLineSize)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+		line = NormalizeTableName(line)
+		if line == "" || IsExcludedTable(line) {
 			continue
 		}
-		lines = append(lines, scanner.Text())
+		lines = append(lines, line)
+	}
+	return lines, nil
+}
+
+// ReadLine reads a single line of any length from reader without its line
+// terminator. It returns an error when the line exceeds maxLineSize bytes.
+func ReadLine(reader *bufio.Reader, maxLineSize int) (string, error) {
+	var line []byte
+	for {
+		chunk, isPrefix, err := reader.ReadLine()
+		if err != nil {
+			return "", err
+		}
+		line = append(line, chunk...)
+		if maxLineSize > 0 && len(line) > maxLineSize {
+			return "", fmt.Errorf("line exceeds the maximum row size of %d bytes", maxLineSize)
+		}
+		if !isPrefix {
+			return string(line), nil
+		}
 	}
-	return lines, scanner.Err()
 }
@@ -0,0 +1,122 @@
+package lib
+
+import (
+	"bufio"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	. "github.com/timakin/gopli/constants"
+)
+
+func TestReadLinesLimit(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gopli_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	wide := strings.Repeat("x", 256*1024)
+	path := filepath.Join(dir, "rows.txt")
+	if err := ioutil.WriteFile(path, []byte("users\n"+wide+"\nschema_migrations\nposts"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	lines, err := ReadLinesLimit(path, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(lines) != 3 || lines[0] != "users" || lines[1] != wide || lines[2] != "posts" {
+		t.Errorf("unexpected lines: %d lines", len(lines))
+	}
+
+	if _, err := ReadLinesLimit(path, 1024); err == nil {
+		t.Error("expected an error for a line longer than the limit")
+	}
+}
+
+func TestReadLineStripsCRLF(t *testing.T) {
+	reader := bufio.NewReader(strings.NewReader("a\r\nb"))
+	for _, expected := range []string{"a", "b"} {
+		line, err := ReadLine(reader, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if line != expected {
+			t.Errorf("expected %q, got %q", expected, line)
+		}
+	}
+}
+
+func TestIsExcludedTable(t *testing.T) {
+	defer IgnoreTableCase(false)
+
+	cases := []struct {
+		table      string
+		ignoreCase bool
+		expected   bool
+	}{
+		{"schema_migrations", false, true},
+		{" schema_migrations\t", false, true},
+		{"schema_migrations\r", false, true},
+		{"Schema_Migrations", false, false},
+		{"Schema_Migrations", true, true},
+		{"schema_migrations_archive", true, false},
+		{"users", true, false},
+		{"", false, false},
+	}
+	for _, c := range cases {
+		IgnoreTableCase(c.ignoreCase)
+		if actual := IsExcludedTable(c.table); actual != c.expected {
+			t.Errorf("IsExcludedTable(%q) with ignoreCase=%v: expected %v, got %v", c.table, c.ignoreCase, c.expected, actual)
+		}
+	}
+}
+
+func TestReadLinesLimitNormalizesNames(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gopli_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "table_list.txt")
+	if err := ioutil.WriteFile(path, []byte("users \r\n\n  \nrepli_chk\t\nposts\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	lines, err := ReadLinesLimit(path, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(lines) != 2 || lines[0] != "users" || lines[1] != "posts" {
+		t.Errorf("unexpected lines: %q", lines)
+	}
+}
+
+func TestIsFilteredOut(t *testing.T) {
+	filter := Filter{Include: []string{"users*", "/^billing\\.inv/"}, Exclude: []string{"*_audit", "users_tmp"}}
+	cases := map[string]bool{
+		"users":            false,
+		"users_profiles":   false,
+		"users_tmp":        true,
+		"users_audit":      true,
+		"billing.invoices": false,
+		"billing.plans":    true,
+		"orders":           true,
+		"app.users":        false,
+	}
+	for table, expected := range cases {
+		if got := IsFilteredOut(filter, table); got != expected {
+			t.Errorf("IsFilteredOut(%q) = %v, want %v", table, got, expected)
+		}
+	}
+	if IsFilteredOut(Filter{}, "orders") {
+		t.Error("expected no patterns to keep every table")
+	}
+	if ValidateTablePattern("/(/") == nil || ValidateTablePattern("[") == nil {
+		t.Error("expected invalid patterns to be reported")
+	}
+}
@@ -0,0 +1,96 @@
+package lib
+
+import (
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Health tracks the state reported by the daemon's probe endpoints.
+type Health struct {
+	mu        sync.Mutex
+	ready     bool
+	running   bool
+	lastRun   time.Time
+	lastError string
+	// paused holds the reason scheduled runs are paused, if they are.
+	paused string
+}
+
+// RunStarted marks the beginning of a scheduled run.
+func (health *Health) RunStarted() {
+	health.mu.Lock()
+	defer health.mu.Unlock()
+	health.running = true
+}
+
+// RunFinished records the outcome of a scheduled run. A nil err makes the daemon ready.
+func (health *Health) RunFinished(err error) {
+	health.mu.Lock()
+	defer health.mu.Unlock()
+	health.running = false
+	health.lastRun = time.Now()
+	if err != nil {
+		health.ready = false
+		health.lastError = err.Error()
+		return
+	}
+	health.ready = true
+	health.lastError = ""
+}
+
+// Running reports whether a run is in progress.
+func (health *Health) Running() bool {
+	health.mu.Lock()
+	defer health.mu.Unlock()
+	return health.running
+}
+
+// Pause stops scheduled runs until Resume is called.
+func (health *Health) Pause(reason string) {
+	health.mu.Lock()
+	defer health.mu.Unlock()
+	health.paused = reason
+}
+
+// Resume lets scheduled runs continue.
+func (health *Health) Resume() {
+	health.mu.Lock()
+	defer health.mu.Unlock()
+	health.paused = ""
+}
+
+// Paused reports whether scheduled runs are paused.
+func (health *Health) Paused() bool {
+	health.mu.Lock()
+	defer health.mu.Unlock()
+	return health.paused != ""
+}
+
+// ServeHealthz answers liveness probes; the process is alive as long as it can serve.
+func (health *Health) ServeHealthz(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("ok\n"))
+}
+
+// ServeReadyz answers readiness probes with 200 once the last run succeeded.
+func (health *Health) ServeReadyz(w http.ResponseWriter, r *http.Request) {
+	health.mu.Lock()
+	defer health.mu.Unlock()
+	if health.paused != "" {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		w.Write([]byte("paused: " + health.paused + "\n"))
+		return
+	}
+	if !health.ready {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		if health.lastError != "" {
+			w.Write([]byte("last run failed: " + health.lastError + "\n"))
+		} else {
+			w.Write([]byte("waiting for the first run\n"))
+		}
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("ok (last run " + health.lastRun.Format(time.RFC3339) + ")\n"))
+}
@@ -0,0 +1,70 @@
+package lib
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "github.com/timakin/gopli/constants"
+)
+
+// History records the source checksums of the last sync between two hosts.
+type History struct {
+	From       string            `json:"from"`
+	To         string            `json:"to"`
+	FinishedAt time.Time         `json:"finished_at"`
+	Checksums  map[string]string `json:"checksums"`
+}
+
+func historyPath(conf HistoryConf, from string, to string) (string, error) {
+	dir := conf.Dir
+	if dir == "" {
+		dir = DEFAULT_HISTORY_DIR
+	}
+	dir, err := ExpandPath(dir)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, url.PathEscape(from)+"_"+url.PathEscape(to)+".json"), nil
+}
+
+// ReadHistory returns the history of syncs from from to to, which is empty
+// before the first one.
+func ReadHistory(conf HistoryConf, from string, to string) (*History, error) {
+	history := &History{From: from, To: to, Checksums: make(map[string]string)}
+	path, err := historyPath(conf, from, to)
+	if err != nil {
+		return nil, err
+	}
+	historyBytes, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return history, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(historyBytes, history); err != nil {
+		return nil, err
+	}
+	return history, nil
+}
+
+// Write saves the history, stamping the finish time.
+func (history *History) Write(conf HistoryConf) error {
+	path, err := historyPath(conf, history.From, history.To)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	history.FinishedAt = time.Now()
+	historyBytes, err := json.MarshalIndent(history, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, historyBytes, 0600)
+}
@@ -0,0 +1,30 @@
+package lib
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	. "github.com/timakin/gopli/constants"
+)
+
+func TestHistory(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gopli_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	conf := HistoryConf{Dir: dir}
+
+	history, err := ReadHistory(conf, "production", "staging/1")
+	if err != nil || len(history.Checksums) != 0 {
+		t.Fatalf("expected an empty history, got %v (%v)", history, err)
+	}
+	history.Checksums["users"] = "1234"
+	if err := history.Write(conf); err != nil {
+		t.Fatal(err)
+	}
+	if history, err = ReadHistory(conf, "production", "staging/1"); err != nil || history.Checksums["users"] != "1234" {
+		t.Errorf("expected the recorded checksum, got %v (%v)", history, err)
+	}
+}
@@ -0,0 +1,109 @@
+package lib
+
+import (
+	"os"
+	"strings"
+
+	. "github.com/timakin/gopli/constants"
+)
+
+var language = LANG_EN
+
+// messages translates the errors of the CLI, keyed by the English message.
+// Logs stay in English, so they can be searched and parsed the same way
+// everywhere.
+var messages = map[string]map[string]string{
+	LANG_JA: {
+		"--changed-only and --skip-unchanged can't be combined": "--changed-only と --skip-unchanged は同時に指定できません",
+		"Failed to apply DDL: ":                                 "DDL の適用に失敗しました: ",
+		"Failed to apply seed ":                                 "シードの適用に失敗しました ",
+		"Failed to back up: ":                                   "バックアップに失敗しました: ",
+		"Failed to checksum tables on ":                         "テーブルのチェックサムを取得できませんでした: ",
+		"Failed to clean: ":                                     "テーブルの削除に失敗しました: ",
+		"Failed to connect to ":                                 "接続に失敗しました: ",
+		"Failed to count rows on ":                              "行数を数えられませんでした: ",
+		"Failed to create backup directory: ":                   "バックアップ用ディレクトリの作成に失敗しました: ",
+		"Failed to create fetcher instance for backup: ":        "バックアップ用の取得処理を準備できませんでした: ",
+		"Failed to create fetcher instance: ":                   "取得処理を準備できませんでした: ",
+		"Failed to create inserter instance: ":                  "投入処理を準備できませんでした: ",
+		"Failed to create the preview database: ":               "プレビュー用データベースの作成に失敗しました: ",
+		"Failed to create working directory: ":                  "作業ディレクトリの作成に失敗しました: ",
+		"Failed to drain the destination: ":                     "接続先の切り離しに失敗しました: ",
+		"Failed to drop the preview database: ":                 "プレビュー用データベースの削除に失敗しました: ",
+		"Failed to fetch: ":                                     "データの取得に失敗しました: ",
+		"Failed to find backup: ":                               "バックアップが見つかりません: ",
+		"Failed to find snapshot: ":                             "スナップショットが見つかりません: ",
+		"Failed to find temporary directories: ":                "一時ディレクトリの検索に失敗しました: ",
+		"Failed to generate DDL: ":                              "DDL の生成に失敗しました: ",
+		"Failed to insert: ":                                    "データの投入に失敗しました: ",
+		"Failed to inspect tables on ":                          "テーブル情報の取得に失敗しました: ",
+		"Failed to inspect tables: ":                            "テーブル情報の取得に失敗しました: ",
+		"Failed to inspect the schema of ":                      "スキーマの取得に失敗しました: ",
+		"Failed to list snapshots: ":                            "スナップショットの一覧を取得できませんでした: ",
+		"Failed to list the tables of ":                         "テーブルの一覧を取得できませんでした: ",
+		"Failed to load into ":                                  "投入に失敗した投入先があります: ",
+		"Failed to measure dumps: ":                             "ダンプのサイズを計測できませんでした: ",
+		"Failed to name the preview database of ":               "プレビュー用データベース名を決定できませんでした: ",
+		"Failed to open snapshot: ":                             "スナップショットを開けませんでした: ",
+		"Failed to open the dump cache: ":                       "ダンプキャッシュを開けませんでした: ",
+		"Failed to print configuration: ":                       "設定を表示できませんでした: ",
+		"Failed to prune snapshots: ":                           "古いスナップショットの削除に失敗しました: ",
+		"Failed to read plan: ":                                 "プランを読み込めませんでした: ",
+		"Failed to read seed files: ":                           "シードファイルを読み込めませんでした: ",
+		"Failed to read the list of tables: ":                   "テーブル一覧を読み込めませんでした: ",
+		"Failed to read the sync history: ":                     "同期履歴を読み込めませんでした: ",
+		"Failed to save backup: ":                               "バックアップの保存に失敗しました: ",
+		"Failed to save snapshot: ":                             "スナップショットの保存に失敗しました: ",
+		"Failed to set the maintenance flag: ":                  "メンテナンスフラグの設定に失敗しました: ",
+		"Failed to write DDL: ":                                 "DDL の書き出しに失敗しました: ",
+		"Failed to write plan: ":                                "プランの書き出しに失敗しました: ",
+		"Finished with failed tables: ":                         "失敗したテーブルがあります: ",
+		"Invalid --var: ":                                       "--var が不正です: ",
+		"Invalid concurrency: ":                                 "並列数が不正です: ",
+		"Invalid configuration: ":                               "設定が不正です: ",
+		"Multiple destinations can't skip unchanged tables":     "投入先が複数の場合は --skip-unchanged と --changed-only を指定できません",
+		"No tables to benchmark":                                "ベンチマークするテーブルがありません",
+		"Only preview destinations can be destroyed: ":          "削除できるのはプレビュー用の接続先のみです: ",
+		"Passphrase for ":                                       "パスフレーズ ",
+		"Password for ":                                         "パスワード ",
+		"Plan file is required":                                 "プランファイルを指定してください",
+		"Snapshot name is required":                             "スナップショット名を指定してください",
+		"The data differs: ":                                    "データが一致しません: ",
+		"The schemas differ: ":                                  "スキーマが一致しません: ",
+		"Unknown backup mode: ":                                 "不明なバックアップモードです: ",
+		"Unknown online schema change tool: ":                   "不明なオンラインスキーマ変更ツールです: ",
+		"Unknown schema drift policy: ":                         "不明なスキーマ変更時のポリシーです: ",
+		"Unknown table error policy: ":                          "不明なテーブルエラー時のポリシーです: ",
+		"%s: '%s' is not a %s command. See '%s --help'.":        "%s: '%s' は %s のコマンドではありません。'%s --help' を参照してください。",
+	},
+}
+
+// SetLanguage shows messages in lang from now on, falling back to English
+// for unknown languages.
+func SetLanguage(lang string) {
+	if _, ok := messages[lang]; ok {
+		language = lang
+		return
+	}
+	language = LANG_EN
+}
+
+// DetectLanguage returns the language of the locale in LC_ALL, LC_MESSAGES
+// or LANG, e.g. ja for ja_JP.UTF-8.
+func DetectLanguage() string {
+	for _, name := range []string{"LC_ALL", "LC_MESSAGES", "LANG"} {
+		if locale := os.Getenv(name); locale != "" {
+			return strings.ToLower(strings.SplitN(strings.SplitN(locale, ".", 2)[0], "_", 2)[0])
+		}
+	}
+	return LANG_EN
+}
+
+// T translates message into the current language. Messages without a
+// translation are returned as they are.
+func T(message string) string {
+	if translated, ok := messages[language][message]; ok {
+		return translated
+	}
+	return message
+}
@@ -0,0 +1,38 @@
+package lib
+
+import (
+	"os"
+	"testing"
+
+	. "github.com/timakin/gopli/constants"
+)
+
+func TestT(t *testing.T) {
+	defer SetLanguage(LANG_EN)
+	SetLanguage(LANG_JA)
+	if T("Failed to fetch: ") != "データの取得に失敗しました: " {
+		t.Errorf("expected a Japanese message, got %q", T("Failed to fetch: "))
+	}
+	if T("Untranslated") != "Untranslated" {
+		t.Errorf("expected untranslated messages as they are, got %q", T("Untranslated"))
+	}
+	SetLanguage("fr")
+	if T("Failed to fetch: ") != "Failed to fetch: " {
+		t.Errorf("expected English for unknown languages, got %q", T("Failed to fetch: "))
+	}
+}
+
+func TestDetectLanguage(t *testing.T) {
+	for _, name := range []string{"LC_ALL", "LC_MESSAGES", "LANG"} {
+		defer os.Setenv(name, os.Getenv(name))
+		os.Unsetenv(name)
+	}
+	os.Setenv("LANG", "ja_JP.UTF-8")
+	if lang := DetectLanguage(); lang != LANG_JA {
+		t.Errorf("expected ja, got %s", lang)
+	}
+	os.Setenv("LC_ALL", "en_US.UTF-8")
+	if lang := DetectLanguage(); lang != LANG_EN {
+		t.Errorf("expected LC_ALL to take precedence, got %s", lang)
+	}
+}
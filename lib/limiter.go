@@ -0,0 +1,411 @@
+package lib
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	. "github.com/timakin/gopli/constants"
+)
+
+// SessionLimiter bounds the number of parallel sessions of a phase.
+type SessionLimiter interface {
+	// Acquire blocks until a session may start.
+	Acquire()
+	// Release reports the outcome of a finished session.
+	Release(bytes int64, err error)
+}
+
+type fixedLimiter struct {
+	sem chan int
+}
+
+// NewFixedLimiter allows exactly n parallel sessions.
+func NewFixedLimiter(n int) SessionLimiter {
+	return &fixedLimiter{sem: make(chan int, n)}
+}
+
+func (limiter *fixedLimiter) Acquire() {
+	limiter.sem <- 1
+}
+
+func (limiter *fixedLimiter) Release(bytes int64, err error) {
+	<-limiter.sem
+}
+
+// AdaptiveLimiter grows the number of parallel sessions while the aggregate
+// throughput keeps improving and shrinks it when throughput drops or
+// sessions fail.
+type AdaptiveLimiter struct {
+	mu     sync.Mutex
+	cond   *sync.Cond
+	min    int
+	max    int
+	limit  int
+	active int
+
+	windowStart     time.Time
+	windowBytes     int64
+	windowSessions  int
+	priorThroughput float64
+}
+
+// NewAdaptiveLimiter starts with initial sessions and never exceeds max.
+// Failures may shrink it down to a single session.
+func NewAdaptiveLimiter(initial int, max int) *AdaptiveLimiter {
+	if initial < 1 {
+		initial = 1
+	}
+	if max < initial {
+		max = initial
+	}
+	limiter := &AdaptiveLimiter{min: 1, max: max, limit: initial}
+	limiter.cond = sync.NewCond(&limiter.mu)
+	return limiter
+}
+
+func (limiter *AdaptiveLimiter) Acquire() {
+	limiter.mu.Lock()
+	defer limiter.mu.Unlock()
+	for limiter.active >= limiter.limit {
+		limiter.cond.Wait()
+	}
+	if limiter.windowStart.IsZero() {
+		limiter.windowStart = time.Now()
+	}
+	limiter.active++
+}
+
+func (limiter *AdaptiveLimiter) Release(bytes int64, err error) {
+	limiter.mu.Lock()
+	defer limiter.mu.Unlock()
+	defer limiter.cond.Broadcast()
+	limiter.active--
+
+	if err != nil {
+		limiter.setLimit(limiter.limit / 2)
+		limiter.resetWindow()
+		return
+	}
+
+	limiter.windowBytes += bytes
+	limiter.windowSessions++
+	// Judge a setting only after as many sessions as it allows have finished.
+	if limiter.windowSessions < limiter.limit {
+		return
+	}
+	throughput := float64(limiter.windowBytes) / time.Since(limiter.windowStart).Seconds()
+	switch {
+	case limiter.priorThroughput == 0 || throughput > limiter.priorThroughput*1.05:
+		limiter.setLimit(limiter.limit + 1)
+	case throughput < limiter.priorThroughput*0.95:
+		limiter.setLimit(limiter.limit - 1)
+	}
+	limiter.priorThroughput = throughput
+	limiter.resetWindow()
+}
+
+// AcquireN blocks until n sessions may start at once and returns how many it
+// took: n, or the current limit when that is lower, so a shrunk limit never
+// holds heavy sessions back for good.
+func (limiter *AdaptiveLimiter) AcquireN(n int) int {
+	limiter.mu.Lock()
+	defer limiter.mu.Unlock()
+	for {
+		taken := n
+		if taken > limiter.limit {
+			taken = limiter.limit
+		}
+		if limiter.active+taken <= limiter.limit {
+			if limiter.windowStart.IsZero() {
+				limiter.windowStart = time.Now()
+			}
+			limiter.active += taken
+			return taken
+		}
+		limiter.cond.Wait()
+	}
+}
+
+// Limit returns the current number of allowed sessions.
+func (limiter *AdaptiveLimiter) Limit() int {
+	limiter.mu.Lock()
+	defer limiter.mu.Unlock()
+	return limiter.limit
+}
+
+func (limiter *AdaptiveLimiter) setLimit(limit int) {
+	if limit < limiter.min {
+		limit = limiter.min
+	}
+	if limit > limiter.max {
+		limit = limiter.max
+	}
+	if limit != limiter.limit {
+		log.Printf("\t[Concurrency] adjusting parallel sessions from %d to %d", limiter.limit, limit)
+	}
+	limiter.limit = limit
+}
+
+func (limiter *AdaptiveLimiter) resetWindow() {
+	limiter.windowStart = time.Now()
+	limiter.windowBytes = 0
+	limiter.windowSessions = 0
+}
+
+// CapacityGate holds sessions back to a capacity that may change while they
+// run, e.g. the sessions a host accepts once its MaxSessions is known. A
+// capacity of 0 leaves the sessions alone.
+type CapacityGate struct {
+	capacity func() int
+	mu       sync.Mutex
+	cond     *sync.Cond
+	active   int
+}
+
+// NewCapacityGate returns a gate asking capacity for the current capacity.
+func NewCapacityGate(capacity func() int) *CapacityGate {
+	gate := &CapacityGate{capacity: capacity}
+	gate.cond = sync.NewCond(&gate.mu)
+	return gate
+}
+
+// Limit returns a limiter passing the gate before acquiring limiter.
+func (gate *CapacityGate) Limit(limiter SessionLimiter) SessionLimiter {
+	return &gatedLimiter{gate: gate, limiter: limiter}
+}
+
+type gatedLimiter struct {
+	gate    *CapacityGate
+	limiter SessionLimiter
+}
+
+func (gated *gatedLimiter) Acquire() {
+	gate := gated.gate
+	gate.mu.Lock()
+	for {
+		capacity := gate.capacity()
+		if capacity <= 0 || gate.active < capacity {
+			break
+		}
+		gate.cond.Wait()
+	}
+	gate.active++
+	gate.mu.Unlock()
+	gated.limiter.Acquire()
+}
+
+func (gated *gatedLimiter) Release(bytes int64, err error) {
+	gated.limiter.Release(bytes, err)
+	gate := gated.gate
+	gate.mu.Lock()
+	defer gate.mu.Unlock()
+	gate.active--
+	gate.cond.Broadcast()
+}
+
+// StartOrder makes the first sessions of a sequence of tables start in the
+// order the tables were queued, whatever order their goroutines run in.
+type StartOrder struct {
+	last chan struct{}
+}
+
+// NewStartOrder returns an empty start order.
+func NewStartOrder() *StartOrder {
+	last := make(chan struct{})
+	close(last)
+	return &StartOrder{last: last}
+}
+
+// Next queues a table and returns the limiter its sessions acquire.
+func (order *StartOrder) Next(limiter SessionLimiter) *OrderedLimiter {
+	turn := &OrderedLimiter{limiter: limiter, wait: order.last, done: make(chan struct{})}
+	order.last = turn.done
+	return turn
+}
+
+// OrderedLimiter waits for the tables queued before its own to start a
+// session before acquiring one.
+type OrderedLimiter struct {
+	limiter SessionLimiter
+	wait    chan struct{}
+	done    chan struct{}
+	once    sync.Once
+}
+
+func (limiter *OrderedLimiter) Acquire() {
+	<-limiter.wait
+	limiter.limiter.Acquire()
+	limiter.Pass()
+}
+
+func (limiter *OrderedLimiter) Release(bytes int64, err error) {
+	limiter.limiter.Release(bytes, err)
+}
+
+// Pass lets the next table start. Tables that never acquire a session must
+// call it.
+func (limiter *OrderedLimiter) Pass() {
+	limiter.once.Do(func() { close(limiter.done) })
+}
+
+// WeightedLimiter lets the sessions of heavy tables take several slots of a
+// limiter and the sessions of light tables take a share of one.
+type WeightedLimiter struct {
+	limiter SessionLimiter
+	slots   int
+	// mu makes sessions taking several slots gather them one at a time, so
+	// two of them never wait on each other's partial slots.
+	mu sync.Mutex
+
+	sharedMu sync.Mutex
+	shared   map[int]*sharedSlots
+}
+
+// NewWeightedLimiter weighs sessions against limiter, which allows at least
+// slots sessions unless it is an AdaptiveLimiter. Heavy sessions take at most
+// the current limit of an AdaptiveLimiter.
+func NewWeightedLimiter(limiter SessionLimiter, slots int) *WeightedLimiter {
+	if slots < 1 {
+		slots = 1
+	}
+	return &WeightedLimiter{limiter: limiter, slots: slots, shared: make(map[int]*sharedSlots)}
+}
+
+// For returns the limiter of sessions weighing weight slots. Weights above 1
+// are rounded and capped at the slots of the limiter. Weights below 1 take a
+// share of a slot, round(1/weight) of them to a slot and at most
+// MaxSharedSessions, and spread over as many slots as are free.
+func (weighted *WeightedLimiter) For(weight float64) SessionLimiter {
+	if weight > 1 {
+		n := int(weight + 0.5)
+		if n > weighted.slots {
+			n = weighted.slots
+		}
+		if n <= 1 {
+			return weighted.limiter
+		}
+		return &multiSlot{weighted: weighted, n: n}
+	}
+	if weight <= 0 || weight == 1 {
+		return weighted.limiter
+	}
+	size := int(1/weight + 0.5)
+	if size > MaxSharedSessions {
+		size = MaxSharedSessions
+	}
+	if size <= 1 {
+		return weighted.limiter
+	}
+	weighted.sharedMu.Lock()
+	defer weighted.sharedMu.Unlock()
+	slots, ok := weighted.shared[size]
+	if !ok {
+		slots = &sharedSlots{limiter: weighted.limiter, size: size}
+		weighted.shared[size] = slots
+	}
+	return slots
+}
+
+// batchAcquirer takes several sessions at once, possibly fewer than asked.
+type batchAcquirer interface {
+	AcquireN(n int) int
+}
+
+// multiSlot takes n slots for every session.
+type multiSlot struct {
+	weighted *WeightedLimiter
+	n        int
+
+	// taken holds the slots of every running session, which are fewer than
+	// n when a batchAcquirer capped them.
+	mu    sync.Mutex
+	taken []int
+}
+
+func (slots *multiSlot) Acquire() {
+	taken := slots.n
+	if acquirer, ok := slots.weighted.limiter.(batchAcquirer); ok {
+		taken = acquirer.AcquireN(slots.n)
+	} else {
+		slots.weighted.mu.Lock()
+		for i := 0; i < slots.n; i++ {
+			slots.weighted.limiter.Acquire()
+		}
+		slots.weighted.mu.Unlock()
+	}
+	slots.mu.Lock()
+	slots.taken = append(slots.taken, taken)
+	slots.mu.Unlock()
+}
+
+func (slots *multiSlot) Release(bytes int64, err error) {
+	slots.mu.Lock()
+	taken := slots.taken[len(slots.taken)-1]
+	slots.taken = slots.taken[:len(slots.taken)-1]
+	slots.mu.Unlock()
+
+	slots.weighted.limiter.Release(bytes, err)
+	for i := 1; i < taken; i++ {
+		slots.weighted.limiter.Release(0, nil)
+	}
+}
+
+// sharedSlots runs sessions size to a slot of limiter. A session joins a held
+// slot with room left, or acquires a new one. A slot is released, reporting
+// the outcome of its sessions together, once none of them runs.
+type sharedSlots struct {
+	limiter SessionLimiter
+	size    int
+
+	mu   sync.Mutex
+	held []*sharedSlot
+}
+
+type sharedSlot struct {
+	active int
+	bytes  int64
+	err    error
+}
+
+func (slots *sharedSlots) Acquire() {
+	slots.mu.Lock()
+	for _, slot := range slots.held {
+		if slot.active < slots.size {
+			slot.active++
+			slots.mu.Unlock()
+			return
+		}
+	}
+	slots.mu.Unlock()
+
+	slots.limiter.Acquire()
+	slots.mu.Lock()
+	slots.held = append(slots.held, &sharedSlot{active: 1})
+	slots.mu.Unlock()
+}
+
+// Release ends a session of the slot running the fewest, so the slots of
+// fewer light tables are given back sooner.
+func (slots *sharedSlots) Release(bytes int64, err error) {
+	slots.mu.Lock()
+	least := 0
+	for i, slot := range slots.held {
+		if slot.active < slots.held[least].active {
+			least = i
+		}
+	}
+	slot := slots.held[least]
+	slot.active--
+	slot.bytes += bytes
+	if err != nil {
+		slot.err = err
+	}
+	if slot.active > 0 {
+		slots.mu.Unlock()
+		return
+	}
+	slots.held = append(slots.held[:least], slots.held[least+1:]...)
+	slots.mu.Unlock()
+	slots.limiter.Release(slot.bytes, slot.err)
+}
@@ -0,0 +1,180 @@
+package lib
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestAdaptiveLimiter(t *testing.T) {
+	limiter := NewAdaptiveLimiter(1, 4)
+
+	limiter.Acquire()
+	limiter.Release(1024, nil)
+	if limiter.Limit() != 2 {
+		t.Fatalf("expected the limit to grow to 2, got %d", limiter.Limit())
+	}
+
+	limiter.Acquire()
+	limiter.Release(0, errors.New("session failed"))
+	if limiter.Limit() != 1 {
+		t.Fatalf("expected the limit to shrink to 1 after a failure, got %d", limiter.Limit())
+	}
+
+	// Failures shrink the limit below the initial number of sessions.
+	limiter = NewAdaptiveLimiter(4, 8)
+	limiter.Acquire()
+	limiter.Release(0, errors.New("session failed"))
+	if limiter.Limit() != 2 {
+		t.Fatalf("expected the limit to shrink to 2 after a failure, got %d", limiter.Limit())
+	}
+}
+
+func TestStartOrder(t *testing.T) {
+	limiter := NewFixedLimiter(1)
+	order := NewStartOrder()
+	turns := []*OrderedLimiter{order.Next(limiter), order.Next(limiter), order.Next(limiter)}
+
+	started := make(chan int, len(turns))
+	var wg sync.WaitGroup
+	// Start the goroutines in reverse to show their order doesn't matter.
+	for i := len(turns) - 1; i >= 0; i-- {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if i == 1 {
+				// A table without sessions still lets the next one start.
+				turns[i].Pass()
+				return
+			}
+			turns[i].Acquire()
+			started <- i
+			turns[i].Release(0, nil)
+		}(i)
+	}
+	wg.Wait()
+	close(started)
+
+	var got []int
+	for i := range started {
+		got = append(got, i)
+	}
+	if len(got) != 2 || got[0] != 0 || got[1] != 2 {
+		t.Errorf("expected tables to start in queue order [0 2], got %v", got)
+	}
+}
+
+// acquired reports whether limiter grants a session within a short while.
+func acquired(limiter SessionLimiter) bool {
+	done := make(chan bool)
+	go func() {
+		limiter.Acquire()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return true
+	case <-time.After(50 * time.Millisecond):
+		return false
+	}
+}
+
+func TestWeightedLimiter(t *testing.T) {
+	weighted := NewWeightedLimiter(NewFixedLimiter(3), 3)
+	heavy := weighted.For(2)
+	if !acquired(heavy) {
+		t.Fatal("expected a heavy session to take 2 of 3 free slots")
+	}
+	if acquired(heavy) {
+		t.Fatal("expected a second heavy session to wait for 2 slots")
+	}
+
+	weighted = NewWeightedLimiter(NewFixedLimiter(2), 2)
+	light := weighted.For(0.25)
+	for i := 0; i < 8; i++ {
+		if !acquired(light) {
+			t.Fatalf("expected light session %d to take a share of a slot", i+1)
+		}
+	}
+	if acquired(weighted.For(0.25)) {
+		t.Error("expected a ninth light session to wait")
+	}
+	if acquired(weighted.For(1)) {
+		t.Error("expected the light sessions to hold both slots")
+	}
+	weighted = NewWeightedLimiter(NewFixedLimiter(1), 1)
+	if weighted.For(100) != weighted.For(1) {
+		t.Error("expected weights above the slots to be capped")
+	}
+}
+
+func TestCapacityGate(t *testing.T) {
+	var mu sync.Mutex
+	capacity := 0
+	gate := NewCapacityGate(func() int {
+		mu.Lock()
+		defer mu.Unlock()
+		return capacity
+	})
+	limiter := gate.Limit(NewFixedLimiter(3))
+
+	limiter.Acquire()
+	mu.Lock()
+	capacity = 1
+	mu.Unlock()
+
+	acquired := make(chan bool)
+	go func() {
+		limiter.Acquire()
+		acquired <- true
+	}()
+	select {
+	case <-acquired:
+		t.Fatal("expected the session to wait for the lowered capacity")
+	case <-time.After(50 * time.Millisecond):
+	}
+	limiter.Release(0, nil)
+	select {
+	case <-acquired:
+	case <-time.After(time.Second):
+		t.Fatal("expected the session to start once another ended")
+	}
+}
+
+func TestSharedSlotsRelease(t *testing.T) {
+	weighted := NewWeightedLimiter(NewFixedLimiter(2), 2)
+	light := weighted.For(0.5)
+	for i := 0; i < 3; i++ {
+		light.Acquire()
+	}
+	// Ending the lone session of the second slot gives it back.
+	light.Release(0, nil)
+	if !acquired(weighted.For(1)) {
+		t.Error("expected the slot of the finished light session to be released")
+	}
+	if acquired(weighted.For(1)) {
+		t.Error("expected the slot still running light sessions to be held")
+	}
+}
+
+func TestWeightedLimiterAfterAdaptiveShrinks(t *testing.T) {
+	adaptive := NewAdaptiveLimiter(4, 8)
+	for i := 0; i < 2; i++ {
+		adaptive.Acquire()
+		adaptive.Release(0, errors.New("session failed"))
+	}
+	if limit := adaptive.Limit(); limit != 1 {
+		t.Fatalf("expected the limit to shrink to 1, got %d", limit)
+	}
+
+	weighted := NewWeightedLimiter(adaptive, 4)
+	heavy := weighted.For(4)
+	if !acquired(heavy) {
+		t.Fatal("expected a heavy session to take the only slot left")
+	}
+	heavy.Release(0, nil)
+	if !acquired(weighted.For(1)) {
+		t.Error("expected the slot of the heavy session to be released")
+	}
+}
@@ -0,0 +1,23 @@
+package lib
+
+import "fmt"
+
+// LoadSample is the load a source server showed while it was sampled.
+type LoadSample struct {
+	// QPS is the average number of statements per second.
+	QPS float64
+	// Threads is the highest number of connected threads seen.
+	Threads int64
+}
+
+// PeakReason returns why the sample is considered peak load, or an empty
+// string when it is not. A zero threshold is not checked.
+func (sample LoadSample) PeakReason(peakQPS int, peakThreads int) string {
+	if peakQPS > 0 && sample.QPS >= float64(peakQPS) {
+		return fmt.Sprintf("%.0f queries/s (peak_qps %d)", sample.QPS, peakQPS)
+	}
+	if peakThreads > 0 && sample.Threads >= int64(peakThreads) {
+		return fmt.Sprintf("%d threads connected (peak_threads %d)", sample.Threads, peakThreads)
+	}
+	return ""
+}
@@ -0,0 +1,22 @@
+package lib
+
+import "testing"
+
+func TestLoadSamplePeakReason(t *testing.T) {
+	sample := LoadSample{QPS: 1200, Threads: 80}
+	cases := []struct {
+		peakQPS, peakThreads int
+		peak                 bool
+	}{
+		{0, 0, false},
+		{1000, 0, true},
+		{2000, 0, false},
+		{2000, 50, true},
+		{2000, 100, false},
+	}
+	for _, c := range cases {
+		if got := sample.PeakReason(c.peakQPS, c.peakThreads); (got != "") != c.peak {
+			t.Errorf("PeakReason(%d, %d) = %q, want peak %v", c.peakQPS, c.peakThreads, got, c.peak)
+		}
+	}
+}
@@ -0,0 +1,45 @@
+package lib
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+
+	. "github.com/timakin/gopli/constants"
+)
+
+// logLevelGiven is set once --log-level chose the level, which the defaults
+// of the configuration then leave alone.
+var logLevelGiven bool
+
+// SetLogLevel sets the level given with --log-level. LOG_LEVEL_INFO shows the
+// log, and LOG_LEVEL_ERROR only the errors commands fail with.
+func SetLogLevel(level string) error {
+	if err := setLogLevel(level); err != nil {
+		return err
+	}
+	logLevelGiven = true
+	return nil
+}
+
+// defaultLogLevel sets the log_level of the defaults section, unless
+// --log-level gave one.
+func defaultLogLevel(level string) error {
+	if level == "" || logLevelGiven {
+		return nil
+	}
+	return setLogLevel(level)
+}
+
+func setLogLevel(level string) error {
+	switch level {
+	case LOG_LEVEL_INFO:
+		log.SetOutput(os.Stderr)
+	case LOG_LEVEL_ERROR:
+		log.SetOutput(ioutil.Discard)
+	default:
+		return fmt.Errorf("unknown log level %q", level)
+	}
+	return nil
+}
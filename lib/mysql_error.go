@@ -0,0 +1,70 @@
+package lib
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// mysqlErrorPattern matches the errors the mysql client prints, like
+// "ERROR 1045 (28000): Access denied for user ..." or
+// "ERROR 1205 (HY000) at line 1: Lock wait timeout exceeded ...".
+var mysqlErrorPattern = regexp.MustCompile(`ERROR (\d+)(?: \(\w+\))?(?: at line \d+)?: ([^\n]*)`)
+
+// mysqlErrorCauses maps the MySQL error codes scripts can react to onto
+// their cause.
+var mysqlErrorCauses = map[int]error{
+	1044: ErrAuthenticationFailed, // access denied to the database
+	1045: ErrAuthenticationFailed, // access denied for the user
+	1698: ErrAuthenticationFailed, // access denied by the auth plugin
+	2002: ErrConnectionFailed,     // can't connect through the socket
+	2003: ErrConnectionFailed,     // can't connect to the server
+	2005: ErrConnectionFailed,     // unknown server host
+	2013: ErrConnectionFailed,     // lost connection during the query
+	1205: ErrLockWaitTimeout,
+	1148: ErrLocalInfileDisabled,
+	3948: ErrLocalInfileDisabled,
+}
+
+// MySQLError is a command failing with an error of the mysql client.
+type MySQLError struct {
+	Code    int
+	Message string
+	// Err is the failure of the command itself, like its exit status.
+	Err error
+}
+
+func (mysqlError *MySQLError) Error() string {
+	return fmt.Sprintf("%v: ERROR %d: %s", mysqlError.Err, mysqlError.Code, mysqlError.Message)
+}
+
+// Unwrap returns the failure of the command and the cause of the code, so
+// errors.Is finds both.
+func (mysqlError *MySQLError) Unwrap() []error {
+	errs := []error{mysqlError.Err}
+	if cause, ok := mysqlErrorCauses[mysqlError.Code]; ok {
+		errs = append(errs, cause)
+	}
+	return errs
+}
+
+// ParseMySQLError wraps err in a MySQLError when stderr of the failed
+// command holds an error of the mysql client, and returns it as is
+// otherwise.
+func ParseMySQLError(err error, stderr string) error {
+	if err == nil {
+		return nil
+	}
+	var mysqlError *MySQLError
+	if errors.As(err, &mysqlError) {
+		return err
+	}
+	match := mysqlErrorPattern.FindStringSubmatch(stderr)
+	if match == nil {
+		return err
+	}
+	code, _ := strconv.Atoi(match[1])
+	return &MySQLError{Code: code, Message: strings.TrimSpace(match[2]), Err: err}
+}
@@ -0,0 +1,34 @@
+package lib
+
+import (
+	"errors"
+	"testing"
+
+	. "github.com/timakin/gopli/constants"
+)
+
+func TestParseMySQLError(t *testing.T) {
+	exitStatus := errors.New("exit status 1")
+	err := ParseMySQLError(exitStatus, "mysql: [Warning] Using a password on the command line interface can be insecure.\nERROR 1045 (28000): Access denied for user 'app'@'10.0.0.1' (using password: YES)\n")
+	var mysqlError *MySQLError
+	if !errors.As(err, &mysqlError) || mysqlError.Code != 1045 || mysqlError.Message != "Access denied for user 'app'@'10.0.0.1' (using password: YES)" {
+		t.Fatalf("unexpected error %#v", err)
+	}
+	if !errors.Is(err, exitStatus) || ExitCode(err) != EXIT_AUTHENTICATION {
+		t.Errorf("expected the exit status and the authentication failure, got %v", err)
+	}
+
+	err = ParseMySQLError(exitStatus, "ERROR 1205 (HY000) at line 1: Lock wait timeout exceeded; try restarting transaction\n")
+	if ExitCode(err) != EXIT_LOCK_WAIT_TIMEOUT || err.Error() != "exit status 1: ERROR 1205: Lock wait timeout exceeded; try restarting transaction" {
+		t.Errorf("unexpected error %v", err)
+	}
+	if err := ParseMySQLError(exitStatus, "ERROR 1146 (42S02): Table 'app.gone' doesn't exist\n"); ExitCode(err) != EXIT_DATABASE {
+		t.Errorf("expected a database failure, got %v", err)
+	}
+	if err := ParseMySQLError(exitStatus, "bash: mysql: command not found\n"); err != exitStatus {
+		t.Errorf("expected the error as is, got %v", err)
+	}
+	if err := ParseMySQLError(nil, "ERROR 1045 (28000): Access denied"); err != nil {
+		t.Errorf("expected nil, got %v", err)
+	}
+}
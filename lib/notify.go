@@ -0,0 +1,64 @@
+package lib
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	. "github.com/timakin/gopli/constants"
+)
+
+// Notification is posted as JSON to the daemon's --notify-url.
+type Notification struct {
+	Event   string    `json:"event"`
+	From    string    `json:"from"`
+	To      string    `json:"to"`
+	Message string    `json:"message"`
+	At      time.Time `json:"at"`
+}
+
+// Notify posts notification to url.
+func Notify(url string, notification Notification) error {
+	body, err := json.Marshal(notification)
+	if err != nil {
+		return err
+	}
+	client := &http.Client{Timeout: NOTIFY_TIMEOUT_SECONDS * time.Second}
+	resp, err := client.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return redactURLError(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("notification rejected with %s", resp.Status)
+	}
+	return nil
+}
+
+// RedactURL returns target without its credentials and query, which often
+// carry tokens, so it can be logged.
+func RedactURL(target string) string {
+	parsed, err := url.Parse(target)
+	if err != nil {
+		return "(invalid URL)"
+	}
+	parsed.User = nil
+	if parsed.RawQuery != "" {
+		parsed.RawQuery = redactedValue
+	}
+	parsed.Fragment = ""
+	return parsed.String()
+}
+
+// redactURLError redacts the URL the HTTP client puts in its errors.
+func redactURLError(err error) error {
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		urlErr.URL = RedactURL(urlErr.URL)
+	}
+	return err
+}
@@ -0,0 +1,17 @@
+package lib
+
+import "github.com/k0kubun/pp"
+
+var plainOutput bool
+
+// UsePlainOutput turns colors and other ANSI escapes off, for output read by
+// CI systems or saved to files.
+func UsePlainOutput(plain bool) {
+	plainOutput = plain
+	pp.ColoringEnabled = !plain
+}
+
+// PlainOutput reports whether output has to do without ANSI escapes.
+func PlainOutput() bool {
+	return plainOutput
+}
@@ -0,0 +1,191 @@
+package lib
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	. "github.com/timakin/gopli/constants"
+)
+
+// TableStat holds the estimated size of a table.
+type TableStat struct {
+	Name  string `json:"name"`
+	Rows  int64  `json:"rows"`
+	Bytes int64  `json:"bytes"`
+	// Engine is the storage engine, or the table type of views.
+	Engine string `json:"engine,omitempty"`
+}
+
+// ExclusionReason returns why the table is never synced, or an empty string
+// when it is.
+func (stat TableStat) ExclusionReason() string {
+	if IsExcludedTable(stat.Name) {
+		return PLAN_REASON_EXCLUDED
+	}
+	if !IsDataEngine(stat.Engine) {
+		return fmt.Sprintf(PLAN_REASON_NO_DATA_ENGINE, stat.Engine)
+	}
+	return ""
+}
+
+// SkipReason returns why a sync with filter leaves the table out, or an
+// empty string when it syncs the table.
+func (stat TableStat) SkipReason(filter Filter) string {
+	if reason := stat.ExclusionReason(); reason != "" {
+		return reason
+	}
+	if IsFilteredOut(filter, stat.Name) {
+		return PLAN_REASON_FILTERED
+	}
+	return ""
+}
+
+// PrintTableStats writes the tables a sync with filter would include with
+// their estimated size. With all, excluded tables are listed as well.
+func PrintTableStats(out io.Writer, stats []TableStat, filter Filter, all bool) {
+	w := tabwriter.NewWriter(out, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "TABLE\tROWS\tSIZE\t")
+	var included int
+	var rows, size int64
+	for _, stat := range stats {
+		if reason := stat.SkipReason(filter); reason != "" {
+			if all {
+				fmt.Fprintf(w, "%s\t(%s)\t\t\n", stat.Name, reason)
+			}
+			continue
+		}
+		included++
+		rows += stat.Rows
+		size += stat.Bytes
+		fmt.Fprintf(w, "%s\t~%d\t%s\t\n", stat.Name, stat.Rows, HumanBytes(stat.Bytes))
+	}
+	w.Flush()
+	fmt.Fprintf(out, "\n%d tables (~%d rows, %s).\n", included, rows, HumanBytes(size))
+}
+
+// PlanEntry is the action planned for a single table.
+type PlanEntry struct {
+	Table  string `json:"table"`
+	Action string `json:"action"`
+	Reason string `json:"reason,omitempty"`
+	Rows   int64  `json:"rows"`
+	Bytes  int64  `json:"bytes"`
+	// Class is schema_only or data_only as configured in [filter].
+	Class string `json:"class,omitempty"`
+}
+
+// Plan lists what a sync between two hosts will do to every table.
+type Plan struct {
+	From      string      `json:"from"`
+	To        string      `json:"to"`
+	CreatedAt time.Time   `json:"created_at"`
+	Tables    []PlanEntry `json:"tables"`
+}
+
+// BuildPlan compares the source tables with the tables existing on the
+// destination. Tables filter leaves out or marks as schema only are skipped.
+func BuildPlan(from string, to string, sourceStats []TableStat, destinationStats []TableStat, filter Filter) *Plan {
+	existing := make(map[string]bool)
+	for _, stat := range destinationStats {
+		existing[TableKey(stat.Name)] = true
+	}
+
+	plan := &Plan{From: from, To: to, CreatedAt: time.Now()}
+	for _, stat := range sourceStats {
+		entry := PlanEntry{Table: stat.Name, Action: PLAN_ACTION_REPLACE, Rows: stat.Rows, Bytes: stat.Bytes, Class: TableClass(filter, stat.Name)}
+		if reason := stat.SkipReason(filter); reason != "" {
+			entry.Action = PLAN_ACTION_SKIP
+			entry.Reason = reason
+		} else if entry.Class == TABLE_CLASS_SCHEMA_ONLY {
+			entry.Action = PLAN_ACTION_SKIP
+			entry.Reason = PLAN_REASON_SCHEMA_ONLY
+		} else if !existing[TableKey(stat.Name)] {
+			entry.Action = PLAN_ACTION_SKIP
+			entry.Reason = PLAN_REASON_MISSING_DESTINATION
+		}
+		plan.Tables = append(plan.Tables, entry)
+	}
+	return plan
+}
+
+// TablesToLoad returns the tables the plan replaces.
+func (plan *Plan) TablesToLoad() []string {
+	var tables []string
+	for _, entry := range plan.Tables {
+		if entry.Action == PLAN_ACTION_REPLACE {
+			tables = append(tables, entry.Table)
+		}
+	}
+	return tables
+}
+
+// Print writes a human readable summary of the plan.
+func (plan *Plan) Print(out io.Writer) {
+	fmt.Fprintf(out, "Plan: %s -> %s\n\n", plan.From, plan.To)
+	w := tabwriter.NewWriter(out, 0, 8, 2, ' ', 0)
+	var replaced, skipped int
+	var rows, size int64
+	for _, entry := range plan.Tables {
+		switch entry.Action {
+		case PLAN_ACTION_REPLACE:
+			replaced++
+			rows += entry.Rows
+			size += entry.Bytes
+			fmt.Fprintf(w, "  ~ %s\t%s\t~%d rows\t%s\t%s\n", entry.Table, entry.Action, entry.Rows, HumanBytes(entry.Bytes), classLabel(entry.Class))
+		default:
+			skipped++
+			fmt.Fprintf(w, "  - %s\t%s\t(%s)\t\n", entry.Table, entry.Action, entry.Reason)
+		}
+	}
+	w.Flush()
+	fmt.Fprintf(out, "\n%d to replace (~%d rows, %s), %d to skip.\n", replaced, rows, HumanBytes(size), skipped)
+}
+
+// classLabel returns how Print marks the class of a table.
+func classLabel(class string) string {
+	if class == "" {
+		return ""
+	}
+	return "(" + strings.Replace(class, "_", " ", -1) + ")"
+}
+
+// Write saves the plan as JSON.
+func (plan *Plan) Write(path string) error {
+	planBytes, err := json.MarshalIndent(plan, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, planBytes, 0600)
+}
+
+// ReadPlan loads a plan saved by Write.
+func ReadPlan(path string) (*Plan, error) {
+	planBytes, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var plan Plan
+	if err := json.Unmarshal(planBytes, &plan); err != nil {
+		return nil, err
+	}
+	return &plan, nil
+}
+
+// HumanBytes formats a byte count with a binary unit.
+func HumanBytes(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+	div, exp := int64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(size)/float64(div), "KMGTPE"[exp])
+}
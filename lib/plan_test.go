@@ -0,0 +1,42 @@
+package lib
+
+import (
+	"testing"
+
+	. "github.com/timakin/gopli/constants"
+)
+
+func TestBuildPlanTableClasses(t *testing.T) {
+	stats := []TableStat{{Name: "users", Engine: "InnoDB"}, {Name: "sessions", Engine: "InnoDB"}, {Name: "logs.events", Engine: "InnoDB"}}
+	filter := Filter{SchemaOnly: []string{"sessions"}, DataOnly: []string{"events"}}
+	plan := BuildPlan("production", "staging", stats, stats, filter)
+
+	expected := map[string]PlanEntry{
+		"users":       {Action: PLAN_ACTION_REPLACE},
+		"sessions":    {Action: PLAN_ACTION_SKIP, Reason: PLAN_REASON_SCHEMA_ONLY, Class: TABLE_CLASS_SCHEMA_ONLY},
+		"logs.events": {Action: PLAN_ACTION_REPLACE, Class: TABLE_CLASS_DATA_ONLY},
+	}
+	for _, entry := range plan.Tables {
+		want := expected[entry.Table]
+		if entry.Action != want.Action || entry.Reason != want.Reason || entry.Class != want.Class {
+			t.Errorf("%s: expected %+v, got %+v", entry.Table, want, entry)
+		}
+	}
+}
+
+func TestBuildPlanSkipsTablesWithoutData(t *testing.T) {
+	stats := []TableStat{{Name: "users", Engine: "InnoDB"}, {Name: "active_users", Engine: "VIEW"}, {Name: "remote_orders", Engine: "federated"}, {Name: "sink", Engine: "BLACKHOLE"}}
+	plan := BuildPlan("production", "staging", stats, stats, Filter{})
+
+	expected := map[string]string{
+		"users":         "",
+		"active_users":  "no data (VIEW)",
+		"remote_orders": "no data (federated)",
+		"sink":          "no data (BLACKHOLE)",
+	}
+	for _, entry := range plan.Tables {
+		if entry.Reason != expected[entry.Table] || (entry.Reason == "") != (entry.Action == PLAN_ACTION_REPLACE) {
+			t.Errorf("%s: unexpected entry %+v", entry.Table, entry)
+		}
+	}
+}
@@ -0,0 +1,42 @@
+package lib
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strings"
+	"text/template"
+)
+
+// previewName matches the database names preview templates may render to.
+var previewName = regexp.MustCompile(`^[0-9A-Za-z_$-]+$`)
+
+// ParseVars parses NAME=VALUE pairs given with --var.
+func ParseVars(pairs []string) (map[string]string, error) {
+	vars := make(map[string]string)
+	for _, pair := range pairs {
+		fields := strings.SplitN(pair, "=", 2)
+		if len(fields) != 2 || fields[0] == "" {
+			return nil, fmt.Errorf("invalid variable %q, expected NAME=VALUE", pair)
+		}
+		vars[fields[0]] = fields[1]
+	}
+	return vars, nil
+}
+
+// RenderDatabaseName fills the database name template of a preview
+// destination in with vars, e.g. "app_pr_{{.PR}}" to "app_pr_123".
+func RenderDatabaseName(name string, vars map[string]string) (string, error) {
+	tmpl, err := template.New("name").Option("missingkey=error").Parse(name)
+	if err != nil {
+		return "", err
+	}
+	var rendered bytes.Buffer
+	if err := tmpl.Execute(&rendered, vars); err != nil {
+		return "", err
+	}
+	if !previewName.MatchString(rendered.String()) {
+		return "", fmt.Errorf("invalid database name %q", rendered.String())
+	}
+	return rendered.String(), nil
+}
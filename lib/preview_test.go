@@ -0,0 +1,23 @@
+package lib
+
+import "testing"
+
+func TestRenderDatabaseName(t *testing.T) {
+	vars, err := ParseVars([]string{"PR=123", "EMPTY="})
+	if err != nil {
+		t.Fatal(err)
+	}
+	name, err := RenderDatabaseName("app_pr_{{.PR}}", vars)
+	if err != nil || name != "app_pr_123" {
+		t.Errorf("expected app_pr_123, got %q (%v)", name, err)
+	}
+	if _, err := RenderDatabaseName("app_pr_{{.BRANCH}}", vars); err == nil {
+		t.Error("expected a missing variable to fail")
+	}
+	if _, err := RenderDatabaseName("app_pr_{{.PR}}", map[string]string{"PR": "1`; DROP DATABASE app"}); err == nil {
+		t.Error("expected a name with other characters to fail")
+	}
+	if _, err := ParseVars([]string{"PR"}); err == nil {
+		t.Error("expected a variable without a value to fail")
+	}
+}
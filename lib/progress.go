@@ -0,0 +1,127 @@
+package lib
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	. "github.com/timakin/gopli/constants"
+)
+
+// Progress follows the phase and transferred bytes of every table of a run,
+// for the terminal UI. A nil Progress ignores every update.
+type Progress struct {
+	mu     sync.Mutex
+	tables map[string]*TableProgress
+	order  []string
+	errors []string
+	logs   []string
+}
+
+// TableProgress is the state of a single table.
+type TableProgress struct {
+	Phase string
+	// Bytes were transferred in the current phase, out of an estimated Total.
+	Bytes   int64
+	Total   int64
+	Started time.Time
+}
+
+// NewProgress starts tracking a run.
+func NewProgress() *Progress {
+	return &Progress{tables: make(map[string]*TableProgress)}
+}
+
+func (progress *Progress) table(name string) *TableProgress {
+	table, ok := progress.tables[name]
+	if !ok {
+		table = &TableProgress{Phase: PHASE_QUEUED}
+		progress.tables[name] = table
+		progress.order = append(progress.order, name)
+	}
+	return table
+}
+
+// SetPhase moves table to phase, estimating total bytes for it. A zero total
+// keeps the estimate of the previous phase.
+func (progress *Progress) SetPhase(table string, phase string, total int64) {
+	if progress == nil {
+		return
+	}
+	progress.mu.Lock()
+	defer progress.mu.Unlock()
+	state := progress.table(table)
+	state.Phase = phase
+	state.Bytes = 0
+	state.Started = time.Now()
+	if total > 0 {
+		state.Total = total
+	}
+}
+
+// AddBytes records bytes transferred for table.
+func (progress *Progress) AddBytes(table string, n int64) {
+	if progress == nil {
+		return
+	}
+	progress.mu.Lock()
+	defer progress.mu.Unlock()
+	progress.table(table).Bytes += n
+}
+
+// Fail marks table as failed with err.
+func (progress *Progress) Fail(table string, err error) {
+	if progress == nil {
+		return
+	}
+	progress.mu.Lock()
+	defer progress.mu.Unlock()
+	progress.table(table).Phase = PHASE_FAILED
+	progress.errors = append(progress.errors, table+": "+err.Error())
+}
+
+// Writer returns a writer counting the bytes written as transferred for
+// table.
+func (progress *Progress) Writer(table string) *ProgressWriter {
+	return &ProgressWriter{progress: progress, table: table}
+}
+
+// Write keeps the latest log lines, so logs can be shown next to the tables.
+// Lines reporting failures are kept as errors as well.
+func (progress *Progress) Write(p []byte) (int, error) {
+	progress.mu.Lock()
+	defer progress.mu.Unlock()
+	for _, line := range strings.Split(strings.TrimRight(string(p), "\n"), "\n") {
+		if strings.Contains(line, "failed") || strings.Contains(line, "Failed") {
+			progress.errors = append(progress.errors, line)
+		}
+		progress.logs = append(progress.logs, line)
+	}
+	if len(progress.logs) > TUI_LOG_LINES {
+		progress.logs = progress.logs[len(progress.logs)-TUI_LOG_LINES:]
+	}
+	return len(p), nil
+}
+
+// Snapshot returns a copy of the state of every table, in the order they
+// were first seen, with the recorded errors and latest log lines.
+func (progress *Progress) Snapshot() (names []string, tables []TableProgress, errors []string, logs []string) {
+	progress.mu.Lock()
+	defer progress.mu.Unlock()
+	for _, name := range progress.order {
+		names = append(names, name)
+		tables = append(tables, *progress.tables[name])
+	}
+	return names, tables, append([]string(nil), progress.errors...), append([]string(nil), progress.logs...)
+}
+
+// ProgressWriter counts bytes written as transferred for a table.
+type ProgressWriter struct {
+	progress *Progress
+	table    string
+}
+
+func (writer *ProgressWriter) Write(p []byte) (int, error) {
+	writer.progress.AddBytes(writer.table, int64(len(p)))
+	return len(p), nil
+}
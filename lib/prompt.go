@@ -0,0 +1,146 @@
+package lib
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+
+	. "github.com/timakin/gopli/constants"
+)
+
+var (
+	errNoTerminal = errors.New("stdin is not a terminal")
+	errNoPrompt   = errors.New("prompts are off (no_prompt)")
+)
+
+var (
+	promptMu sync.Mutex
+	// prompted holds the secrets entered so far, so every secret is only
+	// asked for once per run.
+	prompted = make(map[string]string)
+	stdin    = bufio.NewReader(os.Stdin)
+	noPrompt bool
+)
+
+var (
+	ttyMu sync.Mutex
+	// echoOff is set while a secret is typed without echo.
+	echoOff bool
+)
+
+// DisablePrompts stops asking for missing secrets, like without a terminal.
+func DisablePrompts(disable bool) {
+	promptMu.Lock()
+	defer promptMu.Unlock()
+	noPrompt = disable
+}
+
+// PromptPassword asks for the password of dbConf on the terminal when the
+// configuration gives none. Without a terminal, e.g. in cron or CI, dbConf is
+// returned as it is and the client connects without a password.
+func PromptPassword(dbConf Database) (Database, error) {
+	if dbConf.Password != "" || dbConf.UseMyCnf || dbConf.IAMAuth || dbConf.NoPassword {
+		return dbConf, nil
+	}
+	account := dbConf.User + "@" + dbConf.Host
+	password, err := askSecret("database "+account, T("Password for ")+account+": ")
+	if err == errNoTerminal || err == errNoPrompt {
+		return dbConf, nil
+	}
+	dbConf.Password = password
+	return dbConf, err
+}
+
+// askSecret returns the secret named key, asking for it with prompt the
+// first time.
+func askSecret(key string, prompt string) (string, error) {
+	promptMu.Lock()
+	defer promptMu.Unlock()
+	if secret, ok := prompted[key]; ok {
+		return secret, nil
+	}
+	if noPrompt {
+		return "", errNoPrompt
+	}
+	secret, err := readSecret(prompt)
+	if err != nil {
+		return "", err
+	}
+	prompted[key] = secret
+	return secret, nil
+}
+
+// readSecret reads a line from the terminal without echoing it.
+var readSecret = func(prompt string) (string, error) {
+	if !IsTerminal(os.Stdin) {
+		return "", errNoTerminal
+	}
+	fmt.Fprint(os.Stderr, prompt)
+	defer fmt.Fprintln(os.Stderr)
+	interrupted := make(chan os.Signal, 1)
+	signal.Notify(interrupted, os.Interrupt, syscall.SIGTERM)
+	defer func() {
+		signal.Stop(interrupted)
+		close(interrupted)
+	}()
+	go restoreOnSignal(interrupted)
+	if err := hideInput(); err != nil {
+		return "", err
+	}
+	defer RestoreTerminal()
+	line, err := stdin.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// hideInput turns echo off for typing a secret.
+func hideInput() error {
+	ttyMu.Lock()
+	defer ttyMu.Unlock()
+	if err := stty("-echo"); err != nil {
+		return err
+	}
+	echoOff = true
+	return nil
+}
+
+// RestoreTerminal turns echo back on when the process is interrupted while a
+// secret is typed, and leaves the screen of the progress.
+func RestoreTerminal() {
+	leaveTUI()
+	ttyMu.Lock()
+	defer ttyMu.Unlock()
+	if echoOff {
+		stty("echo")
+		echoOff = false
+	}
+}
+
+// restoreOnSignal turns echo back on when a signal arrives during a prompt,
+// and delivers the signal again to the handlers of the command, or to the
+// default one terminating the process.
+func restoreOnSignal(signals chan os.Signal) {
+	sig, ok := <-signals
+	if !ok {
+		return
+	}
+	RestoreTerminal()
+	signal.Stop(signals)
+	if process, err := os.FindProcess(os.Getpid()); err == nil {
+		process.Signal(sig)
+	}
+}
+
+func stty(mode string) error {
+	cmd := exec.Command("stty", mode)
+	cmd.Stdin = os.Stdin
+	return cmd.Run()
+}
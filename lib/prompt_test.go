@@ -0,0 +1,94 @@
+package lib
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"testing"
+
+	. "github.com/timakin/gopli/constants"
+)
+
+func stubSecret(t *testing.T, secret string, err error) *int {
+	original := readSecret
+	asked := 0
+	readSecret = func(prompt string) (string, error) {
+		asked++
+		return secret, err
+	}
+	prompted = make(map[string]string)
+	t.Cleanup(func() {
+		readSecret = original
+		prompted = make(map[string]string)
+	})
+	return &asked
+}
+
+func TestPromptPassword(t *testing.T) {
+	asked := stubSecret(t, "s3cret", nil)
+
+	dbConf := Database{Host: "db.internal", User: "app"}
+	for i := 0; i < 2; i++ {
+		prompted, err := PromptPassword(dbConf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if prompted.Password != "s3cret" {
+			t.Errorf("expected the entered password, got %q", prompted.Password)
+		}
+	}
+	if *asked != 1 {
+		t.Errorf("expected to be asked once, was asked %d times", *asked)
+	}
+
+	for _, configured := range []Database{
+		{User: "app", Password: "configured"},
+		{User: "app", UseMyCnf: true},
+		{User: "app", IAMAuth: true},
+		{User: "root", NoPassword: true},
+	} {
+		if prompted, err := PromptPassword(configured); err != nil || prompted.Password != configured.Password {
+			t.Errorf("expected %+v as it is, got %+v, %v", configured, prompted, err)
+		}
+	}
+	if *asked != 1 {
+		t.Errorf("expected no more prompts, was asked %d times", *asked)
+	}
+}
+
+func TestPromptPasswordWithoutTerminal(t *testing.T) {
+	stubSecret(t, "", errNoTerminal)
+
+	dbConf, err := PromptPassword(Database{Host: "db.internal", User: "app"})
+	if err != nil || dbConf.Password != "" {
+		t.Errorf("expected to go on without a password, got %+v, %v", dbConf, err)
+	}
+}
+
+func TestLoadSignerWithPassphrase(t *testing.T) {
+	asked := stubSecret(t, "passphrase", nil)
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, err := x509.EncryptPEMBlock(rand.Reader, "RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(key), []byte("passphrase"), x509.PEMCipherAES256)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sshConf := SSH{Host: "bastion", KeyData: pem.EncodeToMemory(block)}
+	if _, err := LoadSigner(sshConf); err != nil {
+		t.Fatal(err)
+	}
+	if *asked != 1 {
+		t.Errorf("expected to be asked for the passphrase once, was asked %d times", *asked)
+	}
+
+	stubSecret(t, "", errNoTerminal)
+	if _, err := LoadSigner(sshConf); !errors.Is(err, ErrCredentialsMissing) {
+		t.Errorf("expected missing credentials without a terminal, got %v", err)
+	}
+}
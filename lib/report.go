@@ -0,0 +1,151 @@
+package lib
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os/exec"
+	"sort"
+	"strings"
+	"time"
+
+	. "github.com/timakin/gopli/constants"
+)
+
+// Report summarizes a single run.
+type Report struct {
+	From    string `json:"from"`
+	To      string `json:"to"`
+	WorkDir string `json:"work_dir"`
+	// FailedTables maps every failed table to its error.
+	FailedTables  map[string]string `json:"failed_tables,omitempty"`
+	SkippedTables []string          `json:"skipped_tables,omitempty"`
+	Fetch         *FetchStats       `json:"fetch,omitempty"`
+	// Failovers lists the source hosts that were skipped for their failover.
+	Failovers []Failover `json:"failovers,omitempty"`
+	// Seeds lists the seed files applied after the load.
+	Seeds []string `json:"seeds,omitempty"`
+	// Destinations holds the outcome of every destination when loading
+	// into several at once.
+	Destinations []DestinationResult `json:"destinations,omitempty"`
+	// Error is the failure the run gave up with, and MySQLErrorCode the
+	// code of the MySQL error behind it.
+	Error          string    `json:"error,omitempty"`
+	MySQLErrorCode int       `json:"mysql_error_code,omitempty"`
+	StartedAt      time.Time `json:"started_at"`
+	FinishedAt     time.Time `json:"finished_at"`
+}
+
+// Failover records a switch from an unreachable source host.
+type Failover struct {
+	From   string `json:"from"`
+	To     string `json:"to"`
+	Reason string `json:"reason"`
+}
+
+// NewReport starts a report for a run between from and to.
+func NewReport(from string, to string) *Report {
+	return &Report{
+		From:      from,
+		To:        to,
+		StartedAt: time.Now(),
+	}
+}
+
+// AddTableErrors records the failed tables of a phase.
+func (report *Report) AddTableErrors(tableErrors *TableErrors) {
+	if report.FailedTables == nil {
+		report.FailedTables = make(map[string]string)
+	}
+	for table, message := range tableErrors.Messages() {
+		report.FailedTables[table] = tableErrors.Phase + ": " + message
+	}
+	if tableErrors.Skipped {
+		report.SkippedTables = append(report.SkippedTables, tableErrors.Tables()...)
+	}
+}
+
+// Failures lists the failed tables with their errors, then the failed
+// destinations with theirs.
+func (report *Report) Failures() []string {
+	tables := make([]string, 0, len(report.FailedTables))
+	for table := range report.FailedTables {
+		tables = append(tables, table)
+	}
+	sort.Strings(tables)
+	var failures []string
+	for _, table := range tables {
+		failures = append(failures, table+": "+report.FailedTables[table])
+	}
+	for _, result := range report.Destinations {
+		if result.Error != "" {
+			failures = append(failures, result.Host+": "+result.Error)
+		}
+	}
+	return failures
+}
+
+// SetError records the failure the run gave up with.
+func (report *Report) SetError(err error) {
+	report.Error = err.Error()
+	var mysqlError *MySQLError
+	if errors.As(err, &mysqlError) {
+		report.MySQLErrorCode = mysqlError.Code
+	}
+}
+
+// Write stamps the finish time and saves the report as JSON.
+func (report *Report) Write(path string) error {
+	reportBytes, err := report.finish()
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, reportBytes, 0600)
+}
+
+// Upload stamps the finish time and sends the report as JSON to target:
+// copied with the aws CLI to an s3:// path, or POSTed to an http(s) URL.
+func (report *Report) Upload(target string) error {
+	reportBytes, err := report.finish()
+	if err != nil {
+		return err
+	}
+	switch {
+	case strings.HasPrefix(target, REPORT_SCHEME_S3):
+		return runUploadCommand(bytes.NewReader(reportBytes), "aws", "s3", "cp", "--content-type", "application/json", "-", target)
+	case strings.HasPrefix(target, "http://"), strings.HasPrefix(target, "https://"):
+		client := &http.Client{Timeout: REPORT_UPLOAD_TIMEOUT_SECONDS * time.Second}
+		resp, err := client.Post(target, "application/json", bytes.NewReader(reportBytes))
+		if err != nil {
+			return redactURLError(err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode >= 300 {
+			return fmt.Errorf("report rejected with %s", resp.Status)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unsupported report URL %q", RedactURL(target))
+	}
+}
+
+func (report *Report) finish() ([]byte, error) {
+	report.FinishedAt = time.Now()
+	return json.MarshalIndent(report, "", "  ")
+}
+
+// runUploadCommand runs an object store CLI reading the upload from stdin.
+var runUploadCommand = func(stdin io.Reader, name string, args ...string) error {
+	var stderr bytes.Buffer
+	cmd := exec.Command(name, args...)
+	cmd.Stdin = stdin
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%s: %v: %s", name, err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
@@ -0,0 +1,89 @@
+package lib
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestReportUploadPostsJSON(t *testing.T) {
+	var received Report
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.Header.Get("Content-Type") != "application/json" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		json.NewDecoder(r.Body).Decode(&received)
+	}))
+	defer server.Close()
+
+	report := NewReport("production", "staging")
+	if err := report.Upload(server.URL + "/reports"); err != nil {
+		t.Fatal(err)
+	}
+	if received.From != "production" || received.To != "staging" || received.FinishedAt.IsZero() {
+		t.Errorf("unexpected report %+v", received)
+	}
+}
+
+func TestReportUploadRejected(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer server.Close()
+
+	if err := NewReport("production", "staging").Upload(server.URL); err == nil {
+		t.Error("expected an error for a rejected upload")
+	}
+}
+
+func TestReportUploadToS3(t *testing.T) {
+	defer func(original func(io.Reader, string, ...string) error) { runUploadCommand = original }(runUploadCommand)
+	var args []string
+	var body []byte
+	runUploadCommand = func(stdin io.Reader, name string, arg ...string) error {
+		args = append([]string{name}, arg...)
+		body, _ = ioutil.ReadAll(stdin)
+		return nil
+	}
+
+	if err := NewReport("production", "staging").Upload("s3://reports/gopli/staging.json"); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"aws", "s3", "cp", "--content-type", "application/json", "-", "s3://reports/gopli/staging.json"}
+	if !reflect.DeepEqual(args, want) {
+		t.Errorf("args = %v, want %v", args, want)
+	}
+	var uploaded Report
+	if err := json.Unmarshal(body, &uploaded); err != nil || uploaded.From != "production" {
+		t.Errorf("unexpected upload %s: %v", body, err)
+	}
+}
+
+func TestReportUploadUnsupported(t *testing.T) {
+	if err := NewReport("production", "staging").Upload("ftp://reports"); err == nil {
+		t.Error("expected an error for an unsupported URL")
+	}
+}
+
+func TestReportFailures(t *testing.T) {
+	report := NewReport("production", "staging,qa")
+	tableErrors := NewTableErrors("load")
+	tableErrors.Add("users", errors.New("exit status 1"))
+	tableErrors.Add("orders", errors.New("exit status 2"))
+	report.AddTableErrors(tableErrors)
+	report.Destinations = []DestinationResult{{Host: "staging"}, {Host: "qa", Error: "Failed to clean: timeout"}}
+
+	want := []string{"orders: load: exit status 2", "users: load: exit status 1", "qa: Failed to clean: timeout"}
+	if failures := report.Failures(); !reflect.DeepEqual(failures, want) {
+		t.Errorf("expected %v, got %v", want, failures)
+	}
+	if failures := NewReport("production", "staging").Failures(); len(failures) != 0 {
+		t.Errorf("expected no failures, got %v", failures)
+	}
+}
@@ -0,0 +1,296 @@
+package lib
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	. "github.com/timakin/gopli/constants"
+)
+
+// Column is the definition of a single column as found in information_schema.
+type Column struct {
+	Table    string
+	Name     string
+	Type     string
+	Nullable bool
+	// Default is nil when the column has no default value.
+	Default *string
+	Extra   string
+}
+
+// Generated reports whether the column is computed from other columns.
+// Such columns can neither be loaded nor altered like plain ones.
+func (column Column) Generated() bool {
+	return strings.Contains(column.Extra, "VIRTUAL GENERATED") || strings.Contains(column.Extra, "STORED GENERATED")
+}
+
+// Invisible reports whether the column is left out of SELECT *.
+func (column Column) Invisible() bool {
+	return strings.Contains(column.Extra, "INVISIBLE")
+}
+
+// CheckConstraint is a CHECK constraint of a table.
+type CheckConstraint struct {
+	Table  string
+	Name   string
+	Clause string
+}
+
+// Schema is what DiffSchemas compares.
+type Schema struct {
+	Columns []Column
+	Checks  []CheckConstraint
+}
+
+// CheckChange adds or drops a CHECK constraint. A changed constraint is
+// dropped and added again.
+type CheckChange struct {
+	Action string
+	Check  CheckConstraint
+}
+
+// ColumnChange is a change bringing a destination column in line with the source.
+type ColumnChange struct {
+	Action string
+	Column Column
+	// After names the column a new column follows, empty for the first one.
+	After string
+}
+
+// DDLStatement is a single generated statement.
+type DDLStatement struct {
+	SQL string
+	// Table and Alter are set for ALTER TABLE statements, Alter holding its
+	// clauses, so online schema change tools can run them.
+	Table string
+	Alter string
+}
+
+// IsComment reports whether the statement is a note for the reader only.
+func (statement DDLStatement) IsComment() bool {
+	return strings.HasPrefix(statement.SQL, "--")
+}
+
+// SchemaDiff lists the differences between a source and a destination schema.
+type SchemaDiff struct {
+	// MissingTables exist on the source only.
+	MissingTables []string
+	// ExtraTables exist on the destination only. They are never dropped.
+	ExtraTables []string
+	// ChangedTables have column or constraint changes, in the order of the source.
+	ChangedTables []string
+	Changes       map[string][]ColumnChange
+	CheckChanges  map[string][]CheckChange
+	// ExtraColumns exist on the destination only, by table, once
+	// KeepExtraColumns left them out of the changes.
+	ExtraColumns map[string][]string
+}
+
+// KeepExtraColumns leaves the columns of the destination only out of the
+// changes, so they are kept instead of dropped.
+func (diff *SchemaDiff) KeepExtraColumns() {
+	diff.ExtraColumns = make(map[string][]string)
+	var changed []string
+	for _, table := range diff.ChangedTables {
+		var changes []ColumnChange
+		for _, change := range diff.Changes[table] {
+			if change.Action == COLUMN_DROP {
+				diff.ExtraColumns[table] = append(diff.ExtraColumns[table], change.Column.Name)
+				continue
+			}
+			changes = append(changes, change)
+		}
+		diff.Changes[table] = changes
+		if len(changes) > 0 || len(diff.CheckChanges[table]) > 0 {
+			changed = append(changed, table)
+		}
+	}
+	diff.ChangedTables = changed
+}
+
+// ExtraColumnTables returns the tables with ExtraColumns in order.
+func (diff *SchemaDiff) ExtraColumnTables() []string {
+	tables := make([]string, 0, len(diff.ExtraColumns))
+	for table := range diff.ExtraColumns {
+		tables = append(tables, table)
+	}
+	sort.Strings(tables)
+	return tables
+}
+
+// ExcludeDataOnly leaves the tables filter marks as data only out of the
+// diff, and returns them.
+func (diff *SchemaDiff) ExcludeDataOnly(filter Filter) []string {
+	var excluded []string
+	keep := func(tables []string) []string {
+		var kept []string
+		for _, table := range tables {
+			if TableClass(filter, table) == TABLE_CLASS_DATA_ONLY {
+				excluded = append(excluded, table)
+				continue
+			}
+			kept = append(kept, table)
+		}
+		return kept
+	}
+	diff.MissingTables = keep(diff.MissingTables)
+	diff.ChangedTables = keep(diff.ChangedTables)
+	diff.ExtraTables = keep(diff.ExtraTables)
+	return excluded
+}
+
+// Empty reports whether the schemas match.
+func (diff *SchemaDiff) Empty() bool {
+	return len(diff.MissingTables) == 0 && len(diff.ExtraTables) == 0 && len(diff.ChangedTables) == 0 && len(diff.ExtraColumns) == 0
+}
+
+// Err returns an error wrapping ErrTableSchemaMismatch naming the tables
+// that differ, or nil when the schemas match.
+func (diff *SchemaDiff) Err() error {
+	if diff.Empty() {
+		return nil
+	}
+	var tables []string
+	tables = append(tables, diff.MissingTables...)
+	tables = append(tables, diff.ChangedTables...)
+	for _, table := range diff.ExtraColumnTables() {
+		if len(diff.Changes[table]) == 0 && len(diff.CheckChanges[table]) == 0 {
+			tables = append(tables, table)
+		}
+	}
+	tables = append(tables, diff.ExtraTables...)
+	return fmt.Errorf("%w: %s", ErrTableSchemaMismatch, strings.Join(tables, ", "))
+}
+
+// DiffSchemas compares the source schema with the destination.
+// Excluded tables are ignored.
+func DiffSchemas(source *Schema, destination *Schema) *SchemaDiff {
+	sourceTables, sourceOrder := groupColumns(source.Columns)
+	destinationTables, destinationOrder := groupColumns(destination.Columns)
+	sourceChecks := groupChecks(source.Checks)
+	destinationChecks := groupChecks(destination.Checks)
+
+	diff := &SchemaDiff{Changes: make(map[string][]ColumnChange), CheckChanges: make(map[string][]CheckChange)}
+	for _, key := range sourceOrder {
+		columns := sourceTables[key]
+		table := columns[0].Table
+		existing, ok := destinationTables[key]
+		if !ok {
+			diff.MissingTables = append(diff.MissingTables, table)
+			continue
+		}
+		changes := diffColumns(columns, existing)
+		checkChanges := diffChecks(sourceChecks[key], destinationChecks[key])
+		if len(changes) > 0 || len(checkChanges) > 0 {
+			diff.ChangedTables = append(diff.ChangedTables, table)
+			diff.Changes[table] = changes
+			diff.CheckChanges[table] = checkChanges
+		}
+	}
+	for _, key := range destinationOrder {
+		if _, ok := sourceTables[key]; !ok {
+			diff.ExtraTables = append(diff.ExtraTables, destinationTables[key][0].Table)
+		}
+	}
+	return diff
+}
+
+func groupChecks(checks []CheckConstraint) map[string][]CheckConstraint {
+	tables := make(map[string][]CheckConstraint)
+	for _, check := range checks {
+		key := TableKey(check.Table)
+		tables[key] = append(tables[key], check)
+	}
+	return tables
+}
+
+func diffChecks(source []CheckConstraint, destination []CheckConstraint) []CheckChange {
+	existing := make(map[string]CheckConstraint)
+	for _, check := range destination {
+		existing[check.Name] = check
+	}
+	var changes []CheckChange
+	seen := make(map[string]bool)
+	for _, check := range source {
+		seen[check.Name] = true
+		current, ok := existing[check.Name]
+		if ok && current.Clause == check.Clause {
+			continue
+		}
+		if ok {
+			changes = append(changes, CheckChange{Action: COLUMN_DROP, Check: current})
+		}
+		changes = append(changes, CheckChange{Action: COLUMN_ADD, Check: check})
+	}
+	for _, check := range destination {
+		if !seen[check.Name] {
+			changes = append(changes, CheckChange{Action: COLUMN_DROP, Check: check})
+		}
+	}
+	return changes
+}
+
+func groupColumns(columns []Column) (map[string][]Column, []string) {
+	tables := make(map[string][]Column)
+	var order []string
+	for _, column := range columns {
+		if IsExcludedTable(column.Table) {
+			continue
+		}
+		key := TableKey(column.Table)
+		if _, ok := tables[key]; !ok {
+			order = append(order, key)
+		}
+		tables[key] = append(tables[key], column)
+	}
+	return tables, order
+}
+
+func diffColumns(source []Column, destination []Column) []ColumnChange {
+	existing := make(map[string]Column)
+	for _, column := range destination {
+		existing[TableKey(column.Name)] = column
+	}
+
+	var changes []ColumnChange
+	var after string
+	seen := make(map[string]bool)
+	for _, column := range source {
+		key := TableKey(column.Name)
+		seen[key] = true
+		current, ok := existing[key]
+		switch {
+		case !ok:
+			changes = append(changes, ColumnChange{Action: COLUMN_ADD, Column: column, After: after})
+		case !sameDefinition(column, current):
+			changes = append(changes, ColumnChange{Action: COLUMN_MODIFY, Column: column})
+		}
+		after = column.Name
+	}
+	for _, column := range destination {
+		if !seen[TableKey(column.Name)] {
+			changes = append(changes, ColumnChange{Action: COLUMN_DROP, Column: column})
+		}
+	}
+	return changes
+}
+
+// integerDisplayWidth matches the display width of integer types, which
+// MySQL 8.0.19 and later no longer report while MariaDB still does.
+var integerDisplayWidth = regexp.MustCompile(`^((?:tiny|small|medium|big)?int)\(\d+\)`)
+
+func sameType(a string, b string) bool {
+	return integerDisplayWidth.ReplaceAllString(a, "$1") == integerDisplayWidth.ReplaceAllString(b, "$1")
+}
+
+func sameDefinition(a Column, b Column) bool {
+	if !sameType(a.Type, b.Type) || a.Nullable != b.Nullable || a.Extra != b.Extra {
+		return false
+	}
+	if a.Default == nil || b.Default == nil {
+		return a.Default == nil && b.Default == nil
+	}
+	return *a.Default == *b.Default
+}
@@ -0,0 +1,115 @@
+package lib
+
+import (
+	"testing"
+
+	. "github.com/timakin/gopli/constants"
+)
+
+func TestDiffSchemas(t *testing.T) {
+	zero := "0"
+	source := []Column{
+		{Table: "users", Name: "id", Type: "int(11)", Extra: "auto_increment"},
+		{Table: "users", Name: "name", Type: "varchar(255)", Nullable: true},
+		{Table: "users", Name: "age", Type: "int(11)", Default: &zero},
+		{Table: "posts", Name: "id", Type: "int(11)"},
+		{Table: "schema_migrations", Name: "version", Type: "varchar(255)"},
+	}
+	destination := []Column{
+		{Table: "users", Name: "id", Type: "int(11)", Extra: "auto_increment"},
+		{Table: "users", Name: "name", Type: "varchar(100)", Nullable: true},
+		{Table: "users", Name: "legacy", Type: "text", Nullable: true},
+		{Table: "audits", Name: "id", Type: "int(11)"},
+	}
+
+	diff := DiffSchemas(&Schema{Columns: source}, &Schema{Columns: destination})
+	if len(diff.MissingTables) != 1 || diff.MissingTables[0] != "posts" {
+		t.Errorf("unexpected missing tables: %v", diff.MissingTables)
+	}
+	if len(diff.ExtraTables) != 1 || diff.ExtraTables[0] != "audits" {
+		t.Errorf("unexpected extra tables: %v", diff.ExtraTables)
+	}
+	changes := diff.Changes["users"]
+	if len(diff.ChangedTables) != 1 || len(changes) != 3 {
+		t.Fatalf("unexpected changes: %+v", diff.Changes)
+	}
+	expected := []struct{ action, column, after string }{
+		{COLUMN_MODIFY, "name", ""},
+		{COLUMN_ADD, "age", "name"},
+		{COLUMN_DROP, "legacy", ""},
+	}
+	for i, e := range expected {
+		if changes[i].Action != e.action || changes[i].Column.Name != e.column || changes[i].After != e.after {
+			t.Errorf("change %d: expected %v, got %+v", i, e, changes[i])
+		}
+	}
+
+	if !DiffSchemas(&Schema{Columns: source}, &Schema{Columns: source}).Empty() {
+		t.Error("expected no differences between identical schemas")
+	}
+
+	diff.KeepExtraColumns()
+	if len(diff.Changes["users"]) != 2 || len(diff.ExtraColumns["users"]) != 1 || diff.ExtraColumns["users"][0] != "legacy" {
+		t.Errorf("expected legacy to be kept, got %+v and %v", diff.Changes["users"], diff.ExtraColumns)
+	}
+
+	// A table whose only change is an extra column still differs.
+	diff = DiffSchemas(&Schema{Columns: source}, &Schema{Columns: append(source, Column{Table: "posts", Name: "legacy", Type: "text"})})
+	diff.KeepExtraColumns()
+	if len(diff.ChangedTables) != 0 || diff.Empty() || diff.Err() == nil {
+		t.Errorf("expected posts to differ without changes, got %+v", diff)
+	}
+}
+
+func TestDiffSchemasChecks(t *testing.T) {
+	columns := []Column{{Table: "users", Name: "age", Type: "int"}}
+	source := &Schema{Columns: columns, Checks: []CheckConstraint{
+		{Table: "users", Name: "adult", Clause: "(`age` >= 18)"},
+		{Table: "users", Name: "sane", Clause: "(`age` < 200)"},
+	}}
+	destination := &Schema{Columns: columns, Checks: []CheckConstraint{
+		{Table: "users", Name: "adult", Clause: "(`age` >= 20)"},
+		{Table: "users", Name: "legacy", Clause: "(`age` > 0)"},
+	}}
+
+	changes := DiffSchemas(source, destination).CheckChanges["users"]
+	expected := []struct{ action, name, clause string }{
+		{COLUMN_DROP, "adult", "(`age` >= 20)"},
+		{COLUMN_ADD, "adult", "(`age` >= 18)"},
+		{COLUMN_ADD, "sane", "(`age` < 200)"},
+		{COLUMN_DROP, "legacy", "(`age` > 0)"},
+	}
+	if len(changes) != len(expected) {
+		t.Fatalf("unexpected changes: %+v", changes)
+	}
+	for i, e := range expected {
+		if changes[i].Action != e.action || changes[i].Check.Name != e.name || changes[i].Check.Clause != e.clause {
+			t.Errorf("change %d: expected %v, got %+v", i, e, changes[i])
+		}
+	}
+}
+
+func TestInvisibleAndGeneratedColumns(t *testing.T) {
+	if !(Column{Extra: "INVISIBLE"}).Invisible() || !(Column{Extra: "DEFAULT_GENERATED INVISIBLE"}).Invisible() {
+		t.Error("expected invisible columns to be detected")
+	}
+	if (Column{Extra: "DEFAULT_GENERATED"}).Generated() || !(Column{Extra: "STORED GENERATED"}).Generated() {
+		t.Error("expected only computed columns to count as generated")
+	}
+}
+
+func TestDiffSchemasIgnoresIntegerDisplayWidth(t *testing.T) {
+	source := &Schema{Columns: []Column{{Table: "users", Name: "id", Type: "int(11) unsigned"}}}
+	destination := &Schema{Columns: []Column{{Table: "users", Name: "id", Type: "int unsigned"}}}
+	if diff := DiffSchemas(source, destination); !diff.Empty() {
+		t.Errorf("expected no difference, got %+v", diff)
+	}
+}
+
+func TestExcludeDataOnly(t *testing.T) {
+	diff := &SchemaDiff{MissingTables: []string{"users", "events"}, ChangedTables: []string{"orders"}}
+	excluded := diff.ExcludeDataOnly(Filter{DataOnly: []string{"events", "orders"}})
+	if len(excluded) != 2 || len(diff.MissingTables) != 1 || diff.MissingTables[0] != "users" || len(diff.ChangedTables) != 0 {
+		t.Errorf("expected data only tables to be left out, got %+v (excluded %v)", diff, excluded)
+	}
+}
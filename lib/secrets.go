@@ -0,0 +1,199 @@
+package lib
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"strings"
+
+	. "github.com/timakin/gopli/constants"
+	"golang.org/x/crypto/ssh"
+)
+
+// SecretsProvider reads the secrets referred to by the configuration.
+type SecretsProvider interface {
+	// Secret returns the secret of ref, the reference without its prefix.
+	Secret(ref string) (string, error)
+}
+
+// secretsProviders returns the providers by the prefix of their references.
+// Providers only connect once they are asked for a secret.
+func secretsProviders(tmlconf *TomlConfig) map[string]SecretsProvider {
+	return map[string]SecretsProvider{
+		SECRET_REF_VAULT:  &vaultProvider{conf: tmlconf.Vault},
+		SECRET_REF_AWS_SM: &awsSecretsProvider{},
+		SECRET_REF_GCP_SM: &gcpSecretsProvider{},
+	}
+}
+
+// ResolveSecrets replaces the secret references in the configuration with
+// the secrets they point at, so no secret has to be stored on disk.
+// A reference looks like vault:secret/data/production/db#password or
+// aws-sm:production/db. Database and SSH passwords, SSH keys and
+// certificates may be references, and SSH keys are signed by Vault when
+// vault_sign is set.
+func ResolveSecrets(tmlconf *TomlConfig) error {
+	providers := secretsProviders(tmlconf)
+	resolve := func(value string) (string, bool, error) {
+		for prefix, provider := range providers {
+			if strings.HasPrefix(value, prefix) {
+				secret, err := provider.Secret(strings.TrimPrefix(value, prefix))
+				return secret, true, err
+			}
+		}
+		return value, false, nil
+	}
+
+	for name, dbConf := range tmlconf.Database {
+		password, ok, err := resolve(dbConf.Password)
+		if err != nil {
+			return fmt.Errorf("database.%s.password: %v", name, err)
+		}
+		if ok {
+			dbConf.Password = password
+			tmlconf.Database[name] = dbConf
+		}
+	}
+	for name, sshConf := range tmlconf.SSH {
+		key, ok, err := resolve(sshConf.Key)
+		if err != nil {
+			return fmt.Errorf("ssh.%s.key: %v", name, err)
+		}
+		if ok {
+			sshConf.KeyData = []byte(key)
+		}
+		password, ok, err := resolve(sshConf.Password)
+		if err != nil {
+			return fmt.Errorf("ssh.%s.password: %v", name, err)
+		}
+		if ok {
+			sshConf.Password = password
+		}
+		cert, ok, err := resolve(sshConf.Cert)
+		if err != nil {
+			return fmt.Errorf("ssh.%s.cert: %v", name, err)
+		}
+		if ok {
+			sshConf.CertData = []byte(cert)
+		}
+		if sshConf.VaultSign != "" {
+			vault, err := providers[SECRET_REF_VAULT].(*vaultProvider).connect()
+			if err != nil {
+				return fmt.Errorf("ssh.%s.vault_sign: %v", name, err)
+			}
+			signer, err := loadPrivateKey(sshConf)
+			if err != nil {
+				return fmt.Errorf("ssh.%s.key: %v", name, err)
+			}
+			cert, err := vault.SignPublicKey(sshConf.VaultSign, string(ssh.MarshalAuthorizedKey(signer.PublicKey())))
+			if err != nil {
+				return fmt.Errorf("ssh.%s.vault_sign: %v", name, err)
+			}
+			sshConf.CertData = []byte(cert)
+		}
+		tmlconf.SSH[name] = sshConf
+	}
+	return nil
+}
+
+// vaultProvider reads references like secret/data/production/db#password.
+type vaultProvider struct {
+	conf   Vault
+	client *vaultClient
+}
+
+func (provider *vaultProvider) connect() (*vaultClient, error) {
+	if provider.client == nil {
+		client, err := newVaultClient(provider.conf)
+		if err != nil {
+			return nil, err
+		}
+		provider.client = client
+	}
+	return provider.client, nil
+}
+
+func (provider *vaultProvider) Secret(ref string) (string, error) {
+	path, field := splitSecretField(ref)
+	if path == "" || field == "" {
+		return "", fmt.Errorf("Vault reference %q needs a path and a #field", ref)
+	}
+	client, err := provider.connect()
+	if err != nil {
+		return "", err
+	}
+	return client.Read(path, field)
+}
+
+// awsSecretsProvider reads references like production/db or
+// production/db#password from AWS Secrets Manager with the aws CLI and its
+// usual credentials and region.
+type awsSecretsProvider struct{}
+
+func (provider *awsSecretsProvider) Secret(ref string) (string, error) {
+	id, field := splitSecretField(ref)
+	secret, err := runSecretCommand("aws", "secretsmanager", "get-secret-value", "--secret-id", id, "--query", "SecretString", "--output", "text")
+	if err != nil {
+		return "", err
+	}
+	return secretField(strings.TrimSuffix(secret, "\n"), field)
+}
+
+// gcpSecretsProvider reads references like db-password or
+// projects/production/secrets/db#password from GCP Secret Manager with the
+// gcloud CLI. The latest version is read.
+type gcpSecretsProvider struct{}
+
+func (provider *gcpSecretsProvider) Secret(ref string) (string, error) {
+	name, field := splitSecretField(ref)
+	args := []string{"secrets", "versions", "access", "latest"}
+	if parts := strings.Split(name, "/"); len(parts) == 4 && parts[0] == "projects" && parts[2] == "secrets" {
+		args = append(args, "--project", parts[1], "--secret", parts[3])
+	} else {
+		args = append(args, "--secret", name)
+	}
+	secret, err := runSecretCommand("gcloud", args...)
+	if err != nil {
+		return "", err
+	}
+	return secretField(secret, field)
+}
+
+// runSecretCommand runs a secret store CLI and returns its output.
+var runSecretCommand = func(name string, args ...string) (string, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(name, args...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("%s: %v: %s", name, err, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.String(), nil
+}
+
+// splitSecretField splits a reference into the secret and the #field.
+func splitSecretField(ref string) (string, string) {
+	i := strings.LastIndex(ref, "#")
+	if i < 0 {
+		return ref, ""
+	}
+	return ref[:i], ref[i+1:]
+}
+
+// secretField returns field of a JSON secret, or the whole secret without a
+// field.
+func secretField(secret string, field string) (string, error) {
+	if field == "" {
+		return secret, nil
+	}
+	var fields map[string]interface{}
+	if err := json.Unmarshal([]byte(secret), &fields); err != nil {
+		return "", fmt.Errorf("secret is not a JSON object to read %s from", field)
+	}
+	value, ok := fields[field].(string)
+	if !ok {
+		return "", fmt.Errorf("no field %s in the secret", field)
+	}
+	return value, nil
+}
@@ -0,0 +1,102 @@
+package lib
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	. "github.com/timakin/gopli/constants"
+)
+
+func TestResolveSecretsFromVault(t *testing.T) {
+	_, key, _ := ed25519.GenerateKey(rand.Reader)
+	der, _ := x509.MarshalPKCS8PrivateKey(key)
+	keyPEM := string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}))
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != "s.test" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		switch r.URL.Path {
+		case "/v1/secret/data/production":
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"data": map[string]interface{}{
+					"data":     map[string]string{"password": "db-secret", "private_key": keyPEM},
+					"metadata": map[string]interface{}{"version": 3},
+				},
+			})
+		case "/v1/ssh-client-signer/sign/deploy":
+			json.NewEncoder(w).Encode(map[string]interface{}{"data": map[string]string{"signed_key": "signed"}})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	tmlconf := TomlConfig{
+		Database: map[string]Database{"production": {Password: "vault:secret/data/production#password"}},
+		SSH: map[string]SSH{"production": {
+			Key:       "vault:secret/data/production#private_key",
+			VaultSign: "ssh-client-signer/sign/deploy",
+		}},
+		Vault: Vault{Address: server.URL, Token: "s.test"},
+	}
+	if err := ResolveSecrets(&tmlconf); err != nil {
+		t.Fatal(err)
+	}
+	if password := tmlconf.Database["production"].Password; password != "db-secret" {
+		t.Errorf("expected the password from Vault, got %s", password)
+	}
+	sshConf := tmlconf.SSH["production"]
+	if string(sshConf.KeyData) != keyPEM || string(sshConf.CertData) != "signed" {
+		t.Errorf("expected the key and certificate from Vault, got %q and %q", sshConf.KeyData, sshConf.CertData)
+	}
+
+	tmlconf.Database["production"] = Database{Password: "vault:secret/data/production#missing"}
+	if err := ResolveSecrets(&tmlconf); err == nil {
+		t.Error("expected an error for a missing field")
+	}
+}
+
+func TestResolveSecretsFromCloudProviders(t *testing.T) {
+	defer func(run func(string, ...string) (string, error)) { runSecretCommand = run }(runSecretCommand)
+	var calls []string
+	runSecretCommand = func(name string, args ...string) (string, error) {
+		calls = append(calls, name+" "+strings.Join(args, " "))
+		if name == "aws" {
+			return "{\"password\":\"aws-secret\"}\n", nil
+		}
+		return "gcp-secret", nil
+	}
+
+	tmlconf := TomlConfig{Database: map[string]Database{
+		"production": {Password: "aws-sm:production/db#password"},
+		"staging":    {Password: "gcp-sm:projects/shared/secrets/staging-db"},
+	}}
+	if err := ResolveSecrets(&tmlconf); err != nil {
+		t.Fatal(err)
+	}
+	if password := tmlconf.Database["production"].Password; password != "aws-secret" {
+		t.Errorf("expected aws-secret, got %s", password)
+	}
+	if password := tmlconf.Database["staging"].Password; password != "gcp-secret" {
+		t.Errorf("expected gcp-secret, got %s", password)
+	}
+	sort.Strings(calls)
+	expected := []string{
+		"aws secretsmanager get-secret-value --secret-id production/db --query SecretString --output text",
+		"gcloud secrets versions access latest --project shared --secret staging-db",
+	}
+	if !reflect.DeepEqual(calls, expected) {
+		t.Errorf("expected %v, got %v", expected, calls)
+	}
+}
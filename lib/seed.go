@@ -0,0 +1,71 @@
+package lib
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	. "github.com/timakin/gopli/constants"
+)
+
+// SeedFiles lists the .sql and .csv files of dir in name order, so seeds can
+// be ordered with a numeric prefix. Other files are ignored.
+func SeedFiles(dir string) ([]string, error) {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	for _, entry := range entries {
+		ext := strings.ToLower(filepath.Ext(entry.Name()))
+		if entry.IsDir() || ext != SEED_SQL_EXT && ext != SEED_CSV_EXT {
+			continue
+		}
+		files = append(files, filepath.Join(dir, entry.Name()))
+	}
+	return files, nil
+}
+
+// seedData is what .sql seed files can refer to.
+type seedData struct {
+	Env map[string]string
+}
+
+// seedFuncs are the functions available to .sql seed files. sql quotes a
+// value as a string literal, e.g. {{ sql .Env.BASE_URL }}.
+var seedFuncs = template.FuncMap{
+	"sql": func(value string) string {
+		return "'" + strings.Replace(strings.Replace(value, "\\", "\\\\", -1), "'", "''", -1) + "'"
+	},
+}
+
+// RenderSeed expands the template variables of a .sql seed file with env, so
+// the same seeds serve every environment. Undefined variables are an error.
+func RenderSeed(path string, env map[string]string) (string, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	tmpl, err := template.New(filepath.Base(path)).Funcs(seedFuncs).Option("missingkey=error").Parse(string(content))
+	if err != nil {
+		return "", err
+	}
+	var rendered bytes.Buffer
+	if err := tmpl.Execute(&rendered, seedData{Env: env}); err != nil {
+		return "", err
+	}
+	return rendered.String(), nil
+}
+
+// SeedTable returns the table a CSV seed file is loaded into, named after the
+// file without its extension and an optional numeric prefix, e.g.
+// 10_feature_flags.csv or 20_archive.users.csv.
+func SeedTable(path string) string {
+	name := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	if i := strings.Index(name, "_"); i > 0 && strings.Trim(name[:i], "0123456789") == "" {
+		name = name[i+1:]
+	}
+	return name
+}
@@ -0,0 +1,67 @@
+package lib
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSeedFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gopli_seed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for _, name := range []string{"20_feature_flags.csv", "10_accounts.sql", "README.md"} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), nil, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	files, err := SeedFiles(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 2 || filepath.Base(files[0]) != "10_accounts.sql" || filepath.Base(files[1]) != "20_feature_flags.csv" {
+		t.Errorf("expected the seed files in name order, got %v", files)
+	}
+}
+
+func TestSeedTable(t *testing.T) {
+	for path, expected := range map[string]string{
+		"seeds/feature_flags.csv":     "feature_flags",
+		"seeds/20_feature_flags.csv":  "feature_flags",
+		"seeds/030_archive.users.csv": "archive.users",
+		"seeds/test_accounts.csv":     "test_accounts",
+	} {
+		if table := SeedTable(path); table != expected {
+			t.Errorf("%s: expected %s, got %s", path, expected, table)
+		}
+	}
+}
+
+func TestRenderSeed(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gopli_seed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "settings.sql")
+	seed := "UPDATE settings SET value = {{ sql .Env.BASE_URL }} WHERE name = 'base_url';"
+	if err := ioutil.WriteFile(path, []byte(seed), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	rendered, err := RenderSeed(path, map[string]string{"BASE_URL": "https://qa.example.com/?a='b'"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "UPDATE settings SET value = 'https://qa.example.com/?a=''b''' WHERE name = 'base_url';"
+	if rendered != expected {
+		t.Errorf("expected %q, got %q", expected, rendered)
+	}
+	if _, err := RenderSeed(path, nil); err == nil {
+		t.Error("expected an undefined variable to fail")
+	}
+}
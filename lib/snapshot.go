@@ -0,0 +1,313 @@
+package lib
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	. "github.com/timakin/gopli/constants"
+)
+
+// SnapshotMeta describes a set of dump files retained after a sync.
+type SnapshotMeta struct {
+	Name      string    `json:"name"`
+	Kind      string    `json:"kind"`
+	Source    string    `json:"source"`
+	Database  string    `json:"database"`
+	Tables    []string  `json:"tables"`
+	CreatedAt time.Time `json:"created_at"`
+	// Files maps the dump files laid out by the file_name template to
+	// their names in a workspace.
+	Files map[string]string `json:"files,omitempty"`
+	Path  string            `json:"-"`
+}
+
+// SnapshotDir returns the directory snapshots are stored in.
+func SnapshotDir(conf Snapshot) (string, error) {
+	dir := conf.Dir
+	if dir == "" {
+		dir = DEFAULT_SNAPSHOT_DIR
+	}
+	return ExpandPath(dir)
+}
+
+// DefaultSnapshotName builds a snapshot name from the source host key and the current time.
+func DefaultSnapshotName(source string) string {
+	return source + "-" + time.Now().Format(SNAPSHOT_TIME_FORMAT)
+}
+
+func validateSnapshotName(name string) error {
+	if name == "" || name == "." || name == ".." || strings.ContainsAny(name, `/\`) {
+		return errors.New("invalid snapshot name: " + name)
+	}
+	return nil
+}
+
+// SaveSnapshot copies every dump file in srcDir into a new snapshot named meta.Name.
+func SaveSnapshot(srcDir string, conf Snapshot, meta SnapshotMeta) (string, error) {
+	if err := validateSnapshotName(meta.Name); err != nil {
+		return "", err
+	}
+	dir, err := SnapshotDir(conf)
+	if err != nil {
+		return "", err
+	}
+	dstDir := filepath.Join(dir, meta.Name)
+	if _, err := os.Stat(dstDir); err == nil {
+		return "", errors.New("snapshot already exists: " + meta.Name)
+	}
+	if err := os.MkdirAll(dstDir, 0700); err != nil {
+		return "", err
+	}
+
+	meta.CreatedAt = time.Now()
+	files, err := ioutil.ReadDir(srcDir)
+	if err != nil {
+		return "", err
+	}
+	for _, file := range files {
+		if file.IsDir() {
+			continue
+		}
+		name, err := snapshotFileName(conf.FileName, meta, file.Name())
+		if err != nil {
+			return "", err
+		}
+		if name != file.Name() {
+			if meta.Files == nil {
+				meta.Files = make(map[string]string)
+			}
+			meta.Files[name] = file.Name()
+		}
+		dst := filepath.Join(dstDir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(dst), 0700); err != nil {
+			return "", err
+		}
+		if err := copyFile(filepath.Join(srcDir, file.Name()), dst); err != nil {
+			return "", err
+		}
+	}
+
+	metaBytes, err := json.MarshalIndent(meta, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	if err := ioutil.WriteFile(filepath.Join(dstDir, SNAPSHOT_META_FILE), metaBytes, 0600); err != nil {
+		return "", err
+	}
+	return dstDir, nil
+}
+
+// snapshotFileName lays out a file of a workspace in a snapshot according to
+// template. Files not belonging to a table of the snapshot stay at the top.
+func snapshotFileName(template string, meta SnapshotMeta, name string) (string, error) {
+	if template == "" {
+		return name, nil
+	}
+	for _, table := range meta.Tables {
+		tableFile := TableFileName(table)
+		if name != tableFile && !strings.HasPrefix(name, tableFile+".") {
+			continue
+		}
+		ext := strings.TrimPrefix(filepath.Ext(tableFile), ".") + name[len(tableFile):]
+		replacer := strings.NewReplacer(
+			"{db}", meta.Database,
+			"{source}", meta.Source,
+			"{snapshot}", meta.Name,
+			"{date}", meta.CreatedAt.Format(SNAPSHOT_DATE_FORMAT),
+			"{table}", strings.TrimSuffix(tableFile, filepath.Ext(tableFile)),
+			"{ext}", ext)
+		return checkFileNameTemplate(replacer.Replace(template))
+	}
+	return name, nil
+}
+
+func checkFileNameTemplate(name string) (string, error) {
+	cleaned := path.Clean(name)
+	if path.IsAbs(cleaned) || cleaned == "." || cleaned == ".." || strings.HasPrefix(cleaned, "../") || strings.Contains(cleaned, `\`) {
+		return "", errors.New("invalid snapshot file name: " + name)
+	}
+	return cleaned, nil
+}
+
+// ValidateFileNameTemplate checks a snapshot file_name template. {table} and
+// {ext} are required, so every file of a table gets a distinct name.
+func ValidateFileNameTemplate(template string) error {
+	if template == "" {
+		return nil
+	}
+	if !strings.Contains(template, "{table}") || !strings.HasSuffix(template, "{ext}") {
+		return errors.New("must contain {table} and end with {ext}")
+	}
+	_, err := checkFileNameTemplate(template)
+	return err
+}
+
+// OpenSnapshot opens a snapshot as a workspace to load it. Snapshots laid out
+// by a file_name template are linked into a temporary workspace, which the
+// returned function removes.
+func OpenSnapshot(meta SnapshotMeta, conf WorkspaceConf) (*Workspace, func(), error) {
+	if len(meta.Files) == 0 {
+		ws, err := OpenWorkspace(meta.Path, conf)
+		return ws, func() {}, err
+	}
+	ws, err := NewWorkspace(TMP_DIR_PREFIX, conf)
+	if err != nil {
+		return nil, nil, err
+	}
+	link := func(src string, name string) error {
+		return os.Symlink(filepath.Join(meta.Path, filepath.FromSlash(src)), filepath.Join(ws.Path, name))
+	}
+	files, err := ioutil.ReadDir(meta.Path)
+	if err != nil {
+		ws.Remove()
+		return nil, nil, err
+	}
+	for _, file := range files {
+		if file.IsDir() || file.Name() == SNAPSHOT_META_FILE || meta.Files[file.Name()] != "" {
+			continue
+		}
+		if err := link(file.Name(), file.Name()); err != nil {
+			ws.Remove()
+			return nil, nil, err
+		}
+	}
+	for src, name := range meta.Files {
+		if err := link(src, name); err != nil {
+			ws.Remove()
+			return nil, nil, err
+		}
+	}
+	return ws, ws.Remove, nil
+}
+
+// ListSnapshots returns every snapshot in the store, newest first.
+func ListSnapshots(conf Snapshot) ([]SnapshotMeta, error) {
+	dir, err := SnapshotDir(conf)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := ioutil.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var snapshots []SnapshotMeta
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		meta, err := readSnapshotMeta(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			continue
+		}
+		snapshots = append(snapshots, meta)
+	}
+	sort.Slice(snapshots, func(i, j int) bool {
+		return snapshots[i].CreatedAt.After(snapshots[j].CreatedAt)
+	})
+	return snapshots, nil
+}
+
+// LatestBackup returns the newest destination backup taken from host.
+func LatestBackup(conf Snapshot, host string) (SnapshotMeta, error) {
+	snapshots, err := ListSnapshots(conf)
+	if err != nil {
+		return SnapshotMeta{}, err
+	}
+	for _, snapshot := range snapshots {
+		if snapshot.Kind == SNAPSHOT_KIND_BACKUP && snapshot.Source == host {
+			return snapshot, nil
+		}
+	}
+	return SnapshotMeta{}, errors.New("no backup found for " + host)
+}
+
+// FindSnapshot looks up a snapshot by name.
+func FindSnapshot(conf Snapshot, name string) (SnapshotMeta, error) {
+	if err := validateSnapshotName(name); err != nil {
+		return SnapshotMeta{}, err
+	}
+	dir, err := SnapshotDir(conf)
+	if err != nil {
+		return SnapshotMeta{}, err
+	}
+	return readSnapshotMeta(filepath.Join(dir, name))
+}
+
+// PruneSnapshots removes snapshots that are neither among the newest keepLast
+// nor younger than keepDays. A zero value disables the respective rule, and
+// when both are zero nothing is removed.
+func PruneSnapshots(conf Snapshot, keepLast int, keepDays int) ([]SnapshotMeta, error) {
+	if keepLast <= 0 && keepDays <= 0 {
+		return nil, nil
+	}
+	snapshots, err := ListSnapshots(conf)
+	if err != nil {
+		return nil, err
+	}
+
+	threshold := time.Now().AddDate(0, 0, -keepDays)
+	var pruned []SnapshotMeta
+	for i, snapshot := range snapshots {
+		if keepLast > 0 && i < keepLast {
+			continue
+		}
+		if keepDays > 0 && snapshot.CreatedAt.After(threshold) {
+			continue
+		}
+		if err := os.RemoveAll(snapshot.Path); err != nil {
+			return pruned, err
+		}
+		pruned = append(pruned, snapshot)
+	}
+	return pruned, nil
+}
+
+func readSnapshotMeta(path string) (SnapshotMeta, error) {
+	var meta SnapshotMeta
+	metaBytes, err := ioutil.ReadFile(filepath.Join(path, SNAPSHOT_META_FILE))
+	if err != nil {
+		return meta, err
+	}
+	if err := json.Unmarshal(metaBytes, &meta); err != nil {
+		return meta, err
+	}
+	meta.Path = path
+	return meta, nil
+}
+
+func copyFile(src string, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	// Copies into a workspace must not be loaded half done.
+	partial := dst + PARTIAL_FILE_EXT
+	out, err := os.OpenFile(partial, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		os.Remove(partial)
+		return err
+	}
+	if err := out.Close(); err != nil {
+		os.Remove(partial)
+		return err
+	}
+	return os.Rename(partial, dst)
+}
@@ -0,0 +1,70 @@
+package lib
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	. "github.com/timakin/gopli/constants"
+)
+
+func TestSnapshotFileNameTemplate(t *testing.T) {
+	ws, err := NewWorkspace("gopli_test", WorkspaceConf{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ws.Remove()
+	for name, data := range map[string]string{TABLE_LIST_FILE: "users\n", "users.txt": "1\n", "users.txt.1": "2\n"} {
+		if err := ws.WriteFile(name, []byte(data)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	dir, err := ioutil.TempDir("", "gopli_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	conf := Snapshot{Dir: dir, FileName: "{date}/{db}/{table}.{ext}"}
+	path, err := SaveSnapshot(ws.Path, conf, SnapshotMeta{Name: "nightly", Database: "app", Tables: []string{"users"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	date := time.Now().Format(SNAPSHOT_DATE_FORMAT)
+	if _, err := os.Stat(filepath.Join(path, date, "app", "users.txt.1")); err != nil {
+		t.Errorf("expected the dump laid out by the template: %v", err)
+	}
+
+	meta, err := FindSnapshot(conf, "nightly")
+	if err != nil {
+		t.Fatal(err)
+	}
+	restored, closeSnapshot, err := OpenSnapshot(meta, WorkspaceConf{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer closeSnapshot()
+	if tables, err := restored.ReadTableList(); err != nil || len(tables) != 1 {
+		t.Errorf("expected the table list, got %v (%v)", tables, err)
+	}
+	if files := restored.TableFiles("users"); len(files) != 2 {
+		t.Errorf("expected 2 dump files, got %v", files)
+	}
+}
+
+func TestValidateFileNameTemplate(t *testing.T) {
+	for template, valid := range map[string]bool{
+		"":                      true,
+		"{db}/{table}.{ext}":    true,
+		"{table}.sql":           false,
+		"../{table}.{ext}":      false,
+		"/backup/{table}.{ext}": false,
+		"{date}/{table}-{ext}":  true,
+	} {
+		if err := ValidateFileNameTemplate(template); (err == nil) != valid {
+			t.Errorf("%q: expected valid=%v, got %v", template, valid, err)
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package lib
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"strings"
+	"unicode"
+
+	. "github.com/timakin/gopli/constants"
+)
+
+// maxTableFileName keeps dump file names well below the 255 byte limit of
+// common file systems.
+const maxTableFileName = 128
+
+// TableName is a table, optionally qualified with its schema. An empty
+// Schema means the database of the host the table is read from or loaded to.
+type TableName struct {
+	Schema string
+	Name   string
+}
+
+// ParseTableName parses the names found in table lists and on the command
+// line: "table", "schema.table", or either part quoted with backticks when
+// it contains dots, e.g. "`v1.events`".
+func ParseTableName(s string) TableName {
+	s = NormalizeTableName(s)
+	first, rest := splitIdentifier(s)
+	if strings.HasPrefix(rest, ".") && rest != "." {
+		second, trailing := splitIdentifier(rest[1:])
+		if trailing == "" {
+			return TableName{Schema: first, Name: second}
+		}
+	}
+	if rest == "" {
+		return TableName{Name: first}
+	}
+	// Not a valid qualified name, take it literally.
+	return TableName{Name: s}
+}
+
+// splitIdentifier reads a single, possibly backtick quoted, identifier from
+// the start of s and returns it with the remainder of s.
+func splitIdentifier(s string) (string, string) {
+	if !strings.HasPrefix(s, "`") {
+		if i := strings.Index(s, "."); i >= 0 {
+			return s[:i], s[i:]
+		}
+		return s, ""
+	}
+	var ident []byte
+	for i := 1; i < len(s); i++ {
+		if s[i] != '`' {
+			ident = append(ident, s[i])
+			continue
+		}
+		if i+1 < len(s) && s[i+1] == '`' {
+			ident = append(ident, '`')
+			i++
+			continue
+		}
+		return string(ident), s[i+1:]
+	}
+	// Unterminated quote
+	return s, ""
+}
+
+// String returns the name in the form ParseTableName reads back.
+func (table TableName) String() string {
+	if table.Schema == "" {
+		return listIdentifier(table.Name)
+	}
+	return listIdentifier(table.Schema) + "." + listIdentifier(table.Name)
+}
+
+func listIdentifier(name string) string {
+	if strings.ContainsAny(name, ".`") || name != NormalizeTableName(name) {
+		return "`" + strings.Replace(name, "`", "``", -1) + "`"
+	}
+	return name
+}
+
+// TableFileName returns the name of the dump file of table. Names that are
+// too long or contain characters unsafe in file names are replaced by a
+// readable prefix and a hash, so distinct tables never share a file. So are
+// names containing dots, which would read like a schema and a table.
+func TableFileName(table string) string {
+	parsed := ParseTableName(table)
+	name := parsed.Name
+	if parsed.Schema != "" {
+		name = parsed.Schema + "." + parsed.Name
+	}
+	dotted := strings.Contains(parsed.Schema, ".") || strings.Contains(parsed.Name, ".")
+	if len(name) <= maxTableFileName && isSafeFileName(name) && !dotted {
+		return name + ".txt"
+	}
+
+	hash := sha1.Sum([]byte(table))
+	var prefix []rune
+	for _, r := range name {
+		if len(string(prefix))+len(string(r)) > maxTableFileName/2 {
+			break
+		}
+		if isSafeFileRune(r) && r != '.' {
+			prefix = append(prefix, r)
+		} else {
+			prefix = append(prefix, '_')
+		}
+	}
+	return string(prefix) + "-" + hex.EncodeToString(hash[:8]) + ".txt"
+}
+
+func isSafeFileName(name string) bool {
+	if name == "" || strings.HasPrefix(name, ".") || name+".txt" == TABLE_LIST_FILE {
+		return false
+	}
+	for _, r := range name {
+		if !isSafeFileRune(r) {
+			return false
+		}
+	}
+	return true
+}
+
+func isSafeFileRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || strings.ContainsRune("_-$.", r)
+}
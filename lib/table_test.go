@@ -0,0 +1,67 @@
+package lib
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseTableName(t *testing.T) {
+	cases := map[string]TableName{
+		"users":         {Name: "users"},
+		" users ":       {Name: "users"},
+		"archive.users": {Schema: "archive", Name: "users"},
+		"`v1.events`":   {Name: "v1.events"},
+		"`a.b`.`c.d`":   {Schema: "a.b", Name: "c.d"},
+		"app.`we``ird`": {Schema: "app", Name: "we`ird"},
+		"ユーザー":          {Name: "ユーザー"},
+		"販売.注文":         {Schema: "販売", Name: "注文"},
+		"a.b.c":         {Name: "a.b.c"},
+		"`unterminated": {Name: "`unterminated"},
+		"schema.":       {Name: "schema."},
+	}
+	for s, expected := range cases {
+		if actual := ParseTableName(s); actual != expected {
+			t.Errorf("ParseTableName(%q): expected %+v, got %+v", s, expected, actual)
+		}
+	}
+}
+
+func TestTableNameRoundTrip(t *testing.T) {
+	for _, table := range []TableName{
+		{Name: "users"},
+		{Name: "v1.events"},
+		{Schema: "a.b", Name: "c`d"},
+		{Schema: "販売", Name: "注文"},
+	} {
+		if actual := ParseTableName(table.String()); actual != table {
+			t.Errorf("%+v was read back as %+v", table, actual)
+		}
+	}
+}
+
+func TestTableFileName(t *testing.T) {
+	cases := map[string]string{
+		"users":         "users.txt",
+		"archive.users": "archive.users.txt",
+		"ユーザー":          "ユーザー.txt",
+	}
+	for table, expected := range cases {
+		if actual := TableFileName(table); actual != expected {
+			t.Errorf("TableFileName(%q): expected %s, got %s", table, expected, actual)
+		}
+	}
+
+	long := strings.Repeat("x", 200)
+	for _, table := range []string{"a/b", "`a b`", "table_list", "`..`", long} {
+		name := TableFileName(table)
+		if strings.ContainsAny(name, "/ ") || len(name) > maxTableFileName+len(".txt") || name == "table_list.txt" || strings.HasPrefix(name, ".") {
+			t.Errorf("TableFileName(%q) is unsafe: %s", table, name)
+		}
+	}
+	if TableFileName("a/b") == TableFileName("a_b") || TableFileName("a/b") == TableFileName("a?b") {
+		t.Error("distinct tables share a dump file")
+	}
+	if TableFileName("archive.users") == TableFileName("`archive.users`") || TableFileName("`a.b`.c") == TableFileName("a.`b.c`") {
+		t.Error("tables with dots in their names share a dump file")
+	}
+}
@@ -0,0 +1,297 @@
+package lib
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+	"strings"
+
+	. "github.com/timakin/gopli/constants"
+)
+
+// TableWriter streams the dump of a table to disk through a bounded buffer,
+// rolling over to a new file before MaxFileSize is exceeded. Rows are never
+// split across files. With CompressDumps, every file is gzipped on the fly.
+// The files keep PARTIAL_FILE_EXT until Close, so an interrupted fetch never
+// leaves a truncated dump behind for the load.
+type TableWriter struct {
+	ws    *Workspace
+	table string
+	ext   string
+
+	part    int
+	paths   []string
+	file    *os.File
+	gz      *gzip.Writer
+	buf     *bufio.Writer
+	written int64
+	// pending holds the start of a row whose end hasn't arrived yet.
+	pending []byte
+	size    int64
+}
+
+// CreateTable starts writing the dump of table, replacing the one left by a
+// previous attempt.
+func (ws *Workspace) CreateTable(table string) (*TableWriter, error) {
+	writer := &TableWriter{ws: ws, table: table}
+	if ws.CompressDumps {
+		writer.ext = GZIP_FILE_EXT
+	}
+	if err := writer.open(); err != nil {
+		return nil, err
+	}
+	return writer, nil
+}
+
+func (writer *TableWriter) open() error {
+	path := writer.ws.TablePath(writer.table)
+	if writer.part > 0 {
+		path = writer.ws.tablePartPath(writer.table, writer.part)
+	}
+	path += writer.ext
+	file, err := os.OpenFile(path+PARTIAL_FILE_EXT, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, writer.ws.FileMode)
+	if err != nil {
+		return err
+	}
+	writer.paths = append(writer.paths, path)
+	writer.file = file
+	var out io.Writer = file
+	if writer.ext == GZIP_FILE_EXT {
+		writer.gz = gzip.NewWriter(file)
+		out = writer.gz
+	}
+	writer.buf = bufio.NewWriterSize(out, TABLE_WRITE_BUFFER_SIZE)
+	writer.written = 0
+	return nil
+}
+
+// closeFile flushes and closes the current file.
+func (writer *TableWriter) closeFile() error {
+	err := writer.buf.Flush()
+	if writer.gz != nil {
+		if closeErr := writer.gz.Close(); err == nil {
+			err = closeErr
+		}
+		writer.gz = nil
+	}
+	if closeErr := writer.file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	// The umask can only narrow the mode passed at creation, so set it explicitly.
+	return os.Chmod(writer.file.Name(), writer.ws.FileMode)
+}
+
+func (writer *TableWriter) rotate() error {
+	if err := writer.closeFile(); err != nil {
+		return err
+	}
+	writer.part++
+	return writer.open()
+}
+
+func (writer *TableWriter) write(rows []byte) error {
+	_, err := writer.buf.Write(rows)
+	writer.written += int64(len(rows))
+	return err
+}
+
+// Write appends rows to the dump. It is meant to receive the output of a
+// command, so rows may arrive in pieces.
+func (writer *TableWriter) Write(p []byte) (int, error) {
+	writer.size += int64(len(p))
+	if writer.ws.MaxFileSize <= 0 {
+		return len(p), writer.write(p)
+	}
+
+	data := p
+	if len(writer.pending) > 0 {
+		data = append(writer.pending, p...)
+	}
+	end := bytes.LastIndexByte(data, '\n') + 1
+	rows := data[:end]
+	for len(rows) > 0 {
+		room := writer.ws.MaxFileSize - writer.written
+		if int64(len(rows)) <= room {
+			if err := writer.write(rows); err != nil {
+				return 0, err
+			}
+			break
+		}
+		cut := 0
+		if room > 0 {
+			cut = bytes.LastIndexByte(rows[:room], '\n') + 1
+		}
+		if cut == 0 {
+			if writer.written > 0 {
+				if err := writer.rotate(); err != nil {
+					return 0, err
+				}
+				continue
+			}
+			// A single row larger than a file
+			cut = bytes.IndexByte(rows, '\n') + 1
+		}
+		if err := writer.write(rows[:cut]); err != nil {
+			return 0, err
+		}
+		rows = rows[cut:]
+		if err := writer.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	writer.pending = append(writer.pending[:0], data[end:]...)
+	return len(p), nil
+}
+
+// Size returns the number of bytes written so far, before compression.
+func (writer *TableWriter) Size() int64 {
+	return writer.size
+}
+
+// Close writes what is left, removes the files left over by a previous,
+// longer or differently compressed attempt and records the size of the dump
+// before compression.
+func (writer *TableWriter) Close() error {
+	if len(writer.pending) > 0 {
+		if err := writer.write(writer.pending); err != nil {
+			writer.closeFile()
+			return err
+		}
+	}
+	if err := writer.closeFile(); err != nil {
+		return err
+	}
+
+	// Stale parts go first, so an interruption never leaves them next to
+	// the new ones.
+	for part := 0; ; part++ {
+		path := writer.ws.TablePath(writer.table)
+		if part > 0 {
+			path = writer.ws.tablePartPath(writer.table, part)
+		}
+		removed := false
+		for _, ext := range []string{"", GZIP_FILE_EXT} {
+			if part <= writer.part && ext == writer.ext {
+				continue
+			}
+			err := os.Remove(path + ext)
+			if err != nil && !os.IsNotExist(err) {
+				return err
+			}
+			removed = removed || err == nil
+		}
+		if part > writer.part && !removed {
+			break
+		}
+	}
+	for _, path := range writer.paths {
+		if err := os.Rename(path+PARTIAL_FILE_EXT, path); err != nil {
+			return err
+		}
+	}
+	return writer.ws.writeTableSize(writer.table, writer.size)
+}
+
+// Abort closes the dump and removes the files written, after a failed
+// attempt.
+func (writer *TableWriter) Abort() {
+	writer.closeFile()
+	for _, path := range writer.paths {
+		os.Remove(path + PARTIAL_FILE_EXT)
+	}
+}
+
+// CountRows returns the number of rows in the dump of table.
+func (ws *Workspace) CountRows(table string) (int64, error) {
+	var rows int64
+	buf := make([]byte, TABLE_WRITE_BUFFER_SIZE)
+	for _, path := range ws.TableFiles(table) {
+		dump, err := OpenDump(path)
+		if err != nil {
+			return 0, err
+		}
+		var last byte = '\n'
+		for {
+			n, err := dump.Read(buf)
+			if n > 0 {
+				rows += int64(bytes.Count(buf[:n], []byte{'\n'}))
+				last = buf[n-1]
+			}
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				dump.Close()
+				return 0, err
+			}
+		}
+		dump.Close()
+		// The last row may lack its newline.
+		if last != '\n' {
+			rows++
+		}
+	}
+	return rows, nil
+}
+
+// IsCompressedDump reports whether the dump file at path is gzipped.
+func IsCompressedDump(path string) bool {
+	return strings.HasSuffix(path, GZIP_FILE_EXT)
+}
+
+// OpenDump opens the dump file at path for reading, decompressing it when
+// it is gzipped.
+func OpenDump(path string) (io.ReadCloser, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	if !IsCompressedDump(path) {
+		return file, nil
+	}
+	reader, err := gzip.NewReader(file)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return &gzipDump{Reader: reader, file: file}, nil
+}
+
+type gzipDump struct {
+	*gzip.Reader
+	file *os.File
+}
+
+func (dump *gzipDump) Close() error {
+	dump.Reader.Close()
+	return dump.file.Close()
+}
+
+// OpenDumps opens the dump files at paths for reading one after the other,
+// decompressing the gzipped ones on the fly, and returns the function closing
+// them. Loads read compressed dumps this way, so they are never stored
+// uncompressed.
+func OpenDumps(paths []string) (io.Reader, func(), error) {
+	readers := make([]io.Reader, 0, len(paths))
+	dumps := make([]io.Closer, 0, len(paths))
+	closeAll := func() {
+		for _, dump := range dumps {
+			dump.Close()
+		}
+	}
+	for _, path := range paths {
+		dump, err := OpenDump(path)
+		if err != nil {
+			closeAll()
+			return nil, nil, err
+		}
+		readers = append(readers, dump)
+		dumps = append(dumps, dump)
+	}
+	return io.MultiReader(readers...), closeAll, nil
+}
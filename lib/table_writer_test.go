@@ -0,0 +1,146 @@
+package lib
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	. "github.com/timakin/gopli/constants"
+)
+
+func TestTableWriterStreamsCompressed(t *testing.T) {
+	ws, err := NewWorkspace("gopli_test", WorkspaceConf{MaxFileSize: 10, CompressDumps: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ws.Remove()
+	// A previous uncompressed attempt must not be loaded as well.
+	if err := ioutil.WriteFile(ws.TablePath("users"), []byte("stale\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	writer, err := ws.CreateTable("users")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows := "1\tab\n2\tcd\n3\tlong row\n4"
+	// Rows arrive in pieces, like the output of a command.
+	for _, piece := range []string{"1\ta", "b\n2\tcd\n3\tlo", "ng row\n", "4"} {
+		if _, err := writer.Write([]byte(piece)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if writer.Size() != int64(len(rows)) {
+		t.Errorf("expected %d bytes, got %d", len(rows), writer.Size())
+	}
+
+	var parts []string
+	for _, path := range ws.TableFiles("users") {
+		if !IsCompressedDump(path) {
+			t.Errorf("%s is not compressed", path)
+		}
+		dump, err := OpenDump(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		part, err := ioutil.ReadAll(dump)
+		dump.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		parts = append(parts, string(part))
+	}
+	if len(parts) != 3 || strings.Join(parts, "") != rows {
+		t.Errorf("unexpected files: %q", parts)
+	}
+	if _, err := os.Stat(ws.TablePath("users")); !os.IsNotExist(err) {
+		t.Errorf("expected the stale dump to be removed, got %v", err)
+	}
+
+	dumps, closeDumps, err := OpenDumps(ws.TableFiles("users"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadAll(dumps)
+	closeDumps()
+	if err != nil || string(data) != rows {
+		t.Errorf("unexpected dumps %q, %v", data, err)
+	}
+	if size := ws.TableSize("users"); size != int64(len(rows)) {
+		t.Errorf("expected the size before compression %d, got %d", len(rows), size)
+	}
+}
+
+func TestTableWriterAbort(t *testing.T) {
+	ws, err := NewWorkspace("gopli_test", WorkspaceConf{MaxFileSize: 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ws.Remove()
+
+	writer, err := ws.CreateTable("users")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := writer.Write([]byte("1\ta\n2\tb\n")); err != nil {
+		t.Fatal(err)
+	}
+	writer.Abort()
+	if _, err := os.Stat(ws.TablePath("users")); !os.IsNotExist(err) {
+		t.Errorf("expected the partial dump to be removed, got %v", err)
+	}
+}
+
+func TestCountRows(t *testing.T) {
+	ws, err := NewWorkspace("gopli_test", WorkspaceConf{MaxFileSize: 8, CompressDumps: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ws.Remove()
+
+	if err := ws.WriteTable("users", []byte("1\tab\n2\tcd\n3\tlong row\n4")); err != nil {
+		t.Fatal(err)
+	}
+	if rows, err := ws.CountRows("users"); err != nil || rows != 4 {
+		t.Errorf("expected 4 rows, got %d, %v", rows, err)
+	}
+	if err := ws.WriteTable("empty", nil); err != nil {
+		t.Fatal(err)
+	}
+	if rows, err := ws.CountRows("empty"); err != nil || rows != 0 {
+		t.Errorf("expected no rows, got %d, %v", rows, err)
+	}
+}
+
+func TestTableWriterIsAtomic(t *testing.T) {
+	ws, err := NewWorkspace("gopli_test", WorkspaceConf{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ws.Remove()
+
+	writer, err := ws.CreateTable("users")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := writer.Write([]byte("1\tab\n")); err != nil {
+		t.Fatal(err)
+	}
+	// An interrupted fetch leaves nothing the load would pick up.
+	if _, err := os.Stat(ws.TablePath("users")); !os.IsNotExist(err) {
+		t.Errorf("expected no dump before Close, got %v", err)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(ws.TablePath("users") + PARTIAL_FILE_EXT); !os.IsNotExist(err) {
+		t.Errorf("expected the partial file to be renamed, got %v", err)
+	}
+	if data, err := ioutil.ReadFile(ws.TablePath("users")); err != nil || string(data) != "1\tab\n" {
+		t.Errorf("unexpected dump %q, %v", data, err)
+	}
+}
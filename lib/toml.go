@@ -1,24 +1,78 @@
 package lib
 
 import (
+	"fmt"
 	"log"
 
 	"github.com/BurntSushi/toml"
-	"github.com/k0kubun/pp"
 	. "github.com/timakin/gopli/constants"
 )
 
-type tomlConfig struct {
-	Database map[string]Database
-	SSH      map[string]SSH
+// TomlConfig is the whole configuration file.
+type TomlConfig struct {
+	Database  map[string]Database `toml:"database"`
+	SSH       map[string]SSH      `toml:"ssh"`
+	Snapshot  Snapshot            `toml:"snapshot"`
+	Workspace WorkspaceConf       `toml:"workspace"`
+	Filter    Filter              `toml:"filter"`
+	Vault     Vault               `toml:"vault"`
+	Cache     Cache               `toml:"cache"`
+	History   HistoryConf         `toml:"history"`
+	Defaults  Defaults            `toml:"defaults"`
+	// Columns limits the columns synced of the tables it names.
+	Columns map[string]ColumnSelection `toml:"columns"`
 }
 
-func LoadTomlConf(configPath string) (tmlconf tomlConfig) {
-	log.Print("[Setting] loading toml configuration...")
-	if _, err := toml.DecodeFile(configPath, &tmlconf); err != nil {
-		pp.Print(err)
+// LoadTomlConf reads the configuration like ReadTomlConf, panicking when it
+// can't be read.
+func LoadTomlConf(configPath string) TomlConfig {
+	tmlconf, err := ReadTomlConf(configPath)
+	if err != nil {
+		panic(err)
 	}
-
-	log.Print("[Setting] loaded toml configuration")
 	return tmlconf
 }
+
+// ReadTomlConf reads the configuration file at configPath, or the
+// environment when configPath is empty, and resolves its secret references.
+// The returned errors wrap ErrInvalidConfig.
+func ReadTomlConf(configPath string) (tmlconf TomlConfig, err error) {
+	if configPath == "" {
+		log.Print("[Setting] no configuration file given, loading configuration from environment")
+		tmlconf = LoadEnvConf()
+	} else {
+		log.Print("[Setting] loading toml configuration...")
+		if _, err := toml.DecodeFile(configPath, &tmlconf); err != nil {
+			return tmlconf, fmt.Errorf("%w: %s: %v", ErrInvalidConfig, configPath, err)
+		}
+		IgnoreTableCase(tmlconf.Filter.IgnoreCase)
+		SetInternalTables(tmlconf.Filter.InternalTables)
+		log.Print("[Setting] loaded toml configuration")
+	}
+
+	if err := applyDefaults(&tmlconf); err != nil {
+		return tmlconf, fmt.Errorf("%w: defaults: %v", ErrInvalidConfig, err)
+	}
+
+	if err := ResolveSecrets(&tmlconf); err != nil {
+		return tmlconf, fmt.Errorf("%w: failed to resolve secrets: %w", ErrInvalidConfig, err)
+	}
+	return tmlconf, nil
+}
+
+// applyDefaults fills in the settings the database sections leave out from
+// the defaults section, and applies its log level and prompt setting.
+func applyDefaults(tmlconf *TomlConfig) error {
+	defaults := tmlconf.Defaults
+	for name, dbConf := range tmlconf.Database {
+		if dbConf.Concurrency == 0 {
+			dbConf.Concurrency = defaults.Concurrency
+		}
+		if dbConf.Compression == "" {
+			dbConf.Compression = defaults.Compression
+		}
+		tmlconf.Database[name] = dbConf
+	}
+	DisablePrompts(defaults.NoPrompt)
+	return defaultLogLevel(defaults.LogLevel)
+}
@@ -0,0 +1,104 @@
+package lib
+
+import (
+	"errors"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestReadTomlConfDefaults(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "gopli.toml")
+	config := `
+[defaults]
+concurrency = 6
+compression = "zstd"
+dry_run = true
+no_prompt = true
+log_level = "error"
+
+[database.production]
+host = "db.internal"
+concurrency = 2
+
+[database.staging]
+host = "staging.internal"
+compression = "none"
+`
+	if err := ioutil.WriteFile(path, []byte(config), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		log.SetOutput(os.Stderr)
+		DisablePrompts(false)
+	})
+
+	tmlconf, err := ReadTomlConf(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if production := tmlconf.Database["production"]; production.Concurrency != 2 || production.Compression != "zstd" {
+		t.Errorf("expected the concurrency of production and the default compression, got %+v", production)
+	}
+	if staging := tmlconf.Database["staging"]; staging.Concurrency != 6 || staging.Compression != "none" {
+		t.Errorf("expected the default concurrency and the compression of staging, got %+v", staging)
+	}
+	if !tmlconf.Defaults.DryRun {
+		t.Error("expected dry_run to be read")
+	}
+	if log.Writer() != ioutil.Discard {
+		t.Error("expected the log to be left out at the error level")
+	}
+	if _, err := askSecret("database app@db.internal", "Password: "); err != errNoPrompt {
+		t.Errorf("expected no prompt, got %v", err)
+	}
+
+	logLevelGiven = true
+	defer func() { logLevelGiven = false }()
+	log.SetOutput(os.Stderr)
+	if _, err := ReadTomlConf(path); err != nil {
+		t.Fatal(err)
+	}
+	if log.Writer() != os.Stderr {
+		t.Error("expected --log-level to win over the defaults")
+	}
+}
+
+func TestReadTomlConfUnknownLogLevel(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "gopli.toml")
+	if err := ioutil.WriteFile(path, []byte("[defaults]\nlog_level = \"verbose\"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ReadTomlConf(path); !errors.Is(err, ErrInvalidConfig) {
+		t.Errorf("expected an invalid configuration, got %v", err)
+	}
+}
+
+func TestReadTomlConfInternalTables(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "gopli.toml")
+	config := `
+[filter]
+internal_tables = ["flyway_schema_history"]
+`
+	if err := ioutil.WriteFile(path, []byte(config), 0600); err != nil {
+		t.Fatal(err)
+	}
+	defer SetInternalTables(nil)
+
+	if _, err := ReadTomlConf(path); err != nil {
+		t.Fatal(err)
+	}
+	if !IsExcludedTable("app.flyway_schema_history") {
+		t.Error("expected the configured internal table to be excluded")
+	}
+	if IsExcludedTable("schema_migrations") {
+		t.Error("expected internal_tables to replace the default internal tables")
+	}
+
+	SetInternalTables(nil)
+	if !IsExcludedTable("schema_migrations") {
+		t.Error("expected the default internal tables to be restored")
+	}
+}
@@ -0,0 +1,211 @@
+package lib
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	. "github.com/timakin/gopli/constants"
+)
+
+// Tracer records the spans of a run and exports them to an OpenTelemetry
+// collector over OTLP/HTTP with JSON encoding. A nil Tracer records nothing.
+type Tracer struct {
+	endpoint string
+	traceID  string
+	root     *Span
+
+	mu    sync.Mutex
+	spans []*Span
+}
+
+// Span is a timed operation of a run, e.g. a phase or a table. A nil Span
+// ignores every call.
+type Span struct {
+	tracer     *Tracer
+	id         string
+	parentID   string
+	name       string
+	attributes map[string]string
+	start      time.Time
+	end        time.Time
+	err        error
+}
+
+// StartTrace starts the trace of a run exported to endpoint, the base URL of
+// an OTLP/HTTP collector such as http://localhost:4318, with a root span
+// named name.
+func StartTrace(endpoint string, name string, attributes map[string]string) *Tracer {
+	tracer := &Tracer{endpoint: otlpTracesURL(endpoint), traceID: randomHex(16)}
+	tracer.root = tracer.Start(name, nil, attributes)
+	return tracer
+}
+
+// Root returns the root span of the trace.
+func (tracer *Tracer) Root() *Span {
+	if tracer == nil {
+		return nil
+	}
+	return tracer.root
+}
+
+// Start starts a span, a child of parent, or of the root span when parent
+// is nil.
+func (tracer *Tracer) Start(name string, parent *Span, attributes map[string]string) *Span {
+	if tracer == nil {
+		return nil
+	}
+	span := &Span{tracer: tracer, id: randomHex(8), name: name, attributes: attributes, start: time.Now()}
+	if parent == nil {
+		parent = tracer.root
+	}
+	if parent != nil {
+		span.parentID = parent.id
+	}
+	return span
+}
+
+// End finishes the span, marking it failed with a non-nil err.
+func (span *Span) End(err error) {
+	if span == nil {
+		return
+	}
+	span.end = time.Now()
+	span.err = err
+	span.tracer.mu.Lock()
+	span.tracer.spans = append(span.tracer.spans, span)
+	span.tracer.mu.Unlock()
+}
+
+// Flush ends the root span with err and exports every finished span.
+func (tracer *Tracer) Flush(err error) error {
+	if tracer == nil {
+		return nil
+	}
+	tracer.root.End(err)
+	body, err := json.Marshal(tracer.export())
+	if err != nil {
+		return err
+	}
+	client := &http.Client{Timeout: OTLP_EXPORT_TIMEOUT_SECONDS * time.Second}
+	resp, err := client.Post(tracer.endpoint, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("spans rejected with %s", resp.Status)
+	}
+	return nil
+}
+
+// The OTLP/JSON encoding of ExportTraceServiceRequest.
+type otlpRequest struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpResource struct {
+	Attributes []otlpAttribute `json:"attributes"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpSpan struct {
+	TraceID           string          `json:"traceId"`
+	SpanID            string          `json:"spanId"`
+	ParentSpanID      string          `json:"parentSpanId,omitempty"`
+	Name              string          `json:"name"`
+	Kind              int             `json:"kind"`
+	StartTimeUnixNano string          `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string          `json:"endTimeUnixNano"`
+	Attributes        []otlpAttribute `json:"attributes,omitempty"`
+	Status            otlpStatus      `json:"status"`
+}
+
+type otlpAttribute struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+type otlpValue struct {
+	StringValue string `json:"stringValue"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+func (tracer *Tracer) export() otlpRequest {
+	tracer.mu.Lock()
+	defer tracer.mu.Unlock()
+	spans := make([]otlpSpan, 0, len(tracer.spans))
+	for _, span := range tracer.spans {
+		exported := otlpSpan{
+			TraceID:           tracer.traceID,
+			SpanID:            span.id,
+			ParentSpanID:      span.parentID,
+			Name:              span.name,
+			Kind:              OTLP_SPAN_KIND_INTERNAL,
+			StartTimeUnixNano: strconv.FormatInt(span.start.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(span.end.UnixNano(), 10),
+			Attributes:        otlpAttributes(span.attributes),
+			Status:            otlpStatus{Code: OTLP_STATUS_OK},
+		}
+		if span.err != nil {
+			exported.Status = otlpStatus{Code: OTLP_STATUS_ERROR, Message: span.err.Error()}
+		}
+		spans = append(spans, exported)
+	}
+	return otlpRequest{ResourceSpans: []otlpResourceSpans{{
+		Resource:   otlpResource{Attributes: otlpAttributes(map[string]string{"service.name": OTLP_SERVICE_NAME})},
+		ScopeSpans: []otlpScopeSpans{{Scope: otlpScope{Name: OTLP_SERVICE_NAME}, Spans: spans}},
+	}}}
+}
+
+func otlpAttributes(attributes map[string]string) []otlpAttribute {
+	keys := make([]string, 0, len(attributes))
+	for key := range attributes {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	converted := make([]otlpAttribute, 0, len(keys))
+	for _, key := range keys {
+		converted = append(converted, otlpAttribute{Key: key, Value: otlpValue{StringValue: attributes[key]}})
+	}
+	return converted
+}
+
+// otlpTracesURL appends the traces path to the base URL of a collector.
+func otlpTracesURL(endpoint string) string {
+	if strings.HasSuffix(endpoint, OTLP_TRACES_PATH) {
+		return endpoint
+	}
+	return strings.TrimSuffix(endpoint, "/") + OTLP_TRACES_PATH
+}
+
+func randomHex(size int) string {
+	id := make([]byte, size)
+	rand.Read(id)
+	return hex.EncodeToString(id)
+}
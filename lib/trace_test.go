@@ -0,0 +1,73 @@
+package lib
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	. "github.com/timakin/gopli/constants"
+)
+
+func TestTracerFlush(t *testing.T) {
+	var received otlpRequest
+	var path string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		json.NewDecoder(r.Body).Decode(&received)
+	}))
+	defer server.Close()
+
+	tracer := StartTrace(server.URL, "sync", map[string]string{"gopli.from": "production"})
+	tracer.Start("fetch users", nil, map[string]string{"db.sql.table": "users"}).End(nil)
+	tracer.Start("load users", nil, nil).End(errors.New("timeout"))
+	if err := tracer.Flush(nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if path != OTLP_TRACES_PATH {
+		t.Errorf("exported to %s, want %s", path, OTLP_TRACES_PATH)
+	}
+	spans := received.ResourceSpans[0].ScopeSpans[0].Spans
+	if len(spans) != 3 {
+		t.Fatalf("expected 3 spans, got %d", len(spans))
+	}
+	byName := make(map[string]otlpSpan)
+	for _, span := range spans {
+		if span.TraceID != spans[0].TraceID || len(span.TraceID) != 32 || len(span.SpanID) != 16 {
+			t.Errorf("unexpected ids of %s: %s/%s", span.Name, span.TraceID, span.SpanID)
+		}
+		byName[span.Name] = span
+	}
+	root := byName["sync"]
+	if root.ParentSpanID != "" || root.Status.Code != OTLP_STATUS_OK {
+		t.Errorf("unexpected root span %+v", root)
+	}
+	if fetch := byName["fetch users"]; fetch.ParentSpanID != root.SpanID || fetch.Attributes[0].Value.StringValue != "users" {
+		t.Errorf("unexpected fetch span %+v", fetch)
+	}
+	if load := byName["load users"]; load.Status.Code != OTLP_STATUS_ERROR || load.Status.Message != "timeout" {
+		t.Errorf("unexpected load span %+v", load)
+	}
+}
+
+func TestNilTracer(t *testing.T) {
+	var tracer *Tracer
+	tracer.Start("fetch users", tracer.Root(), nil).End(nil)
+	if err := tracer.Flush(nil); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestOTLPTracesURL(t *testing.T) {
+	for endpoint, want := range map[string]string{
+		"http://localhost:4318":           "http://localhost:4318/v1/traces",
+		"http://localhost:4318/":          "http://localhost:4318/v1/traces",
+		"https://otel.internal/v1/traces": "https://otel.internal/v1/traces",
+	} {
+		if got := otlpTracesURL(endpoint); got != want {
+			t.Errorf("otlpTracesURL(%q) = %q, want %q", endpoint, got, want)
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package lib
+
+import (
+	"sync"
+	"time"
+)
+
+// TableTransfer accounts for the fetch of a single table.
+type TableTransfer struct {
+	Table string `json:"table"`
+	Codec string `json:"codec,omitempty"`
+	// TransferredBytes crossed the network, Bytes were written to disk.
+	TransferredBytes int64 `json:"transferred_bytes"`
+	Bytes            int64 `json:"bytes"`
+	// CompressionRatio is Bytes / TransferredBytes.
+	CompressionRatio float64 `json:"compression_ratio"`
+	NetworkSeconds   float64 `json:"network_seconds"`
+	DecodeSeconds    float64 `json:"decode_seconds,omitempty"`
+	DiskSeconds      float64 `json:"disk_seconds"`
+}
+
+// FetchStats sums the transfers of a fetch. Times are summed over tables,
+// so they exceed the wall clock time when tables are fetched in parallel.
+type FetchStats struct {
+	mu               sync.Mutex
+	TransferredBytes int64           `json:"transferred_bytes"`
+	Bytes            int64           `json:"bytes"`
+	CompressionRatio float64         `json:"compression_ratio"`
+	NetworkSeconds   float64         `json:"network_seconds"`
+	DecodeSeconds    float64         `json:"decode_seconds,omitempty"`
+	DiskSeconds      float64         `json:"disk_seconds"`
+	Tables           []TableTransfer `json:"tables"`
+	// ExcludedTables maps the tables left out of the fetch to the reason.
+	ExcludedTables map[string]string `json:"excluded_tables,omitempty"`
+	// Checksums compares the tables with the destination with
+	// --skip-unchanged, or with the last sync with --changed-only.
+	Checksums []TableChecksum `json:"checksums,omitempty"`
+	// TableClasses maps the tables marked schema_only or data_only in
+	// [filter] to their class.
+	TableClasses map[string]string `json:"table_classes,omitempty"`
+}
+
+// TableChecksum compares the CHECKSUM TABLE values of a table. Destination
+// is empty when the destination has no such table.
+type TableChecksum struct {
+	Table       string `json:"table"`
+	Source      string `json:"source"`
+	Destination string `json:"destination"`
+	Unchanged   bool   `json:"unchanged"`
+}
+
+// NewTableTransfer builds the accounting of a finished table fetch.
+func NewTableTransfer(table string, codec string, transferred int64, bytes int64, network time.Duration, decode time.Duration, disk time.Duration) TableTransfer {
+	return TableTransfer{
+		Table:            table,
+		Codec:            codec,
+		TransferredBytes: transferred,
+		Bytes:            bytes,
+		CompressionRatio: ratio(bytes, transferred),
+		NetworkSeconds:   network.Seconds(),
+		DecodeSeconds:    decode.Seconds(),
+		DiskSeconds:      disk.Seconds(),
+	}
+}
+
+// Add records the transfer of a table. A nil FetchStats ignores it.
+func (stats *FetchStats) Add(transfer TableTransfer) {
+	if stats == nil {
+		return
+	}
+	stats.mu.Lock()
+	defer stats.mu.Unlock()
+	stats.Tables = append(stats.Tables, transfer)
+	stats.TransferredBytes += transfer.TransferredBytes
+	stats.Bytes += transfer.Bytes
+	stats.CompressionRatio = ratio(stats.Bytes, stats.TransferredBytes)
+	stats.NetworkSeconds += transfer.NetworkSeconds
+	stats.DecodeSeconds += transfer.DecodeSeconds
+	stats.DiskSeconds += transfer.DiskSeconds
+}
+
+// Exclude records a table left out of the fetch. A nil FetchStats ignores it.
+func (stats *FetchStats) Exclude(table string, reason string) {
+	if stats == nil {
+		return
+	}
+	stats.mu.Lock()
+	defer stats.mu.Unlock()
+	if stats.ExcludedTables == nil {
+		stats.ExcludedTables = make(map[string]string)
+	}
+	stats.ExcludedTables[table] = reason
+}
+
+// Classify records the class of a table. A nil FetchStats ignores it.
+func (stats *FetchStats) Classify(table string, class string) {
+	if stats == nil {
+		return
+	}
+	stats.mu.Lock()
+	defer stats.mu.Unlock()
+	if stats.TableClasses == nil {
+		stats.TableClasses = make(map[string]string)
+	}
+	stats.TableClasses[table] = class
+}
+
+// AddChecksum records a checksum comparison. A nil FetchStats ignores it.
+func (stats *FetchStats) AddChecksum(checksum TableChecksum) {
+	if stats == nil {
+		return
+	}
+	stats.mu.Lock()
+	defer stats.mu.Unlock()
+	stats.Checksums = append(stats.Checksums, checksum)
+}
+
+func ratio(bytes int64, transferred int64) float64 {
+	if transferred == 0 {
+		return 0
+	}
+	return float64(bytes) / float64(transferred)
+}
@@ -0,0 +1,28 @@
+package lib
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFetchStats(t *testing.T) {
+	stats := &FetchStats{}
+	stats.Add(NewTableTransfer("users", "zstd", 100, 400, time.Second, 0, 2*time.Second))
+	stats.Add(NewTableTransfer("posts", "", 300, 300, time.Second, 0, time.Second))
+
+	if stats.TransferredBytes != 400 || stats.Bytes != 700 || len(stats.Tables) != 2 {
+		t.Errorf("unexpected totals: %+v", stats)
+	}
+	if stats.Tables[0].CompressionRatio != 4 || stats.CompressionRatio != 1.75 {
+		t.Errorf("unexpected compression ratios: %v and %v", stats.Tables[0].CompressionRatio, stats.CompressionRatio)
+	}
+	if stats.NetworkSeconds != 2 || stats.DiskSeconds != 3 {
+		t.Errorf("unexpected times: %v and %v", stats.NetworkSeconds, stats.DiskSeconds)
+	}
+	if transfer := NewTableTransfer("empty", "", 0, 0, 0, 0, 0); transfer.CompressionRatio != 0 {
+		t.Errorf("expected no ratio for an empty table, got %v", transfer.CompressionRatio)
+	}
+
+	var disabled *FetchStats
+	disabled.Add(NewTableTransfer("users", "", 1, 1, 0, 0, 0))
+}
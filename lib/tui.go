@@ -0,0 +1,186 @@
+package lib
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	. "github.com/timakin/gopli/constants"
+)
+
+const (
+	enterAltScreen = "\x1b[?1049h\x1b[?25l"
+	leaveAltScreen = "\x1b[?25h\x1b[?1049l"
+	clearScreen    = "\x1b[H\x1b[2J"
+	progressBar    = 20
+)
+
+// TUI redraws the progress of a run full screen on a terminal.
+type TUI struct {
+	progress *Progress
+	out      io.Writer
+	stop     chan struct{}
+	done     chan struct{}
+}
+
+var (
+	screenMu sync.Mutex
+	// altScreen is where the running TUI switched to the alternate screen.
+	altScreen io.Writer
+)
+
+// IsTerminal reports whether f is an interactive terminal.
+func IsTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// StartTUI switches out to the alternate screen and redraws progress there
+// until Stop is called.
+func StartTUI(progress *Progress, out io.Writer) *TUI {
+	tui := &TUI{progress: progress, out: out, stop: make(chan struct{}), done: make(chan struct{})}
+	screenMu.Lock()
+	io.WriteString(out, enterAltScreen)
+	altScreen = out
+	screenMu.Unlock()
+	go func() {
+		defer close(tui.done)
+		ticker := time.NewTicker(TUI_REFRESH_MILLISECONDS * time.Millisecond)
+		defer ticker.Stop()
+		for {
+			tui.draw()
+			select {
+			case <-ticker.C:
+			case <-tui.stop:
+				return
+			}
+		}
+	}()
+	return tui
+}
+
+// Stop restores the screen and prints the errors of the run, which would
+// otherwise vanish with the alternate screen.
+func (tui *TUI) Stop() {
+	close(tui.stop)
+	<-tui.done
+	leaveTUI()
+	_, _, errors, _ := tui.progress.Snapshot()
+	for _, line := range errors {
+		fmt.Fprintln(tui.out, line)
+	}
+}
+
+// leaveTUI switches back from the alternate screen of the running TUI, if
+// any. RestoreTerminal calls it too, so an interrupted run doesn't leave
+// the terminal on the alternate screen with the cursor hidden.
+func leaveTUI() {
+	screenMu.Lock()
+	defer screenMu.Unlock()
+	if altScreen != nil {
+		io.WriteString(altScreen, leaveAltScreen)
+		altScreen = nil
+	}
+}
+
+func (tui *TUI) draw() {
+	names, tables, errors, logs := tui.progress.Snapshot()
+	width, height := terminalSize(tui.out)
+	screenMu.Lock()
+	defer screenMu.Unlock()
+	if altScreen == nil {
+		// The terminal was restored on an interrupt.
+		return
+	}
+	io.WriteString(tui.out, clearScreen+renderProgress(names, tables, errors, logs, width, height, time.Now()))
+}
+
+// terminalSize returns the size of the terminal out is, asking it each time
+// so resizing the window takes effect. It falls back on the size exported by
+// the shell.
+func terminalSize(out io.Writer) (int, int) {
+	if f, ok := out.(*os.File); ok {
+		if width, height, ok := windowSize(f); ok {
+			return width, height
+		}
+	}
+	return envSize("COLUMNS", 100), envSize("LINES", 30)
+}
+
+func envSize(name string, fallback int) int {
+	if size, err := strconv.Atoi(os.Getenv(name)); err == nil && size > 0 {
+		return size
+	}
+	return fallback
+}
+
+// renderProgress lays out the table grid, the error pane and the latest log
+// lines to fit width and height.
+func renderProgress(names []string, tables []TableProgress, errors []string, logs []string, width int, height int, now time.Time) string {
+	var lines []string
+	counts := make(map[string]int)
+	for _, table := range tables {
+		counts[table.Phase]++
+	}
+	lines = append(lines, fmt.Sprintf("gopli  %d tables  %d done  %d failed", len(tables), counts[PHASE_DONE]+counts[PHASE_UNCHANGED], counts[PHASE_FAILED]), "")
+
+	rows := height - len(lines) - TUI_ERROR_LINES - TUI_LOG_LINES - 4
+	if rows < 1 {
+		rows = 1
+	}
+	// Finished tables make room for the ones still running.
+	order := make([]int, 0, len(tables))
+	for _, finished := range []bool{false, true} {
+		for i, table := range tables {
+			if (table.Phase == PHASE_DONE || table.Phase == PHASE_UNCHANGED) == finished {
+				order = append(order, i)
+			}
+		}
+	}
+	for n, i := range order {
+		if n == rows {
+			lines = append(lines, fmt.Sprintf("... %d more", len(order)-rows))
+			break
+		}
+		lines = append(lines, renderTable(names[i], tables[i], now))
+	}
+
+	lines = append(lines, "", "Errors:")
+	if len(errors) > TUI_ERROR_LINES {
+		errors = errors[len(errors)-TUI_ERROR_LINES:]
+	}
+	lines = append(lines, errors...)
+	lines = append(lines, "", "Log:")
+	lines = append(lines, logs...)
+
+	for i, line := range lines {
+		if len(line) > width {
+			lines[i] = line[:width]
+		}
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
+
+func renderTable(name string, table TableProgress, now time.Time) string {
+	bar := strings.Repeat(" ", progressBar+2)
+	percent := "    "
+	if table.Total > 0 {
+		// Totals are estimates, which transfers may exceed.
+		ratio := float64(table.Bytes) / float64(table.Total)
+		if ratio > 1 {
+			ratio = 1
+		}
+		done := int(ratio * progressBar)
+		bar = "[" + strings.Repeat("#", done) + strings.Repeat("-", progressBar-done) + "]"
+		percent = fmt.Sprintf("%3d%%", int(ratio*100))
+	}
+	var throughput string
+	if elapsed := now.Sub(table.Started).Seconds(); table.Bytes > 0 && elapsed > 0 {
+		throughput = HumanBytes(int64(float64(table.Bytes)/elapsed)) + "/s"
+	}
+	return fmt.Sprintf("%-30s %-9s %s %s %10s %12s", name, table.Phase, bar, percent, HumanBytes(table.Bytes), throughput)
+}
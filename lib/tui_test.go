@@ -0,0 +1,46 @@
+package lib
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/timakin/gopli/constants"
+)
+
+func TestRenderProgress(t *testing.T) {
+	progress := NewProgress()
+	progress.SetPhase("users", PHASE_FETCHING, 1000)
+	progress.Writer("users").Write(make([]byte, 500))
+	progress.SetPhase("posts", PHASE_DONE, 0)
+	progress.Fail("logs", errors.New("Lost connection"))
+	progress.Write([]byte("[Fetch] fetching users\n"))
+
+	names, tables, errs, logs := progress.Snapshot()
+	screen := renderProgress(names, tables, errs, logs, 100, 30, time.Now())
+	for _, expected := range []string{"3 tables  1 done  1 failed", "[##########----------]  50%", "logs: Lost connection", "[Fetch] fetching users"} {
+		if !strings.Contains(screen, expected) {
+			t.Errorf("expected %q in\n%s", expected, screen)
+		}
+	}
+	if strings.Index(screen, "posts") < strings.Index(screen, "users") {
+		t.Errorf("expected running tables before finished ones in\n%s", screen)
+	}
+}
+
+func TestRestoreTerminalLeavesTUI(t *testing.T) {
+	var out bytes.Buffer
+	tui := StartTUI(NewProgress(), &out)
+	// An interrupt restores the terminal before the run can stop the TUI.
+	RestoreTerminal()
+	tui.Stop()
+	screen := out.String()
+	if strings.Count(screen, leaveAltScreen) != 1 {
+		t.Errorf("expected the alternate screen to be left once, got %q", screen)
+	}
+	if !strings.HasSuffix(screen, leaveAltScreen) {
+		t.Errorf("expected nothing drawn after restoring the terminal, got %q", screen)
+	}
+}
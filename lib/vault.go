@@ -0,0 +1,151 @@
+package lib
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	. "github.com/timakin/gopli/constants"
+)
+
+// vaultClient reads secrets from HashiCorp Vault over its HTTP API.
+type vaultClient struct {
+	address string
+	token   string
+	client  *http.Client
+}
+
+// newVaultClient logs in to Vault with the configured auth method.
+func newVaultClient(conf Vault) (*vaultClient, error) {
+	vault := &vaultClient{
+		address: strings.TrimSuffix(conf.Address, "/"),
+		client:  &http.Client{Timeout: VAULT_TIMEOUT_SECONDS * time.Second},
+	}
+	if vault.address == "" {
+		vault.address = strings.TrimSuffix(os.Getenv("VAULT_ADDR"), "/")
+	}
+	if vault.address == "" {
+		return nil, errors.New("no Vault address, set vault.address or VAULT_ADDR")
+	}
+
+	method := conf.AuthMethod
+	if method == "" {
+		method = VAULT_AUTH_TOKEN
+	}
+	mount := conf.AuthMount
+	if mount == "" {
+		mount = method
+	}
+	switch method {
+	case VAULT_AUTH_TOKEN:
+		vault.token = conf.Token
+		if vault.token == "" {
+			vault.token = os.Getenv("VAULT_TOKEN")
+		}
+		if vault.token == "" {
+			token, err := ioutil.ReadFile(expandPath(VAULT_TOKEN_FILE))
+			if err != nil {
+				return nil, errors.New("no Vault token, set vault.token or VAULT_TOKEN, or run vault login")
+			}
+			vault.token = strings.TrimSpace(string(token))
+		}
+	case VAULT_AUTH_APPROLE:
+		secretID := conf.SecretID
+		if secretID == "" {
+			secretID = os.Getenv("VAULT_SECRET_ID")
+		}
+		if err := vault.login(mount, map[string]string{"role_id": conf.RoleID, "secret_id": secretID}); err != nil {
+			return nil, err
+		}
+	case VAULT_AUTH_KUBERNETES:
+		jwt, err := ioutil.ReadFile(KUBERNETES_SA_TOKEN_FILE)
+		if err != nil {
+			return nil, err
+		}
+		if err := vault.login(mount, map[string]string{"role": conf.Role, "jwt": strings.TrimSpace(string(jwt))}); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unsupported Vault auth method %q", method)
+	}
+	return vault, nil
+}
+
+func (vault *vaultClient) login(mount string, credentials map[string]string) error {
+	var response struct {
+		Auth struct {
+			ClientToken string `json:"client_token"`
+		} `json:"auth"`
+	}
+	if err := vault.request(http.MethodPost, "auth/"+mount+"/login", credentials, &response); err != nil {
+		return err
+	}
+	vault.token = response.Auth.ClientToken
+	return nil
+}
+
+// Read returns the field of the secret at path. Secrets of KV version 2
+// engines are unwrapped.
+func (vault *vaultClient) Read(path string, field string) (string, error) {
+	var response struct {
+		Data map[string]interface{} `json:"data"`
+	}
+	if err := vault.request(http.MethodGet, path, nil, &response); err != nil {
+		return "", err
+	}
+	data := response.Data
+	if inner, ok := data["data"].(map[string]interface{}); ok && data["metadata"] != nil {
+		data = inner
+	}
+	value, ok := data[field].(string)
+	if !ok {
+		return "", fmt.Errorf("no field %s in Vault secret %s", field, path)
+	}
+	return value, nil
+}
+
+// SignPublicKey has the SSH secrets engine at path sign publicKey and returns
+// the certificate.
+func (vault *vaultClient) SignPublicKey(path string, publicKey string) (string, error) {
+	var response struct {
+		Data struct {
+			SignedKey string `json:"signed_key"`
+		} `json:"data"`
+	}
+	if err := vault.request(http.MethodPost, path, map[string]string{"public_key": publicKey}, &response); err != nil {
+		return "", err
+	}
+	return response.Data.SignedKey, nil
+}
+
+func (vault *vaultClient) request(method string, path string, body interface{}, result interface{}) error {
+	var payload []byte
+	if body != nil {
+		var err error
+		if payload, err = json.Marshal(body); err != nil {
+			return err
+		}
+	}
+	req, err := http.NewRequest(method, vault.address+"/v1/"+strings.TrimPrefix(path, "/"), bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	if vault.token != "" {
+		req.Header.Set("X-Vault-Token", vault.token)
+	}
+	resp, err := vault.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("Vault %s %s failed with %s", method, path, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(result)
+}
@@ -0,0 +1,134 @@
+package lib
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	. "github.com/timakin/gopli/constants"
+)
+
+// TableCounts holds the tables of a host with their exact row counts.
+type TableCounts struct {
+	Tables []string
+	Rows   map[string]int64
+	// Checksums is nil when checksums aren't compared.
+	Checksums map[string]string
+}
+
+// VerifyEntry is the comparison of a single table between two hosts. Rows
+// are only counted for tables existing on both hosts.
+type VerifyEntry struct {
+	Table               string `json:"table"`
+	Status              string `json:"status"`
+	SourceRows          int64  `json:"source_rows"`
+	DestinationRows     int64  `json:"destination_rows"`
+	SourceChecksum      string `json:"source_checksum,omitempty"`
+	DestinationChecksum string `json:"destination_checksum,omitempty"`
+}
+
+// VerifyReport compares the data of every table between two hosts.
+type VerifyReport struct {
+	From      string        `json:"from"`
+	To        string        `json:"to"`
+	CreatedAt time.Time     `json:"created_at"`
+	Tables    []VerifyEntry `json:"tables"`
+}
+
+// BuildVerifyReport compares the row counts, and the checksums when both
+// hosts have one, of the tables of the source with the destination.
+func BuildVerifyReport(from string, to string, source TableCounts, destination TableCounts) *VerifyReport {
+	existing := make(map[string]string)
+	for _, table := range destination.Tables {
+		existing[TableKey(table)] = table
+	}
+
+	report := &VerifyReport{From: from, To: to, CreatedAt: time.Now()}
+	compared := make(map[string]bool)
+	for _, table := range source.Tables {
+		entry := VerifyEntry{Table: table, Status: VERIFY_STATUS_MISSING_DESTINATION, SourceRows: source.Rows[table]}
+		if destinationTable, ok := existing[TableKey(table)]; ok {
+			compared[TableKey(table)] = true
+			entry.DestinationRows = destination.Rows[destinationTable]
+			entry.SourceChecksum = source.Checksums[table]
+			entry.DestinationChecksum = destination.Checksums[destinationTable]
+			entry.Status = VERIFY_STATUS_MATCH
+			if entry.SourceRows != entry.DestinationRows || checksumsDiffer(entry) {
+				entry.Status = VERIFY_STATUS_MISMATCH
+			}
+		}
+		report.Tables = append(report.Tables, entry)
+	}
+	for _, table := range destination.Tables {
+		if !compared[TableKey(table)] {
+			report.Tables = append(report.Tables, VerifyEntry{Table: table, Status: VERIFY_STATUS_MISSING_SOURCE, DestinationRows: destination.Rows[table]})
+		}
+	}
+	return report
+}
+
+func checksumsDiffer(entry VerifyEntry) bool {
+	return entry.SourceChecksum != "" && entry.DestinationChecksum != "" && entry.SourceChecksum != entry.DestinationChecksum
+}
+
+// Mismatched returns the tables that differ or exist on one host only.
+func (report *VerifyReport) Mismatched() []string {
+	var tables []string
+	for _, entry := range report.Tables {
+		if entry.Status != VERIFY_STATUS_MATCH {
+			tables = append(tables, entry.Table)
+		}
+	}
+	return tables
+}
+
+// Err returns an error wrapping ErrDataMismatch when any table differs.
+func (report *VerifyReport) Err() error {
+	tables := report.Mismatched()
+	if len(tables) == 0 {
+		return nil
+	}
+	return fmt.Errorf("%w: %s", ErrDataMismatch, strings.Join(tables, ", "))
+}
+
+// Print writes a human readable summary of the report.
+func (report *VerifyReport) Print(out io.Writer) {
+	fmt.Fprintf(out, "Verify: %s -> %s\n\n", report.From, report.To)
+	w := tabwriter.NewWriter(out, 0, 8, 2, ' ', 0)
+	counts := make(map[string]int)
+	for _, entry := range report.Tables {
+		counts[entry.Status]++
+		switch entry.Status {
+		case VERIFY_STATUS_MATCH:
+			fmt.Fprintf(w, "  = %s\t%d rows\t\n", entry.Table, entry.SourceRows)
+		case VERIFY_STATUS_MISMATCH:
+			fmt.Fprintf(w, "  ! %s\t%d != %d rows\t%s\n", entry.Table, entry.SourceRows, entry.DestinationRows, checksumLabel(entry))
+		default:
+			fmt.Fprintf(w, "  - %s\t(%s)\t\n", entry.Table, strings.Replace(entry.Status, "_", " on ", -1))
+		}
+	}
+	w.Flush()
+	missing := counts[VERIFY_STATUS_MISSING_SOURCE] + counts[VERIFY_STATUS_MISSING_DESTINATION]
+	fmt.Fprintf(out, "\n%d matching, %d mismatched, %d missing.\n", counts[VERIFY_STATUS_MATCH], counts[VERIFY_STATUS_MISMATCH], missing)
+}
+
+// checksumLabel returns how Print marks differing checksums.
+func checksumLabel(entry VerifyEntry) string {
+	if !checksumsDiffer(entry) {
+		return ""
+	}
+	return "(checksum " + entry.SourceChecksum + " != " + entry.DestinationChecksum + ")"
+}
+
+// WriteJSON writes the report as JSON, for CI jobs gating on it.
+func (report *VerifyReport) WriteJSON(out io.Writer) error {
+	reportBytes, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(out, string(reportBytes))
+	return err
+}
@@ -0,0 +1,48 @@
+package lib
+
+import (
+	"errors"
+	"testing"
+
+	. "github.com/timakin/gopli/constants"
+)
+
+func TestBuildVerifyReport(t *testing.T) {
+	source := TableCounts{
+		Tables:    []string{"users", "orders", "events"},
+		Rows:      map[string]int64{"users": 10, "orders": 5, "events": 3},
+		Checksums: map[string]string{"users": "111", "orders": "222", "events": "333"},
+	}
+	destination := TableCounts{
+		Tables:    []string{"users", "orders", "sessions"},
+		Rows:      map[string]int64{"users": 10, "orders": 5, "sessions": 1},
+		Checksums: map[string]string{"users": "111", "orders": "999"},
+	}
+	report := BuildVerifyReport("production", "staging", source, destination)
+
+	expected := map[string]string{
+		"users":    VERIFY_STATUS_MATCH,
+		"orders":   VERIFY_STATUS_MISMATCH,
+		"events":   VERIFY_STATUS_MISSING_DESTINATION,
+		"sessions": VERIFY_STATUS_MISSING_SOURCE,
+	}
+	if len(report.Tables) != len(expected) {
+		t.Fatalf("expected %d tables, got %+v", len(expected), report.Tables)
+	}
+	for _, entry := range report.Tables {
+		if entry.Status != expected[entry.Table] {
+			t.Errorf("%s: expected %s, got %s", entry.Table, expected[entry.Table], entry.Status)
+		}
+	}
+	if err := report.Err(); !errors.Is(err, ErrDataMismatch) {
+		t.Errorf("expected a data mismatch, got %v", err)
+	}
+}
+
+func TestBuildVerifyReportWithoutChecksums(t *testing.T) {
+	counts := TableCounts{Tables: []string{"users"}, Rows: map[string]int64{"users": 10}}
+	report := BuildVerifyReport("production", "staging", counts, counts)
+	if err := report.Err(); err != nil {
+		t.Errorf("unexpected error %v", err)
+	}
+}
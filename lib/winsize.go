@@ -0,0 +1,22 @@
+//go:build linux || darwin || freebsd || netbsd || openbsd || dragonfly
+// +build linux darwin freebsd netbsd openbsd dragonfly
+
+package lib
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// windowSize asks the terminal of f for its width and height.
+func windowSize(f *os.File) (int, int, bool) {
+	var size struct {
+		rows, cols, xpixel, ypixel uint16
+	}
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, f.Fd(), uintptr(syscall.TIOCGWINSZ), uintptr(unsafe.Pointer(&size)))
+	if errno != 0 || size.cols == 0 || size.rows == 0 {
+		return 0, 0, false
+	}
+	return int(size.cols), int(size.rows), true
+}
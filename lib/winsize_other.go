@@ -0,0 +1,11 @@
+//go:build !(linux || darwin || freebsd || netbsd || openbsd || dragonfly)
+// +build !linux,!darwin,!freebsd,!netbsd,!openbsd,!dragonfly
+
+package lib
+
+import "os"
+
+// windowSize can't ask the terminal for its size on this platform.
+func windowSize(f *os.File) (int, int, bool) {
+	return 0, 0, false
+}
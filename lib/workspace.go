@@ -0,0 +1,232 @@
+package lib
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	. "github.com/timakin/gopli/constants"
+)
+
+// Workspace is the local working directory of a single run.
+// Every run gets its own directory so concurrent runs never share dump files.
+type Workspace struct {
+	Path       string
+	DirMode    os.FileMode
+	FileMode   os.FileMode
+	MaxRowSize int
+	// MaxFileSize is the size dumps roll over to the next file at, 0 for
+	// a single file per table.
+	MaxFileSize int64
+	// CompressDumps gzips dumps as they are written.
+	CompressDumps bool
+}
+
+// NewWorkspace creates a uniquely named working directory under the system temp dir.
+func NewWorkspace(prefix string, conf WorkspaceConf) (*Workspace, error) {
+	ws, err := OpenWorkspace("", conf)
+	if err != nil {
+		return nil, err
+	}
+	path, err := os.MkdirTemp("", prefix)
+	if err != nil {
+		return nil, err
+	}
+	// The umask can only narrow the mode passed at creation, so set it explicitly.
+	if err := os.Chmod(path, ws.DirMode); err != nil {
+		os.RemoveAll(path)
+		return nil, err
+	}
+	ws.Path = path
+	return ws, nil
+}
+
+// OpenWorkspace wraps an existing directory, such as a snapshot, as a workspace.
+func OpenWorkspace(path string, conf WorkspaceConf) (*Workspace, error) {
+	dirMode, err := parseFileMode(conf.DirMode, DEFAULT_DIR_MODE)
+	if err != nil {
+		return nil, err
+	}
+	fileMode, err := parseFileMode(conf.FileMode, DEFAULT_FILE_MODE)
+	if err != nil {
+		return nil, err
+	}
+	maxRowSize := conf.MaxRowSize
+	if maxRowSize == 0 {
+		maxRowSize = MAX_LINE_SIZE
+	}
+	return &Workspace{Path: path, DirMode: dirMode, FileMode: fileMode, MaxRowSize: maxRowSize, MaxFileSize: conf.MaxFileSize, CompressDumps: conf.CompressDumps}, nil
+}
+
+// TableListPath returns the path of the table list file inside the workspace.
+func (ws *Workspace) TableListPath() string {
+	return filepath.Join(ws.Path, TABLE_LIST_FILE)
+}
+
+// ReadTableList reads the table list file inside the workspace.
+func (ws *Workspace) ReadTableList() ([]string, error) {
+	return ReadLinesLimit(ws.TableListPath(), ws.MaxRowSize)
+}
+
+// TablePath returns the path of the dump file of table inside the workspace.
+func (ws *Workspace) TablePath(table string) string {
+	return filepath.Join(ws.Path, TableFileName(table))
+}
+
+// TableFiles returns the paths of the dump files of table: TablePath and
+// the rolled over files following it, with GZIP_FILE_EXT when they are
+// compressed.
+func (ws *Workspace) TableFiles(table string) []string {
+	ext := ""
+	if _, err := os.Stat(ws.TablePath(table) + GZIP_FILE_EXT); err == nil {
+		ext = GZIP_FILE_EXT
+	}
+	paths := []string{ws.TablePath(table) + ext}
+	for part := 1; ; part++ {
+		path := ws.tablePartPath(table, part) + ext
+		if _, err := os.Stat(path); err != nil {
+			return paths
+		}
+		paths = append(paths, path)
+	}
+}
+
+func (ws *Workspace) tablePartPath(table string, part int) string {
+	return ws.TablePath(table) + "." + strconv.Itoa(part)
+}
+
+// WriteColumns records the columns of the dump of table, in order, for dumps
+// that don't hold every column of the table.
+func (ws *Workspace) WriteColumns(table string, columns []string) error {
+	return ws.writeTableList(table, COLUMNS_FILE_SUFFIX, columns)
+}
+
+// ReadColumns returns the columns recorded by WriteColumns, or nil when the
+// dump holds every column.
+func (ws *Workspace) ReadColumns(table string) ([]string, error) {
+	return ws.readTableList(table, COLUMNS_FILE_SUFFIX)
+}
+
+// WritePartitions records the partitions the dump of table is limited to.
+func (ws *Workspace) WritePartitions(table string, partitions []string) error {
+	return ws.writeTableList(table, PARTITIONS_FILE_SUFFIX, partitions)
+}
+
+// ReadPartitions returns the partitions recorded by WritePartitions, or nil
+// when the dump holds the whole table.
+func (ws *Workspace) ReadPartitions(table string) ([]string, error) {
+	return ws.readTableList(table, PARTITIONS_FILE_SUFFIX)
+}
+
+func (ws *Workspace) writeTableList(table string, suffix string, items []string) error {
+	return ws.WriteFile(filepath.Base(ws.TablePath(table))+suffix, []byte(strings.Join(items, "\n")+"\n"))
+}
+
+func (ws *Workspace) readTableList(table string, suffix string) ([]string, error) {
+	data, err := ioutil.ReadFile(ws.TablePath(table) + suffix)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return strings.Split(strings.TrimSuffix(string(data), "\n"), "\n"), nil
+}
+
+// TableSize returns the size of the dump of table before compression, as
+// recorded by the TableWriter, or the size of its files when the dump was
+// written otherwise.
+func (ws *Workspace) TableSize(table string) int64 {
+	data, err := ioutil.ReadFile(ws.TablePath(table) + SIZE_FILE_SUFFIX)
+	if err == nil {
+		if size, err := strconv.ParseInt(strings.TrimSpace(string(data)), 10, 64); err == nil {
+			return size
+		}
+	}
+	var size int64
+	for _, path := range ws.TableFiles(table) {
+		if info, err := os.Stat(path); err == nil {
+			size += info.Size()
+		}
+	}
+	return size
+}
+
+func (ws *Workspace) writeTableSize(table string, size int64) error {
+	return ws.WriteFile(filepath.Base(ws.TablePath(table))+SIZE_FILE_SUFFIX, []byte(strconv.FormatInt(size, 10)+"\n"))
+}
+
+// WriteTable writes the whole dump of table at once through a TableWriter.
+func (ws *Workspace) WriteTable(table string, data []byte) error {
+	writer, err := ws.CreateTable(table)
+	if err != nil {
+		return err
+	}
+	if _, err := writer.Write(data); err != nil {
+		writer.Abort()
+		return err
+	}
+	return writer.Close()
+}
+
+// WriteFile writes data to name inside the workspace with the configured file
+// mode. The file only appears under name once it is complete.
+func (ws *Workspace) WriteFile(name string, data []byte) error {
+	path := filepath.Join(ws.Path, name)
+	partial := path + PARTIAL_FILE_EXT
+	file, err := os.OpenFile(partial, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, ws.FileMode)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		os.Remove(partial)
+		return err
+	}
+	if err := file.Close(); err != nil {
+		os.Remove(partial)
+		return err
+	}
+	if err := os.Chmod(partial, ws.FileMode); err != nil {
+		return err
+	}
+	return os.Rename(partial, path)
+}
+
+// DumpSize returns the total size of the files inside the workspace.
+func (ws *Workspace) DumpSize() (int64, error) {
+	files, err := ioutil.ReadDir(ws.Path)
+	if err != nil {
+		return 0, err
+	}
+	var size int64
+	for _, file := range files {
+		if !file.IsDir() {
+			size += file.Size()
+		}
+	}
+	return size, nil
+}
+
+// Remove deletes the workspace and everything in it.
+func (ws *Workspace) Remove() {
+	DeleteTmpDir(ws.Path)
+}
+
+// TmpDirPattern returns the glob matching every workspace gopli may have created.
+func TmpDirPattern() string {
+	return filepath.Join(os.TempDir(), TMP_DIR_PATTERN)
+}
+
+func parseFileMode(mode string, defaultMode os.FileMode) (os.FileMode, error) {
+	if mode == "" {
+		return defaultMode, nil
+	}
+	parsed, err := strconv.ParseUint(mode, 8, 32)
+	if err != nil {
+		return 0, err
+	}
+	return os.FileMode(parsed) & os.ModePerm, nil
+}
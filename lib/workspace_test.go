@@ -0,0 +1,44 @@
+package lib
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	. "github.com/timakin/gopli/constants"
+)
+
+func TestWriteTableRollsOver(t *testing.T) {
+	ws, err := NewWorkspace("gopli_test", WorkspaceConf{MaxFileSize: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ws.Remove()
+
+	rows := "1\tab\n2\tcd\n3\tlong row\n4\n"
+	if err := ws.WriteTable("users", []byte(rows)); err != nil {
+		t.Fatal(err)
+	}
+	var parts []string
+	for _, path := range ws.TableFiles("users") {
+		part, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(part) > 10 && strings.Count(string(part), "\n") > 1 {
+			t.Errorf("%s holds %d bytes", path, len(part))
+		}
+		parts = append(parts, string(part))
+	}
+	if len(parts) != 3 || strings.Join(parts, "") != rows {
+		t.Errorf("unexpected files: %q", parts)
+	}
+
+	// A shorter dump of the same table must not leave old files behind.
+	if err := ws.WriteTable("users", []byte("1\tab\n")); err != nil {
+		t.Fatal(err)
+	}
+	if files := ws.TableFiles("users"); len(files) != 1 {
+		t.Errorf("expected a single file, got %v", files)
+	}
+}
@@ -1,12 +1,17 @@
 package main
 
 import (
+	"fmt"
 	"os"
+	"runtime"
 
 	"github.com/codegangsta/cli"
+	"github.com/timakin/gopli/command"
+	"github.com/timakin/gopli/lib"
 )
 
 func main() {
+	defer exitOnFailure()
 
 	app := cli.NewApp()
 	app.Name = Name
@@ -16,8 +21,27 @@ func main() {
 	app.Usage = ""
 
 	app.Flags = GlobalFlags
+	app.Before = command.Setup
 	app.Commands = Commands
 	app.CommandNotFound = CommandNotFound
 
 	app.Run(os.Args)
 }
+
+// exitOnFailure prints the failure a command gave up with, and exits with
+// the code telling its cause. Runtime errors keep their stack trace.
+func exitOnFailure() {
+	recovered := recover()
+	if recovered == nil {
+		return
+	}
+	if _, ok := recovered.(runtime.Error); ok {
+		panic(recovered)
+	}
+	err, ok := recovered.(error)
+	if !ok {
+		err = fmt.Errorf("%v", recovered)
+	}
+	fmt.Fprintln(os.Stderr, err)
+	os.Exit(lib.ExitCode(err))
+}